@@ -1,7 +1,340 @@
 package config
 
 // 设置gin为release模式
-import "github.com/gin-gonic/gin"
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+const serviceConfigFile = "service.json"
+
+// Config 服务配置
+type Config struct {
+	// 监听地址
+	Addr string `json:"addr"`
+	// gin运行模式: debug, test, release
+	GinMode string `json:"gin_mode"`
+	// 打印后端配置
+	Print PrintConfig `json:"print"`
+	// Office 文档转换配置
+	Office OfficeConfig `json:"office"`
+	// 打印队列配置
+	Jobs JobsConfig `json:"jobs"`
+	// 打印机发现配置
+	Discovery DiscoveryConfig `json:"discovery"`
+	// 打印机状态检查配置
+	Health HealthConfig `json:"health"`
+	// 页面预览配置
+	Preview PreviewConfig `json:"preview"`
+	// 打印计费和配额配置
+	Accounting AccountingConfig `json:"accounting"`
+	// 内置 IPP 打印机配置
+	IPP IPPServerConfig `json:"ipp"`
+	// 热文件夹配置
+	HotFolders HotFoldersConfig `json:"hot_folders"`
+	// 邮件打印配置
+	Mail MailConfig `json:"mail"`
+	// URL 打印配置
+	PrintURL PrintURLConfig `json:"print_url"`
+}
+
+// PrintConfig 打印后端配置
+type PrintConfig struct {
+	// 后端名称, 如 com, fake
+	Backend string `json:"backend"`
+	// 后端地址, 含义由具体后端决定
+	URI string `json:"uri,omitempty"`
+	// 后端的其他设置
+	Settings map[string]string `json:"settings,omitempty"`
+	// 过滤命令: 名称 -> 命令, 如 "pxl": "gs -q -sDEVICE=pxlmono -o {out} {in}".
+	// socket 和 lpd 后端的 filter 设置填写这里的名称, 打印机管理接口不能直接指定命令
+	Filters map[string]string `json:"filters,omitempty"`
+	// 登记的 file 打印机允许的输出根目录, 为空时不能登记 file 打印机. 本节配置的默认后端不受限制
+	FileRoot string `json:"file_root,omitempty"`
+}
+
+// OfficeConfig 使用 LibreOffice 将 Office 文档转换为 PDF 的配置
+type OfficeConfig struct {
+	// 是否启用转换
+	Enabled bool `json:"enabled"`
+	// soffice 可执行文件, 默认从 PATH 中查找
+	Path string `json:"path,omitempty"`
+	// LibreOffice 用户配置目录, 默认位于系统临时目录
+	ProfileDir string `json:"profile_dir,omitempty"`
+	// 单个文档的转换超时秒数
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// 同时进行的转换数
+	Concurrency int `json:"concurrency"`
+}
+
+// JobsConfig 打印队列配置
+type JobsConfig struct {
+	// 同时处理的任务数
+	Workers int `json:"workers"`
+	// 已结束任务的保留天数, 0 表示一直保留
+	RetentionDays int `json:"retention_days"`
+	// 保留打印 (hold) 的任务未释放时自动取消的小时数, 0 表示一直保留
+	HoldTTLHours int `json:"hold_ttl_hours"`
+	// 打印机旁释放终端的令牌, 请求头 X-Release-Token 与之相同时无需 PIN 即可释放, 为空时不启用
+	ReleaseToken string `json:"release_token,omitempty"`
+}
+
+// DiscoveryConfig mDNS 打印机发现配置
+type DiscoveryConfig struct {
+	// 查询发往的地址, 为空时使用 mDNS 组播地址 224.0.0.251:5353
+	Addr string `json:"addr,omitempty"`
+	// 每次扫描等待应答的秒数
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// HealthConfig 打印机状态检查配置
+type HealthConfig struct {
+	// 检查间隔秒数, 0 表示不定期检查
+	IntervalSeconds int `json:"interval_seconds"`
+	// 单台打印机的检查超时秒数
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// PreviewConfig 页面预览配置
+type PreviewConfig struct {
+	// 是否启用预览
+	Enabled bool `json:"enabled"`
+	// 渲染器: pdftoppm, ghostscript, 为空时使用第一个可用的
+	Rasterizer string `json:"rasterizer,omitempty"`
+	// 渲染器可执行文件, 默认从 PATH 中查找
+	Path string `json:"path,omitempty"`
+	// 预览图缓存目录
+	CacheDir string `json:"cache_dir"`
+	// 缓存大小上限 (MB), 0 表示不限制
+	CacheMaxMB int `json:"cache_max_mb"`
+	// 单页渲染超时秒数
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// 预览图最大宽度 (像素)
+	MaxWidth int `json:"max_width"`
+}
+
+// AccountingConfig 打印计费和配额配置, 页数均按打印面数 (页数 × 份数) 计算
+type AccountingConfig struct {
+	// 是否记录用量
+	Enabled bool `json:"enabled"`
+	// 每个用户每天的页数上限, 0 表示不限制
+	DailyPages int `json:"daily_pages"`
+	// 每个用户每月的页数上限, 0 表示不限制
+	MonthlyPages int `json:"monthly_pages"`
+	// 单独设置配额的用户, 覆盖上面的默认配额
+	Users map[string]QuotaConfig `json:"users,omitempty"`
+	// 每面黑白和彩色的单价
+	MonoPrice  float64 `json:"mono_price"`
+	ColorPrice float64 `json:"color_price"`
+	// 每张纸的单价, 双面打印用纸减半
+	SheetPrice float64 `json:"sheet_price"`
+	// 用量记录的保留天数, 0 表示一直保留
+	RetentionDays int `json:"retention_days"`
+	// 用量报表和打印机管理等接口的令牌, 请求头 X-Admin-Token 需与之相同, 为空时这些接口不可用
+	AdminToken string `json:"admin_token,omitempty"`
+	// 认证代理设置的用户名请求头, 如 X-Forwarded-User. 设置后网页和接口提交的任务的用户取自该请求头,
+	// 请求体中的 user 被忽略, 没有该请求头的请求被拒绝; 服务只能经由代理访问时才能使用, 否则请求头可以伪造.
+	// 为空时使用请求体中客户端自报的 user, 任何人都可以换一个用户名绕过配额
+	UserHeader string `json:"user_header,omitempty"`
+}
+
+// QuotaConfig 单个用户的配额, 0 表示不限制
+type QuotaConfig struct {
+	DailyPages   int `json:"daily_pages"`
+	MonthlyPages int `json:"monthly_pages"`
+}
+
+// IPPServerConfig 内置 IPP 打印机配置, 电脑和手机可以添加 ipp://<服务地址>/ipp/print 直接打印
+type IPPServerConfig struct {
+	// 是否启用, 默认不启用. IPP 打印不需要认证, 客户端自报的用户名不可信, 只应在可信的网络中启用
+	Enabled bool `json:"enabled"`
+	// 打印机名称, 也是 mDNS 中公布的实例名
+	Name string `json:"name"`
+	// 位置说明
+	Location string `json:"location,omitempty"`
+	// 任务提交到的打印机或打印池, 为空时使用默认打印后端
+	Printer string `json:"printer,omitempty"`
+	// 单个文档的大小上限 (MB), 0 表示不限制
+	MaxDocumentMB int `json:"max_document_mb"`
+	// 是否通过 mDNS 公布, 使客户端添加打印机时能自动发现
+	Advertise bool `json:"advertise"`
+}
+
+// HotFoldersConfig 热文件夹配置, 放入目录的文件写入完成后自动打印
+type HotFoldersConfig struct {
+	// 监视的目录
+	Folders []HotFolderConfig `json:"folders"`
+	// 文件大小和修改时间保持不变多少秒后视为写入完成
+	SettleSeconds int `json:"settle_seconds"`
+	// 扫描目录的间隔秒数, 不能使用 inotify 时依靠扫描发现新文件
+	PollSeconds int `json:"poll_seconds"`
+	// 只使用扫描, 监视 SMB/NFS 挂载的目录时需要开启, 其他主机写入的文件不会产生 inotify 事件
+	Poll bool `json:"poll"`
+}
+
+// HotFolderConfig 单个热文件夹, 处理完的文件移入其中的 done 和 failed 子目录
+type HotFolderConfig struct {
+	// 监视的目录
+	Path string `json:"path"`
+	// 目标打印机或打印池, 为空时使用默认打印后端
+	Printer string `json:"printer,omitempty"`
+	// 任务的用户, 用于水印和配额
+	User string `json:"user,omitempty"`
+	// 打印选项, 格式与打印接口的 options 相同
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+// MailConfig 邮件打印配置, 内置的 SMTP 服务器收到邮件后打印其中的附件
+type MailConfig struct {
+	// 是否启用
+	Enabled bool `json:"enabled"`
+	// SMTP 监听地址
+	Addr string `json:"addr"`
+	// 主机名, 出现在 SMTP 问候语中, 为空时使用本机名称
+	Hostname string `json:"hostname,omitempty"`
+	// 接收的收件地址, 如 print@office.example.com, 为空时接收发往任意地址的邮件
+	Recipients []string `json:"recipients,omitempty"`
+	// 允许的发件人: 地址或 "@域名" -> 任务的用户, 用户为空时使用地址中 @ 之前的部分
+	Senders map[string]string `json:"senders"`
+	// 允许连接的客户端地址, 每项为 IP 或 CIDR, 通常只填写公司邮件服务器, 不能为空
+	AllowedNetworks []string `json:"allowed_networks"`
+	// 目标打印机或打印池, 为空时使用默认打印后端
+	Printer string `json:"printer,omitempty"`
+	// 打印选项, 格式与打印接口的 options 相同
+	Options json.RawMessage `json:"options,omitempty"`
+	// 邮件大小上限 (MB), 0 表示不限制
+	MaxMessageMB int `json:"max_message_mb"`
+	// 回复打印结果
+	Reply MailReplyConfig `json:"reply"`
+}
+
+// MailReplyConfig 通过中继服务器回复打印结果
+type MailReplyConfig struct {
+	// 中继服务器地址 host:port, 为空时不回复
+	Relay string `json:"relay,omitempty"`
+	// 中继服务器的用户名和密码, 为空时不认证
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// 回复邮件的发件地址, 默认为第一个收件地址
+	From string `json:"from,omitempty"`
+	// 回复前等待任务结束的最长秒数, 0 表示加入队列后立即回复
+	WaitSeconds int `json:"wait_seconds"`
+}
+
+// PrintURLConfig 从 URL 下载文档打印的配置
+type PrintURLConfig struct {
+	// 是否启用
+	Enabled bool `json:"enabled"`
+	// 允许下载的主机, 启用时不能为空.
+	// 每项为主机名、"*.域名"、IP 地址或 CIDR, 如 intranet.example.com, *.example.com, 10.0.0.0/8
+	Allow []string `json:"allow,omitempty"`
+	// 禁止下载的主机, 格式同 allow, 优先于 allow. 本机和链路本地地址总是禁止, 除非在 allow 中按 IP 列出
+	Deny []string `json:"deny,omitempty"`
+	// 文档大小上限 (MB), 0 表示不限制
+	MaxSizeMB int `json:"max_size_mb"`
+	// 最多跟随的重定向次数
+	MaxRedirects int `json:"max_redirects"`
+	// 下载超时秒数
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
+		Addr:    "0.0.0.0:80",
+		GinMode: "release",
+		Print: PrintConfig{
+			Backend: "com",
+		},
+		Office: OfficeConfig{
+			Enabled:        true,
+			Path:           "soffice",
+			TimeoutSeconds: 120,
+			Concurrency:    2,
+		},
+		Jobs: JobsConfig{
+			Workers:       1,
+			RetentionDays: 7,
+			HoldTTLHours:  24,
+		},
+		Discovery: DiscoveryConfig{
+			TimeoutSeconds: 3,
+		},
+		Health: HealthConfig{
+			IntervalSeconds: 60,
+			TimeoutSeconds:  5,
+		},
+		Preview: PreviewConfig{
+			Enabled:        true,
+			CacheDir:       filepath.Join("cache", "preview"),
+			CacheMaxMB:     200,
+			TimeoutSeconds: 30,
+			MaxWidth:       2000,
+		},
+		Accounting: AccountingConfig{
+			Enabled:       true,
+			RetentionDays: 400,
+		},
+		IPP: IPPServerConfig{
+			Name:          "Printer Service",
+			MaxDocumentMB: 100,
+		},
+		HotFolders: HotFoldersConfig{
+			SettleSeconds: 3,
+			PollSeconds:   10,
+		},
+		Mail: MailConfig{
+			Addr:         "0.0.0.0:25",
+			MaxMessageMB: 25,
+			Reply: MailReplyConfig{
+				WaitSeconds: 300,
+			},
+		},
+		PrintURL: PrintURLConfig{
+			MaxSizeMB:      100,
+			MaxRedirects:   5,
+			TimeoutSeconds: 60,
+		},
+	}
+}
+
+// Path 返回服务配置文件路径
+func Path() string {
+	return filepath.Join("config", serviceConfigFile)
+}
+
+// Load 读取服务配置, 配置文件不存在时写入默认配置
+func Load() (*Config, error) {
+	cfg := Default()
+	configPath := Path()
+
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+			return nil, err
+		}
+		data, err := json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(configPath, data, 0644); err != nil {
+			return nil, err
+		}
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 未出现在文件中的字段保留默认值
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
 
 // SetGinMode 设置gin为release模式
 func SetGinMode(mode string) {
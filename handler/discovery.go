@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"errors"
+	"printer/config"
+	"printer/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// discovery 打印机发现服务, 由 SetupDiscovery 创建
+var discovery *services.Discovery
+
+// SetupDiscovery 创建打印机发现服务, 需在 SetupPrinters 之后调用
+func SetupDiscovery(cfg config.DiscoveryConfig) error {
+	if printers == nil {
+		return errors.New("打印机列表未初始化")
+	}
+
+	discovery = services.NewDiscovery(printers, cfg.Addr, time.Duration(cfg.TimeoutSeconds)*time.Second)
+	return nil
+}
+
+// ListDiscoveredPrinters 获取网络上发现的打印机, 带 refresh=1 或从未扫描过时重新扫描
+func ListDiscoveredPrinters(c *gin.Context) {
+	if discovery == nil {
+		c.JSON(503, gin.H{"error": "打印机发现不可用"})
+		return
+	}
+
+	found := discovery.List()
+	if c.Query("refresh") == "1" || discovery.ScannedAt().IsZero() {
+		var err error
+		if found, err = discovery.Scan(c.Request.Context()); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(200, gin.H{"printers": found, "scanned_at": discovery.ScannedAt()})
+}
+
+// AddDiscoveredPrinter 将发现的打印机添加到打印机列表
+func AddDiscoveredPrinter(c *gin.Context) {
+	if discovery == nil {
+		c.JSON(503, gin.H{"error": "打印机发现不可用"})
+		return
+	}
+
+	// 请求体可选, 用于指定打印机名称
+	var body struct {
+		Name string `json:"name"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(400, gin.H{"error": "无效的请求数据"})
+			return
+		}
+	}
+
+	printer, err := discovery.Add(c.Param("id"), body.Name)
+	if err != nil {
+		if errors.Is(err, services.ErrDiscoveredNotFound) {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		printerError(c, err)
+		return
+	}
+
+	c.JSON(200, printer)
+}
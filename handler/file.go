@@ -1,19 +1,30 @@
 package handler
 
 import (
+	"log"
 	"os"
 	"path/filepath"
+	"printer/services"
+	"printer/services/pdf"
 
 	"github.com/gin-gonic/gin"
 )
 
 const uploadDir = "uploads"
 
+// fileMeta 上传文件的页数等检查结果
+var fileMeta = services.NewFileMetaStore(uploadDir)
+
 // FileInfo 文件信息结构
 type FileInfo struct {
 	Filename   string `json:"filename"`
 	Size       int64  `json:"size"`
 	UploadTime string `json:"upload_time"`
+	// 页数, 未知时为0
+	Pages int       `json:"pages,omitempty"`
+	PDF   *pdf.Info `json:"pdf,omitempty"`
+	// 第一页缩略图地址, 不能预览时为空
+	Preview string `json:"preview,omitempty"`
 }
 
 // UploadFile 处理文件上传
@@ -40,18 +51,28 @@ func UploadFile(c *gin.Context) {
 		c.JSON(500, gin.H{"error": "Failed to create file"})
 		return
 	}
-	defer dst.Close()
-
 	// 保存文件
-	if _, err := dst.ReadFrom(file); err != nil {
+	_, err = dst.ReadFrom(file)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to save file"})
 		return
 	}
 
-	c.JSON(200, gin.H{
+	// 检查页数等信息, 失败不影响上传
+	response := gin.H{
 		"message":  "File uploaded successfully",
 		"filename": header.Filename,
-	})
+	}
+	if meta, err := fileMeta.Inspect(header.Filename); err != nil {
+		log.Printf("检查文件 %s 失败: %v", header.Filename, err)
+	} else if meta.PDF != nil {
+		response["pages"] = meta.Pages()
+		response["pdf"] = meta.PDF
+	}
+	c.JSON(200, response)
 }
 
 // DownloadFile 处理文件下载
@@ -91,11 +112,17 @@ func ListFiles(c *gin.Context) {
 			if err != nil {
 				continue
 			}
-			files = append(files, FileInfo{
+			file := FileInfo{
 				Filename:   info.Name(),
 				Size:       info.Size(),
 				UploadTime: info.ModTime().Format("2006-01-02 15:04:05"),
-			})
+				Preview:    previewURL(info.Name()),
+			}
+			if meta, err := fileMeta.Get(info.Name()); err == nil {
+				file.Pages = meta.Pages()
+				file.PDF = meta.PDF
+			}
+			files = append(files, file)
 		}
 	}
 
@@ -118,6 +145,7 @@ func DeleteFile(c *gin.Context) {
 		c.JSON(500, gin.H{"error": "Failed to delete file"})
 		return
 	}
+	fileMeta.Delete(filename)
 
 	c.JSON(200, gin.H{
 		"message":  "File deleted successfully",
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"errors"
+	"printer/config"
+	"printer/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// healthMonitor 打印机状态检查, 由 SetupHealthMonitor 创建
+var healthMonitor *services.HealthMonitor
+
+// SetupHealthMonitor 启动打印机状态检查, 需在 SetupJobQueue 之后调用.
+// 检查为不可用的打印机上的任务会保持排队, 恢复后继续打印
+func SetupHealthMonitor(cfg config.HealthConfig) error {
+	if printers == nil || jobQueue == nil {
+		return errors.New("打印队列未初始化")
+	}
+
+	monitor := services.NewHealthMonitor(printers,
+		time.Duration(cfg.IntervalSeconds)*time.Second,
+		time.Duration(cfg.TimeoutSeconds)*time.Second)
+	monitor.OnAvailable(jobQueue.Wake)
+	jobQueue.SetAvailability(monitor.Available)
+	monitor.Start()
+	healthMonitor = monitor
+	return nil
+}
+
+// ListPrinterHealth 获取全部打印机最近一次的状态检查结果
+func ListPrinterHealth(c *gin.Context) {
+	if healthMonitor == nil {
+		c.JSON(503, gin.H{"error": "状态检查不可用"})
+		return
+	}
+
+	c.JSON(200, gin.H{"printers": healthMonitor.List()})
+}
+
+// GetPrinterHealth 获取单台打印机的状态, 带 refresh=1 或从未检查过时立即检查
+func GetPrinterHealth(c *gin.Context) {
+	if healthMonitor == nil {
+		c.JSON(503, gin.H{"error": "状态检查不可用"})
+		return
+	}
+
+	name := c.Param("name")
+	health, ok := healthMonitor.Get(name)
+	if c.Query("refresh") == "1" || !ok {
+		var err error
+		if health, err = healthMonitor.Check(c.Request.Context(), name); err != nil {
+			printerError(c, err)
+			return
+		}
+	}
+
+	c.JSON(200, health)
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"printer/config"
+	"printer/services"
+	"time"
+)
+
+// hotFolders 热文件夹监视器, 未配置热文件夹时为 nil
+var hotFolders *services.HotFolderWatcher
+
+// SetupHotFolders 开始监视配置的热文件夹, 需在 SetupJobQueue 之后调用
+func SetupHotFolders(cfg config.HotFoldersConfig) error {
+	if len(cfg.Folders) == 0 {
+		return nil
+	}
+	if jobQueue == nil {
+		return errors.New("打印队列未初始化")
+	}
+
+	folders := make([]services.HotFolder, len(cfg.Folders))
+	for i, f := range cfg.Folders {
+		folders[i] = services.HotFolder{
+			Path:    f.Path,
+			Printer: f.Printer,
+			User:    f.User,
+		}
+		if len(f.Options) > 0 {
+			if err := json.Unmarshal(f.Options, &folders[i].Options); err != nil {
+				return fmt.Errorf("热文件夹 %s 的打印选项无效: %v", f.Path, err)
+			}
+		}
+	}
+
+	watcher, err := services.NewHotFolderWatcher(jobQueue, printers, uploadDir, folders,
+		time.Duration(cfg.SettleSeconds)*time.Second, time.Duration(cfg.PollSeconds)*time.Second, cfg.Poll)
+	if err != nil {
+		return err
+	}
+	watcher.Start()
+	hotFolders = watcher
+	return nil
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"printer/config"
+	"printer/services"
+	"printer/services/mdns"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ippServer 内置的 IPP 打印机, 由 SetupIPPServer 创建, 未启用时为 nil
+var ippServer *services.IPPServer
+
+// ippAdvertiser 公布 IPP 打印机的 mDNS 连接, 未公布时为 nil
+var ippAdvertiser net.PacketConn
+
+// SetupIPPServer 创建内置的 IPP 打印机, 需在 SetupJobQueue 之后调用.
+// addr 为服务的监听地址, 公布到 mDNS 时使用其中的端口
+func SetupIPPServer(cfg config.IPPServerConfig, addr string) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if jobQueue == nil {
+		return errors.New("打印队列未初始化")
+	}
+
+	ippServer = services.NewIPPServer(jobQueue, printers, uploadDir, services.IPPServerSettings{
+		Name:            cfg.Name,
+		Location:        cfg.Location,
+		Printer:         cfg.Printer,
+		MaxDocumentSize: int64(cfg.MaxDocumentMB) << 20,
+	})
+	if !cfg.Advertise {
+		return nil
+	}
+	return advertiseIPP(addr)
+}
+
+// advertiseIPP 在 mDNS 上公布 _ipp._tcp 服务, 客户端添加打印机时可以自动发现
+func advertiseIPP(addr string) error {
+	_, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("监听地址无效: %v", err)
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return fmt.Errorf("监听地址无效: %s", addr)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	host, _, _ := strings.Cut(hostname, ".")
+
+	group, err := net.ResolveUDPAddr("udp4", mdns.DefaultAddr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return fmt.Errorf("加入 mDNS 组播组失败: %v", err)
+	}
+
+	responder := &mdns.Responder{
+		Instances: []mdns.Instance{ippServer.Instance(host+".local.", port, localAddrs())},
+		Group:     group,
+	}
+	ippAdvertiser = conn
+	go func() {
+		if err := responder.Serve(conn); err != nil {
+			log.Printf("mDNS 应答停止: %v", err)
+		}
+	}()
+	return nil
+}
+
+// localAddrs 返回本机的 IPv4 单播地址
+func localAddrs() []net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.To4() != nil && ipNet.IP.IsGlobalUnicast() {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	return ips
+}
+
+// HandleIPP 处理发往内置 IPP 打印机的请求
+func HandleIPP(c *gin.Context) {
+	if ippServer == nil {
+		c.JSON(404, gin.H{"error": "IPP打印未启用"})
+		return
+	}
+	ippServer.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"path/filepath"
+	"printer/config"
+	"printer/services"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const jobsFile = "jobs.json"
+
+// jobQueue 打印任务队列, 由 SetupJobQueue 创建
+var jobQueue *services.JobQueue
+
+// releaseToken 打印机旁释放终端的令牌, 为空时只能用 PIN 释放
+var releaseToken string
+
+// SetupJobQueue 创建并启动打印队列, 需在 SetupPrinters 和 SetupAccounting 之后调用
+func SetupJobQueue(cfg config.JobsConfig) error {
+	if printers == nil {
+		return errors.New("打印机列表未初始化")
+	}
+
+	retention := time.Duration(cfg.RetentionDays) * 24 * time.Hour
+	queue, err := services.NewJobQueue(printers, filepath.Join("config", jobsFile), uploadDir, retention)
+	if err != nil {
+		return err
+	}
+	queue.SetHoldTTL(time.Duration(cfg.HoldTTLHours) * time.Hour)
+	if accounting != nil {
+		queue.SetAccounting(accounting)
+	}
+	queue.Start(cfg.Workers)
+	jobQueue = queue
+	releaseToken = cfg.ReleaseToken
+	return nil
+}
+
+// Close 停止后台任务
+func Close() {
+	if mailListener != nil {
+		mailListener.Close()
+		mailPrinter.Stop()
+	}
+	if hotFolders != nil {
+		hotFolders.Stop()
+	}
+	if ippAdvertiser != nil {
+		ippAdvertiser.Close()
+	}
+	if healthMonitor != nil {
+		healthMonitor.Stop()
+	}
+	if jobQueue != nil {
+		jobQueue.Stop()
+	}
+}
+
+// ListJobs 获取打印任务列表
+func ListJobs(c *gin.Context) {
+	if jobQueue == nil {
+		c.JSON(503, gin.H{"error": "打印服务不可用"})
+		return
+	}
+
+	// state 参数按状态筛选, 如 ?state=scheduled
+	jobs := jobQueue.List()
+	if state := services.JobState(c.Query("state")); state != "" {
+		if !slices.Contains(services.JobStates, state) {
+			c.JSON(400, gin.H{"error": "任务状态无效: " + string(state)})
+			return
+		}
+		filtered := make([]services.Job, 0, len(jobs))
+		for _, job := range jobs {
+			if job.State == state {
+				filtered = append(filtered, job)
+			}
+		}
+		jobs = filtered
+	}
+
+	c.JSON(200, gin.H{"jobs": jobs})
+}
+
+// GetJob 获取单个打印任务
+func GetJob(c *gin.Context) {
+	if jobQueue == nil {
+		c.JSON(503, gin.H{"error": "打印服务不可用"})
+		return
+	}
+
+	job, err := jobQueue.Get(c.Param("id"))
+	if err != nil {
+		jobError(c, err)
+		return
+	}
+
+	c.JSON(200, job)
+}
+
+// jobError 将队列错误转换为HTTP响应
+func jobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrJobFinished), errors.Is(err, services.ErrJobNotRetryable),
+		errors.Is(err, services.ErrJobNotHeld):
+		c.JSON(409, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrWrongPIN), errors.Is(err, services.ErrQuotaExceeded):
+		c.JSON(403, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTooManyAttempts):
+		c.JSON(429, gin.H{"error": err.Error()})
+	default:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
+
+// CancelJob 取消排队中或正在打印的任务
+func CancelJob(c *gin.Context) {
+	if jobQueue == nil {
+		c.JSON(503, gin.H{"error": "打印服务不可用"})
+		return
+	}
+
+	job, err := jobQueue.Cancel(c.Param("id"))
+	if err != nil {
+		jobError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "任务已取消", "job": job})
+}
+
+// RetryJob 重新打印失败或已取消的任务
+func RetryJob(c *gin.Context) {
+	if jobQueue == nil {
+		c.JSON(503, gin.H{"error": "打印服务不可用"})
+		return
+	}
+
+	job, err := jobQueue.Retry(c.Param("id"))
+	if err != nil {
+		jobError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "任务已重新排队", "job": job})
+}
+
+// SetJobPriority 调整任务优先级, 路由上需要管理员令牌
+func SetJobPriority(c *gin.Context) {
+	if jobQueue == nil {
+		c.JSON(503, gin.H{"error": "打印服务不可用"})
+		return
+	}
+
+	var reqBody struct {
+		Priority *int `json:"priority"`
+	}
+	if err := c.ShouldBindJSON(&reqBody); err != nil || reqBody.Priority == nil {
+		c.JSON(400, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	job, err := jobQueue.SetPriority(c.Param("id"), *reqBody.Priority)
+	if err != nil {
+		jobError(c, err)
+		return
+	}
+
+	c.JSON(200, job)
+}
+
+// trustedRelease 判断请求是否来自打印机旁已认证的释放终端
+func trustedRelease(c *gin.Context) bool {
+	token := c.GetHeader("X-Release-Token")
+	return releaseToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(releaseToken)) == 1
+}
+
+// ReleaseJob 用 PIN 释放保留的任务, 释放终端可不提供 PIN
+func ReleaseJob(c *gin.Context) {
+	if jobQueue == nil {
+		c.JSON(503, gin.H{"error": "打印服务不可用"})
+		return
+	}
+
+	// 释放终端可以不带请求体
+	trusted := trustedRelease(c)
+	var reqBody struct {
+		PIN string `json:"pin"`
+	}
+	if err := c.ShouldBindJSON(&reqBody); err != nil && !trusted {
+		c.JSON(400, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	job, err := jobQueue.Release(c.Param("id"), reqBody.PIN, trusted)
+	if err != nil {
+		jobError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "任务已释放", "job": job})
+}
+
+// ReleaseUserJobs 释放用户全部 PIN 相同的保留任务
+func ReleaseUserJobs(c *gin.Context) {
+	if jobQueue == nil {
+		c.JSON(503, gin.H{"error": "打印服务不可用"})
+		return
+	}
+
+	var reqBody struct {
+		User string `json:"user"`
+		PIN  string `json:"pin"`
+	}
+	if err := c.ShouldBindJSON(&reqBody); err != nil || reqBody.User == "" {
+		c.JSON(400, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	jobs, err := jobQueue.ReleaseUser(reqBody.User, reqBody.PIN)
+	if err != nil {
+		jobError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "任务已释放", "jobs": jobs})
+}
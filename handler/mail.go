@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"printer/config"
+	"printer/services"
+	"printer/services/smtp"
+	"time"
+)
+
+// mailPrinter 邮件打印, 未启用时为 nil
+var mailPrinter *services.MailPrinter
+
+// mailListener SMTP 服务器的监听, 未启用时为 nil
+var mailListener net.Listener
+
+// SetupMailPrint 启动接收打印邮件的 SMTP 服务器, 需在 SetupJobQueue 之后调用
+func SetupMailPrint(cfg config.MailConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if jobQueue == nil {
+		return errors.New("打印队列未初始化")
+	}
+
+	settings := services.MailPrintSettings{
+		Recipients: cfg.Recipients,
+		Senders:    cfg.Senders,
+		Networks:   cfg.AllowedNetworks,
+		Printer:    cfg.Printer,
+		Relay: services.MailRelay{
+			Addr:     cfg.Reply.Relay,
+			Username: cfg.Reply.Username,
+			Password: cfg.Reply.Password,
+			From:     cfg.Reply.From,
+		},
+		ReplyWait: time.Duration(cfg.Reply.WaitSeconds) * time.Second,
+	}
+	if len(cfg.Options) > 0 {
+		if err := json.Unmarshal(cfg.Options, &settings.Options); err != nil {
+			return fmt.Errorf("邮件打印的打印选项无效: %v", err)
+		}
+	}
+	printer, err := services.NewMailPrinter(jobQueue, printers, uploadDir, settings)
+	if err != nil {
+		return err
+	}
+
+	hostname := cfg.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	server := &smtp.Server{
+		Hostname:  hostname,
+		MaxSize:   int64(cfg.MaxMessageMB) << 20,
+		Client:    printer.Client,
+		Recipient: printer.Recipient,
+		Handler:   printer.Receive,
+	}
+	l, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("监听 SMTP 端口失败: %v", err)
+	}
+	mailPrinter = printer
+	mailListener = l
+	go func() {
+		if err := server.Serve(l); err != nil {
+			log.Printf("SMTP 服务停止: %v", err)
+		}
+	}()
+	return nil
+}
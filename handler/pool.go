@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"printer/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListPools 获取打印池列表
+func ListPools(c *gin.Context) {
+	c.JSON(200, gin.H{"pools": printers.ListPools()})
+}
+
+// GetPool 获取单个打印池
+func GetPool(c *gin.Context) {
+	pool, err := printers.GetPool(c.Param("name"))
+	if err != nil {
+		printerError(c, err)
+		return
+	}
+
+	c.JSON(200, pool)
+}
+
+// AddPool 添加打印池
+func AddPool(c *gin.Context) {
+	var pool services.Pool
+	if err := c.ShouldBindJSON(&pool); err != nil {
+		c.JSON(400, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := printers.AddPool(pool); err != nil {
+		printerError(c, err)
+		return
+	}
+
+	c.JSON(200, pool)
+}
+
+// UpdatePool 修改打印池
+func UpdatePool(c *gin.Context) {
+	var pool services.Pool
+	if err := c.ShouldBindJSON(&pool); err != nil {
+		c.JSON(400, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := printers.UpdatePool(c.Param("name"), pool); err != nil {
+		printerError(c, err)
+		return
+	}
+
+	c.JSON(200, pool)
+}
+
+// DeletePool 删除打印池, 已提交到该池的任务打印时会失败
+func DeletePool(c *gin.Context) {
+	if err := printers.DeletePool(c.Param("name")); err != nil {
+		printerError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "打印池已删除"})
+}
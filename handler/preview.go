@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"printer/config"
+	"printer/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 未指定宽度时的预览图宽度, 文件列表中的缩略图使用较小的宽度
+const (
+	defaultPreviewWidth   = 800
+	thumbnailPreviewWidth = 200
+)
+
+// previewer 页面预览, 由 SetupPreview 创建, 没有可用的渲染器时为 nil
+var previewer *services.Previewer
+
+// previewMaxWidth 预览图最大宽度
+var previewMaxWidth = 2000
+
+// SetupPreview 根据配置创建页面预览服务
+func SetupPreview(cfg config.PreviewConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	rasterizer, err := services.NewRasterizer(cfg.Rasterizer, cfg.Path)
+	if err != nil {
+		return err
+	}
+	if cfg.MaxWidth > 0 {
+		previewMaxWidth = cfg.MaxWidth
+	}
+	previewer = services.NewPreviewer(rasterizer, cfg.CacheDir,
+		int64(cfg.CacheMaxMB)<<20, time.Duration(cfg.TimeoutSeconds)*time.Second)
+	return nil
+}
+
+// previewURL 返回文件第一页缩略图的地址, 不能预览时返回空字符串
+func previewURL(filename string) string {
+	if previewer == nil || !previewer.Supports(filepath.Ext(filename)) {
+		return ""
+	}
+	return "/files/" + url.PathEscape(filename) + "/preview?page=1&width=" + strconv.Itoa(thumbnailPreviewWidth)
+}
+
+// PreviewFile 返回文件某一页的 PNG 预览图, 参数 page 从1开始, width 为像素宽度
+func PreviewFile(c *gin.Context) {
+	if previewer == nil {
+		c.JSON(503, gin.H{"error": "预览服务不可用"})
+		return
+	}
+
+	filename := c.Param("filename")
+	filePath := filepath.Join(uploadDir, filename)
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		c.JSON(404, gin.H{"error": "文件不存在"})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(400, gin.H{"error": "页码无效"})
+		return
+	}
+	width, err := strconv.Atoi(c.DefaultQuery("width", strconv.Itoa(defaultPreviewWidth)))
+	if err != nil || width < 1 || width > previewMaxWidth {
+		c.JSON(400, gin.H{"error": "宽度无效, 最大为 " + strconv.Itoa(previewMaxWidth)})
+		return
+	}
+
+	png, err := previewer.Preview(c.Request.Context(), filePath, page, width)
+	switch {
+	case errors.Is(err, services.ErrPageOutOfRange):
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrPreviewUnsupported):
+		c.JSON(415, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 预览图按文件内容缓存, 文件被覆盖后地址不变, 只允许短时间缓存
+	c.Header("Cache-Control", "private, max-age=60")
+	c.File(png)
+}
@@ -1,18 +1,66 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"printer/config"
 	"printer/services"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// printService 当前使用的打印服务, 由 SetupPrintService 根据配置创建
+var printService *services.PrintService
+
+// SetupPrintService 根据配置选择打印后端
+func SetupPrintService(cfg config.PrintConfig) error {
+	services.SetFileRoot(cfg.FileRoot)
+	for name, command := range cfg.Filters {
+		if name == "" || strings.TrimSpace(command) == "" {
+			return fmt.Errorf("过滤器 %q 的命令为空", name)
+		}
+		services.RegisterFilter(name, command)
+	}
+	backend, err := services.NewBackend(cfg.Backend, services.BackendConfig{
+		URI:      cfg.URI,
+		Settings: cfg.Settings,
+	})
+	if err != nil {
+		return err
+	}
+	SetPrintBackend(backend)
+	return nil
+}
+
+// SetupConverters 根据配置注册文档转换器, 后端不能直接打印的文档会先转换为 PDF
+func SetupConverters(cfg config.OfficeConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	converter, err := services.NewOfficeConverter(cfg.Path, cfg.ProfileDir,
+		time.Duration(cfg.TimeoutSeconds)*time.Second, cfg.Concurrency)
+	if err != nil {
+		return err
+	}
+	services.RegisterConverter(converter)
+	return nil
+}
+
+// SetPrintBackend 直接指定打印后端, 测试时可传入 services.FakeBackend
+func SetPrintBackend(backend services.PrintBackend) {
+	printService = services.NewPrintService(backend)
+}
+
 // HandlePrint 处理打印请求
 func HandlePrint(c *gin.Context) {
-	// 从JSON body中获取filename
+	// 从JSON body中获取filename、优先级和打印选项
 	var reqBody struct {
 		Filename string `json:"filename"`
+		jobRequest
 	}
 
 	if err := c.ShouldBindJSON(&reqBody); err != nil {
@@ -26,7 +74,7 @@ func HandlePrint(c *gin.Context) {
 	}
 
 	// 构建完整的文件路径
-	filePath := filepath.Join("uploads", reqBody.Filename)
+	filePath := filepath.Join(uploadDir, reqBody.Filename)
 
 	// 检查文件是否存在
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
@@ -34,17 +82,224 @@ func HandlePrint(c *gin.Context) {
 		return
 	}
 
-	// 创建打印服务实例
-	printService := &services.PrintService{}
+	if jobQueue == nil {
+		c.JSON(503, gin.H{"error": "打印服务不可用"})
+		return
+	}
+
+	_, options, ok := resolveOptions(c, reqBody.Printer, reqBody.Options)
+	if !ok {
+		return
+	}
+	// 已知页数时检查页码范围
+	if meta, err := fileMeta.Get(reqBody.Filename); err == nil {
+		if err := meta.CheckPrintable(options); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	submitJob(c, reqBody.jobRequest, services.Job{
+		Filename: reqBody.Filename,
+		Options:  options,
+	})
+}
+
+// maxBatchFiles 一次合并打印的最多文件数
+const maxBatchFiles = 100
+
+// HandlePrintBatch 将多个文件按顺序合并为一个任务打印, 避免在共享打印机上与其他任务交错
+func HandlePrintBatch(c *gin.Context) {
+	var reqBody struct {
+		Files []services.BatchFile `json:"files"`
+		jobRequest
+	}
+
+	if err := c.ShouldBindJSON(&reqBody); err != nil {
+		c.JSON(400, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	if len(reqBody.Files) == 0 {
+		c.JSON(400, gin.H{"error": "文件列表不能为空"})
+		return
+	}
+	if len(reqBody.Files) > maxBatchFiles {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("一次最多合并 %d 个文件", maxBatchFiles)})
+		return
+	}
+
+	for _, f := range reqBody.Files {
+		if err := services.CheckBatchFile(f); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := os.Stat(filepath.Join(uploadDir, f.Filename)); os.IsNotExist(err) {
+			c.JSON(404, gin.H{"error": "文件不存在: " + f.Filename})
+			return
+		}
+		// 已知页数时检查每个文件的页码范围
+		if meta, err := fileMeta.Get(f.Filename); err == nil {
+			if err := meta.CheckPrintable(services.PrintOptions{PageRanges: f.PageRanges}); err != nil {
+				c.JSON(400, gin.H{"error": f.Filename + ": " + err.Error()})
+				return
+			}
+		}
+	}
+
+	if jobQueue == nil {
+		c.JSON(503, gin.H{"error": "打印服务不可用"})
+		return
+	}
+
+	service, options, ok := resolveOptions(c, reqBody.Printer, reqBody.Options)
+	if !ok {
+		return
+	}
+	// 合并后的文档为 PDF
+	if !service.Backend.Capabilities().CanPrint(".pdf") {
+		c.JSON(400, gin.H{"error": "打印机不能打印 PDF, 无法合并打印"})
+		return
+	}
+
+	submitJob(c, reqBody.jobRequest, services.Job{
+		Filename: reqBody.Files[0].Filename,
+		Files:    reqBody.Files,
+		Options:  options,
+	})
+}
 
-	// 执行打印
-	err := printService.PrintFile(filePath)
+// resolveOptions 在排队前合并打印机或打印池的默认选项并检查, 后端不支持的选项直接拒绝.
+// 检查失败时已写入响应, 返回 false
+func resolveOptions(c *gin.Context, printer string, opts services.PrintOptions) (*services.PrintService, services.PrintOptions, bool) {
+	service, options, err := printers.ResolveTarget(printer, opts)
+	if err != nil {
+		printerError(c, err)
+		return nil, options, false
+	}
+	if !checkWatermarkImage(c, options) {
+		return nil, options, false
+	}
+	return service, options, true
+}
+
+// checkWatermarkImage 检查水印图片是否已上传, 不存在时已写入响应, 返回 false
+func checkWatermarkImage(c *gin.Context, options services.PrintOptions) bool {
+	if options.Watermark.Enabled() && options.Watermark.Image != "" {
+		if _, err := os.Stat(filepath.Join(uploadDir, options.Watermark.Image)); err != nil {
+			c.JSON(400, gin.H{"error": "水印图片不存在: " + options.Watermark.Image})
+			return false
+		}
+	}
+	return true
+}
+
+// jobRequest 各打印接口共用的任务参数
+type jobRequest struct {
+	Printer  string                `json:"printer"`
+	User     string                `json:"user"`
+	Priority int                   `json:"priority"`
+	Options  services.PrintOptions `json:"options"`
+	// 保留打印: 任务在用户用 PIN 释放前不打印
+	Hold bool   `json:"hold"`
+	PIN  string `json:"pin"`
+	// 定时打印: 不早于该时间 (RFC 3339) 打印
+	NotBefore *time.Time `json:"not_before"`
+	// 周期打印的 cron 表达式, 如 "0 2 * * *"
+	Schedule string `json:"schedule"`
+}
+
+// submitJob 按 req 填写任务的打印机、用户、定时和保留设置后加入打印队列, 立即返回任务ID
+func submitJob(c *gin.Context, req jobRequest, job services.Job) {
+	user, ok := requestUser(c, req.User)
+	if !ok {
+		return
+	}
+	job.Printer = req.Printer
+	job.User = user
+	job.Priority = req.Priority
+	// 只有管理员可以提高优先级, 其他用户最高为默认优先级 0
+	if job.Priority > 0 && !isAdmin(c) {
+		job.Priority = 0
+	}
+	job.NotBefore = req.NotBefore
+	job.Schedule = req.Schedule
+	if req.Schedule != "" {
+		if req.NotBefore != nil {
+			c.JSON(400, gin.H{"error": "not_before 和 schedule 只能指定一个"})
+			return
+		}
+		if _, err := services.ParseSchedule(req.Schedule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var err error
+	if req.Hold {
+		if err := services.ValidatePIN(req.PIN); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		job, err = jobQueue.SubmitHeld(job, req.PIN)
+	} else {
+		job, err = jobQueue.Submit(job)
+	}
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		c.JSON(403, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(200, gin.H{"message": "打印成功"})
+	message := "已加入打印队列"
+	switch {
+	case job.State == services.JobScheduled:
+		message = "已加入定时打印, 将在 " + job.NotBefore.Local().Format("2006-01-02 15:04") + " 后打印"
+	case job.State == services.JobHeld:
+		message = "任务已保留, 请在打印机旁输入 PIN 释放"
+	case healthMonitor != nil && !healthMonitor.Available(job.Printer):
+		message = "打印机暂不可用, 任务将在恢复后打印"
+	}
+	c.JSON(202, gin.H{
+		"message": message,
+		"job_id":  job.ID,
+		"job":     job,
+	})
+}
+
+// HandlePrintCapabilities 返回当前打印后端支持的格式和选项
+func HandlePrintCapabilities(c *gin.Context) {
+	if printService == nil {
+		c.JSON(503, gin.H{"error": "打印服务不可用"})
+		return
+	}
+
+	c.JSON(200, printService.Capabilities())
+}
+
+// HandlePrinterStatus 查询当前打印机状态, 仅支持能报告状态的后端
+func HandlePrinterStatus(c *gin.Context) {
+	if printService == nil {
+		c.JSON(503, gin.H{"error": "打印服务不可用"})
+		return
+	}
+
+	reporter, ok := printService.Backend.(services.StatusReporter)
+	if !ok {
+		c.JSON(501, gin.H{"error": "当前打印后端不支持查询状态"})
+		return
+	}
+
+	status, err := reporter.PrinterStatus(c.Request.Context())
+	if err != nil {
+		c.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, status)
 }
 
 func HandlePreOpenFile(c *gin.Context) {
@@ -64,7 +319,7 @@ func HandlePreOpenFile(c *gin.Context) {
 	}
 
 	// 构建完整的文件路径
-	filePath := filepath.Join("uploads", reqBody.Filename)
+	filePath := filepath.Join(uploadDir, reqBody.Filename)
 
 	// 检查文件是否存在
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
@@ -72,11 +327,13 @@ func HandlePreOpenFile(c *gin.Context) {
 		return
 	}
 
-	// 创建打印服务实例
-	printService := &services.PrintService{}
+	if printService == nil {
+		c.JSON(503, gin.H{"error": "打印服务不可用"})
+		return
+	}
 
 	// 执行预打开
-	err := printService.OpenFile(filePath)
+	err := printService.OpenFile(c.Request.Context(), filePath)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,322 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"printer/config"
+	"printer/services"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupTest 在临时目录中使用 FakeBackend 初始化打印服务和队列, 返回注册了打印相关接口的路由.
+// router.SetupRouter 依赖前端构建产物, 这里只注册测试用到的接口
+func setupTest(t *testing.T, backend *services.FakeBackend, accountingCfg config.AccountingConfig) *gin.Engine {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	for _, dir := range []string{uploadDir, "config"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	SetPrintBackend(backend)
+	if err := SetupPrinters(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetupAccounting(accountingCfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetupJobQueue(config.JobsConfig{Workers: 1}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		Close()
+		printService, printers, jobQueue, accounting = nil, nil, nil, nil
+		adminToken, userHeader, releaseToken = "", "", ""
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/print", HandlePrint)
+	r.GET("/jobs/:id", GetJob)
+	r.PUT("/jobs/:id/priority", RequireAdmin, SetJobPriority)
+	r.POST("/api/printers", RequireAdmin, AddPrinter)
+	usage := r.Group("/api/usage", RequireAdmin)
+	usage.GET("/records", ListUsageRecords)
+	return r
+}
+
+// writeUpload 在上传目录中写入文件
+func writeUpload(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(uploadDir, name), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// doRequest 发送 JSON 请求, 返回响应
+func doRequest(r *gin.Engine, method, path string, body any, header http.Header) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// waitJob 通过 GET /jobs/:id 等待任务结束
+func waitJob(t *testing.T, r *gin.Engine, id string) services.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := doRequest(r, "GET", "/jobs/"+id, nil, nil)
+		if w.Code != 200 {
+			t.Fatalf("GET /jobs/%s: %d %s", id, w.Code, w.Body)
+		}
+		var job services.Job
+		if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+			t.Fatal(err)
+		}
+		if job.State.Finished() {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("任务 %s 未结束, 状态 %s", id, job.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// submitPrint 提交打印请求, 返回任务ID
+func submitPrint(t *testing.T, r *gin.Engine, body gin.H, header http.Header) string {
+	t.Helper()
+	w := doRequest(r, "POST", "/print", body, header)
+	if w.Code != 202 {
+		t.Fatalf("POST /print: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		JobID string `json:"job_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.JobID
+}
+
+func TestHandlePrint(t *testing.T) {
+	backend := services.NewFakeBackend()
+	r := setupTest(t, backend, config.AccountingConfig{})
+	writeUpload(t, "report.pdf", []byte("%PDF-1.4\n"))
+
+	id := submitPrint(t, r, gin.H{
+		"filename": "report.pdf",
+		"user":     "zhangsan",
+		"options":  gin.H{"copies": 2, "duplex": services.DuplexLongEdge},
+	}, nil)
+	job := waitJob(t, r, id)
+	if job.State != services.JobDone {
+		t.Fatalf("state = %s, error = %s", job.State, job.Error)
+	}
+	if job.User != "zhangsan" {
+		t.Errorf("user = %q", job.User)
+	}
+	printed := backend.PrintedOptions()
+	if len(printed) != 1 || printed[0].Copies != 2 || printed[0].Duplex != services.DuplexLongEdge {
+		t.Fatalf("printed options = %+v", printed)
+	}
+}
+
+func TestHandlePrintRejects(t *testing.T) {
+	backend := services.NewFakeBackend()
+	backend.SetCapabilities(services.Capabilities{PrintFormats: []string{".pdf"}, MaxCopies: 1})
+	r := setupTest(t, backend, config.AccountingConfig{})
+	writeUpload(t, "a.pdf", []byte("%PDF-1.4\n"))
+
+	tests := []struct {
+		name string
+		body gin.H
+		code int
+	}{
+		{"no filename", gin.H{}, 400},
+		{"missing file", gin.H{"filename": "missing.pdf"}, 404},
+		{"invalid option", gin.H{"filename": "a.pdf", "options": gin.H{"duplex": "both"}}, 400},
+		{"unsupported duplex", gin.H{"filename": "a.pdf", "options": gin.H{"duplex": services.DuplexLongEdge}}, 400},
+		{"unsupported copies", gin.H{"filename": "a.pdf", "options": gin.H{"copies": 3}}, 400},
+		{"unknown printer", gin.H{"filename": "a.pdf", "printer": "nope"}, 404},
+	}
+	for _, tt := range tests {
+		if w := doRequest(r, "POST", "/print", tt.body, nil); w.Code != tt.code {
+			t.Errorf("%s: %d %s, want %d", tt.name, w.Code, w.Body, tt.code)
+		}
+	}
+	if printed := backend.Printed(); len(printed) != 0 {
+		t.Errorf("printed = %v", printed)
+	}
+}
+
+func TestHandlePrintBackendError(t *testing.T) {
+	backend := services.NewFakeBackend()
+	backend.SetError(services.ErrPrinterDisabled)
+	r := setupTest(t, backend, config.AccountingConfig{})
+	writeUpload(t, "a.pdf", []byte("%PDF-1.4\n"))
+
+	job := waitJob(t, r, submitPrint(t, r, gin.H{"filename": "a.pdf"}, nil))
+	if job.State != services.JobFailed || job.Error == "" {
+		t.Fatalf("state = %s, error = %q", job.State, job.Error)
+	}
+}
+
+func TestHandlePrintUserHeader(t *testing.T) {
+	backend := services.NewFakeBackend()
+	r := setupTest(t, backend, config.AccountingConfig{UserHeader: "X-Remote-User"})
+	writeUpload(t, "a.pdf", []byte("%PDF-1.4\n"))
+
+	// 配置了 user_header 时不能使用请求体中的用户名
+	if w := doRequest(r, "POST", "/print", gin.H{"filename": "a.pdf", "user": "boss"}, nil); w.Code != 401 {
+		t.Fatalf("没有请求头: %d %s", w.Code, w.Body)
+	}
+	id := submitPrint(t, r, gin.H{"filename": "a.pdf", "user": "boss"},
+		http.Header{"X-Remote-User": {"zhangsan"}})
+	if job := waitJob(t, r, id); job.User != "zhangsan" {
+		t.Fatalf("user = %q", job.User)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	r := setupTest(t, services.NewFakeBackend(), config.AccountingConfig{})
+	if w := doRequest(r, "GET", "/api/usage/records", nil, nil); w.Code != 403 {
+		t.Errorf("未配置令牌: %d %s", w.Code, w.Body)
+	}
+
+	adminToken = "secret"
+	if w := doRequest(r, "GET", "/api/usage/records", nil, nil); w.Code != 401 {
+		t.Errorf("没有令牌: %d %s", w.Code, w.Body)
+	}
+	if w := doRequest(r, "GET", "/api/usage/records", nil, http.Header{"X-Admin-Token": {"wrong"}}); w.Code != 401 {
+		t.Errorf("令牌错误: %d %s", w.Code, w.Body)
+	}
+	if w := doRequest(r, "GET", "/api/usage/records", nil, http.Header{"X-Admin-Token": {"secret"}}); w.Code == 401 || w.Code == 403 {
+		t.Errorf("令牌正确: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestAddPrinterRejectsUnsafeSettings(t *testing.T) {
+	r := setupTest(t, services.NewFakeBackend(), config.AccountingConfig{AdminToken: "secret"})
+	admin := http.Header{"X-Admin-Token": {"secret"}}
+	root := t.TempDir()
+	services.SetFileRoot(root)
+	t.Cleanup(func() { services.SetFileRoot("") })
+
+	tests := []struct {
+		name    string
+		printer gin.H
+		code    int
+	}{
+		// 过滤器只能引用服务配置中登记的名称, 不能直接填写命令
+		{"filter command", gin.H{
+			"name": "p1", "backend": "socket", "uri": "socket://192.0.2.10:9100",
+			"settings": gin.H{"filter": "sh -c 'touch /tmp/pwned'"},
+		}, 400},
+		{"file outside root", gin.H{
+			"name": "p2", "backend": "file", "uri": "file://" + filepath.ToSlash(t.TempDir()),
+		}, 400},
+		{"file traversal", gin.H{
+			"name": "p3", "backend": "file", "uri": "file://" + filepath.ToSlash(filepath.Join(root, "..", "etc")),
+		}, 400},
+		{"file formats", gin.H{
+			"name": "p4", "backend": "file", "uri": "file://" + filepath.ToSlash(filepath.Join(root, "out")),
+			"settings": gin.H{"formats": ".sh"},
+		}, 400},
+		{"file in root", gin.H{
+			"name": "p5", "backend": "file", "uri": "file://" + filepath.ToSlash(filepath.Join(root, "out")),
+		}, 200},
+	}
+	for _, tt := range tests {
+		if w := doRequest(r, "POST", "/api/printers", tt.printer, admin); w.Code != tt.code {
+			t.Errorf("%s: %d %s, want %d", tt.name, w.Code, w.Body, tt.code)
+		}
+	}
+}
+
+func TestAddPrinterRequiresAdmin(t *testing.T) {
+	r := setupTest(t, services.NewFakeBackend(), config.AccountingConfig{AdminToken: "secret"})
+	printer := gin.H{"name": "p1", "backend": "socket", "uri": "socket://192.0.2.10:9100"}
+	if w := doRequest(r, "POST", "/api/printers", printer, nil); w.Code != 401 {
+		t.Fatalf("没有令牌: %d %s", w.Code, w.Body)
+	}
+	if _, err := printers.Get("p1"); err == nil {
+		t.Fatal("没有令牌时不应登记打印机")
+	}
+	if w := doRequest(r, "POST", "/api/printers", printer, http.Header{"X-Admin-Token": {"secret"}}); w.Code != 200 {
+		t.Fatalf("令牌正确: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestAddPrinterReservedNames(t *testing.T) {
+	r := setupTest(t, services.NewFakeBackend(), config.AccountingConfig{AdminToken: "secret"})
+	admin := http.Header{"X-Admin-Token": {"secret"}}
+	for _, name := range []string{"status", "discovered"} {
+		printer := gin.H{"name": name, "backend": "socket", "uri": "socket://192.0.2.10:9100"}
+		if w := doRequest(r, "POST", "/api/printers", printer, admin); w.Code != 400 {
+			t.Errorf("%s: %d %s", name, w.Code, w.Body)
+		}
+	}
+	// 只有完全相同的名称才保留
+	printer := gin.H{"name": "status-2f", "backend": "socket", "uri": "socket://192.0.2.10:9100"}
+	if w := doRequest(r, "POST", "/api/printers", printer, admin); w.Code != 200 {
+		t.Errorf("status-2f: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestJobPriorityRequiresAdmin(t *testing.T) {
+	backend := services.NewFakeBackend()
+	// 任务一直在打印, 后提交的任务保持排队
+	backend.SetDelay(time.Hour)
+	r := setupTest(t, backend, config.AccountingConfig{AdminToken: "secret"})
+	admin := http.Header{"X-Admin-Token": {"secret"}}
+	writeUpload(t, "a.pdf", []byte("%PDF-1.4\n"))
+	submitPrint(t, r, gin.H{"filename": "a.pdf"}, nil)
+
+	priority := func(id string) int {
+		t.Helper()
+		job, err := jobQueue.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job.Priority
+	}
+	// 普通用户不能提高优先级, 可以降低
+	if p := priority(submitPrint(t, r, gin.H{"filename": "a.pdf", "priority": 9}, nil)); p != 0 {
+		t.Errorf("普通用户提交: priority = %d", p)
+	}
+	if p := priority(submitPrint(t, r, gin.H{"filename": "a.pdf", "priority": -1}, nil)); p != -1 {
+		t.Errorf("普通用户降低: priority = %d", p)
+	}
+	id := submitPrint(t, r, gin.H{"filename": "a.pdf", "priority": 9}, admin)
+	if p := priority(id); p != 9 {
+		t.Errorf("管理员提交: priority = %d", p)
+	}
+
+	if w := doRequest(r, "PUT", "/jobs/"+id+"/priority", gin.H{"priority": 20}, nil); w.Code != 401 {
+		t.Errorf("没有令牌: %d %s", w.Code, w.Body)
+	}
+	if w := doRequest(r, "PUT", "/jobs/"+id+"/priority", gin.H{"priority": 20}, admin); w.Code != 200 {
+		t.Errorf("令牌正确: %d %s", w.Code, w.Body)
+	}
+	if p := priority(id); p != 20 {
+		t.Errorf("priority = %d", p)
+	}
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"printer/config"
+	"printer/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// urlFetcher 下载 URL 打印的文档, 未启用时为 nil
+var urlFetcher *services.URLFetcher
+
+// SetupPrintURL 根据配置启用 URL 打印
+func SetupPrintURL(cfg config.PrintURLConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	fetcher, err := services.NewURLFetcher(services.FetchSettings{
+		Allow:        cfg.Allow,
+		Deny:         cfg.Deny,
+		MaxSize:      int64(cfg.MaxSizeMB) << 20,
+		MaxRedirects: cfg.MaxRedirects,
+		Timeout:      time.Duration(cfg.TimeoutSeconds) * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	urlFetcher = fetcher
+	return nil
+}
+
+// HandlePrintURL 下载 URL 指向的文档保存到上传目录, 然后像已上传的文件一样加入打印队列
+func HandlePrintURL(c *gin.Context) {
+	var reqBody struct {
+		URL string `json:"url"`
+		jobRequest
+	}
+
+	if err := c.ShouldBindJSON(&reqBody); err != nil {
+		c.JSON(400, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	if reqBody.URL == "" {
+		c.JSON(400, gin.H{"error": "地址不能为空"})
+		return
+	}
+
+	if urlFetcher == nil {
+		c.JSON(404, gin.H{"error": "URL打印未启用"})
+		return
+	}
+	if jobQueue == nil {
+		c.JSON(503, gin.H{"error": "打印服务不可用"})
+		return
+	}
+
+	// 先检查用户和打印选项, 以免下载后才发现不能打印
+	if _, ok := requestUser(c, reqBody.User); !ok {
+		return
+	}
+	service, options, ok := resolveOptions(c, reqBody.Printer, reqBody.Options)
+	if !ok {
+		return
+	}
+
+	filename, err := urlFetcher.Fetch(c.Request.Context(), reqBody.URL, uploadDir)
+	if err != nil {
+		fetchError(c, err)
+		return
+	}
+	if ext := filepath.Ext(filename); !service.Capabilities().CanPrint(ext) {
+		os.Remove(filepath.Join(uploadDir, filename))
+		c.JSON(415, gin.H{"error": "不支持的文件类型: " + ext})
+		return
+	}
+
+	// 与上传的文件一样记录页数, 并检查页码范围
+	if meta, err := fileMeta.Inspect(filename); err != nil {
+		log.Printf("检查文件 %s 失败: %v", filename, err)
+	} else if err := meta.CheckPrintable(options); err != nil {
+		c.JSON(400, gin.H{"error": err.Error(), "filename": filename})
+		return
+	}
+
+	submitJob(c, reqBody.jobRequest, services.Job{
+		Filename: filename,
+		Options:  options,
+	})
+}
+
+// fetchError 将下载错误转换为HTTP响应
+func fetchError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrHostNotAllowed):
+		c.JSON(403, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrDocumentTooLarge):
+		c.JSON(413, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrFetchFailed):
+		c.JSON(502, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotDocument):
+		c.JSON(415, gin.H{"error": err.Error()})
+	default:
+		c.JSON(400, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"errors"
+	"path/filepath"
+	"printer/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	printersFile = "printers.json"
+	poolsFile    = "pools.json"
+)
+
+// printers 已登记的打印机, 由 SetupPrinters 创建
+var printers *services.PrinterRegistry
+
+// SetupPrinters 加载打印机和打印池列表, 未指定打印机的任务使用 SetupPrintService 配置的默认后端
+func SetupPrinters() error {
+	registry, err := services.NewPrinterRegistry(filepath.Join("config", printersFile), printService)
+	if err != nil {
+		return err
+	}
+	if err := registry.LoadPools(filepath.Join("config", poolsFile)); err != nil {
+		return err
+	}
+	printers = registry
+	return nil
+}
+
+// printerError 将打印机相关错误转换为HTTP响应
+func printerError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrPrinterNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPrinterExists):
+		c.JSON(409, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPrinterDisabled), errors.Is(err, services.ErrNoDefaultPrinter),
+		errors.Is(err, services.ErrPoolUnavailable):
+		c.JSON(503, gin.H{"error": err.Error()})
+	default:
+		c.JSON(400, gin.H{"error": err.Error()})
+	}
+}
+
+// ListPrinters 获取打印机列表
+func ListPrinters(c *gin.Context) {
+	c.JSON(200, gin.H{"printers": printers.List()})
+}
+
+// GetPrinter 获取单台打印机
+func GetPrinter(c *gin.Context) {
+	printer, err := printers.Get(c.Param("name"))
+	if err != nil {
+		printerError(c, err)
+		return
+	}
+
+	c.JSON(200, printer)
+}
+
+// AddPrinter 登记新的打印机
+func AddPrinter(c *gin.Context) {
+	var printer services.Printer
+	if err := c.ShouldBindJSON(&printer); err != nil {
+		c.JSON(400, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := printers.Add(printer); err != nil {
+		printerError(c, err)
+		return
+	}
+
+	c.JSON(200, printer)
+}
+
+// UpdatePrinter 修改打印机配置
+func UpdatePrinter(c *gin.Context) {
+	var printer services.Printer
+	if err := c.ShouldBindJSON(&printer); err != nil {
+		c.JSON(400, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := printers.Update(c.Param("name"), printer); err != nil {
+		printerError(c, err)
+		return
+	}
+
+	c.JSON(200, printer)
+}
+
+// DeletePrinter 删除打印机
+func DeletePrinter(c *gin.Context) {
+	if err := printers.Delete(c.Param("name")); err != nil {
+		printerError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "打印机已删除"})
+}
+
+// GetPrinterCapabilities 获取打印机支持的格式和选项
+func GetPrinterCapabilities(c *gin.Context) {
+	service, _, err := printers.Resolve(c.Param("name"))
+	if err != nil {
+		printerError(c, err)
+		return
+	}
+
+	c.JSON(200, service.Capabilities())
+}
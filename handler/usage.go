@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"printer/config"
+	"printer/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const usageFile = "usage.json"
+
+// accounting 打印用量记录, 由 SetupAccounting 创建, 未启用时为 nil
+var accounting *services.Accounting
+
+// adminToken 管理接口的令牌, 为空时管理接口不可用
+var adminToken string
+
+// userHeader 认证代理设置的用户名请求头, 为空时使用请求体中的用户名
+var userHeader string
+
+// SetupAccounting 加载用量记录和配额设置, 需在 SetupJobQueue 之前调用
+func SetupAccounting(cfg config.AccountingConfig) error {
+	adminToken = cfg.AdminToken
+	userHeader = cfg.UserHeader
+	if !cfg.Enabled {
+		return nil
+	}
+
+	users := make(map[string]services.Quota, len(cfg.Users))
+	for name, q := range cfg.Users {
+		users[name] = services.Quota{DailyPages: q.DailyPages, MonthlyPages: q.MonthlyPages}
+	}
+	a, err := services.NewAccounting(filepath.Join("config", usageFile), services.AccountingPolicy{
+		Quota:      services.Quota{DailyPages: cfg.DailyPages, MonthlyPages: cfg.MonthlyPages},
+		UserQuotas: users,
+		Pricing: services.Pricing{
+			MonoPage:  cfg.MonoPrice,
+			ColorPage: cfg.ColorPrice,
+			Sheet:     cfg.SheetPrice,
+		},
+		Retention: time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+	})
+	if err != nil {
+		return err
+	}
+	accounting = a
+	return nil
+}
+
+// RequireAdmin 检查请求头 X-Admin-Token, 用于用量报表和打印机管理等接口, 未配置令牌时拒绝全部请求
+func RequireAdmin(c *gin.Context) {
+	if adminToken == "" {
+		c.AbortWithStatusJSON(403, gin.H{"error": "未配置管理员令牌, 管理接口不可用"})
+		return
+	}
+	if !isAdmin(c) {
+		c.AbortWithStatusJSON(401, gin.H{"error": "需要管理员令牌"})
+		return
+	}
+	c.Next()
+}
+
+// isAdmin 判断请求是否带有正确的管理员令牌, 未配置令牌时总是返回 false
+func isAdmin(c *gin.Context) bool {
+	return adminToken != "" &&
+		subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Admin-Token")), []byte(adminToken)) == 1
+}
+
+// requestUser 返回任务的用户. 配置了 user_header 时取自认证代理设置的请求头,
+// 没有该请求头时已写入响应, 返回 false; 否则使用客户端在请求体中填写的 user
+func requestUser(c *gin.Context, user string) (string, bool) {
+	if userHeader == "" {
+		return user, true
+	}
+	user = c.GetHeader(userHeader)
+	if user == "" {
+		c.JSON(401, gin.H{"error": "未认证的请求"})
+		return "", false
+	}
+	return user, true
+}
+
+// usageRange 解析 from、to 参数 (YYYY-MM-DD, 包含首尾两天), 默认为本月1日到今天
+func usageRange(c *gin.Context) (time.Time, time.Time, bool) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if s := c.Query("from"); s != "" {
+		t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "from 日期无效, 格式为 YYYY-MM-DD"})
+			return time.Time{}, time.Time{}, false
+		}
+		from = t
+	}
+	if s := c.Query("to"); s != "" {
+		t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "to 日期无效, 格式为 YYYY-MM-DD"})
+			return time.Time{}, time.Time{}, false
+		}
+		to = t
+	}
+	return from, to.AddDate(0, 0, 1), true
+}
+
+// usageRecords 返回请求时间范围内的记录, 可用 user、printer 参数筛选,
+// printer 可以是打印池或实际打印的打印机
+func usageRecords(c *gin.Context) ([]services.UsageRecord, bool) {
+	if accounting == nil {
+		c.JSON(503, gin.H{"error": "用量记录未启用"})
+		return nil, false
+	}
+	from, to, ok := usageRange(c)
+	if !ok {
+		return nil, false
+	}
+
+	user, filterUser := c.GetQuery("user")
+	printer, filterPrinter := c.GetQuery("printer")
+	var records []services.UsageRecord
+	for _, r := range accounting.Records(from, to) {
+		if (filterUser && r.User != user) || (filterPrinter && r.Printer != printer && recordDevice(r) != printer) {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, true
+}
+
+// writeCSV 以附件形式返回 CSV, 首行为列名
+func writeCSV(c *gin.Context, name string, header []string, rows [][]string) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	c.Status(200)
+	w := csv.NewWriter(c.Writer)
+	w.Write(header)
+	w.WriteAll(rows)
+}
+
+// recordDevice 返回实际打印的打印机, 没有记录时为提交的目标
+func recordDevice(r services.UsageRecord) string {
+	if r.Device != "" {
+		return r.Device
+	}
+	return r.Printer
+}
+
+func formatCost(cost float64) string {
+	return strconv.FormatFloat(cost, 'f', -1, 64)
+}
+
+// ListUsageRecords 返回每个已完成任务的用量, format=csv 时返回 CSV
+func ListUsageRecords(c *gin.Context) {
+	records, ok := usageRecords(c)
+	if !ok {
+		return
+	}
+
+	if c.Query("format") != "csv" {
+		if records == nil {
+			records = []services.UsageRecord{}
+		}
+		c.JSON(200, gin.H{"records": records})
+		return
+	}
+	rows := make([][]string, len(records))
+	for i, r := range records {
+		rows[i] = []string{
+			r.Time.Local().Format(time.DateTime), r.JobID, r.User, r.Printer, recordDevice(r),
+			strconv.Itoa(r.Pages), strconv.Itoa(r.Copies),
+			strconv.FormatBool(r.Color), strconv.FormatBool(r.Duplex),
+			strconv.Itoa(r.TotalPages), strconv.Itoa(r.Sheets), formatCost(r.Cost),
+		}
+	}
+	writeCSV(c, "usage-records.csv",
+		[]string{"time", "job_id", "user", "printer", "device", "pages", "copies", "color", "duplex", "total_pages", "sheets", "cost"},
+		rows)
+}
+
+// usageSummary 按 key 汇总请求时间范围内的用量, format=csv 时返回 CSV, column 为 key 的列名
+func usageSummary(c *gin.Context, name, column string, key func(services.UsageRecord) string) {
+	records, ok := usageRecords(c)
+	if !ok {
+		return
+	}
+	summaries := services.SummarizeUsage(records, key)
+
+	if c.Query("format") != "csv" {
+		c.JSON(200, gin.H{name: summaries})
+		return
+	}
+	rows := make([][]string, len(summaries))
+	for i, s := range summaries {
+		rows[i] = []string{
+			s.Key, strconv.Itoa(s.Jobs), strconv.Itoa(s.TotalPages),
+			strconv.Itoa(s.ColorPages), strconv.Itoa(s.MonoPages),
+			strconv.Itoa(s.Sheets), formatCost(s.Cost),
+		}
+	}
+	writeCSV(c, "usage-"+name+".csv",
+		[]string{column, "jobs", "total_pages", "color_pages", "mono_pages", "sheets", "cost"},
+		rows)
+}
+
+// ListUserUsage 按用户汇总用量
+func ListUserUsage(c *gin.Context) {
+	usageSummary(c, "users", "user", func(r services.UsageRecord) string { return r.User })
+}
+
+// ListPrinterUsage 按实际打印的打印机汇总用量, 默认后端的打印机名称为空
+func ListPrinterUsage(c *gin.Context) {
+	usageSummary(c, "printers", "printer", recordDevice)
+}
+
+// GetUserQuota 返回用户的配额、今天和本月已打印的页数以及待打印的页数
+func GetUserQuota(c *gin.Context) {
+	if jobQueue == nil {
+		c.JSON(503, gin.H{"error": "打印服务不可用"})
+		return
+	}
+
+	status, ok := jobQueue.QuotaStatus(c.Param("user"))
+	if !ok {
+		c.JSON(503, gin.H{"error": "用量记录未启用"})
+		return
+	}
+	c.JSON(200, status)
+}
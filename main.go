@@ -7,16 +7,20 @@ import (
 	"os"
 	"os/signal"
 	"printer/config"
+	"printer/handler"
 	"printer/router"
 	"syscall"
 	"time"
 )
 
-func interruptServer(server *http.Server) {
+// interruptServer 收到中断信号时关闭服务器并停止后台任务, 全部完成后关闭返回的通道
+func interruptServer(server *http.Server) <-chan struct{} {
+	done := make(chan struct{})
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
+		defer close(done)
 		<-signals
 		log.Println("Shutting down server gracefully...")
 
@@ -31,21 +35,73 @@ func interruptServer(server *http.Server) {
 		} else {
 			log.Println("Server shut down gracefully")
 		}
+
+		// 停止打印队列, 未完成的任务下次启动时继续
+		handler.Close()
 	}()
+	return done
 }
 func main() {
-	config.SetGinMode("release")
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	config.SetGinMode(cfg.GinMode)
+	if err := handler.SetupPrintService(cfg.Print); err != nil {
+		// 默认打印后端不可用时仍然可以使用已登记的打印机、文件管理和VNC功能
+		log.Printf("Print backend %q unavailable: %v", cfg.Print.Backend, err)
+	}
+	if err := handler.SetupPrintURL(cfg.PrintURL); err != nil {
+		log.Fatalf("Invalid print_url config: %v", err)
+	}
+	if err := handler.SetupConverters(cfg.Office); err != nil {
+		// 没有安装 LibreOffice 时只能打印后端直接支持的格式
+		log.Printf("Office conversion unavailable: %v", err)
+	}
+	if err := handler.SetupPreview(cfg.Preview); err != nil {
+		// 没有安装 pdftoppm 或 Ghostscript 时不提供预览
+		log.Printf("Page preview unavailable: %v", err)
+	}
+	if err := handler.SetupPrinters(); err != nil {
+		log.Fatalf("Failed to load printers: %v", err)
+	}
+	if err := handler.SetupDiscovery(cfg.Discovery); err != nil {
+		log.Fatalf("Failed to set up printer discovery: %v", err)
+	}
+	if err := handler.SetupAccounting(cfg.Accounting); err != nil {
+		log.Fatalf("Failed to load print usage: %v", err)
+	}
+	if err := handler.SetupJobQueue(cfg.Jobs); err != nil {
+		log.Fatalf("Failed to start print queue: %v", err)
+	}
+	if err := handler.SetupHealthMonitor(cfg.Health); err != nil {
+		log.Fatalf("Failed to start printer health monitor: %v", err)
+	}
+	if err := handler.SetupIPPServer(cfg.IPP, cfg.Addr); err != nil {
+		// 不能公布 mDNS 时仍可手动添加 IPP 打印机
+		log.Printf("IPP printer advertisement unavailable: %v", err)
+	}
+	if err := handler.SetupHotFolders(cfg.HotFolders); err != nil {
+		log.Fatalf("Failed to start hot folders: %v", err)
+	}
+	if err := handler.SetupMailPrint(cfg.Mail); err != nil {
+		// 端口被占用或没有权限监听 25 端口时其他功能照常使用
+		log.Printf("Email printing unavailable: %v", err)
+	}
 	r := router.SetupRouter()
 
 	server := &http.Server{
-		Addr:    "0.0.0.0:80",
+		Addr:    cfg.Addr,
 		Handler: r,
 	}
 
-	interruptServer(server)
+	done := interruptServer(server)
 	// 当前监听的地址
 	log.Printf("Server is listening on %s\n", server.Addr)
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server failed: %v", err)
 	}
+	// ListenAndServe 在 Shutdown 开始时就会返回, 等待队列等后台任务停止后再退出
+	<-done
 }
@@ -33,18 +33,76 @@ func SetupRouter() *gin.Engine {
 
 	// 打印路由
 	r.POST("/print", handler.HandlePrint)
+	// 合并打印路由
+	r.POST("/print/batch", handler.HandlePrintBatch)
+	// 从URL下载文档打印
+	r.POST("/print/url", handler.HandlePrintURL)
+	// 打印机状态路由
+	r.GET("/print/status", handler.HandlePrinterStatus)
+	r.GET("/print/capabilities", handler.HandlePrintCapabilities)
 	// 预打印路由
 	r.POST("/preopen", handler.HandlePreOpenFile)
 
+	// 打印任务路由
+	jobs := r.Group("/jobs")
+	{
+		jobs.GET("", handler.ListJobs)                                          // 获取任务列表
+		jobs.POST("/release", handler.ReleaseUserJobs)                          // 释放用户的保留任务
+		jobs.GET("/:id", handler.GetJob)                                        // 获取任务详情
+		jobs.DELETE("/:id", handler.CancelJob)                                  // 取消任务
+		jobs.POST("/:id/retry", handler.RetryJob)                               // 重试任务
+		jobs.POST("/:id/release", handler.ReleaseJob)                           // 释放保留任务
+		jobs.PUT("/:id/priority", handler.RequireAdmin, handler.SetJobPriority) // 调整优先级, 需要管理员令牌
+	}
+
 	// 文件相关路由
 	files := r.Group("/files")
 	{
-		files.GET("", handler.ListFiles)               // 获取文件列表
-		files.POST("", handler.UploadFile)             // 上传文件
-		files.GET("/:filename", handler.DownloadFile)  // 下载文件
-		files.DELETE("/:filename", handler.DeleteFile) // 删除文件
+		files.GET("", handler.ListFiles)                     // 获取文件列表
+		files.POST("", handler.UploadFile)                   // 上传文件
+		files.GET("/:filename", handler.DownloadFile)        // 下载文件
+		files.GET("/:filename/preview", handler.PreviewFile) // 页面预览
+		files.DELETE("/:filename", handler.DeleteFile)       // 删除文件
 	}
 
+	// 打印机管理路由, 登记、修改和删除打印机需要管理员令牌
+	printerGroup := r.Group("/api/printers")
+	{
+		printerGroup.GET("", handler.ListPrinters)                                               // 获取打印机列表
+		printerGroup.POST("", handler.RequireAdmin, handler.AddPrinter)                          // 登记打印机
+		printerGroup.GET("/:name", handler.GetPrinter)                                           // 获取打印机
+		printerGroup.PUT("/:name", handler.RequireAdmin, handler.UpdatePrinter)                  // 修改打印机
+		printerGroup.DELETE("/:name", handler.RequireAdmin, handler.DeletePrinter)               // 删除打印机
+		printerGroup.GET("/:name/capabilities", handler.GetPrinterCapabilities)                  // 打印机能力
+		printerGroup.GET("/:name/status", handler.GetPrinterHealth)                              // 打印机状态
+		printerGroup.GET("/status", handler.ListPrinterHealth)                                   // 全部打印机状态
+		printerGroup.GET("/discovered", handler.ListDiscoveredPrinters)                          // 发现的打印机
+		printerGroup.POST("/discovered/:id", handler.RequireAdmin, handler.AddDiscoveredPrinter) // 添加发现的打印机
+	}
+
+	// 打印池路由, 添加、修改和删除打印池需要管理员令牌
+	poolGroup := r.Group("/api/pools")
+	{
+		poolGroup.GET("", handler.ListPools)                                 // 获取打印池列表
+		poolGroup.POST("", handler.RequireAdmin, handler.AddPool)            // 添加打印池
+		poolGroup.GET("/:name", handler.GetPool)                             // 获取打印池
+		poolGroup.PUT("/:name", handler.RequireAdmin, handler.UpdatePool)    // 修改打印池
+		poolGroup.DELETE("/:name", handler.RequireAdmin, handler.DeletePool) // 删除打印池
+	}
+
+	// 用量报表路由, 需要管理员令牌
+	usage := r.Group("/api/usage", handler.RequireAdmin)
+	{
+		usage.GET("/records", handler.ListUsageRecords)  // 每个任务的用量
+		usage.GET("/users", handler.ListUserUsage)       // 按用户汇总
+		usage.GET("/users/:user", handler.GetUserQuota)  // 用户配额
+		usage.GET("/printers", handler.ListPrinterUsage) // 按打印机汇总
+	}
+
+	// IPP打印路由, 电脑和手机可将本服务添加为 IPP 打印机
+	r.POST("/ipp/print", handler.HandleIPP)
+	r.POST("/ipp/print/:job", handler.HandleIPP)
+
 	// WebSocket路由
 	r.GET("/websockify", func(c *gin.Context) {
 		handler.HandleWebsockifyHTTP(c.Writer, c.Request)
@@ -0,0 +1,376 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"printer/services/pdf"
+)
+
+// ErrQuotaExceeded 用户打印的页数超出配额
+var ErrQuotaExceeded = errors.New("超出打印配额")
+
+// Quota 页数配额, 按打印面数 (页数 × 份数) 计算, 0 表示不限制
+type Quota struct {
+	DailyPages   int `json:"daily_pages"`
+	MonthlyPages int `json:"monthly_pages"`
+}
+
+// Pricing 计费单价
+type Pricing struct {
+	// 每面黑白
+	MonoPage float64
+	// 每面彩色
+	ColorPage float64
+	// 每张纸
+	Sheet float64
+}
+
+// AccountingPolicy 配额和计费设置
+type AccountingPolicy struct {
+	// 默认配额
+	Quota Quota
+	// 单独设置配额的用户
+	UserQuotas map[string]Quota
+	Pricing    Pricing
+	// 用量记录的保留时长, 0 表示一直保留
+	Retention time.Duration
+}
+
+// UsageRecord 一个已完成任务的用量
+type UsageRecord struct {
+	JobID   string `json:"job_id"`
+	User    string `json:"user,omitempty"`
+	Printer string `json:"printer,omitempty"`
+	// 实际打印的打印机, 目标为打印池时是分配到的成员
+	Device string    `json:"device,omitempty"`
+	Time   time.Time `json:"time"`
+	// 每份的页数, 拼版和分隔页按实际交给打印机的页面计算
+	Pages  int  `json:"pages"`
+	Copies int  `json:"copies"`
+	Color  bool `json:"color"`
+	Duplex bool `json:"duplex"`
+	// 打印面数, 即 页数 × 份数, 配额按此计算
+	TotalPages int `json:"total_pages"`
+	// 用纸张数
+	Sheets int     `json:"sheets"`
+	Cost   float64 `json:"cost"`
+}
+
+// UsageSummary 按用户或打印机汇总的用量
+type UsageSummary struct {
+	Key        string  `json:"key"`
+	Jobs       int     `json:"jobs"`
+	TotalPages int     `json:"total_pages"`
+	ColorPages int     `json:"color_pages"`
+	MonoPages  int     `json:"mono_pages"`
+	Sheets     int     `json:"sheets"`
+	Cost       float64 `json:"cost"`
+}
+
+// QuotaStatus 用户的配额和已用页数
+type QuotaStatus struct {
+	User  string `json:"user"`
+	Quota Quota  `json:"quota"`
+	// 今天和本月已打印的面数
+	DailyUsed   int `json:"daily_used"`
+	MonthlyUsed int `json:"monthly_used"`
+	// 已接受但还未打印的面数
+	Pending int `json:"pending"`
+}
+
+// Accounting 记录每个任务的用量并计算配额, 保存在 path 指定的文件中
+type Accounting struct {
+	path   string
+	policy AccountingPolicy
+
+	mu      sync.Mutex
+	records []UsageRecord
+}
+
+// NewAccounting 创建用量记录并从 path 恢复历史记录
+func NewAccounting(path string, policy AccountingPolicy) (*Accounting, error) {
+	a := &Accounting{path: path, policy: policy}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &a.records); err != nil {
+		return nil, fmt.Errorf("解析用量记录失败: %v", err)
+	}
+	return a, nil
+}
+
+// save 将全部记录写入文件, 调用方需持有 a.mu
+func (a *Accounting) save() {
+	if a.policy.Retention > 0 {
+		deadline := time.Now().Add(-a.policy.Retention)
+		kept := a.records[:0]
+		for _, r := range a.records {
+			if r.Time.After(deadline) {
+				kept = append(kept, r)
+			}
+		}
+		a.records = kept
+	}
+
+	data, err := json.Marshal(a.records)
+	if err != nil {
+		log.Printf("序列化用量记录失败: %v", err)
+		return
+	}
+	if err := writeFileAtomic(a.path, data); err != nil {
+		log.Printf("保存用量记录失败: %v", err)
+	}
+}
+
+// QuotaFor 返回用户的配额, 单独设置过的用户使用自己的配额
+func (a *Accounting) QuotaFor(user string) Quota {
+	if q, ok := a.policy.UserQuotas[user]; ok {
+		return q
+	}
+	return a.policy.Quota
+}
+
+// newRecord 按最终交给打印机的页数和选项计算任务的用量, 未指定颜色时按黑白计
+func (a *Accounting) newRecord(job Job, pages int, opts PrintOptions, now time.Time) UsageRecord {
+	copies := opts.CopyCount()
+	r := UsageRecord{
+		JobID:   job.ID,
+		User:    job.User,
+		Printer: job.Printer,
+		Device:  job.Device,
+		Time:    now,
+		Pages:   pages,
+		Copies:  copies,
+		Color:   opts.Color == ColorColor,
+		Duplex:  opts.Duplex == DuplexLongEdge || opts.Duplex == DuplexShortEdge,
+	}
+	r.TotalPages = pages * copies
+	r.Sheets = r.TotalPages
+	if r.Duplex {
+		r.Sheets = (pages + 1) / 2 * copies
+	}
+	price := a.policy.Pricing.MonoPage
+	if r.Color {
+		price = a.policy.Pricing.ColorPage
+	}
+	cost := float64(r.TotalPages)*price + float64(r.Sheets)*a.policy.Pricing.Sheet
+	r.Cost = math.Round(cost*10000) / 10000
+	return r
+}
+
+// Record 保存一条用量记录
+func (a *Accounting) Record(r UsageRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records = append(a.records, r)
+	a.save()
+}
+
+// Usage 返回用户在 t 所在的日和月已打印的面数
+func (a *Accounting) Usage(user string, t time.Time) (int, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	t = t.Local()
+	y, m, d := t.Date()
+	var day, month int
+	for _, r := range a.records {
+		if r.User != user {
+			continue
+		}
+		ry, rm, rd := r.Time.Local().Date()
+		if ry == y && rm == m {
+			month += r.TotalPages
+			if rd == d {
+				day += r.TotalPages
+			}
+		}
+	}
+	return day, month
+}
+
+// Records 返回 [from, to) 之间的记录, 按时间排序
+func (a *Accounting) Records(from, to time.Time) []UsageRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var records []UsageRecord
+	for _, r := range a.records {
+		if !r.Time.Before(from) && r.Time.Before(to) {
+			records = append(records, r)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	return records
+}
+
+// SummarizeUsage 按 key 分组汇总用量, 结果按 key 排序
+func SummarizeUsage(records []UsageRecord, key func(UsageRecord) string) []UsageSummary {
+	groups := make(map[string]*UsageSummary)
+	for _, r := range records {
+		k := key(r)
+		s, ok := groups[k]
+		if !ok {
+			s = &UsageSummary{Key: k}
+			groups[k] = s
+		}
+		s.Jobs++
+		s.TotalPages += r.TotalPages
+		if r.Color {
+			s.ColorPages += r.TotalPages
+		} else {
+			s.MonoPages += r.TotalPages
+		}
+		s.Sheets += r.Sheets
+		s.Cost += r.Cost
+	}
+
+	summaries := make([]UsageSummary, 0, len(groups))
+	for _, s := range groups {
+		s.Cost = math.Round(s.Cost*10000) / 10000
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Key < summaries[j].Key
+	})
+	return summaries
+}
+
+// checkQuota 检查用户再打印 pages 面后是否超出配额, pending 为已接受但还未打印的面数
+func (a *Accounting) checkQuota(user string, pending, pages int, now time.Time) error {
+	quota := a.QuotaFor(user)
+	if quota.DailyPages <= 0 && quota.MonthlyPages <= 0 {
+		return nil
+	}
+	day, month := a.Usage(user, now)
+	if quota.DailyPages > 0 && day+pending+pages > quota.DailyPages {
+		return fmt.Errorf("%w: 今日已打印 %d 页, 待打印 %d 页, 本任务 %d 页, 每日上限 %d 页",
+			ErrQuotaExceeded, day, pending, pages, quota.DailyPages)
+	}
+	if quota.MonthlyPages > 0 && month+pending+pages > quota.MonthlyPages {
+		return fmt.Errorf("%w: 本月已打印 %d 页, 待打印 %d 页, 本任务 %d 页, 每月上限 %d 页",
+			ErrQuotaExceeded, month, pending, pages, quota.MonthlyPages)
+	}
+	return nil
+}
+
+// estimatePages 在打印前估算任务每份的页数: PDF 按页码范围、拼版和分隔页计算,
+// 其他格式在转换前无法得知页数, 每个文件按 1 页计
+func estimatePages(dir string, job Job) int {
+	files := job.Files
+	if len(files) == 0 {
+		files = []BatchFile{{Filename: job.Filename}}
+	}
+	pages := 0
+	for _, f := range files {
+		pages += countPDFPages(filepath.Join(dir, f.Filename), f.PageRanges)
+	}
+
+	opts := job.Options
+	pages = selectedPages(opts.Ranges(), pages)
+
+	duplex := opts.Duplex == DuplexLongEdge || opts.Duplex == DuplexShortEdge
+	switch {
+	case opts.NumberUp > 1:
+		pages = (pages + opts.NumberUp - 1) / opts.NumberUp
+	case opts.IsBooklet():
+		// 每张纸正反两面, 每面两页
+		pages = (pages + 3) / 4 * 2
+		duplex = true
+	case opts.Poster != "":
+		cols, rows, _ := ParsePoster(opts.Poster)
+		pages *= cols * rows
+	}
+
+	// 双面打印时分隔页单独占一张纸
+	banner := 1
+	if duplex {
+		banner = 2
+	}
+	switch opts.Banner {
+	case BannerStart, BannerEnd:
+		pages += banner
+	case BannerBoth:
+		pages += 2 * banner
+	}
+	return max(pages, 1)
+}
+
+// countPDFPages 返回 PDF 按页码范围选出的页数, 不是 PDF 或无法读取时按 1 页计
+func countPDFPages(path, pageRanges string) int {
+	if !strings.EqualFold(filepath.Ext(path), ".pdf") {
+		return 1
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 1
+	}
+	info, err := pdf.Inspect(data)
+	if err != nil || info.Pages == 0 {
+		return 1
+	}
+	ranges, _ := ParsePageRanges(pageRanges)
+	return selectedPages(ranges, info.Pages)
+}
+
+// selectedPages 返回共 total 页的文档中页码范围选出的页数, 范围无效时返回 total
+func selectedPages(ranges []PageRange, total int) int {
+	resolved, err := ResolvePageRanges(ranges, total)
+	if err != nil {
+		return total
+	}
+	pages := 0
+	for _, r := range resolved {
+		pages += r.Last - r.First + 1
+	}
+	return pages
+}
+
+// printedDoc 打印流程最终交给后端的文档, 由 process 填写后用于计费
+type printedDoc struct {
+	// 每份的页数, 后端直接打印非 PDF 文件时为 0
+	pages int
+	opts  PrintOptions
+}
+
+type printedDocKey struct{}
+
+// withPrintedDoc 返回会记录最终文档页数的 context
+func withPrintedDoc(ctx context.Context) (context.Context, *printedDoc) {
+	doc := &printedDoc{}
+	return context.WithValue(ctx, printedDocKey{}, doc), doc
+}
+
+// reportPrinted 在 context 需要时记录交给后端的文档页数和选项
+func reportPrinted(ctx context.Context, path string, opts PrintOptions) {
+	doc, ok := ctx.Value(printedDocKey{}).(*printedDoc)
+	if !ok {
+		return
+	}
+	doc.opts = opts
+	if strings.EqualFold(filepath.Ext(path), ".pdf") {
+		if _, pages, err := readPages(path, opts); err == nil {
+			doc.pages = len(pages)
+		}
+	}
+}
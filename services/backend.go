@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Capabilities 描述打印后端支持的能力
+type Capabilities struct {
+	// PrintFormats 可直接打印的文件扩展名, 如 ".pdf"
+	PrintFormats []string `json:"print_formats"`
+	// OpenFormats 可在本机打开编辑的文件扩展名, 为空表示不支持打开
+	OpenFormats []string `json:"open_formats"`
+
+	// MaxCopies 最多打印份数, 0 或 1 表示不支持多份
+	MaxCopies int `json:"max_copies"`
+	// PageRanges 是否支持指定页码范围
+	PageRanges bool `json:"page_ranges"`
+	// Duplex 是否支持双面打印
+	Duplex bool `json:"duplex"`
+	// Orientation 是否支持横向打印
+	Orientation bool `json:"orientation"`
+	// Media 可选择的纸张
+	Media []string `json:"media"`
+	// Color 是否支持选择彩色或黑白
+	Color bool `json:"color"`
+	// Collate 是否支持设置逐份打印
+	Collate bool `json:"collate"`
+}
+
+// CanPrint 判断后端是否能直接打印该扩展名的文件
+func (c Capabilities) CanPrint(ext string) bool {
+	return containsExt(c.PrintFormats, ext)
+}
+
+// CanOpen 判断后端是否能打开该扩展名的文件
+func (c Capabilities) CanOpen(ext string) bool {
+	return containsExt(c.OpenFormats, ext)
+}
+
+func containsExt(formats []string, ext string) bool {
+	ext = strings.ToLower(ext)
+	for _, f := range formats {
+		if f == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintBackend 打印后端接口, 每种打印方式(COM自动化、IPP等)各自实现
+type PrintBackend interface {
+	// Print 按选项打印指定的文件, filePath 为绝对路径.
+	// 调用前 PrintService 已通过 Capabilities().Check 检查过选项
+	Print(ctx context.Context, filePath string, opts PrintOptions) error
+	// Open 在本机打开指定的文件以便编辑
+	Open(ctx context.Context, filePath string) error
+	// Capabilities 返回后端支持的能力
+	Capabilities() Capabilities
+}
+
+// PrinterStatus 打印机状态
+type PrinterStatus struct {
+	// idle, processing, stopped
+	State string `json:"state"`
+	// 如 media-empty, toner-low, 参见 printer-state-reasons
+	Reasons []string `json:"reasons"`
+	Message string   `json:"message,omitempty"`
+	// 耗材余量
+	Supplies []Supply `json:"supplies,omitempty"`
+	// 纸盒余量
+	Trays []InputTray `json:"trays,omitempty"`
+}
+
+// StatusReporter 能查询打印机状态的后端实现此接口
+type StatusReporter interface {
+	PrinterStatus(ctx context.Context) (PrinterStatus, error)
+}
+
+// BackendConfig 创建打印后端时使用的配置
+type BackendConfig struct {
+	// 后端地址, 含义由具体后端决定
+	URI string `json:"uri,omitempty"`
+	// 后端的其他设置
+	Settings map[string]string `json:"settings,omitempty"`
+}
+
+// Setting 读取字符串设置, 未设置时返回 def
+func (c BackendConfig) Setting(key, def string) string {
+	if v, ok := c.Settings[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// DurationSetting 读取时长设置, 如 "30s"
+func (c BackendConfig) DurationSetting(key string, def time.Duration) (time.Duration, error) {
+	v := c.Setting(key, "")
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("设置 %s 无效: %v", key, err)
+	}
+	return d, nil
+}
+
+// BoolSetting 读取布尔设置
+func (c BackendConfig) BoolSetting(key string, def bool) (bool, error) {
+	v := c.Setting(key, "")
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("设置 %s 无效: %v", key, err)
+	}
+	return b, nil
+}
+
+// ListSetting 读取逗号分隔的列表设置
+func (c BackendConfig) ListSetting(key string, def []string) []string {
+	v := c.Setting(key, "")
+	if v == "" {
+		return def
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// BackendFactory 根据配置创建打印后端
+type BackendFactory func(cfg BackendConfig) (PrintBackend, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]BackendFactory)
+)
+
+// RegisterBackend 注册打印后端, 通常在各后端文件的 init 中调用
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if factory == nil {
+		panic("services: RegisterBackend factory is nil")
+	}
+	if _, dup := backends[name]; dup {
+		panic("services: RegisterBackend called twice for backend " + name)
+	}
+	backends[name] = factory
+}
+
+// NewBackend 根据名称创建已注册的打印后端
+func NewBackend(name string, cfg BackendConfig) (PrintBackend, error) {
+	backendsMu.RLock()
+	factory, ok := backends[name]
+	backendsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("未知的打印后端: %s", name)
+	}
+	return factory(cfg)
+}
+
+// Backends 返回已注册的后端名称
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
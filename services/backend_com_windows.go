@@ -0,0 +1,327 @@
+//go:build windows
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-ole/go-ole"
+	"github.com/go-ole/go-ole/oleutil"
+
+	"printer/services/pdf"
+)
+
+func init() {
+	RegisterBackend("com", func(cfg BackendConfig) (PrintBackend, error) {
+		return &comBackend{}, nil
+	})
+}
+
+// comBackend 通过COM自动化调用WPS和Acrobat完成打印
+type comBackend struct{}
+
+// Capabilities 返回COM后端支持的文件类型
+func (b *comBackend) Capabilities() Capabilities {
+	// 双面、纸张和颜色由打印机驱动的默认设置决定, COM接口无法逐任务指定
+	return Capabilities{
+		PrintFormats: []string{".doc", ".docx", ".pdf"},
+		OpenFormats:  []string{".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".pdf"},
+		MaxCopies:    999,
+		PageRanges:   true,
+		Collate:      true,
+	}
+}
+
+// Open 通过软件打开文件
+func (b *comBackend) Open(ctx context.Context, filePath string) error {
+	// 获取文件扩展名
+	ext := strings.ToLower(filepath.Ext(filePath))
+
+	// 初始化COM
+	err := ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED)
+	if err != nil {
+		return fmt.Errorf("COM初始化失败: %v", err)
+	}
+	defer ole.CoUninitialize()
+
+	// 根据文件类型选择打开方式
+	switch ext {
+	case ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx":
+		return b.openOffice(filePath)
+	case ".pdf":
+		return b.openPDF(filePath)
+	default:
+		return fmt.Errorf("不支持的文件类型: %s", ext)
+	}
+}
+
+// Print 处理文件打印, COM调用开始后无法中断, 只在开始前检查是否已取消
+func (b *comBackend) Print(ctx context.Context, filePath string, opts PrintOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// 获取文件扩展名
+	ext := strings.ToLower(filepath.Ext(filePath))
+
+	// 初始化COM
+	err := ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED)
+	if err != nil {
+		return fmt.Errorf("COM初始化失败: %v", err)
+	}
+	defer ole.CoUninitialize()
+
+	// 根据文件类型选择打印方式
+	switch ext {
+	case ".doc", ".docx":
+		return b.printWord(filePath, opts)
+	case ".pdf":
+		return b.printPDF(filePath, opts)
+	default:
+		return fmt.Errorf("不支持的文件类型: %s", ext)
+	}
+}
+
+// openOffice 打开Office文档
+func (b *comBackend) openOffice(filePath string) error {
+	// 根据文件扩展名选择应用程序
+	ext := strings.ToLower(filepath.Ext(filePath))
+	var appProgID, collection string
+	switch ext {
+	case ".doc", ".docx":
+		appProgID, collection = "kwps.Application", "Documents" // Word
+	case ".xls", ".xlsx":
+		appProgID, collection = "ket.Application", "WorkBooks" // Excel
+	case ".ppt", ".pptx":
+		appProgID, collection = "kwpp.Application", "Presentations" // PPT
+	default:
+		return fmt.Errorf("不支持的文件类型: %s", ext)
+	}
+
+	// 创建应用实例
+	unknown, err := oleutil.CreateObject(appProgID)
+	if err != nil {
+		return fmt.Errorf("创建应用实例失败: %v", err)
+	}
+	defer unknown.Release()
+
+	app, err := unknown.QueryInterface(ole.IID_IDispatch)
+	if err != nil {
+		return fmt.Errorf("获取应用接口失败: %v", err)
+	}
+	defer app.Release()
+
+	// 打开文件
+	doc, err := openDocument(app, collection, filePath)
+	if err != nil {
+		return err
+	}
+	defer doc.Release()
+
+	// 设置应用可见
+	if _, err := oleutil.PutProperty(app, "Visible", true); err != nil {
+		return fmt.Errorf("显示应用失败: %v", err)
+	}
+
+	return nil
+}
+
+// openDocument 通过应用的文档集合 (如 Documents) 打开文件, 返回文档对象
+func openDocument(app *ole.IDispatch, collection, filePath string) (*ole.IDispatch, error) {
+	docs, err := oleutil.GetProperty(app, collection)
+	if err != nil {
+		return nil, fmt.Errorf("获取%s失败: %v", collection, err)
+	}
+	defer docs.Clear()
+
+	doc, err := oleutil.CallMethod(docs.ToIDispatch(), "Open", filePath)
+	if err != nil {
+		return nil, fmt.Errorf("打开文档失败: %v", err)
+	}
+	return doc.ToIDispatch(), nil
+}
+
+// openPDF 打开PDF文档
+func (b *comBackend) openPDF(filePath string) error {
+	// 创建PDF应用实例
+	unknown, err := oleutil.CreateObject("AcroExch.App")
+	if err != nil {
+		return fmt.Errorf("创建PDF应用实例失败: %v", err)
+	}
+	defer unknown.Release()
+
+	app, err := unknown.QueryInterface(ole.IID_IDispatch)
+	if err != nil {
+		return fmt.Errorf("获取PDF接口失败: %v", err)
+	}
+	defer app.Release()
+
+	// 创建PDF文档实例
+	unknownDoc, err := oleutil.CreateObject("AcroExch.AVDoc")
+	if err != nil {
+		return fmt.Errorf("创建PDF文档实例失败: %v", err)
+	}
+	defer unknownDoc.Release()
+	avDoc, err := unknownDoc.QueryInterface(ole.IID_IDispatch)
+	if err != nil {
+		return fmt.Errorf("获取PDF文档接口失败: %v", err)
+	}
+	defer avDoc.Release()
+
+	// 打开PDF文档, 文档留在 Acrobat 中供用户查看, 不关闭
+	_, err = oleutil.CallMethod(avDoc, "Open", filePath, "")
+	if err != nil {
+		return fmt.Errorf("打开PDF文档失败: %v", err)
+	}
+
+	// 打开PDF应用
+	_, err = oleutil.CallMethod(app, "Show")
+	if err != nil {
+		return fmt.Errorf("打开PDF应用失败: %v", err)
+	}
+
+	return nil
+}
+
+// printWord 打印Word文档
+func (b *comBackend) printWord(filePath string, opts PrintOptions) error {
+	// 创建Word应用实例
+	unknown, err := oleutil.CreateObject("kwps.Application")
+	if err != nil {
+		return fmt.Errorf("创建Word应用实例失败: %v", err)
+	}
+	defer unknown.Release()
+
+	word, err := unknown.QueryInterface(ole.IID_IDispatch)
+	if err != nil {
+		return fmt.Errorf("获取Word接口失败: %v", err)
+	}
+	defer word.Release()
+
+	// 打开文档
+	doc, err := openDocument(word, "Documents", filePath)
+	if err != nil {
+		return err
+	}
+	defer doc.Release()
+
+	// 打印文档
+	// PrintOut(Background, Append, Range, OutputFileName, From, To, Item, Copies, Pages, PageType, PrintToFile, Collate)
+	printRange := 0 // wdPrintAllDocument
+	if opts.PageRanges != "" {
+		printRange = 4 // wdPrintRangeOfPages
+	}
+	_, err = oleutil.CallMethod(doc, "PrintOut", false, false, printRange, "", "", "", 0,
+		opts.CopyCount(), opts.PageRanges, 0, false, opts.Collated())
+	if err != nil {
+		return fmt.Errorf("打印文档失败: %v", err)
+	}
+
+	// 关闭文档
+	_, err = oleutil.CallMethod(doc, "Close")
+	if err != nil {
+		return fmt.Errorf("关闭文档失败: %v", err)
+	}
+
+	// 退出Word应用
+	_, err = oleutil.CallMethod(word, "Quit")
+	if err != nil {
+		return fmt.Errorf("退出Word应用失败: %v", err)
+	}
+
+	return nil
+}
+
+// printPDF 打印PDF文档
+func (b *comBackend) printPDF(filePath string, opts PrintOptions) error {
+	// 优先在本地读取页数, 读取失败时打开文档后由 Acrobat 获取
+	pages, _ := pdfPageCount(filePath)
+
+	// 创建PDF文档实例
+	unknown, err := oleutil.CreateObject("AcroExch.AVDoc")
+	if err != nil {
+		return fmt.Errorf("创建PDF应用实例失败: %v", err)
+	}
+	defer unknown.Release()
+
+	avDoc, err := unknown.QueryInterface(ole.IID_IDispatch)
+	if err != nil {
+		return fmt.Errorf("获取PDF接口失败: %v", err)
+	}
+	defer avDoc.Release()
+
+	// 打开PDF文档, 出错返回时也要关闭, 否则文档一直留在 Acrobat 中
+	_, err = oleutil.CallMethod(avDoc, "Open", filePath, "")
+	if err != nil {
+		return fmt.Errorf("打开PDF文档失败: %v", err)
+	}
+	defer oleutil.CallMethod(avDoc, "Close", true)
+
+	if pages == 0 {
+		pdDoc, err := oleutil.CallMethod(avDoc, "GetPDDoc")
+		if err != nil {
+			return fmt.Errorf("获取PDF文档失败: %v", err)
+		}
+		defer pdDoc.Clear()
+		numPages, err := oleutil.CallMethod(pdDoc.ToIDispatch(), "GetNumPages")
+		if err != nil {
+			return fmt.Errorf("获取PDF页数失败: %v", err)
+		}
+		pages = int(numPages.Val)
+	}
+
+	ranges, err := ResolvePageRanges(opts.Ranges(), pages)
+	if err != nil {
+		return err
+	}
+
+	// PrintPages(nFirstPage, nLastPage, nPSLevel, bBinaryOk, bShrinkToFit) 页码从0开始,
+	// 每次调用只能打印一个范围一份, 多份和多个范围需要多次调用
+	printPages := func(first, last int) error {
+		_, err := oleutil.CallMethod(avDoc, "PrintPages", first-1, last-1, 2, 1, 1)
+		if err != nil {
+			return fmt.Errorf("打印PDF文档失败: %v", err)
+		}
+		return nil
+	}
+	if opts.Collated() {
+		for i := 0; i < opts.CopyCount(); i++ {
+			for _, r := range ranges {
+				if err := printPages(r.First, r.Last); err != nil {
+					return err
+				}
+			}
+		}
+	} else {
+		for _, r := range ranges {
+			for page := r.First; page <= r.Last; page++ {
+				for i := 0; i < opts.CopyCount(); i++ {
+					if err := printPages(page, page); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// pdfPageCount 不借助外部程序读取 PDF 的页数
+func pdfPageCount(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	info, err := pdf.Inspect(data)
+	if err != nil {
+		return 0, err
+	}
+	if info.Pages == 0 || info.NeedsPassword {
+		return 0, fmt.Errorf("无法读取PDF页数")
+	}
+	return info.Pages, nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterBackend("fake", func(cfg BackendConfig) (PrintBackend, error) {
+		return NewFakeBackend(), nil
+	})
+}
+
+// FakeBackend 不连接任何打印机的后端, 只记录收到的请求, 用于测试
+type FakeBackend struct {
+	mu      sync.Mutex
+	caps    Capabilities
+	err     error
+	delay   time.Duration
+	printed []string
+	options []PrintOptions
+	opened  []string
+}
+
+// NewFakeBackend 创建一个 FakeBackend, 默认接受常见文档格式
+func NewFakeBackend() *FakeBackend {
+	formats := []string{".pdf", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx"}
+	return &FakeBackend{
+		caps: Capabilities{
+			PrintFormats: formats,
+			OpenFormats:  formats,
+			MaxCopies:    999,
+			PageRanges:   true,
+			Duplex:       true,
+			Orientation:  true,
+			Media:        allMedia(),
+			Color:        true,
+			Collate:      true,
+		},
+	}
+}
+
+// SetCapabilities 设置后端报告的能力
+func (f *FakeBackend) SetCapabilities(caps Capabilities) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.caps = caps
+}
+
+// SetError 设置之后每次 Print/Open 返回的错误
+func (f *FakeBackend) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// SetDelay 设置每次打印耗时, 用于模拟耗时较长的打印并测试取消
+func (f *FakeBackend) SetDelay(delay time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.delay = delay
+}
+
+// Printed 返回已打印的文件路径
+func (f *FakeBackend) Printed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.printed...)
+}
+
+// PrintedOptions 返回每次打印使用的选项, 与 Printed 一一对应
+func (f *FakeBackend) PrintedOptions() []PrintOptions {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]PrintOptions(nil), f.options...)
+}
+
+// Opened 返回已打开的文件路径
+func (f *FakeBackend) Opened() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.opened...)
+}
+
+// Print 记录打印请求, ctx 取消时提前返回
+func (f *FakeBackend) Print(ctx context.Context, filePath string, opts PrintOptions) error {
+	f.mu.Lock()
+	delay := f.delay
+	f.mu.Unlock()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.printed = append(f.printed, filePath)
+	f.options = append(f.options, opts)
+	return nil
+}
+
+// Open 记录打开请求
+func (f *FakeBackend) Open(ctx context.Context, filePath string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.opened = append(f.opened, filePath)
+	return nil
+}
+
+// Capabilities 返回后端能力
+func (f *FakeBackend) Capabilities() Capabilities {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.caps
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"printer/services/pdf"
+)
+
+func init() {
+	RegisterBackend("file", newFileBackend)
+}
+
+// fileBackend 不连接打印机, 将打印流程最终交给后端的文档 (转换、拼版、水印之后)
+// 连同任务清单保存到输出目录, 用于归档, 以及在没有打印机的环境中检查整个打印流程的结果
+//
+// uri 为输出目录, 如 file:///var/spool/printer 或 output/pdf.
+// 队列中的任务保存为 <任务ID>.pdf 和 <任务ID>.json, 重试时覆盖;
+// 直接打印 (不经过队列) 时以时间和文件名命名.
+// PDF 按页码范围选出页面后保存, 份数、双面、纸张等打印机设置只记录在清单中
+//
+// 支持的设置:
+//   - formats: 可直接保存的扩展名, 默认 .pdf, 其他格式先转换为 PDF. 只能是 .pdf、.ps 等打印文档的扩展名
+//
+// 通过打印机管理接口登记的 file 打印机, 输出目录必须位于 SetFileRoot 设置的根目录中
+type fileBackend struct {
+	dir     string
+	formats []string
+}
+
+func newFileBackend(cfg BackendConfig) (PrintBackend, error) {
+	dir := strings.TrimPrefix(cfg.URI, "file://")
+	if dir == "" {
+		return nil, errors.New("file后端需要配置输出目录, 如 file:///var/spool/printer")
+	}
+	formats := cfg.ListSetting("formats", []string{".pdf"})
+	for _, ext := range formats {
+		if _, ok := documentFormats[strings.ToLower(ext)]; !ok {
+			return nil, fmt.Errorf("file后端不支持保存 %s 文件", ext)
+		}
+	}
+	return &fileBackend{
+		dir:     filepath.FromSlash(dir),
+		formats: formats,
+	}, nil
+}
+
+// fileRoot 登记的 file 打印机允许的输出根目录, 启动时由 SetFileRoot 设置
+var fileRoot string
+
+// SetFileRoot 设置登记的 file 打印机允许的输出根目录, 为空时不能登记 file 打印机.
+// 服务配置中指定的默认后端不受限制
+func SetFileRoot(dir string) {
+	fileRoot = dir
+}
+
+// checkFileRoot 检查 file 打印机的输出目录位于根目录中, 按已存在的上级目录解析符号链接
+func checkFileRoot(uri string) error {
+	if fileRoot == "" {
+		return errors.New("服务配置中未设置 print.file_root, 不能登记 file 打印机")
+	}
+	root, err := resolvePath(fileRoot)
+	if err != nil {
+		return fmt.Errorf("输出根目录无效: %v", err)
+	}
+	dir, err := resolvePath(filepath.FromSlash(strings.TrimPrefix(uri, "file://")))
+	if err != nil {
+		return fmt.Errorf("输出目录无效: %v", err)
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return fmt.Errorf("输出目录必须位于 %s 中", fileRoot)
+	}
+	return nil
+}
+
+// resolvePath 返回绝对路径, 其中已存在的部分解析符号链接
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var rest []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(append([]string{path}, rest...)...), nil
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+}
+
+// fileManifest 与输出文档同名的任务清单
+type fileManifest struct {
+	JobID   string `json:"job_id,omitempty"`
+	User    string `json:"user,omitempty"`
+	Printer string `json:"printer,omitempty"`
+	// 提交的文件, 批量打印时为全部文件
+	Sources []string `json:"sources,omitempty"`
+	// 保存的文档, 与清单位于同一目录
+	Output string `json:"output"`
+	Format string `json:"format"`
+	// 每份的页数, 非 PDF 文档为 0
+	Pages  int    `json:"pages,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// 交给后端的打印选项, 拼版、水印和页码范围已体现在文档中
+	Options     PrintOptions `json:"options"`
+	SubmittedAt *time.Time   `json:"submitted_at,omitempty"`
+	PrintedAt   time.Time    `json:"printed_at"`
+}
+
+// Capabilities 文档只是保存下来, 打印机设置都可以接受并记录在清单中
+func (b *fileBackend) Capabilities() Capabilities {
+	return Capabilities{
+		PrintFormats: b.formats,
+		MaxCopies:    999,
+		PageRanges:   true,
+		Duplex:       true,
+		Orientation:  true,
+		Media:        allMedia(),
+		Color:        true,
+		Collate:      true,
+	}
+}
+
+// Open file后端没有可以打开文件的程序
+func (b *fileBackend) Open(ctx context.Context, filePath string) error {
+	return errors.New("file后端不支持打开文件")
+}
+
+// Print 将文档和清单写入输出目录, 清单在文档之后写入, 出现清单即表示文档已完整保存
+func (b *fileBackend) Print(ctx context.Context, filePath string, opts PrintOptions) error {
+	if err := os.MkdirAll(b.dir, 0755); err != nil {
+		return fmt.Errorf("创建输出目录失败: %v", err)
+	}
+
+	ext := strings.ToLower(filepath.Ext(filePath))
+	src := filePath
+	if ext == ".pdf" && opts.PageRanges != "" {
+		selected, cleanup, err := MergeFiles(ctx, filepath.Dir(filePath),
+			[]BatchFile{{Filename: filepath.Base(filePath), PageRanges: opts.PageRanges}}, PrintOptions{})
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		src = selected
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("读取文件失败: %v", err)
+	}
+
+	now := time.Now()
+	manifest := fileManifest{
+		Format:    DocumentFormat(filePath),
+		Size:      int64(len(data)),
+		Options:   opts,
+		PrintedAt: now,
+	}
+	name := now.Format("20060102-150405") + "-" + strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	if job, ok := JobFromContext(ctx); ok {
+		name = job.ID
+		manifest.JobID = job.ID
+		manifest.User = job.User
+		manifest.Printer = job.Printer
+		manifest.Sources = []string{job.Filename}
+		if len(job.Files) > 0 {
+			manifest.Sources = manifest.Sources[:0]
+			for _, f := range job.Files {
+				manifest.Sources = append(manifest.Sources, f.Filename)
+			}
+		}
+		manifest.SubmittedAt = &job.CreatedAt
+	}
+	manifest.Output = name + ext
+	if ext == ".pdf" {
+		if info, err := pdf.Inspect(data); err == nil {
+			manifest.Pages = info.Pages
+		}
+	}
+	sum := sha256.Sum256(data)
+	manifest.SHA256 = hex.EncodeToString(sum[:])
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(b.dir, manifest.Output), data); err != nil {
+		return fmt.Errorf("保存文档失败: %v", err)
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(b.dir, name+".json"), manifestData); err != nil {
+		return fmt.Errorf("保存任务清单失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"printer/services/pdf"
+)
+
+// readManifest 读取任务的清单和保存的文档, 检查清单中的大小、校验和与页数
+func readManifest(t *testing.T, dir, id string) (fileManifest, []byte) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m fileManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.JobID != id || m.Output != id+".pdf" || m.Format != "application/pdf" {
+		t.Fatalf("manifest = %+v", m)
+	}
+	doc, err := os.ReadFile(filepath.Join(dir, m.Output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(doc)
+	if m.SHA256 != hex.EncodeToString(sum[:]) || m.Size != int64(len(doc)) {
+		t.Errorf("sha256 = %s, size = %d, 与文档不一致", m.SHA256, m.Size)
+	}
+	info, err := pdf.Inspect(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Pages != m.Pages {
+		t.Errorf("清单页数 %d, 文档页数 %d", m.Pages, info.Pages)
+	}
+	return m, doc
+}
+
+func TestFileBackendPipeline(t *testing.T) {
+	out := t.TempDir()
+	backend, err := NewBackend("file", BackendConfig{URI: out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, dir := newTestQueue(t, backend)
+	// 文本先转换为 PDF, 换页符分隔的 5 页
+	writeTestFile(t, dir, "notes.txt", []byte("第一页\fpage 2\fpage 3\fpage 4\fpage 5\n"))
+	q.Start(1)
+
+	booklet := true
+	tests := []struct {
+		name  string
+		opts  PrintOptions
+		pages int
+		// 交给后端的选项, 拼版和水印已体现在文档中
+		want PrintOptions
+	}{
+		{"plain", PrintOptions{Copies: 2}, 5, PrintOptions{Copies: 2}},
+		{"2-up", PrintOptions{NumberUp: 2}, 3, PrintOptions{}},
+		{"4-up range", PrintOptions{NumberUp: 4, PageRanges: "1-4", PageBorder: BorderSingle}, 1, PrintOptions{}},
+		// 5 页补齐为 8 页, 拼成 2 张纸的正反面, 默认短边翻转
+		{"booklet", PrintOptions{Booklet: &booklet}, 4, PrintOptions{Duplex: DuplexShortEdge}},
+		{"watermark", PrintOptions{Watermark: &Stamp{Text: "{user} {job}"}, Banner: BannerStart}, 6, PrintOptions{}},
+		{"2-up watermark", PrintOptions{NumberUp: 2, Watermark: &Stamp{Text: "机密", Position: StampBottom}}, 3, PrintOptions{}},
+	}
+	for _, tt := range tests {
+		job, err := q.Submit(Job{Filename: "notes.txt", User: "zhangsan", Options: tt.opts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job = waitFinished(t, q, job.ID); job.State != JobDone {
+			t.Fatalf("%s: state = %s, error = %s", tt.name, job.State, job.Error)
+		}
+
+		m, doc := readManifest(t, out, job.ID)
+		if m.Pages != tt.pages {
+			t.Errorf("%s: pages = %d, want %d", tt.name, m.Pages, tt.pages)
+		}
+		if m.User != "zhangsan" || len(m.Sources) != 1 || m.Sources[0] != "notes.txt" {
+			t.Errorf("%s: user = %q, sources = %v", tt.name, m.User, m.Sources)
+		}
+		got, _ := json.Marshal(m.Options)
+		want, _ := json.Marshal(tt.want)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: options = %s, want %s", tt.name, got, want)
+		}
+		// 水印的页面引用了透明度设置
+		if tt.opts.Watermark.Enabled() != bytes.Contains(doc, []byte("/ExtGState")) {
+			t.Errorf("%s: 文档中的透明度设置与水印不符", tt.name)
+		}
+	}
+}
+
+func TestFileBackendBatch(t *testing.T) {
+	out := t.TempDir()
+	backend, err := NewBackend("file", BackendConfig{URI: out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, dir := newTestQueue(t, backend)
+	writeTestFile(t, dir, "a.txt", []byte("a1\fa2\fa3\n"))
+	writeTestFile(t, dir, "b.txt", []byte("b1\fb2\n"))
+	q.Start(1)
+
+	job, err := q.Submit(Job{
+		Filename: "a.txt",
+		Files:    []BatchFile{{Filename: "a.txt", PageRanges: "2-3"}, {Filename: "b.txt"}},
+		Options:  PrintOptions{NumberUp: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job = waitFinished(t, q, job.ID); job.State != JobDone {
+		t.Fatalf("state = %s, error = %s", job.State, job.Error)
+	}
+	m, _ := readManifest(t, out, job.ID)
+	if m.Pages != 2 {
+		t.Errorf("pages = %d, want 2", m.Pages)
+	}
+	if strings.Join(m.Sources, ",") != "a.txt,b.txt" {
+		t.Errorf("sources = %v", m.Sources)
+	}
+}
@@ -0,0 +1,508 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"printer/services/ipp"
+)
+
+func init() {
+	RegisterBackend("ipp", newIPPBackend)
+}
+
+// 扩展名到 document-format 的映射
+var documentFormats = map[string]string{
+	".pdf":  "application/pdf",
+	".ps":   "application/postscript",
+	".pcl":  "application/vnd.hp-pcl",
+	".txt":  "text/plain",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".pwg":  "image/pwg-raster",
+	".urf":  "image/urf",
+}
+
+// DocumentFormat 返回文件对应的 MIME 类型
+func DocumentFormat(filePath string) string {
+	if format, ok := documentFormats[strings.ToLower(filepath.Ext(filePath))]; ok {
+		return format
+	}
+	return "application/octet-stream"
+}
+
+// ippBackend 通过 IPP 将文档提交到 CUPS 或网络打印机
+//
+// 支持的设置:
+//   - user: requesting-user-name, 默认 printer_service
+//   - operation: auto, print-job 或 create-job, 默认 auto
+//   - wait: 是否等待任务结束, 默认 true
+//   - poll_interval: 等待时查询任务状态的间隔, 默认 2s
+//   - wait_timeout: 等待任务结束的最长时间, 超时后取消打印机上的任务, 默认 1h, 0 表示不限制
+//   - timeout: 查询属性和任务状态等请求的超时, 默认 60s. 上传文档的请求不限时间, 大文档经慢速网络也能完成
+//   - formats: 可直接提交的扩展名, 默认 .pdf
+//
+// 打印机上的任务被保留 (pending-held, 如需要在打印机上认证或释放) 时不再等待, 报告为错误
+type ippBackend struct {
+	client       *ipp.Client
+	user         string
+	operation    string
+	wait         bool
+	pollInterval time.Duration
+	waitTimeout  time.Duration
+	timeout      time.Duration
+	formats      []string
+
+	mu         sync.Mutex
+	operations []int // 缓存的 operations-supported
+}
+
+func newIPPBackend(cfg BackendConfig) (PrintBackend, error) {
+	if cfg.URI == "" {
+		return nil, errors.New("ipp后端需要配置打印机地址, 如 ipp://localhost:631/printers/name")
+	}
+	client, err := ipp.NewClient(cfg.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &ippBackend{
+		client:    client,
+		user:      cfg.Setting("user", "printer_service"),
+		operation: cfg.Setting("operation", "auto"),
+		formats:   cfg.ListSetting("formats", []string{".pdf"}),
+	}
+	switch b.operation {
+	case "auto", "print-job", "create-job":
+	default:
+		return nil, fmt.Errorf("设置 operation 无效: %s", b.operation)
+	}
+	if b.wait, err = cfg.BoolSetting("wait", true); err != nil {
+		return nil, err
+	}
+	if b.pollInterval, err = cfg.DurationSetting("poll_interval", 2*time.Second); err != nil {
+		return nil, err
+	}
+	if b.waitTimeout, err = cfg.DurationSetting("wait_timeout", time.Hour); err != nil {
+		return nil, err
+	}
+	if b.timeout, err = cfg.DurationSetting("timeout", 60*time.Second); err != nil {
+		return nil, err
+	}
+	client.HTTPClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: b.timeout}).DialContext,
+			TLSHandshakeTimeout:   b.timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+	return b, nil
+}
+
+// Capabilities 返回IPP后端能力
+func (b *ippBackend) Capabilities() Capabilities {
+	// 打印机不支持的取值会以 client-error-attributes-or-values-not-supported 拒绝
+	return Capabilities{
+		PrintFormats: b.formats,
+		MaxCopies:    999,
+		PageRanges:   true,
+		Duplex:       true,
+		Orientation:  true,
+		Media:        allMedia(),
+		Color:        true,
+		Collate:      true,
+	}
+}
+
+// Open IPP打印机无法在本机打开文件
+func (b *ippBackend) Open(ctx context.Context, filePath string) error {
+	return errors.New("ipp后端不支持打开文件")
+}
+
+// do 发送不带文档的请求, 受 timeout 设置限制
+func (b *ippBackend) do(ctx context.Context, req *ipp.Message) (*ipp.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+	return b.client.Do(ctx, req, nil)
+}
+
+// Print 提交文档并等待任务结束
+func (b *ippBackend) Print(ctx context.Context, filePath string, opts PrintOptions) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+
+	useCreateJob, err := b.useCreateJob(ctx)
+	if err != nil {
+		return err
+	}
+
+	var jobID int
+	if useCreateJob {
+		jobID, err = b.createJob(ctx, file, filePath, opts)
+	} else {
+		jobID, err = b.printJob(ctx, file, filePath, opts)
+	}
+	if err != nil {
+		return err
+	}
+	if !b.wait {
+		return nil
+	}
+	return b.waitJob(ctx, jobID)
+}
+
+// useCreateJob 判断是否使用 Create-Job + Send-Document 提交
+func (b *ippBackend) useCreateJob(ctx context.Context) (bool, error) {
+	switch b.operation {
+	case "print-job":
+		return false, nil
+	case "create-job":
+		return true, nil
+	}
+
+	b.mu.Lock()
+	operations := b.operations
+	b.mu.Unlock()
+
+	if operations == nil {
+		req := b.client.NewRequest(ipp.OpGetPrinterAttributes)
+		req.Group(ipp.TagOperationGroup).Add("requested-attributes", ipp.TagKeyword, "operations-supported")
+		resp, err := b.do(ctx, req)
+		if err != nil {
+			return false, fmt.Errorf("查询打印机属性失败: %v", err)
+		}
+		operations = resp.Attr(ipp.TagPrinterGroup, "operations-supported").Ints()
+		b.mu.Lock()
+		b.operations = operations
+		b.mu.Unlock()
+	}
+
+	var create, send bool
+	for _, op := range operations {
+		switch ipp.Operation(op) {
+		case ipp.OpCreateJob:
+			create = true
+		case ipp.OpSendDocument:
+			send = true
+		}
+	}
+	return create && send, nil
+}
+
+// jobAttributes 写入任务相关的操作属性和打印选项
+func (b *ippBackend) jobAttributes(req *ipp.Message, filePath string, opts PrintOptions) {
+	op := req.Group(ipp.TagOperationGroup)
+	op.Add("requesting-user-name", ipp.TagName, b.user)
+	op.Add("job-name", ipp.TagName, filepath.Base(filePath))
+
+	job := &ipp.Group{Tag: ipp.TagJobGroup}
+	if opts.Copies > 0 {
+		job.Add("copies", ipp.TagInteger, int32(opts.Copies))
+	}
+	if ranges := opts.Ranges(); len(ranges) > 0 {
+		values := make([]interface{}, len(ranges))
+		for i, r := range ranges {
+			last := r.Last
+			if last == 0 {
+				last = 1<<31 - 1
+			}
+			values[i] = ipp.Range{Lower: int32(r.First), Upper: int32(last)}
+		}
+		job.Add("page-ranges", ipp.TagRange, values...)
+	}
+	switch opts.Duplex {
+	case DuplexOneSided:
+		job.Add("sides", ipp.TagKeyword, "one-sided")
+	case DuplexLongEdge:
+		job.Add("sides", ipp.TagKeyword, "two-sided-long-edge")
+	case DuplexShortEdge:
+		job.Add("sides", ipp.TagKeyword, "two-sided-short-edge")
+	}
+	switch opts.Orientation {
+	case OrientationPortrait:
+		job.Add("orientation-requested", ipp.TagEnum, int32(3))
+	case OrientationLandscape:
+		job.Add("orientation-requested", ipp.TagEnum, int32(4))
+	}
+	if media, ok := MediaSizes[opts.Media]; ok {
+		job.Add("media", ipp.TagKeyword, media.IPP)
+	}
+	if opts.Color != "" {
+		job.Add("print-color-mode", ipp.TagKeyword, opts.Color)
+	}
+	if opts.Scaling != "" {
+		job.Add("print-scaling", ipp.TagKeyword, opts.Scaling)
+	}
+	if opts.Collate != nil {
+		handling := "separate-documents-uncollated-copies"
+		if *opts.Collate {
+			handling = "separate-documents-collated-copies"
+		}
+		job.Add("multiple-document-handling", ipp.TagKeyword, handling)
+	}
+	if len(job.Attributes) > 0 {
+		req.Groups = append(req.Groups, job)
+	}
+}
+
+func (b *ippBackend) printJob(ctx context.Context, file *os.File, filePath string, opts PrintOptions) (int, error) {
+	req := b.client.NewRequest(ipp.OpPrintJob)
+	req.Group(ipp.TagOperationGroup).Add("document-format", ipp.TagMimeType, DocumentFormat(filePath))
+	b.jobAttributes(req, filePath, opts)
+
+	resp, err := b.client.Do(ctx, req, file)
+	if err != nil {
+		return 0, fmt.Errorf("提交IPP任务失败: %v", err)
+	}
+	return responseJobID(resp)
+}
+
+func (b *ippBackend) createJob(ctx context.Context, file *os.File, filePath string, opts PrintOptions) (int, error) {
+	req := b.client.NewRequest(ipp.OpCreateJob)
+	b.jobAttributes(req, filePath, opts)
+
+	resp, err := b.do(ctx, req)
+	if err != nil {
+		return 0, fmt.Errorf("创建IPP任务失败: %v", err)
+	}
+	jobID, err := responseJobID(resp)
+	if err != nil {
+		return 0, err
+	}
+
+	req = b.client.NewRequest(ipp.OpSendDocument)
+	op := req.Group(ipp.TagOperationGroup)
+	op.Add("job-id", ipp.TagInteger, int32(jobID))
+	op.Add("requesting-user-name", ipp.TagName, b.user)
+	op.Add("document-name", ipp.TagName, filepath.Base(filePath))
+	op.Add("document-format", ipp.TagMimeType, DocumentFormat(filePath))
+	op.Add("last-document", ipp.TagBoolean, true)
+
+	if _, err := b.client.Do(ctx, req, file); err != nil {
+		b.cancelJob(jobID)
+		return 0, fmt.Errorf("发送IPP文档失败: %v", err)
+	}
+	return jobID, nil
+}
+
+func responseJobID(resp *ipp.Message) (int, error) {
+	jobID, ok := resp.Attr(ipp.TagJobGroup, "job-id").Int()
+	if !ok {
+		return 0, errors.New("IPP响应缺少job-id")
+	}
+	return jobID, nil
+}
+
+// waitJob 轮询任务状态直到任务结束, ctx 取消或超过 wait_timeout 时同时取消打印机上的任务.
+// 任务被打印机保留时返回错误, 保留的任务留在打印机上, 在打印机上释放后仍会打印
+func (b *ippBackend) waitJob(ctx context.Context, jobID int) error {
+	ticker := time.NewTicker(b.pollInterval)
+	defer ticker.Stop()
+	var deadline <-chan time.Time
+	if b.waitTimeout > 0 {
+		timer := time.NewTimer(b.waitTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		status, err := b.jobStatus(ctx, jobID)
+		if err != nil {
+			if ctx.Err() != nil {
+				b.cancelJob(jobID)
+				return ctx.Err()
+			}
+			return err
+		}
+
+		switch status.state {
+		case JobDone:
+			return nil
+		case JobFailed, JobCanceled:
+			return b.jobError(ctx, jobID, status, "")
+		case JobHeld:
+			return b.jobError(ctx, jobID, status, "任务在打印机上被保留, 需要在打印机上释放")
+		}
+
+		select {
+		case <-ctx.Done():
+			b.cancelJob(jobID)
+			return ctx.Err()
+		case <-deadline:
+			b.cancelJob(jobID)
+			return b.jobError(ctx, jobID, status, fmt.Sprintf("等待超过 %s, 已取消", b.waitTimeout))
+		case <-ticker.C:
+		}
+	}
+}
+
+// jobError 生成包含任务状态和原因的错误, 附带打印机状态, 便于判断是否缺纸、卡纸等
+func (b *ippBackend) jobError(ctx context.Context, jobID int, status ippJobStatus, note string) error {
+	msg := fmt.Sprintf("IPP任务 %d 状态为 %s", jobID, status.ipp)
+	if note != "" {
+		msg += ", " + note
+	}
+	if len(status.reasons) > 0 {
+		msg += ", 原因: " + strings.Join(status.reasons, ", ")
+	}
+	if status.message != "" {
+		msg += ", " + status.message
+	}
+	if printer, err := b.PrinterStatus(ctx); err == nil && len(printer.Reasons) > 0 {
+		msg += ", 打印机状态: " + strings.Join(printer.Reasons, ", ")
+	}
+	return errors.New(msg)
+}
+
+// ippJobStatus 打印机上的任务状态
+type ippJobStatus struct {
+	state   JobState
+	ipp     string
+	reasons []string
+	message string
+}
+
+func (b *ippBackend) jobStatus(ctx context.Context, jobID int) (ippJobStatus, error) {
+	req := b.client.NewRequest(ipp.OpGetJobAttributes)
+	op := req.Group(ipp.TagOperationGroup)
+	op.Add("job-id", ipp.TagInteger, int32(jobID))
+	op.Add("requested-attributes", ipp.TagKeyword, "job-state", "job-state-reasons", "job-state-message")
+
+	resp, err := b.do(ctx, req)
+	if err != nil {
+		return ippJobStatus{}, fmt.Errorf("查询IPP任务状态失败: %v", err)
+	}
+	job := resp.Find(ipp.TagJobGroup)
+	state, _ := job.Get("job-state").Int()
+	return ippJobStatus{
+		state:   IPPJobState(state),
+		ipp:     ippJobStateName(state),
+		reasons: job.Get("job-state-reasons").Strings(),
+		message: job.Get("job-state-message").String(),
+	}, nil
+}
+
+// cancelJob 尽力取消打印机上的任务, 调用方的 ctx 可能已经取消, 因此使用独立的超时
+func (b *ippBackend) cancelJob(jobID int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req := b.client.NewRequest(ipp.OpCancelJob)
+	op := req.Group(ipp.TagOperationGroup)
+	op.Add("job-id", ipp.TagInteger, int32(jobID))
+	op.Add("requesting-user-name", ipp.TagName, b.user)
+	b.client.Do(ctx, req, nil)
+}
+
+// PrinterStatus 查询 printer-state、printer-state-reasons 和耗材余量
+func (b *ippBackend) PrinterStatus(ctx context.Context) (PrinterStatus, error) {
+	req := b.client.NewRequest(ipp.OpGetPrinterAttributes)
+	req.Group(ipp.TagOperationGroup).Add("requested-attributes", ipp.TagKeyword,
+		"printer-state", "printer-state-reasons", "printer-state-message",
+		"marker-names", "marker-types", "marker-colors", "marker-levels", "marker-low-levels")
+
+	resp, err := b.do(ctx, req)
+	if err != nil {
+		return PrinterStatus{}, fmt.Errorf("查询打印机状态失败: %v", err)
+	}
+	return ippPrinterStatus(resp.Find(ipp.TagPrinterGroup)), nil
+}
+
+// ippPrinterStatus 从打印机属性分组中提取状态
+func ippPrinterStatus(printer *ipp.Group) PrinterStatus {
+	status := PrinterStatus{Message: printer.Get("printer-state-message").String()}
+	state, _ := printer.Get("printer-state").Int()
+	switch state {
+	case ipp.PrinterStateIdle:
+		status.State = "idle"
+	case ipp.PrinterStateProcessing:
+		status.State = "processing"
+	case ipp.PrinterStateStopped:
+		status.State = "stopped"
+	default:
+		status.State = "unknown"
+	}
+	for _, reason := range printer.Get("printer-state-reasons").Strings() {
+		if reason != "none" {
+			status.Reasons = append(status.Reasons, reason)
+		}
+	}
+
+	// marker-* 是按下标对应的平行数组 (RFC 3805 / PWG 5100.9)
+	names := printer.Get("marker-names").Strings()
+	types := printer.Get("marker-types").Strings()
+	colors := printer.Get("marker-colors").Strings()
+	levels := printer.Get("marker-levels").Ints()
+	lows := printer.Get("marker-low-levels").Ints()
+	for i, name := range names {
+		supply := Supply{Name: name, Level: SupplyLevelUnknown}
+		if i < len(types) {
+			supply.Type = types[i]
+		}
+		if i < len(colors) {
+			supply.Color = colors[i]
+		}
+		if i < len(levels) && levels[i] >= 0 {
+			supply.Level = levels[i]
+		}
+		if i < len(lows) && supply.Level >= 0 {
+			supply.Low = supply.Level <= lows[i]
+		}
+		status.Supplies = append(status.Supplies, supply)
+	}
+	return status
+}
+
+// IPPJobState 将 IPP 的 job-state 映射为本服务的任务状态
+func IPPJobState(state int) JobState {
+	switch state {
+	case ipp.JobStatePending:
+		return JobQueued
+	case ipp.JobStatePendingHeld:
+		return JobHeld
+	case ipp.JobStateProcessing, ipp.JobStateProcessingStopped:
+		return JobPrinting
+	case ipp.JobStateCanceled:
+		return JobCanceled
+	case ipp.JobStateAborted:
+		return JobFailed
+	case ipp.JobStateCompleted:
+		return JobDone
+	}
+	return JobQueued
+}
+
+func ippJobStateName(state int) string {
+	switch state {
+	case ipp.JobStatePending:
+		return "pending"
+	case ipp.JobStatePendingHeld:
+		return "pending-held"
+	case ipp.JobStateProcessing:
+		return "processing"
+	case ipp.JobStateProcessingStopped:
+		return "processing-stopped"
+	case ipp.JobStateCanceled:
+		return "canceled"
+	case ipp.JobStateAborted:
+		return "aborted"
+	case ipp.JobStateCompleted:
+		return "completed"
+	}
+	return fmt.Sprintf("unknown(%d)", state)
+}
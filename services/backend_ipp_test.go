@@ -0,0 +1,332 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"printer/services/ipp"
+)
+
+// ippStandIn 测试用的最小 IPP 打印机, 记录收到的请求,
+// Get-Job-Attributes 依次返回 states 中的状态, 最后一个状态一直保持
+type ippStandIn struct {
+	operations []ipp.Operation
+	states     []int
+	reasons    []string
+	// 收到 Print-Job 或 Send-Document 后等待多久才响应, 模拟慢速打印机
+	delay time.Duration
+
+	mu       sync.Mutex
+	requests []*ipp.Message
+	docs     [][]byte
+	polls    int
+	canceled []int
+}
+
+func (s *ippStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := bufio.NewReader(r.Body)
+	req, err := ipp.Decode(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	doc, _ := io.ReadAll(body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	resp := ipp.NewResponse(req, ipp.StatusOK)
+	switch req.Operation() {
+	case ipp.OpGetPrinterAttributes:
+		printer := resp.Group(ipp.TagPrinterGroup)
+		ops := make([]interface{}, len(s.operations))
+		for i, op := range s.operations {
+			ops[i] = int32(op)
+		}
+		if len(ops) > 0 {
+			printer.Add("operations-supported", ipp.TagEnum, ops...)
+		}
+		printer.Add("printer-state", ipp.TagEnum, int32(ipp.PrinterStateStopped))
+		printer.Add("printer-state-reasons", ipp.TagKeyword, "media-empty-error", "toner-low-warning")
+		printer.Add("marker-names", ipp.TagName, "Black Toner")
+		printer.Add("marker-types", ipp.TagKeyword, "toner")
+		printer.Add("marker-colors", ipp.TagName, "#000000")
+		printer.Add("marker-levels", ipp.TagInteger, int32(8))
+		printer.Add("marker-low-levels", ipp.TagInteger, int32(10))
+	case ipp.OpPrintJob, ipp.OpCreateJob:
+		s.docs = append(s.docs, doc)
+		resp.Group(ipp.TagJobGroup).Add("job-id", ipp.TagInteger, int32(len(s.docs)))
+	case ipp.OpSendDocument:
+		s.docs[len(s.docs)-1] = doc
+	case ipp.OpGetJobAttributes:
+		state := s.states[min(s.polls, len(s.states)-1)]
+		s.polls++
+		job := resp.Group(ipp.TagJobGroup)
+		job.Add("job-state", ipp.TagEnum, int32(state))
+		reasons := []interface{}{"none"}
+		if len(s.reasons) > 0 {
+			reasons = reasons[:0]
+			for _, r := range s.reasons {
+				reasons = append(reasons, r)
+			}
+		}
+		job.Add("job-state-reasons", ipp.TagKeyword, reasons...)
+	case ipp.OpCancelJob:
+		id, _ := req.Attr(ipp.TagOperationGroup, "job-id").Int()
+		s.canceled = append(s.canceled, id)
+	}
+	delay := s.delay
+	s.mu.Unlock()
+
+	if delay > 0 && len(doc) > 0 {
+		time.Sleep(delay)
+	}
+	w.Header().Set("Content-Type", ipp.ContentType)
+	resp.Encode(w)
+}
+
+// operationsReceived 返回收到的请求的操作码
+func (s *ippStandIn) operationsReceived() []ipp.Operation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ops []ipp.Operation
+	for _, req := range s.requests {
+		ops = append(ops, req.Operation())
+	}
+	return ops
+}
+
+// request 返回第一个操作码为 op 的请求
+func (s *ippStandIn) request(op ipp.Operation) *ipp.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, req := range s.requests {
+		if req.Operation() == op {
+			return req
+		}
+	}
+	return nil
+}
+
+// newIPPTestBackend 启动 stand-in 并创建指向它的 ipp 后端
+func newIPPTestBackend(t *testing.T, standIn *ippStandIn, settings map[string]string) PrintBackend {
+	t.Helper()
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+
+	all := map[string]string{"poll_interval": "10ms"}
+	for k, v := range settings {
+		all[k] = v
+	}
+	uri := "ipp://" + strings.TrimPrefix(server.URL, "http://") + "/ipp/print"
+	backend, err := NewBackend("ipp", BackendConfig{URI: uri, Settings: all})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+// writeTestPDF 写入测试文档
+func writeTestPDF(t *testing.T) (string, []byte) {
+	t.Helper()
+	data := []byte("%PDF-1.4\n% test document\n")
+	path := filepath.Join(t.TempDir(), "report.pdf")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+func TestIPPBackendPrintJob(t *testing.T) {
+	standIn := &ippStandIn{
+		operations: []ipp.Operation{ipp.OpPrintJob, ipp.OpGetJobAttributes},
+		states:     []int{ipp.JobStateProcessing, ipp.JobStateCompleted},
+	}
+	backend := newIPPTestBackend(t, standIn, nil)
+	path, data := writeTestPDF(t)
+
+	opts := PrintOptions{Copies: 2, Duplex: DuplexLongEdge, Media: "a4", PageRanges: "1-3"}
+	if err := backend.Print(context.Background(), path, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	req := standIn.request(ipp.OpPrintJob)
+	if req == nil {
+		t.Fatalf("没有收到 Print-Job, 收到 %v", standIn.operationsReceived())
+	}
+	if !bytes.Equal(standIn.docs[0], data) {
+		t.Fatalf("文档内容不一致: %q", standIn.docs[0])
+	}
+	op := req.Find(ipp.TagOperationGroup)
+	if got := op.Get("document-format").String(); got != "application/pdf" {
+		t.Errorf("document-format = %s", got)
+	}
+	if got := op.Get("job-name").String(); got != "report.pdf" {
+		t.Errorf("job-name = %s", got)
+	}
+	job := req.Find(ipp.TagJobGroup)
+	if copies, _ := job.Get("copies").Int(); copies != 2 {
+		t.Errorf("copies = %d", copies)
+	}
+	if got := job.Get("sides").String(); got != "two-sided-long-edge" {
+		t.Errorf("sides = %s", got)
+	}
+	if got := job.Get("media").String(); got != MediaSizes["a4"].IPP {
+		t.Errorf("media = %s", got)
+	}
+	if standIn.polls != 2 {
+		t.Errorf("polls = %d, want 2", standIn.polls)
+	}
+}
+
+func TestIPPBackendCreateJob(t *testing.T) {
+	standIn := &ippStandIn{
+		operations: []ipp.Operation{ipp.OpPrintJob, ipp.OpCreateJob, ipp.OpSendDocument},
+		states:     []int{ipp.JobStateCompleted},
+	}
+	backend := newIPPTestBackend(t, standIn, nil)
+	path, data := writeTestPDF(t)
+
+	if err := backend.Print(context.Background(), path, PrintOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []ipp.Operation{ipp.OpGetPrinterAttributes, ipp.OpCreateJob, ipp.OpSendDocument, ipp.OpGetJobAttributes}
+	if got := standIn.operationsReceived(); !equalOperations(got, want) {
+		t.Fatalf("operations = %v, want %v", got, want)
+	}
+	if !bytes.Equal(standIn.docs[0], data) {
+		t.Fatalf("文档内容不一致: %q", standIn.docs[0])
+	}
+	send := standIn.request(ipp.OpSendDocument).Find(ipp.TagOperationGroup)
+	if last, _ := send.Get("last-document").Bool(); !last {
+		t.Error("Send-Document 缺少 last-document")
+	}
+}
+
+func equalOperations(a, b []ipp.Operation) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIPPBackendJobAborted(t *testing.T) {
+	standIn := &ippStandIn{
+		operations: []ipp.Operation{ipp.OpPrintJob},
+		states:     []int{ipp.JobStateProcessing, ipp.JobStateAborted},
+		reasons:    []string{"document-format-error"},
+	}
+	backend := newIPPTestBackend(t, standIn, nil)
+	path, _ := writeTestPDF(t)
+
+	err := backend.Print(context.Background(), path, PrintOptions{})
+	if err == nil {
+		t.Fatal("任务中止时应返回错误")
+	}
+	for _, want := range []string{"aborted", "document-format-error", "media-empty-error"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("错误 %q 中缺少 %s", err, want)
+		}
+	}
+}
+
+func TestIPPBackendHeldJob(t *testing.T) {
+	standIn := &ippStandIn{
+		operations: []ipp.Operation{ipp.OpPrintJob},
+		states:     []int{ipp.JobStatePending, ipp.JobStatePendingHeld},
+		reasons:    []string{"job-hold-until-specified"},
+	}
+	backend := newIPPTestBackend(t, standIn, nil)
+	path, _ := writeTestPDF(t)
+
+	err := backend.Print(context.Background(), path, PrintOptions{})
+	if err == nil || !strings.Contains(err.Error(), "pending-held") || !strings.Contains(err.Error(), "job-hold-until-specified") {
+		t.Fatalf("err = %v", err)
+	}
+	// 保留的任务留在打印机上, 在打印机上释放后仍会打印
+	if len(standIn.canceled) != 0 {
+		t.Errorf("canceled = %v", standIn.canceled)
+	}
+}
+
+func TestIPPBackendWaitTimeout(t *testing.T) {
+	standIn := &ippStandIn{
+		operations: []ipp.Operation{ipp.OpPrintJob},
+		states:     []int{ipp.JobStateProcessingStopped},
+	}
+	backend := newIPPTestBackend(t, standIn, map[string]string{"wait_timeout": "100ms"})
+	path, _ := writeTestPDF(t)
+
+	err := backend.Print(context.Background(), path, PrintOptions{})
+	if err == nil || !strings.Contains(err.Error(), "processing-stopped") {
+		t.Fatalf("err = %v", err)
+	}
+	if len(standIn.canceled) != 1 || standIn.canceled[0] != 1 {
+		t.Errorf("canceled = %v", standIn.canceled)
+	}
+}
+
+func TestIPPBackendCancel(t *testing.T) {
+	standIn := &ippStandIn{
+		operations: []ipp.Operation{ipp.OpPrintJob},
+		states:     []int{ipp.JobStateProcessing},
+	}
+	backend := newIPPTestBackend(t, standIn, nil)
+	path, _ := writeTestPDF(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := backend.Print(ctx, path, PrintOptions{}); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v", err)
+	}
+	if len(standIn.canceled) != 1 {
+		t.Errorf("canceled = %v", standIn.canceled)
+	}
+}
+
+func TestIPPBackendSlowUpload(t *testing.T) {
+	// timeout 只限制查询类请求, 提交文档的请求耗时超过它也能完成
+	standIn := &ippStandIn{
+		operations: []ipp.Operation{ipp.OpPrintJob},
+		states:     []int{ipp.JobStateCompleted},
+		delay:      300 * time.Millisecond,
+	}
+	backend := newIPPTestBackend(t, standIn, map[string]string{"timeout": "100ms"})
+	path, _ := writeTestPDF(t)
+
+	if err := backend.Print(context.Background(), path, PrintOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIPPBackendPrinterStatus(t *testing.T) {
+	backend := newIPPTestBackend(t, &ippStandIn{}, nil)
+
+	status, err := backend.(StatusReporter).PrinterStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != "stopped" {
+		t.Errorf("state = %s", status.State)
+	}
+	if blocking := status.BlockingReasons(); len(blocking) != 1 || blocking[0] != "media-empty-error" {
+		t.Errorf("blocking reasons = %v", blocking)
+	}
+	if len(status.Supplies) != 1 || status.Supplies[0].Level != 8 || !status.Supplies[0].Low {
+		t.Errorf("supplies = %+v", status.Supplies)
+	}
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	RegisterBackend("lpd", newLPDBackend)
+}
+
+// lpdJobNumber RFC 1179 要求的三位任务号
+var lpdJobNumber atomic.Uint32
+
+// lpdBackend 通过 RFC 1179 LPD 协议提交文件
+//
+// 地址形如 lpd://host:515/queue, 支持的设置:
+//   - user: 控制文件中的用户名, 默认 printer_service
+//   - data_first: 先发送数据文件再发送控制文件, 部分旧打印机需要, 默认 false
+//   - connect_timeout, timeout, filter, formats: 同 socket 后端
+type lpdBackend struct {
+	addr      string
+	queue     string
+	user      string
+	dataFirst bool
+	opts      socketOptions
+}
+
+func newLPDBackend(cfg BackendConfig) (PrintBackend, error) {
+	u, err := url.Parse(cfg.URI)
+	if err != nil || u.Scheme != "lpd" || u.Hostname() == "" {
+		return nil, fmt.Errorf("lpd后端需要配置打印机地址, 如 lpd://192.168.1.10/queue")
+	}
+	queue := strings.Trim(u.Path, "/")
+	if queue == "" {
+		return nil, errors.New("lpd后端地址缺少队列名")
+	}
+	opts, err := parseSocketOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dataFirst, err := cfg.BoolSetting("data_first", false)
+	if err != nil {
+		return nil, err
+	}
+	return &lpdBackend{
+		addr:      splitHostPort(u, "515"),
+		queue:     queue,
+		user:      cfg.Setting("user", "printer_service"),
+		dataFirst: dataFirst,
+		opts:      opts,
+	}, nil
+}
+
+// Capabilities 返回LPD后端能力
+func (b *lpdBackend) Capabilities() Capabilities {
+	return Capabilities{PrintFormats: b.opts.formats, MaxCopies: rawMaxCopies}
+}
+
+// Open 网络打印机无法在本机打开文件
+func (b *lpdBackend) Open(ctx context.Context, filePath string) error {
+	return errors.New("lpd后端不支持打开文件")
+}
+
+// Print 通过 "receive a printer job" 命令提交控制文件和数据文件
+func (b *lpdBackend) Print(ctx context.Context, filePath string, opts PrintOptions) error {
+	sendPath, cleanupFile, err := b.opts.prepare(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	defer cleanupFile()
+
+	info, err := os.Stat(sendPath)
+	if err != nil {
+		return fmt.Errorf("读取文件信息失败: %v", err)
+	}
+
+	conn, cleanupConn, err := b.opts.dial(ctx, b.addr)
+	if err != nil {
+		return err
+	}
+	defer cleanupConn()
+
+	s := &lpdSession{conn: conn, reader: bufio.NewReader(conn), timeout: b.opts.timeout}
+	host := lpdHostname()
+	number := lpdJobNumber.Add(1) % 1000
+	dataName := fmt.Sprintf("dfA%03d%s", number, host)
+	controlName := fmt.Sprintf("cfA%03d%s", number, host)
+	control := b.controlFile(host, dataName, filepath.Base(filePath), opts.CopyCount())
+
+	if err := s.command(ctx, "接收任务", "\x02"+b.queue+"\n"); err != nil {
+		return err
+	}
+
+	sendControl := func() error {
+		if err := s.command(ctx, "控制文件", fmt.Sprintf("\x02%d %s\n", len(control), controlName)); err != nil {
+			return err
+		}
+		if err := s.write([]byte(control)); err != nil {
+			return s.fail(ctx, err)
+		}
+		return s.command(ctx, "控制文件内容", "\x00")
+	}
+	sendData := func() error {
+		if err := s.command(ctx, "数据文件", fmt.Sprintf("\x03%d %s\n", info.Size(), dataName)); err != nil {
+			return err
+		}
+		if _, err := copyFile(ctx, conn, b.opts.timeout, sendPath); err != nil {
+			return s.fail(ctx, err)
+		}
+		return s.command(ctx, "数据文件内容", "\x00")
+	}
+
+	steps := []func() error{sendControl, sendData}
+	if b.dataFirst {
+		steps = []func() error{sendData, sendControl}
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			// 中止任务, 让服务端丢弃已接收的文件
+			s.write([]byte("\x01\n"))
+			return err
+		}
+	}
+	return nil
+}
+
+// controlFile 生成控制文件, 'l' 表示原样打印数据文件, 重复 'l' 行即打印多份
+func (b *lpdBackend) controlFile(host, dataName, filename string, copies int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "H%s\n", host)
+	fmt.Fprintf(&sb, "P%s\n", b.user)
+	fmt.Fprintf(&sb, "J%s\n", lpdSanitize(filename))
+	fmt.Fprintf(&sb, "N%s\n", lpdSanitize(filename))
+	for i := 0; i < copies; i++ {
+		fmt.Fprintf(&sb, "l%s\n", dataName)
+	}
+	fmt.Fprintf(&sb, "U%s\n", dataName)
+	return sb.String()
+}
+
+// lpdSanitize 控制文件按行解析, 去掉文件名中的换行, 长度不超过131字节
+func lpdSanitize(s string) string {
+	s = strings.NewReplacer("\n", " ", "\r", " ").Replace(s)
+	if len(s) > 131 {
+		s = s[:131]
+	}
+	return s
+}
+
+// lpdHostname 返回控制文件使用的主机名, RFC 1179 限制为31个字符
+func lpdHostname() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		host = host[:i]
+	}
+	if len(host) > 31 {
+		host = host[:31]
+	}
+	return host
+}
+
+// lpdSession 一次 LPD 连接上的命令交互
+type lpdSession struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+}
+
+func (s *lpdSession) write(p []byte) error {
+	_, err := deadlineWriter{conn: s.conn, timeout: s.timeout}.Write(p)
+	return err
+}
+
+// command 发送命令并等待服务端确认, 确认字节为0表示成功
+func (s *lpdSession) command(ctx context.Context, step, cmd string) error {
+	if err := s.write([]byte(cmd)); err != nil {
+		return s.fail(ctx, err)
+	}
+	s.conn.SetReadDeadline(time.Now().Add(s.timeout))
+	ack, err := s.reader.ReadByte()
+	if err != nil {
+		return s.fail(ctx, fmt.Errorf("等待%s确认失败: %v", step, err))
+	}
+	if ack != 0 {
+		return fmt.Errorf("LPD服务器拒绝%s (应答 %d)", step, ack)
+	}
+	return nil
+}
+
+// fail ctx 取消导致的连接错误统一返回 ctx.Err()
+func (s *lpdSession) fail(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
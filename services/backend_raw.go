@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterBackend("socket", newRawBackend)
+}
+
+// 直接发送给打印机时默认接受的格式, 打印机需能自行解析这些页面描述语言
+var rawFormats = []string{".pdf", ".ps", ".pcl", ".prn", ".txt"}
+
+// socketOptions 原始TCP和LPD后端共用的连接设置
+type socketOptions struct {
+	connectTimeout time.Duration
+	timeout        time.Duration
+	filter         string
+	formats        []string
+}
+
+func parseSocketOptions(cfg BackendConfig) (socketOptions, error) {
+	var opts socketOptions
+	var err error
+	if opts.connectTimeout, err = cfg.DurationSetting("connect_timeout", 10*time.Second); err != nil {
+		return opts, err
+	}
+	if opts.timeout, err = cfg.DurationSetting("timeout", 60*time.Second); err != nil {
+		return opts, err
+	}
+	if name := cfg.Setting("filter", ""); name != "" {
+		if opts.filter, err = lookupFilter(name); err != nil {
+			return opts, err
+		}
+	}
+	opts.formats = cfg.ListSetting("formats", rawFormats)
+	return opts, nil
+}
+
+var (
+	filtersMu sync.RWMutex
+	filters   = make(map[string]string)
+)
+
+// RegisterFilter 登记过滤命令. 打印机设置中的 filter 只能引用这里登记的名称,
+// 命令本身只能由管理员在服务配置中指定, 不能通过打印机管理接口传入
+func RegisterFilter(name, command string) {
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+
+	if name == "" || strings.TrimSpace(command) == "" {
+		panic("services: RegisterFilter name or command is empty")
+	}
+	filters[name] = command
+}
+
+// lookupFilter 返回已登记的过滤命令
+func lookupFilter(name string) (string, error) {
+	filtersMu.RLock()
+	defer filtersMu.RUnlock()
+
+	command, ok := filters[name]
+	if !ok {
+		return "", fmt.Errorf("过滤器 %q 未在服务配置中登记", name)
+	}
+	return command, nil
+}
+
+// dial 建立TCP连接, ctx 取消时连接会被关闭, 正在进行的读写随即返回
+func (o socketOptions) dial(ctx context.Context, addr string) (net.Conn, func(), error) {
+	dialer := &net.Dialer{Timeout: o.connectTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("连接打印机 %s 失败: %v", addr, err)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	cleanup := func() {
+		stop()
+		conn.Close()
+	}
+	return conn, cleanup, nil
+}
+
+// prepare 按需通过过滤命令转换文件, 返回实际要发送的文件路径
+func (o socketOptions) prepare(ctx context.Context, filePath string) (string, func(), error) {
+	if o.filter == "" {
+		return filePath, func() {}, nil
+	}
+	return runFilter(ctx, o.filter, filePath)
+}
+
+// runFilter 执行转换命令, 命令中的 {in} 和 {out} 分别替换为输入和输出文件,
+// 未使用 {in} 时从标准输入读取, 未使用 {out} 时从标准输出写出
+func runFilter(ctx context.Context, filter, filePath string) (string, func(), error) {
+	args := strings.Fields(filter)
+	if len(args) == 0 {
+		return "", nil, errors.New("过滤命令为空")
+	}
+
+	out, err := os.CreateTemp("", "printer-filter-*"+filepath.Ext(filePath))
+	if err != nil {
+		return "", nil, fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	out.Close()
+	cleanup := func() { os.Remove(out.Name()) }
+
+	var useIn, useOut bool
+	for i, arg := range args {
+		if strings.Contains(arg, "{in}") {
+			useIn = true
+			args[i] = strings.ReplaceAll(args[i], "{in}", filePath)
+		}
+		if strings.Contains(arg, "{out}") {
+			useOut = true
+			args[i] = strings.ReplaceAll(args[i], "{out}", out.Name())
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if !useIn {
+		in, err := os.Open(filePath)
+		if err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("打开文件失败: %v", err)
+		}
+		defer in.Close()
+		cmd.Stdin = in
+	}
+	if !useOut {
+		f, err := os.OpenFile(out.Name(), os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			cleanup()
+			return "", nil, err
+		}
+		defer f.Close()
+		cmd.Stdout = f
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		cleanup()
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		return "", nil, fmt.Errorf("过滤命令执行失败: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out.Name(), cleanup, nil
+}
+
+// deadlineWriter 每次写入前刷新写超时, 打印机长时间不接收数据时返回错误
+type deadlineWriter struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (w deadlineWriter) Write(p []byte) (int, error) {
+	if err := w.conn.SetWriteDeadline(time.Now().Add(w.timeout)); err != nil {
+		return 0, err
+	}
+	return w.conn.Write(p)
+}
+
+// copyFile 将文件内容写入连接
+func copyFile(ctx context.Context, conn net.Conn, timeout time.Duration, filePath string) (int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+
+	n, err := io.Copy(deadlineWriter{conn: conn, timeout: timeout}, file)
+	if err != nil {
+		if ctx.Err() != nil {
+			return n, ctx.Err()
+		}
+		return n, fmt.Errorf("发送数据失败: %v", err)
+	}
+	return n, nil
+}
+
+// splitHostPort 解析 URI 中的主机和端口, 未指定端口时使用 defPort
+func splitHostPort(u *url.URL, defPort string) string {
+	port := u.Port()
+	if port == "" {
+		port = defPort
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// rawMaxCopies 原始TCP和LPD后端通过重复发送实现多份, 限制份数避免误操作
+const rawMaxCopies = 99
+
+// rawBackend 通过 TCP 9100 端口 (JetDirect/AppSocket) 直接发送文件
+//
+// 地址形如 socket://host:9100, 支持的设置:
+//   - connect_timeout: 连接超时, 默认 10s
+//   - timeout: 读写超时, 默认 60s
+//   - close_wait: 发送完成后等待打印机关闭连接的时间, 默认 2s
+//   - filter: 发送前执行的转换命令的名称, 命令由 RegisterFilter 登记
+//   - formats: 可直接发送的扩展名, 默认 .pdf,.ps,.pcl,.prn,.txt
+type rawBackend struct {
+	addr      string
+	opts      socketOptions
+	closeWait time.Duration
+}
+
+func newRawBackend(cfg BackendConfig) (PrintBackend, error) {
+	u, err := url.Parse(cfg.URI)
+	if err != nil || u.Scheme != "socket" || u.Hostname() == "" {
+		return nil, fmt.Errorf("socket后端需要配置打印机地址, 如 socket://192.168.1.10:9100")
+	}
+	opts, err := parseSocketOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	closeWait, err := cfg.DurationSetting("close_wait", 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &rawBackend{
+		addr:      splitHostPort(u, "9100"),
+		opts:      opts,
+		closeWait: closeWait,
+	}, nil
+}
+
+// Capabilities 返回原始TCP后端能力, 数据原样发送, 除份数外的选项都无法传达给打印机
+func (b *rawBackend) Capabilities() Capabilities {
+	return Capabilities{PrintFormats: b.opts.formats, MaxCopies: rawMaxCopies}
+}
+
+// Open 网络打印机无法在本机打开文件
+func (b *rawBackend) Open(ctx context.Context, filePath string) error {
+	return errors.New("socket后端不支持打开文件")
+}
+
+// Print 将文件发送到打印机, 多份时每份单独建立一次连接
+func (b *rawBackend) Print(ctx context.Context, filePath string, opts PrintOptions) error {
+	sendPath, cleanupFile, err := b.opts.prepare(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	defer cleanupFile()
+
+	for i := 0; i < opts.CopyCount(); i++ {
+		if err := b.send(ctx, sendPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send 建立连接并发送一份数据
+func (b *rawBackend) send(ctx context.Context, sendPath string) error {
+	conn, cleanupConn, err := b.opts.dial(ctx, b.addr)
+	if err != nil {
+		return err
+	}
+	defer cleanupConn()
+
+	if _, err := copyFile(ctx, conn, b.opts.timeout, sendPath); err != nil {
+		return err
+	}
+
+	// 关闭写方向通知打印机数据结束, 部分打印机会在处理后回传状态再关闭连接
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		if err := tcpConn.CloseWrite(); err != nil {
+			return fmt.Errorf("关闭连接失败: %v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(b.closeWait))
+		io.Copy(io.Discard, conn)
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,355 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lpdStandIn 测试用的最小 LPD 服务端, 记录收到的命令和文件
+type lpdStandIn struct {
+	// 对以这些字节开头的命令回复非零确认
+	reject map[byte]bool
+	// 收到接收任务命令后不再回复, 模拟卡住的打印机
+	stall bool
+
+	mu       sync.Mutex
+	queue    string
+	commands []string
+	files    map[string][]byte
+	aborted  bool
+}
+
+// start 在本机随机端口上监听, 返回地址
+func (s *lpdStandIn) start(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s.files = make(map[string][]byte)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func (s *lpdStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	ack := func(cmd string) bool {
+		s.mu.Lock()
+		s.commands = append(s.commands, cmd)
+		s.mu.Unlock()
+		if s.reject[cmd[0]] {
+			conn.Write([]byte{1})
+			return false
+		}
+		_, err := conn.Write([]byte{0})
+		return err == nil
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil || line[0] != 2 {
+		return
+	}
+	s.mu.Lock()
+	s.queue = strings.TrimSpace(line[1:])
+	s.mu.Unlock()
+	if s.stall {
+		io.Copy(io.Discard, r)
+		return
+	}
+	if !ack(line) {
+		return
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if line[0] == 1 {
+			s.mu.Lock()
+			s.aborted = true
+			s.mu.Unlock()
+			return
+		}
+		if !ack(line) {
+			continue
+		}
+		size, name, _ := strings.Cut(strings.TrimSpace(line[1:]), " ")
+		n, _ := strconv.Atoi(size)
+		data := make([]byte, n+1)
+		if _, err := io.ReadFull(r, data); err != nil || data[n] != 0 {
+			return
+		}
+		s.mu.Lock()
+		s.files[name] = data[:n]
+		s.mu.Unlock()
+		conn.Write([]byte{0})
+	}
+}
+
+// commandTypes 返回收到的命令的类型字节
+func (s *lpdStandIn) commandTypes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var types []byte
+	for _, cmd := range s.commands {
+		types = append(types, cmd[0])
+	}
+	return types
+}
+
+// file 返回名称以 prefix 开头的文件
+func (s *lpdStandIn) file(prefix string) (string, []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, data := range s.files {
+		if strings.HasPrefix(name, prefix) {
+			return name, data
+		}
+	}
+	return "", nil
+}
+
+// newSocketTestBackend 创建连接到 addr 的 lpd 或 socket 后端
+func newSocketTestBackend(t *testing.T, name, uri string, settings map[string]string) PrintBackend {
+	t.Helper()
+	backend, err := NewBackend(name, BackendConfig{URI: uri, Settings: settings})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+func TestLPDControlFile(t *testing.T) {
+	b := &lpdBackend{user: "zhangsan"}
+	tests := []struct {
+		filename string
+		copies   int
+		want     string
+	}{
+		{"report.pdf", 1, "Hhost\nPzhangsan\nJreport.pdf\nNreport.pdf\nldfA001host\nUdfA001host\n"},
+		{"report.pdf", 3, "Hhost\nPzhangsan\nJreport.pdf\nNreport.pdf\nldfA001host\nldfA001host\nldfA001host\nUdfA001host\n"},
+		// 文件名中的换行会被当作新的控制行
+		{"a\nPadmin.pdf", 1, "Hhost\nPzhangsan\nJa Padmin.pdf\nNa Padmin.pdf\nldfA001host\nUdfA001host\n"},
+	}
+	for _, tt := range tests {
+		if got := b.controlFile("host", "dfA001host", tt.filename, tt.copies); got != tt.want {
+			t.Errorf("%q x%d: %q, want %q", tt.filename, tt.copies, got, tt.want)
+		}
+	}
+	if got := lpdSanitize(strings.Repeat("x", 200)); len(got) != 131 {
+		t.Errorf("长文件名截断为 %d 字节", len(got))
+	}
+}
+
+func TestLPDBackendPrint(t *testing.T) {
+	path, data := writeTestPDF(t)
+	for _, dataFirst := range []bool{false, true} {
+		standIn := &lpdStandIn{}
+		addr := standIn.start(t)
+		backend := newSocketTestBackend(t, "lpd", "lpd://"+addr+"/raw", map[string]string{
+			"user": "zhangsan", "data_first": strconv.FormatBool(dataFirst),
+		})
+		if err := backend.Print(context.Background(), path, PrintOptions{Copies: 2}); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []byte{2, 2, 3}
+		if dataFirst {
+			want = []byte{2, 3, 2}
+		}
+		if got := standIn.commandTypes(); !reflect.DeepEqual(got, want) {
+			t.Errorf("data_first=%v: commands = %v, want %v", dataFirst, got, want)
+		}
+		standIn.mu.Lock()
+		if standIn.queue != "raw" {
+			t.Errorf("queue = %q", standIn.queue)
+		}
+		standIn.mu.Unlock()
+		dataName, got := standIn.file("dfA")
+		if string(got) != string(data) {
+			t.Errorf("data = %q", got)
+		}
+		controlName, control := standIn.file("cfA")
+		// 控制文件和数据文件使用相同的任务号和主机名
+		if controlName == "" || controlName[3:] != dataName[3:] {
+			t.Errorf("control = %q, data = %q", controlName, dataName)
+		}
+		host := lpdHostname()
+		wantControl := fmt.Sprintf("H%s\nPzhangsan\nJreport.pdf\nNreport.pdf\nl%s\nl%s\nU%s\n", host, dataName, dataName, dataName)
+		if string(control) != wantControl {
+			t.Errorf("control file = %q, want %q", control, wantControl)
+		}
+	}
+}
+
+func TestLPDBackendRejected(t *testing.T) {
+	path, _ := writeTestPDF(t)
+	tests := []struct {
+		name    string
+		reject  byte
+		aborted bool
+	}{
+		{"unknown queue", 2, false},
+		{"data file", 3, true},
+	}
+	for _, tt := range tests {
+		standIn := &lpdStandIn{reject: map[byte]bool{tt.reject: true}}
+		addr := standIn.start(t)
+		backend := newSocketTestBackend(t, "lpd", "lpd://"+addr+"/raw", nil)
+		err := backend.Print(context.Background(), path, PrintOptions{})
+		if err == nil || !strings.Contains(err.Error(), "拒绝") {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+		// 中止命令在返回前已写出, 服务端可能稍后才读到
+		deadline := time.Now().Add(time.Second)
+		for tt.aborted && time.Now().Before(deadline) {
+			standIn.mu.Lock()
+			aborted := standIn.aborted
+			standIn.mu.Unlock()
+			if aborted {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		standIn.mu.Lock()
+		if standIn.aborted != tt.aborted {
+			t.Errorf("%s: aborted = %v", tt.name, standIn.aborted)
+		}
+		standIn.mu.Unlock()
+		if _, data := standIn.file("dfA"); data != nil {
+			t.Errorf("%s: 被拒绝的数据文件不应被接收", tt.name)
+		}
+	}
+}
+
+func TestLPDBackendCancel(t *testing.T) {
+	path, _ := writeTestPDF(t)
+	standIn := &lpdStandIn{stall: true}
+	addr := standIn.start(t)
+	backend := newSocketTestBackend(t, "lpd", "lpd://"+addr+"/raw", map[string]string{"timeout": "30s"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := backend.Print(ctx, path, PrintOptions{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("取消后 %v 才返回", elapsed)
+	}
+}
+
+// startRawPrinter 启动接收原始数据的服务端, 每个连接读到 EOF 后把数据发到返回的通道.
+// hold 为 true 时读完数据也不关闭连接
+func startRawPrinter(t *testing.T, hold bool) (string, <-chan []byte) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	received := make(chan []byte, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				data, _ := io.ReadAll(conn)
+				received <- data
+				if hold {
+					time.Sleep(time.Minute)
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), received
+}
+
+func TestRawBackendPrint(t *testing.T) {
+	path, data := writeTestPDF(t)
+	addr, received := startRawPrinter(t, false)
+	backend := newSocketTestBackend(t, "socket", "socket://"+addr, nil)
+	if err := backend.Print(context.Background(), path, PrintOptions{Copies: 2}); err != nil {
+		t.Fatal(err)
+	}
+	// 每份单独建立一次连接
+	for i := 0; i < 2; i++ {
+		select {
+		case got := <-received:
+			if string(got) != string(data) {
+				t.Errorf("copy %d = %q", i+1, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("只收到 %d 份", i)
+		}
+	}
+}
+
+func TestRawBackendCancel(t *testing.T) {
+	path, _ := writeTestPDF(t)
+	addr, _ := startRawPrinter(t, true)
+	// 打印机一直不关闭连接, 发送完成后停在等待关闭的阶段
+	backend := newSocketTestBackend(t, "socket", "socket://"+addr, map[string]string{"close_wait": "30s"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := backend.Print(ctx, path, PrintOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("取消后 %v 才返回", elapsed)
+	}
+}
+
+func TestSocketBackendConfig(t *testing.T) {
+	tests := []struct {
+		name, uri string
+	}{
+		{"lpd", "lpd://192.0.2.1"},
+		{"lpd", "socket://192.0.2.1/raw"},
+		{"socket", "socket://"},
+		{"socket", "lpd://192.0.2.1:9100"},
+	}
+	for _, tt := range tests {
+		if _, err := NewBackend(tt.name, BackendConfig{URI: tt.uri}); err == nil {
+			t.Errorf("%s %s: 应返回错误", tt.name, tt.uri)
+		}
+	}
+	if _, err := NewBackend("socket", BackendConfig{URI: "socket://192.0.2.1", Settings: map[string]string{"filter": "unknown"}}); err == nil {
+		t.Error("未登记的过滤器应返回错误")
+	}
+
+	b := newSocketTestBackend(t, "lpd", "lpd://printer.local/queue", nil).(*lpdBackend)
+	if b.addr != "printer.local:515" || b.queue != "queue" {
+		t.Errorf("lpd = %+v", b)
+	}
+	r := newSocketTestBackend(t, "socket", "socket://printer.local", nil).(*rawBackend)
+	if r.addr != "printer.local:9100" {
+		t.Errorf("socket = %+v", r)
+	}
+}
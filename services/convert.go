@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Converter 将文档转换为 PDF, 使只能打印 PDF 的后端也能打印其他格式
+type Converter interface {
+	// Formats 返回能转换的扩展名, 如 ".docx"
+	Formats() []string
+	// Convert 将 src 转换为 PDF 并写入 dst, opts 中的纸张、方向等选项用于排版
+	Convert(ctx context.Context, src, dst string, opts PrintOptions) error
+}
+
+var (
+	convertersMu sync.RWMutex
+	converters   []Converter
+)
+
+// RegisterConverter 注册转换器, 多个转换器支持同一格式时先注册的优先
+func RegisterConverter(c Converter) {
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+
+	if c == nil {
+		panic("services: RegisterConverter converter is nil")
+	}
+	converters = append(converters, c)
+}
+
+// converterFor 返回能转换该扩展名的转换器, 没有时返回 nil
+func converterFor(ext string) Converter {
+	convertersMu.RLock()
+	defer convertersMu.RUnlock()
+
+	for _, c := range converters {
+		if containsExt(c.Formats(), ext) {
+			return c
+		}
+	}
+	return nil
+}
+
+// ConvertFormats 返回全部已注册转换器能转换的扩展名
+func ConvertFormats() []string {
+	convertersMu.RLock()
+	defer convertersMu.RUnlock()
+
+	seen := make(map[string]bool)
+	var formats []string
+	for _, c := range converters {
+		for _, ext := range c.Formats() {
+			if !seen[ext] {
+				seen[ext] = true
+				formats = append(formats, ext)
+			}
+		}
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// ConvertToPDF 将文件转换为临时 PDF 文件, 返回其路径和清理函数
+func ConvertToPDF(ctx context.Context, filePath string, opts PrintOptions) (string, func(), error) {
+	ext := filepath.Ext(filePath)
+	c := converterFor(ext)
+	if c == nil {
+		return "", nil, fmt.Errorf("不支持转换的文件类型: %s", ext)
+	}
+
+	out, err := os.CreateTemp("", "printer-convert-*.pdf")
+	if err != nil {
+		return "", nil, fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	out.Close()
+	cleanup := func() { os.Remove(out.Name()) }
+
+	if err := c.Convert(ctx, filePath, out.Name(), opts); err != nil {
+		cleanup()
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		return "", nil, fmt.Errorf("转换为PDF失败: %v", err)
+	}
+	return out.Name(), cleanup, nil
+}
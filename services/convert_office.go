@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OfficeFormats LibreOffice 转换器默认处理的扩展名
+var OfficeFormats = []string{".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".odt", ".ods", ".odp", ".rtf"}
+
+// OfficeConverter 通过无界面的 LibreOffice (soffice --headless --convert-to pdf) 转换 Office 文档
+//
+// LibreOffice 同一用户配置目录同时只能运行一个实例, 因此每个并发槽位使用独立的配置目录,
+// 槽位数即最大并发数. 配置目录在多次转换间复用, 避免每次重新初始化
+type OfficeConverter struct {
+	path       string
+	profileDir string
+	timeout    time.Duration
+	formats    []string
+	// 空闲槽位的编号
+	slots chan int
+}
+
+// NewOfficeConverter 创建转换器. path 为 soffice 可执行文件, profileDir 为用户配置目录的上级目录,
+// timeout 为单个文档的转换超时, concurrency 为最大并发数
+func NewOfficeConverter(path, profileDir string, timeout time.Duration, concurrency int) (*OfficeConverter, error) {
+	if path == "" {
+		path = "soffice"
+	}
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("未找到 LibreOffice: %v", err)
+	}
+	if profileDir == "" {
+		profileDir = filepath.Join(os.TempDir(), "printer-libreoffice")
+	}
+	if profileDir, err = filepath.Abs(profileDir); err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	c := &OfficeConverter{
+		path:       resolved,
+		profileDir: profileDir,
+		timeout:    timeout,
+		formats:    OfficeFormats,
+		slots:      make(chan int, concurrency),
+	}
+	for i := 0; i < concurrency; i++ {
+		c.slots <- i
+	}
+	return c, nil
+}
+
+// Formats 返回能转换的扩展名
+func (c *OfficeConverter) Formats() []string {
+	return c.formats
+}
+
+// Convert 将 src 转换为 PDF 写入 dst, 版式由文档本身决定, 忽略 opts.
+// 等待空闲槽位时也会响应 ctx 取消
+func (c *OfficeConverter) Convert(ctx context.Context, src, dst string, opts PrintOptions) error {
+	var slot int
+	select {
+	case slot = <-c.slots:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { c.slots <- slot }()
+
+	// 输出到 dst 所在目录下的临时目录, 完成后直接重命名
+	outDir, err := os.MkdirTemp(filepath.Dir(dst), "soffice-*")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(outDir)
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	profile := filepath.Join(c.profileDir, "profile-"+strconv.Itoa(slot))
+	cmd := exec.CommandContext(ctx, c.path,
+		"--headless", "--invisible", "--norestore", "--nolockcheck", "--nodefault", "--nologo",
+		"-env:UserInstallation="+fileURL(profile),
+		"--convert-to", "pdf",
+		"--outdir", outDir,
+		src)
+	// soffice 会启动子进程, 超时时需要结束整个进程组
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = 5 * time.Second
+	var output strings.Builder
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("LibreOffice 转换超时 (%s)", c.timeout)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("LibreOffice 转换失败: %v: %s", err, strings.TrimSpace(output.String()))
+	}
+
+	// 转换失败时 soffice 也可能返回0, 以输出文件是否存在为准
+	name := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src)) + ".pdf"
+	if err := os.Rename(filepath.Join(outDir, name), dst); err != nil {
+		return fmt.Errorf("LibreOffice 未生成PDF: %s", strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// fileURL 将本地路径转换为 file:// URL, LibreOffice 的 -env:UserInstallation 需要这种形式
+func fileURL(path string) string {
+	p := filepath.ToSlash(path)
+	if !strings.HasPrefix(p, "/") {
+		// Windows 路径 C:/... 需要补上开头的斜杠
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
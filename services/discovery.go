@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"printer/services/mdns"
+)
+
+// DiscoveryServices 浏览的 DNS-SD 服务类型
+var DiscoveryServices = []string{"_ipp._tcp", "_ipps._tcp", "_pdl-datastream._tcp"}
+
+// ErrDiscoveredNotFound 发现列表中没有该设备
+var ErrDiscoveredNotFound = errors.New("未找到该设备, 请重新扫描")
+
+// DiscoveredPrinter 通过 mDNS 发现的打印机
+type DiscoveredPrinter struct {
+	// 由实例全名生成的标识, 添加到打印机列表时使用
+	ID string `json:"id"`
+	// 实例名, 如 "Office Printer"
+	Name string `json:"name"`
+	// 服务类型, 如 "_ipp._tcp"
+	Service string   `json:"service"`
+	Host    string   `json:"host"`
+	Port    int      `json:"port"`
+	Addrs   []string `json:"addrs"`
+	// TXT 记录 ty: 型号
+	MakeModel string `json:"make_model,omitempty"`
+	// TXT 记录 pdl: 支持的文档格式
+	Formats []string `json:"formats,omitempty"`
+	// TXT 记录 Color/Duplex: 是否支持彩色和双面
+	Color  bool `json:"color"`
+	Duplex bool `json:"duplex"`
+	// TXT 记录 note: 位置
+	Location string `json:"location,omitempty"`
+	// 添加到打印机列表时使用的配置
+	Printer Printer `json:"printer"`
+	// 打印机列表中是否已有相同地址的打印机
+	Registered bool `json:"registered"`
+}
+
+// Discovery 通过 mDNS 发现网络打印机, 并缓存最近一次扫描结果
+type Discovery struct {
+	browser  *mdns.Browser
+	timeout  time.Duration
+	printers *PrinterRegistry
+
+	// 同一时间只进行一次扫描
+	scan      sync.Mutex
+	mu        sync.RWMutex
+	found     []DiscoveredPrinter
+	scannedAt time.Time
+}
+
+// NewDiscovery 创建发现服务, addr 为空时使用 mDNS 组播地址
+func NewDiscovery(printers *PrinterRegistry, addr string, timeout time.Duration) *Discovery {
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	return &Discovery{
+		browser:  &mdns.Browser{Addr: addr},
+		timeout:  timeout,
+		printers: printers,
+	}
+}
+
+// Scan 扫描网络并更新缓存
+func (d *Discovery) Scan(ctx context.Context) ([]DiscoveredPrinter, error) {
+	d.scan.Lock()
+	defer d.scan.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	instances, err := d.browser.Browse(ctx, DiscoveryServices)
+	if err != nil {
+		return nil, fmt.Errorf("扫描打印机失败: %v", err)
+	}
+
+	found := make([]DiscoveredPrinter, 0, len(instances))
+	for _, inst := range instances {
+		found = append(found, newDiscoveredPrinter(inst))
+	}
+
+	d.mu.Lock()
+	d.found = found
+	d.scannedAt = time.Now()
+	d.mu.Unlock()
+	return d.List(), nil
+}
+
+// List 返回缓存的扫描结果, 未扫描过时返回空列表
+func (d *Discovery) List() []DiscoveredPrinter {
+	d.mu.RLock()
+	found := append([]DiscoveredPrinter(nil), d.found...)
+	d.mu.RUnlock()
+
+	registered := make(map[string]bool)
+	for _, p := range d.printers.List() {
+		registered[p.Backend+" "+p.URI] = true
+	}
+	for i := range found {
+		found[i].Registered = registered[found[i].Printer.Backend+" "+found[i].Printer.URI]
+	}
+	return found
+}
+
+// ScannedAt 返回最近一次扫描的时间, 未扫描过时为零值
+func (d *Discovery) ScannedAt() time.Time {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.scannedAt
+}
+
+// Add 将发现的打印机添加到打印机列表, name 为空时使用实例名
+func (d *Discovery) Add(id, name string) (Printer, error) {
+	d.mu.RLock()
+	var printer *Printer
+	for _, p := range d.found {
+		if p.ID == id {
+			printer = &p.Printer
+			break
+		}
+	}
+	d.mu.RUnlock()
+	if printer == nil {
+		return Printer{}, ErrDiscoveredNotFound
+	}
+
+	p := *printer
+	if name != "" {
+		p.Name = name
+	}
+	if err := d.printers.Add(p); err != nil {
+		return Printer{}, err
+	}
+	return p, nil
+}
+
+// newDiscoveredPrinter 解析 TXT 记录 (IPP Everywhere / Bonjour Printing), 生成打印机配置
+func newDiscoveredPrinter(inst mdns.Instance) DiscoveredPrinter {
+	sum := sha1.Sum([]byte(strings.ToLower(inst.Name)))
+	p := DiscoveredPrinter{
+		ID:        hex.EncodeToString(sum[:6]),
+		Name:      inst.InstanceName(),
+		Service:   inst.Service,
+		Host:      strings.TrimSuffix(inst.Host, "."),
+		Port:      inst.Port,
+		MakeModel: inst.TXT("ty"),
+		Color:     inst.TXT("Color") == "T",
+		Duplex:    inst.TXT("Duplex") == "T",
+		Location:  inst.TXT("note"),
+	}
+	for _, ip := range inst.Addrs {
+		p.Addrs = append(p.Addrs, ip.String())
+	}
+	for _, format := range strings.Split(inst.TXT("pdl"), ",") {
+		if format = strings.TrimSpace(format); format != "" {
+			p.Formats = append(p.Formats, format)
+		}
+	}
+
+	p.Printer = Printer{
+		Name:     strings.NewReplacer("/", "-", "\\", "-").Replace(p.Name),
+		Location: p.Location,
+		Enabled:  true,
+	}
+	hostPort := net.JoinHostPort(p.connectHost(inst), fmt.Sprint(p.Port))
+	switch inst.Service {
+	case "_ipp._tcp", "_ipps._tcp":
+		scheme := "ipp"
+		if inst.Service == "_ipps._tcp" {
+			scheme = "ipps"
+		}
+		u := url.URL{Scheme: scheme, Host: hostPort, Path: "/" + strings.TrimPrefix(inst.TXT("rp"), "/")}
+		p.Printer.Backend = "ipp"
+		p.Printer.URI = u.String()
+	default:
+		p.Printer.Backend = "socket"
+		p.Printer.URI = "socket://" + hostPort
+	}
+	if exts := formatExtensions(p.Formats); len(exts) > 0 {
+		p.Printer.Settings = map[string]string{"formats": strings.Join(exts, ",")}
+	}
+	return p
+}
+
+// connectHost 优先使用 IPv4 地址, 避免依赖系统解析 .local 主机名
+func (p DiscoveredPrinter) connectHost(inst mdns.Instance) string {
+	for _, ip := range inst.Addrs {
+		if ip.To4() != nil {
+			return ip.String()
+		}
+	}
+	if len(inst.Addrs) > 0 {
+		return inst.Addrs[0].String()
+	}
+	return p.Host
+}
+
+// formatExtensions 将 pdl 中的 MIME 类型转换为可直接提交的扩展名
+func formatExtensions(formats []string) []string {
+	seen := make(map[string]bool)
+	var exts []string
+	for ext, format := range documentFormats {
+		for _, f := range formats {
+			if strings.EqualFold(f, format) && !seen[ext] {
+				seen[ext] = true
+				exts = append(exts, ext)
+			}
+		}
+	}
+	sort.Strings(exts)
+	return exts
+}
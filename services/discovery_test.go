@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"printer/services/mdns"
+)
+
+func TestDiscoveryScan(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	responder := &mdns.Responder{Instances: []mdns.Instance{
+		{
+			Name:    "Office Printer._ipp._tcp.local.",
+			Service: "_ipp._tcp",
+			Host:    "office.local.",
+			Port:    631,
+			Addrs:   []net.IP{net.ParseIP("2001:db8::10"), net.IPv4(192, 0, 2, 10).To4()},
+			Text: map[string]string{
+				"rp": "ipp/print", "ty": "HP LaserJet", "note": "3楼东侧",
+				"pdl": "application/pdf,image/urf,application/postscript", "Color": "T", "Duplex": "F",
+			},
+		},
+		{
+			Name:    "Lobby/1F._pdl-datastream._tcp.local.",
+			Service: "_pdl-datastream._tcp",
+			Host:    "lobby.local.",
+			Port:    9100,
+			Addrs:   []net.IP{net.IPv4(192, 0, 2, 11).To4()},
+		},
+	}}
+	go responder.Serve(conn)
+
+	registry, err := NewPrinterRegistry(filepath.Join(t.TempDir(), "printers.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	discovery := NewDiscovery(registry, conn.LocalAddr().String(), 500*time.Millisecond)
+	found, err := discovery.Scan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("found = %+v", found)
+	}
+
+	lobby, office := found[0], found[1]
+	if office.Name != "Office Printer" || office.MakeModel != "HP LaserJet" || office.Location != "3楼东侧" ||
+		!office.Color || office.Duplex {
+		t.Errorf("office = %+v", office)
+	}
+	// 优先使用 IPv4 地址
+	if office.Printer.Backend != "ipp" || office.Printer.URI != "ipp://192.0.2.10:631/ipp/print" {
+		t.Errorf("office printer = %+v", office.Printer)
+	}
+	if want := map[string]string{"formats": ".pdf,.ps,.urf"}; !reflect.DeepEqual(office.Printer.Settings, want) {
+		t.Errorf("office settings = %v", office.Printer.Settings)
+	}
+	if lobby.Printer.Backend != "socket" || lobby.Printer.URI != "socket://192.0.2.11:9100" || lobby.Printer.Name != "Lobby-1F" {
+		t.Errorf("lobby printer = %+v", lobby.Printer)
+	}
+
+	p, err := discovery.Add(office.ID, "office")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := registry.Get("office"); err != nil || got.URI != p.URI {
+		t.Fatalf("registered = %+v, %v", got, err)
+	}
+	for _, d := range discovery.List() {
+		if d.Registered != (d.ID == office.ID) {
+			t.Errorf("%s: registered = %v", d.Name, d.Registered)
+		}
+	}
+	if _, err := discovery.Add("unknown", ""); !errors.Is(err, ErrDiscoveredNotFound) {
+		t.Errorf("unknown id: err = %v", err)
+	}
+}
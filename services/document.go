@@ -0,0 +1,123 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrDocumentTooLarge 文档超过大小上限
+var ErrDocumentTooLarge = errors.New("文档超过大小上限")
+
+// maxDocumentStem 保存文档时文件名主干的最多字符数
+const maxDocumentStem = 80
+
+// SniffDocumentFormat 按文件头识别文档的 MIME 类型, 无法识别时返回 application/octet-stream.
+// head 通常为文档的前 512 字节
+func SniffDocumentFormat(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return "application/pdf"
+	case bytes.HasPrefix(head, []byte("%!")):
+		return "application/postscript"
+	case bytes.HasPrefix(head, []byte("\x1bE")), bytes.HasPrefix(head, []byte("\x1b%-12345X")):
+		return "application/vnd.hp-pcl"
+	case bytes.HasPrefix(head, []byte("RaS2")):
+		return "image/pwg-raster"
+	case bytes.HasPrefix(head, []byte("UNIRAST")):
+		return "image/urf"
+	}
+
+	format, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err == nil && DocumentExtension(format) != "" {
+		return format
+	}
+	return "application/octet-stream"
+}
+
+// DocumentExtension 返回 MIME 类型对应的扩展名, 未知的类型返回空字符串
+func DocumentExtension(format string) string {
+	ext := ""
+	for e, f := range documentFormats {
+		// 同一类型有多个扩展名时取最短的, 如 .jpg
+		if f == format && (ext == "" || len(e) < len(ext) || len(e) == len(ext) && e < ext) {
+			ext = e
+		}
+	}
+	return ext
+}
+
+// SaveDocument 将 r 中的文档保存到 dir, 返回保存的文件名.
+// 文件名由 name 去掉目录和扩展名后加随机后缀和 ext 组成, 不会覆盖已有文件.
+// limit 大于 0 时超过 limit 字节的文档不保存, 返回 ErrDocumentTooLarge
+func SaveDocument(dir, name, ext string, r io.Reader, limit int64) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	var file *os.File
+	var filename string
+	for i := 0; ; i++ {
+		filename = documentName(name, ext)
+		var err error
+		file, err = os.OpenFile(filepath.Join(dir, filename), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) || i >= 3 {
+			return "", fmt.Errorf("创建文件失败: %v", err)
+		}
+	}
+
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	n, err := io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && limit > 0 && n > limit {
+		err = ErrDocumentTooLarge
+	}
+	if err != nil {
+		os.Remove(filepath.Join(dir, filename))
+		if errors.Is(err, ErrDocumentTooLarge) {
+			return "", err
+		}
+		return "", fmt.Errorf("保存文件失败: %v", err)
+	}
+	return filename, nil
+}
+
+// documentName 由客户端提供的名称生成安全的文件名
+func documentName(name, ext string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = name[strings.LastIndex(name, "/")+1:]
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	stem = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, stem)
+	stem = strings.Trim(stem, " .")
+	if utf8.RuneCountInString(stem) > maxDocumentStem {
+		stem = string([]rune(stem)[:maxDocumentStem])
+	}
+	if stem == "" {
+		stem = "document"
+	}
+
+	b := make([]byte, 3)
+	rand.Read(b)
+	return stem + "-" + hex.EncodeToString(b) + ext
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrHostNotAllowed 地址不在允许列表中或在禁止列表中
+	ErrHostNotAllowed = errors.New("不允许访问该地址")
+	// ErrNotDocument 地址返回的是网页, 通常是登录页或错误页
+	ErrNotDocument = errors.New("地址返回的是网页而不是文档, 可能需要登录或地址有误")
+	// ErrFetchFailed 下载失败
+	ErrFetchFailed = errors.New("下载失败")
+)
+
+// FetchSettings 从 URL 下载文档的设置
+type FetchSettings struct {
+	// 允许的主机, 不能为空.
+	// 每项为主机名、"*.域名"、IP 地址或 CIDR, 如 intranet.example.com, *.example.com, 10.0.0.0/8
+	Allow []string
+	// 禁止的主机, 格式同 Allow, 优先于 Allow
+	Deny []string
+	// 文档大小上限 (字节), 0 表示不限制
+	MaxSize int64
+	// 最多跟随的重定向次数
+	MaxRedirects int
+	// 整个下载的超时
+	Timeout time.Duration
+}
+
+// hostRules 主机名和网段规则
+type hostRules struct {
+	names []string
+	nets  []*net.IPNet
+}
+
+func parseHostRules(list []string) (hostRules, error) {
+	var rules hostRules
+	for _, item := range list {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			_, ipNet, err := net.ParseCIDR(item)
+			if err != nil {
+				return rules, fmt.Errorf("网段无效: %s", item)
+			}
+			rules.nets = append(rules.nets, ipNet)
+			continue
+		}
+		if ip := net.ParseIP(strings.Trim(item, "[]")); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			rules.nets = append(rules.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		rules.names = append(rules.names, strings.TrimSuffix(item, "."))
+	}
+	return rules, nil
+}
+
+func (r hostRules) empty() bool {
+	return len(r.names) == 0 && len(r.nets) == 0
+}
+
+// matchName 判断主机名是否匹配, "*.example.com" 匹配其下的各级子域名
+func (r hostRules) matchName(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, name := range r.names {
+		if suffix, ok := strings.CutPrefix(name, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r hostRules) matchIP(ip net.IP) bool {
+	for _, n := range r.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// specialIP 判断是否为本机、链路本地或组播等不应通过允许的网段间接放行的地址
+func specialIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast()
+}
+
+// matchSpecialIP 判断特殊地址是否被明确列出, 即包含它的网段本身也位于特殊地址范围内,
+// 如 127.0.0.1 或 169.254.0.0/16, 而 0.0.0.0/0 不算
+func (r hostRules) matchSpecialIP(ip net.IP) bool {
+	for _, n := range r.nets {
+		if ones, _ := n.Mask.Size(); ones > 0 && n.Contains(ip) && specialIP(n.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// URLFetcher 从 URL 下载文档到上传目录.
+// 为防止借打印服务访问内网中不该访问的地址 (SSRF), 只能下载允许列表中的主机,
+// 每次连接前都按允许和禁止列表检查主机名和解析出的 IP,
+// 并直接连接检查过的 IP; 本机、链路本地 (含云服务器元数据地址) 和组播地址除非在允许列表中明确列出, 否则一律禁止.
+// 不使用环境变量中的代理
+type URLFetcher struct {
+	settings FetchSettings
+	allow    hostRules
+	deny     hostRules
+	client   *http.Client
+}
+
+// NewURLFetcher 创建下载器
+func NewURLFetcher(settings FetchSettings) (*URLFetcher, error) {
+	if settings.Timeout <= 0 {
+		settings.Timeout = 60 * time.Second
+	}
+	f := &URLFetcher{settings: settings}
+	var err error
+	if f.allow, err = parseHostRules(settings.Allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parseHostRules(settings.Deny); err != nil {
+		return nil, err
+	}
+	if f.allow.empty() {
+		return nil, errors.New("允许下载的主机列表为空")
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	transport := &http.Transport{
+		Proxy: nil,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return f.dial(ctx, dialer, network, addr)
+		},
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	f.client = &http.Client{
+		Transport: transport,
+		Timeout:   settings.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > settings.MaxRedirects {
+				return fmt.Errorf("重定向超过 %d 次", settings.MaxRedirects)
+			}
+			return checkFetchURL(req.URL)
+		},
+	}
+	return f, nil
+}
+
+// checkFetchURL 只允许 http 和 https
+func checkFetchURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: 只支持 http 和 https 地址", ErrHostNotAllowed)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("%w: 缺少主机名", ErrHostNotAllowed)
+	}
+	return nil
+}
+
+// checkHost 按主机名检查, 返回主机名是否在允许列表中.
+// 主机名不在允许列表中但允许列表含网段时, 留到解析出 IP 后再判断
+func (f *URLFetcher) checkHost(host string) (bool, error) {
+	if f.deny.matchName(host) {
+		return false, fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return false, f.checkIP(host, ip, false)
+	}
+	allowed := f.allow.matchName(host)
+	if !allowed && len(f.allow.nets) == 0 {
+		return false, fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+	return allowed, nil
+}
+
+// checkIP 检查要连接的 IP, hostAllowed 为主机名是否已在允许列表中
+func (f *URLFetcher) checkIP(host string, ip net.IP, hostAllowed bool) error {
+	switch {
+	case f.deny.matchIP(ip):
+	case specialIP(ip):
+		if f.allow.matchSpecialIP(ip) {
+			return nil
+		}
+	case f.allow.matchIP(ip), hostAllowed:
+		return nil
+	}
+	if host == ip.String() {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+	return fmt.Errorf("%w: %s (%s)", ErrHostNotAllowed, host, ip)
+}
+
+// dial 解析主机名并检查每个 IP, 连接第一个允许且能连上的 IP
+func (f *URLFetcher) dial(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	hostAllowed, err := f.checkHost(host)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var firstErr error
+	for _, a := range addrs {
+		if err := f.checkIP(host, a.IP, hostAllowed); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(a.IP.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		firstErr = err
+	}
+	if firstErr == nil {
+		firstErr = fmt.Errorf("无法解析主机 %s", host)
+	}
+	return nil, firstErr
+}
+
+// Fetch 下载 rawURL 指向的文档并保存到 dir, 返回保存的文件名.
+// 扩展名优先按文档内容判断, 无法判断时依次按服务器给出的文件名、URL 路径和 Content-Type 判断
+func (f *URLFetcher) Fetch(ctx context.Context, rawURL, dir string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("地址无效: %v", err)
+	}
+	if err := checkFetchURL(u); err != nil {
+		return "", err
+	}
+	if _, err := f.checkHost(u.Hostname()); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("地址无效: %v", err)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrHostNotAllowed) {
+			// 重定向或解析到了不允许的地址
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				return "", urlErr.Err
+			}
+			return "", err
+		}
+		return "", fmt.Errorf("%w: %v", ErrFetchFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: 服务器返回 %s", ErrFetchFailed, resp.Status)
+	}
+	if f.settings.MaxSize > 0 && resp.ContentLength > f.settings.MaxSize {
+		return "", ErrDocumentTooLarge
+	}
+
+	body := bufio.NewReader(resp.Body)
+	head, _ := body.Peek(512)
+	name := fetchFilename(resp)
+	ext, err := fetchExtension(head, name, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return "", err
+	}
+	filename, err := SaveDocument(dir, name, ext, body, f.settings.MaxSize)
+	if err != nil && !errors.Is(err, ErrDocumentTooLarge) {
+		return "", fmt.Errorf("%w: %v", ErrFetchFailed, err)
+	}
+	return filename, err
+}
+
+// fetchFilename 返回服务器在 Content-Disposition 中给出的文件名, 没有时使用最终 URL 路径的最后一段
+func fetchFilename(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return path.Base(strings.ReplaceAll(params["filename"], "\\", "/"))
+	}
+	name := path.Base(resp.Request.URL.Path)
+	if name == "/" || name == "." {
+		return resp.Request.URL.Hostname()
+	}
+	return name
+}
+
+// fetchExtension 确定下载文档的扩展名
+func fetchExtension(head []byte, name, contentType string) (string, error) {
+	sniffed := SniffDocumentFormat(head)
+	if sniffed != "application/octet-stream" && sniffed != "text/plain" {
+		return DocumentExtension(sniffed), nil
+	}
+	if strings.HasPrefix(http.DetectContentType(head), "text/html") {
+		return "", ErrNotDocument
+	}
+	if ext := strings.ToLower(path.Ext(name)); ext != "" {
+		return ext, nil
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if ext := DocumentExtension(mediaType); ext != "" {
+			return ext, nil
+		}
+	}
+	if sniffed == "text/plain" {
+		return ".txt", nil
+	}
+	return "", fmt.Errorf("无法确定文档类型: %s", name)
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestURLFetcherRequiresAllowList(t *testing.T) {
+	if _, err := NewURLFetcher(FetchSettings{Deny: []string{"10.0.0.0/8"}}); err == nil {
+		t.Fatal("允许列表为空时应返回错误")
+	}
+}
+
+func TestURLFetcherFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/doc", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("%PDF-1.4\n"))
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<!DOCTYPE html><html><body>login</body></html>"))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://192.168.0.1/doc", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// 本机地址只有按 IP 列出时才允许
+	fetcher, err := NewURLFetcher(FetchSettings{Allow: []string{"127.0.0.1"}, MaxRedirects: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	name, err := fetcher.Fetch(ctx, server.URL+"/doc", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(name) != ".pdf" {
+		t.Fatalf("filename = %s", name)
+	}
+	if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fetcher.Fetch(ctx, server.URL+"/login", dir); !errors.Is(err, ErrNotDocument) {
+		t.Fatalf("网页: err = %v", err)
+	}
+	for _, u := range []string{
+		"http://10.0.0.1/doc",
+		"file:///etc/passwd",
+		server.URL + "/redirect",
+	} {
+		if _, err := fetcher.Fetch(ctx, u, dir); !errors.Is(err, ErrHostNotAllowed) {
+			t.Errorf("%s: err = %v", u, err)
+		}
+	}
+}
+
+func TestURLFetcherDenyLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("%PDF-1.4\n"))
+	}))
+	defer server.Close()
+
+	// 网段包含本机地址但没有按 IP 列出
+	fetcher, err := NewURLFetcher(FetchSettings{Allow: []string{"0.0.0.0/0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetcher.Fetch(context.Background(), server.URL, t.TempDir()); !errors.Is(err, ErrHostNotAllowed) {
+		t.Fatalf("err = %v", err)
+	}
+}
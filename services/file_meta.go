@@ -0,0 +1,126 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"printer/services/pdf"
+)
+
+// FileMeta 上传文件的检查结果, 目前只检查 PDF
+type FileMeta struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// PDF 的页数、页面尺寸等, 其他格式为 nil
+	PDF *pdf.Info `json:"pdf,omitempty"`
+}
+
+// Pages 返回文件页数, 未知时返回0
+func (m *FileMeta) Pages() int {
+	if m == nil || m.PDF == nil {
+		return 0
+	}
+	return m.PDF.Pages
+}
+
+// CheckPrintable 检查文件能否按 opts 打印: 设置了打开密码的 PDF 无法打印,
+// 已知页数时页码范围不能超出
+func (m *FileMeta) CheckPrintable(opts PrintOptions) error {
+	if m == nil || m.PDF == nil {
+		return nil
+	}
+	if m.PDF.NeedsPassword {
+		return fmt.Errorf("文档设置了打开密码, 无法打印")
+	}
+	if m.PDF.Pages > 0 {
+		_, err := ResolvePageRanges(opts.Ranges(), m.PDF.Pages)
+		return err
+	}
+	return nil
+}
+
+// FileMetaStore 保存上传文件的检查结果, 每个文件对应 dir/.meta/<文件名>.json,
+// 文件大小或修改时间变化后重新检查
+type FileMetaStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileMetaStore 创建检查结果存储, dir 为上传目录
+func NewFileMetaStore(dir string) *FileMetaStore {
+	return &FileMetaStore{dir: dir}
+}
+
+func (s *FileMetaStore) metaPath(filename string) string {
+	return filepath.Join(s.dir, ".meta", filename+".json")
+}
+
+// Inspect 检查文件并保存结果
+func (s *FileMetaStore) Inspect(filename string) (*FileMeta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inspectLocked(filename)
+}
+
+func (s *FileMetaStore) inspectLocked(filename string) (*FileMeta, error) {
+	path := filepath.Join(s.dir, filename)
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	meta := &FileMeta{Size: stat.Size(), ModTime: stat.ModTime()}
+	if strings.EqualFold(filepath.Ext(filename), ".pdf") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		info, err := pdf.Inspect(data)
+		if errors.Is(err, pdf.ErrNotPDF) {
+			info = &pdf.Info{Damaged: true, Problems: []string{err.Error()}}
+		}
+		meta.PDF = info
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.metaPath(filename)), 0755); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(s.metaPath(filename), data); err != nil {
+		return nil, fmt.Errorf("保存文件信息失败: %v", err)
+	}
+	return meta, nil
+}
+
+// Get 返回保存的检查结果, 没有或已过期时重新检查
+func (s *FileMetaStore) Get(filename string) (*FileMeta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stat, err := os.Stat(filepath.Join(s.dir, filename))
+	if err != nil {
+		return nil, err
+	}
+	if data, err := os.ReadFile(s.metaPath(filename)); err == nil {
+		var meta FileMeta
+		if json.Unmarshal(data, &meta) == nil && meta.Size == stat.Size() && meta.ModTime.Equal(stat.ModTime()) {
+			return &meta, nil
+		}
+	}
+	return s.inspectLocked(filename)
+}
+
+// Delete 删除文件的检查结果
+func (s *FileMetaStore) Delete(filename string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	os.Remove(s.metaPath(filename))
+}
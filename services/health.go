@@ -0,0 +1,371 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"printer/services/snmp"
+)
+
+// 状态检查方式
+const (
+	MonitorAuto = "auto"
+	MonitorIPP  = "ipp"
+	MonitorSNMP = "snmp"
+	MonitorNone = "none"
+)
+
+// SupplyLevelUnknown 耗材或纸盒余量未知
+const SupplyLevelUnknown = -1
+
+// Supply 耗材 (墨粉、硒鼓等)
+type Supply struct {
+	Name string `json:"name"`
+	// 如 toner, ink-cartridge, 参见 marker-types
+	Type string `json:"type,omitempty"`
+	// 颜色, 如 #000000
+	Color string `json:"color,omitempty"`
+	// 剩余百分比, 未知时为 -1
+	Level int `json:"level"`
+	// 是否低于打印机设定的警告线
+	Low bool `json:"low,omitempty"`
+}
+
+// InputTray 纸盒
+type InputTray struct {
+	Name string `json:"name"`
+	// 剩余百分比, 未知时为 -1
+	Level int `json:"level"`
+}
+
+// MonitorConfig 打印机状态检查设置
+type MonitorConfig struct {
+	// auto, ipp, snmp, none, 为空时同 auto:
+	// 后端能查询状态时 (如 ipp) 使用后端, 否则对地址中的主机使用 SNMP
+	Method string `json:"method,omitempty"`
+	// SNMP 地址, 为空时使用打印机地址中的主机
+	SNMPAddr string `json:"snmp_addr,omitempty"`
+	// SNMP 团体名, 默认 public
+	Community string `json:"community,omitempty"`
+	// SNMP 版本: 1 或 2c, 默认 2c
+	SNMPVersion string `json:"snmp_version,omitempty"`
+}
+
+// validate 检查状态检查设置
+func (m MonitorConfig) validate() error {
+	switch m.Method {
+	case "", MonitorAuto, MonitorIPP, MonitorSNMP, MonitorNone:
+	default:
+		return fmt.Errorf("状态检查方式无效: %s", m.Method)
+	}
+	switch m.SNMPVersion {
+	case "", "1", "2c":
+	default:
+		return fmt.Errorf("SNMP版本无效: %s", m.SNMPVersion)
+	}
+	return nil
+}
+
+// 不带严重程度后缀时会导致无法打印的 printer-state-reasons
+var blockingReasons = map[string]bool{
+	"media-empty":           true,
+	"media-jam":             true,
+	"media-needed":          true,
+	"toner-empty":           true,
+	"marker-supply-empty":   true,
+	"marker-supply-missing": true,
+	"door-open":             true,
+	"cover-open":            true,
+	"interlock-open":        true,
+	"input-tray-missing":    true,
+	"output-tray-missing":   true,
+	"output-area-full":      true,
+	"offline":               true,
+	"shutdown":              true,
+	"spool-area-full":       true,
+}
+
+// BlockingReasons 返回导致打印机无法打印的原因.
+// 带 -error 后缀的原因总是算作阻塞, 带 -warning 或 -report 后缀的不算
+func (s PrinterStatus) BlockingReasons() []string {
+	var blocking []string
+	for _, reason := range s.Reasons {
+		switch {
+		case strings.HasSuffix(reason, "-warning"), strings.HasSuffix(reason, "-report"):
+		case strings.HasSuffix(reason, "-error"), blockingReasons[reason]:
+			blocking = append(blocking, reason)
+		}
+	}
+	return blocking
+}
+
+// PrinterHealth 最近一次状态检查的结果
+type PrinterHealth struct {
+	Printer string `json:"printer"`
+	// 是否可以接收任务, 不可用的打印机上的任务会保持排队直到恢复.
+	// 只有查询到已停止或缺纸、卡纸等阻塞原因时才为 false, 查询失败时为 true
+	Available bool `json:"available"`
+	// 状态来源: ipp, snmp, 不检查时为 none
+	Source string        `json:"source"`
+	Status PrinterStatus `json:"status"`
+	// 查询失败或不可用的原因
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// HealthMonitor 定期检查已登记打印机的状态, 并缓存结果
+type HealthMonitor struct {
+	printers *PrinterRegistry
+	interval time.Duration
+	timeout  time.Duration
+
+	mu     sync.RWMutex
+	health map[string]PrinterHealth
+	// 打印机恢复可用时调用
+	onAvailable []func()
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewHealthMonitor 创建状态检查器, interval 为检查间隔, timeout 为单台打印机的检查超时
+func NewHealthMonitor(printers *PrinterRegistry, interval, timeout time.Duration) *HealthMonitor {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &HealthMonitor{
+		printers: printers,
+		interval: interval,
+		timeout:  timeout,
+		health:   make(map[string]PrinterHealth),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// OnAvailable 注册打印机恢复可用时的回调, 需在 Start 之前调用
+func (m *HealthMonitor) OnAvailable(fn func()) {
+	m.onAvailable = append(m.onAvailable, fn)
+}
+
+// Start 启动后台检查, interval 不大于0时不定期检查
+func (m *HealthMonitor) Start() {
+	if m.interval <= 0 {
+		return
+	}
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			m.CheckAll(m.ctx)
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop 停止后台检查
+func (m *HealthMonitor) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// CheckAll 并发检查全部已启用的打印机
+func (m *HealthMonitor) CheckAll(ctx context.Context) {
+	var printers []Printer
+	for _, p := range m.printers.List() {
+		if p.Enabled {
+			printers = append(printers, p)
+		}
+	}
+
+	results := make([]PrinterHealth, len(printers))
+	var wg sync.WaitGroup
+	for i, p := range printers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = m.check(ctx, p)
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	health := make(map[string]PrinterHealth, len(results))
+	for _, h := range results {
+		health[h.Printer] = h
+	}
+	m.update(health, true)
+}
+
+// Check 立即检查一台打印机并更新缓存
+func (m *HealthMonitor) Check(ctx context.Context, name string) (PrinterHealth, error) {
+	p, err := m.printers.Get(name)
+	if err != nil {
+		return PrinterHealth{}, err
+	}
+	if !p.Enabled {
+		return PrinterHealth{}, ErrPrinterDisabled
+	}
+	h := m.check(ctx, p)
+	m.update(map[string]PrinterHealth{name: h}, false)
+	return h, nil
+}
+
+// update 写入检查结果, replace 为 true 时丢弃不在 health 中的旧结果
+func (m *HealthMonitor) update(health map[string]PrinterHealth, replace bool) {
+	m.mu.Lock()
+	recovered := false
+	for name, h := range health {
+		if old, ok := m.health[name]; ok && !old.Available && h.Available {
+			recovered = true
+		}
+		if old, ok := m.health[name]; (!ok || old.Available) && !h.Available {
+			log.Printf("打印机 %s 不可用: %s", name, h.Error)
+		}
+	}
+	if replace {
+		m.health = health
+	} else {
+		for name, h := range health {
+			m.health[name] = h
+		}
+	}
+	m.mu.Unlock()
+
+	if recovered {
+		for _, fn := range m.onAvailable {
+			fn()
+		}
+	}
+}
+
+// List 返回全部缓存的检查结果, 按打印机名称排序
+func (m *HealthMonitor) List() []PrinterHealth {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]PrinterHealth, 0, len(m.health))
+	for _, h := range m.health {
+		list = append(list, h)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Printer < list[j].Printer })
+	return list
+}
+
+// Get 返回打印机的缓存结果, 尚未检查过时 ok 为 false
+func (m *HealthMonitor) Get(name string) (PrinterHealth, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	h, ok := m.health[name]
+	return h, ok
+}
+
+// Available 判断任务能否发往该打印机, 未检查过的打印机和默认打印后端视为可用
+func (m *HealthMonitor) Available(name string) bool {
+	if name == "" {
+		return true
+	}
+	h, ok := m.Get(name)
+	return !ok || h.Available
+}
+
+// check 按打印机的设置查询状态
+func (m *HealthMonitor) check(ctx context.Context, p Printer) PrinterHealth {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	h := PrinterHealth{Printer: p.Name, CheckedAt: time.Now()}
+	status, source, err := m.query(ctx, p)
+	h.Source = source
+	if err != nil {
+		// 查询失败不能说明打印机无法打印 (如未开启 SNMP 或团体名不同), 状态按未知处理, 任务照常发送
+		h.Available = true
+		h.Status = PrinterStatus{State: "unknown"}
+		h.Error = err.Error()
+		return h
+	}
+	h.Status = status
+
+	blocking := status.BlockingReasons()
+	switch {
+	case status.State == "stopped":
+		h.Error = "打印机已停止"
+		if len(blocking) > 0 {
+			h.Error += ": " + strings.Join(blocking, ", ")
+		}
+	case len(blocking) > 0:
+		h.Error = strings.Join(blocking, ", ")
+	default:
+		h.Available = true
+	}
+	return h
+}
+
+// query 返回状态和实际使用的检查方式
+func (m *HealthMonitor) query(ctx context.Context, p Printer) (PrinterStatus, string, error) {
+	method := p.Monitor.Method
+	if method == "" {
+		method = MonitorAuto
+	}
+
+	var reporter StatusReporter
+	if method == MonitorAuto || method == MonitorIPP {
+		service, _, err := m.printers.Resolve(p.Name)
+		if err != nil {
+			return PrinterStatus{}, method, err
+		}
+		reporter, _ = service.Backend.(StatusReporter)
+	}
+
+	switch {
+	case method == MonitorNone:
+		return PrinterStatus{State: "unknown"}, MonitorNone, nil
+	case reporter != nil:
+		status, err := reporter.PrinterStatus(ctx)
+		return status, MonitorIPP, err
+	case method == MonitorIPP:
+		return PrinterStatus{}, MonitorIPP, errors.New("打印后端不支持查询状态")
+	}
+
+	addr := p.Monitor.SNMPAddr
+	if addr == "" {
+		if u, err := url.Parse(p.URI); err == nil {
+			addr = u.Hostname()
+		}
+	}
+	if addr == "" {
+		if method == MonitorAuto {
+			return PrinterStatus{State: "unknown"}, MonitorNone, nil
+		}
+		return PrinterStatus{}, MonitorSNMP, errors.New("未配置SNMP地址")
+	}
+
+	community := p.Monitor.Community
+	if community == "" {
+		community = "public"
+	}
+	client := snmp.NewClient(addr, community)
+	if p.Monitor.SNMPVersion == "1" {
+		client.Version = snmp.Version1
+	}
+	status, err := snmpPrinterStatus(ctx, client)
+	return status, MonitorSNMP, err
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	RegisterBackend("test-status", func(cfg BackendConfig) (PrintBackend, error) {
+		return &statusBackend{FakeBackend: NewFakeBackend(), cfg: cfg}, nil
+	})
+}
+
+// statusBackend 按设置中的 state、reasons 和 error 报告状态
+type statusBackend struct {
+	*FakeBackend
+	cfg BackendConfig
+}
+
+func (b *statusBackend) PrinterStatus(ctx context.Context) (PrinterStatus, error) {
+	if msg := b.cfg.Setting("error", ""); msg != "" {
+		return PrinterStatus{}, errors.New(msg)
+	}
+	return PrinterStatus{
+		State:   b.cfg.Setting("state", "idle"),
+		Reasons: b.cfg.ListSetting("reasons", nil),
+	}, nil
+}
+
+func TestHealthMonitorCheck(t *testing.T) {
+	registry, err := NewPrinterRegistry(filepath.Join(t.TempDir(), "printers.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		settings  map[string]string
+		available bool
+	}{
+		{"idle", nil, true},
+		{"low-toner", map[string]string{"reasons": "toner-low,media-low-warning"}, true},
+		{"stopped", map[string]string{"state": "stopped"}, false},
+		{"jam", map[string]string{"state": "processing", "reasons": "media-jam"}, false},
+		{"door", map[string]string{"reasons": "door-open-error"}, false},
+		// 没有开启 SNMP 或团体名不对的打印机不能一直视为不可用
+		{"unreachable", map[string]string{"error": "请求超时"}, true},
+	}
+	for _, tt := range tests {
+		p := Printer{Name: tt.name, Backend: "test-status", Settings: tt.settings, Enabled: true}
+		if err := registry.Add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	monitor := NewHealthMonitor(registry, 0, time.Second)
+	monitor.CheckAll(context.Background())
+	for _, tt := range tests {
+		h, ok := monitor.Get(tt.name)
+		if !ok {
+			t.Fatalf("%s: 没有检查结果", tt.name)
+		}
+		if h.Available != tt.available || monitor.Available(tt.name) != tt.available {
+			t.Errorf("%s: available = %v, want %v (error %q)", tt.name, h.Available, tt.available, h.Error)
+		}
+		if tt.settings["error"] != "" && !strings.Contains(h.Error, tt.settings["error"]) {
+			t.Errorf("%s: error = %q", tt.name, h.Error)
+		}
+	}
+}
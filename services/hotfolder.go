@@ -0,0 +1,420 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 热文件夹中存放结果的子目录
+const (
+	HotFolderDone   = "done"
+	HotFolderFailed = "failed"
+)
+
+// hotFolderTick 检查已提交任务的结果和等待写入完成的文件的间隔
+const hotFolderTick = time.Second
+
+// HotFolder 热文件夹: 放入目录的文件写入完成后自动提交打印,
+// 任务结束后原文件移入 done 或 failed 子目录, 失败原因写在同名的 .error.txt 中
+type HotFolder struct {
+	// 监视的目录, 只处理其中的文件, 不处理子目录
+	Path string
+	// 目标打印机或打印池, 为空时使用默认打印后端
+	Printer string
+	// 任务的用户
+	User string
+	// 打印选项
+	Options PrintOptions
+}
+
+// hotFile 热文件夹中正在处理的文件
+type hotFile struct {
+	folder *HotFolder
+	// 上次看到的大小和修改时间, 以及从何时起没有变化
+	size    int64
+	modTime time.Time
+	since   time.Time
+	// 已提交的任务
+	job string
+	// 任务已结束, 等待移入的子目录和失败原因
+	result string
+	reason string
+	// 移动失败时只记录一次日志, 之后继续重试
+	moveFailed bool
+}
+
+// HotFolderWatcher 监视若干热文件夹. Linux 下通过 inotify 得知目录变化,
+// 其他系统或 inotify 不可用时定期扫描目录.
+// 文件的大小和修改时间在 settle 时间内不再变化才视为写入完成
+type HotFolderWatcher struct {
+	queue     *JobQueue
+	printers  *PrinterRegistry
+	uploadDir string
+	folders   []*HotFolder
+	settle    time.Duration
+	poll      time.Duration
+	// 是否只使用轮询, 如 SMB/NFS 挂载的目录收不到其他主机写入的 inotify 事件
+	pollOnly bool
+
+	// 路径 -> 正在处理的文件, 只在后台 goroutine 中访问
+	files map[string]*hotFile
+
+	mu sync.Mutex
+	// 有变化需要扫描的目录
+	dirty map[string]bool
+	wake  chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewHotFolderWatcher 创建热文件夹监视器, 并创建各目录及其 done 和 failed 子目录.
+// settle 为文件写入完成的判断时间, poll 为扫描目录的间隔, pollOnly 为 true 时不使用 inotify
+func NewHotFolderWatcher(queue *JobQueue, printers *PrinterRegistry, uploadDir string, folders []HotFolder,
+	settle, poll time.Duration, pollOnly bool) (*HotFolderWatcher, error) {
+	if settle <= 0 {
+		settle = 3 * time.Second
+	}
+	if poll <= 0 {
+		poll = 10 * time.Second
+	}
+
+	w := &HotFolderWatcher{
+		queue:     queue,
+		printers:  printers,
+		uploadDir: uploadDir,
+		settle:    settle,
+		poll:      poll,
+		pollOnly:  pollOnly,
+		files:     make(map[string]*hotFile),
+		dirty:     make(map[string]bool),
+		wake:      make(chan struct{}, 1),
+	}
+	seen := make(map[string]bool)
+	for _, f := range folders {
+		if f.Path == "" {
+			return nil, errors.New("热文件夹未设置目录")
+		}
+		path, err := filepath.Abs(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("热文件夹目录无效: %v", err)
+		}
+		if seen[path] {
+			return nil, fmt.Errorf("热文件夹重复: %s", path)
+		}
+		seen[path] = true
+		if err := f.Options.Validate(); err != nil {
+			return nil, fmt.Errorf("热文件夹 %s: %w", path, err)
+		}
+		for _, dir := range []string{path, filepath.Join(path, HotFolderDone), filepath.Join(path, HotFolderFailed)} {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, fmt.Errorf("创建热文件夹目录失败: %v", err)
+			}
+		}
+		f.Path = path
+		w.folders = append(w.folders, &f)
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	return w, nil
+}
+
+// Start 开始监视. 上次退出时已提交但未移走的文件根据任务的 Source 继续跟踪, 不会重复提交
+func (w *HotFolderWatcher) Start() {
+	for _, job := range w.queue.List() {
+		folder := w.folderOf(job.Source)
+		if folder == nil {
+			continue
+		}
+		if _, err := os.Stat(job.Source); err != nil {
+			continue
+		}
+		w.files[job.Source] = &hotFile{folder: folder, job: job.ID}
+	}
+
+	var watcher io.Closer
+	if !w.pollOnly {
+		dirs := make([]string, len(w.folders))
+		for i, f := range w.folders {
+			dirs[i] = f.Path
+		}
+		var err error
+		watcher, err = watchDirs(dirs, w.changed)
+		if err != nil {
+			log.Printf("无法监视热文件夹, 改为每 %v 扫描一次: %v", w.poll, err)
+		}
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		if watcher != nil {
+			defer watcher.Close()
+		}
+		w.loop()
+	}()
+}
+
+// Stop 停止监视, 已提交的任务继续打印, 下次启动时再移动其文件
+func (w *HotFolderWatcher) Stop() {
+	w.cancel()
+	w.wg.Wait()
+}
+
+// folderOf 返回文件所在的热文件夹, 不在任何热文件夹中时返回 nil
+func (w *HotFolderWatcher) folderOf(path string) *HotFolder {
+	if path == "" {
+		return nil
+	}
+	dir := filepath.Dir(path)
+	for _, f := range w.folders {
+		if f.Path == dir {
+			return f
+		}
+	}
+	return nil
+}
+
+// changed 由目录监视调用, dir 为空表示可能丢失了事件, 需要扫描全部目录
+func (w *HotFolderWatcher) changed(dir string) {
+	w.mu.Lock()
+	w.dirty[dir] = true
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop 在后台依次处理目录变化、写入完成的文件和结束的任务.
+// 只扫描有变化或仍有文件在写入的目录, 并每隔 poll 全部扫描一次, 没有 inotify 时依靠这一定期扫描发现新文件
+func (w *HotFolderWatcher) loop() {
+	ticker := time.NewTicker(hotFolderTick)
+	defer ticker.Stop()
+
+	lastPoll := time.Time{}
+	for {
+		now := time.Now()
+		w.mu.Lock()
+		dirty := w.dirty
+		w.dirty = make(map[string]bool)
+		w.mu.Unlock()
+
+		full := dirty[""] || now.Sub(lastPoll) >= w.poll
+		if full {
+			lastPoll = now
+		}
+		for _, f := range w.folders {
+			if full || dirty[f.Path] || w.settling(f) {
+				w.scan(f, now)
+			}
+		}
+		w.collect()
+
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+// settling 判断目录中是否有等待写入完成的文件
+func (w *HotFolderWatcher) settling(folder *HotFolder) bool {
+	for _, file := range w.files {
+		if file.folder == folder && file.job == "" && file.result == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// skipHotFile 判断是否忽略文件: 隐藏文件、Office 的锁文件和常见的临时文件
+func skipHotFile(name string) bool {
+	lower := strings.ToLower(name)
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~$") {
+		return true
+	}
+	for _, suffix := range []string{".tmp", ".part", ".partial", ".crdownload", ".error.txt"} {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// scan 扫描目录, 提交写入完成的新文件
+func (w *HotFolderWatcher) scan(folder *HotFolder, now time.Time) {
+	entries, err := os.ReadDir(folder.Path)
+	if err != nil {
+		log.Printf("扫描热文件夹 %s 失败: %v", folder.Path, err)
+		return
+	}
+
+	present := make(map[string]bool)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || skipHotFile(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(folder.Path, entry.Name())
+		present[path] = true
+		file, ok := w.files[path]
+		if ok && (file.job != "" || file.result != "") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if !ok || info.Size() != file.size || !info.ModTime().Equal(file.modTime) {
+			w.files[path] = &hotFile{folder: folder, size: info.Size(), modTime: info.ModTime(), since: now}
+			continue
+		}
+		if now.Sub(file.since) >= w.settle {
+			w.submit(path, file)
+		}
+	}
+
+	// 写入完成前就被删除或改名的文件不再跟踪
+	for path, file := range w.files {
+		if file.folder == folder && file.job == "" && file.result == "" && !present[path] {
+			delete(w.files, path)
+		}
+	}
+}
+
+// submit 将文件复制到上传目录并提交任务, 不能打印的文件直接移入 failed
+func (w *HotFolderWatcher) submit(path string, file *hotFile) {
+	folder := file.folder
+	if err := w.enqueue(path, file); err != nil {
+		log.Printf("热文件夹 %s 中的 %s 无法打印: %v", folder.Path, filepath.Base(path), err)
+		file.result = HotFolderFailed
+		file.reason = err.Error()
+		w.move(path, file)
+	}
+}
+
+func (w *HotFolderWatcher) enqueue(path string, file *hotFile) error {
+	folder := file.folder
+	ext := strings.ToLower(filepath.Ext(path))
+	service, opts, err := w.printers.ResolveTarget(folder.Printer, folder.Options)
+	if err != nil {
+		return err
+	}
+	if !service.Capabilities().CanPrint(ext) {
+		return fmt.Errorf("不支持的文件类型: %s", ext)
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("读取文件失败: %v", err)
+	}
+	filename, err := SaveDocument(w.uploadDir, filepath.Base(path), ext, src, 0)
+	src.Close()
+	if err != nil {
+		return fmt.Errorf("保存文件失败: %v", err)
+	}
+
+	job, err := w.queue.Submit(Job{
+		Filename: filename,
+		Printer:  folder.Printer,
+		User:     folder.User,
+		Options:  opts,
+		Source:   path,
+	})
+	if err != nil {
+		os.Remove(filepath.Join(w.uploadDir, filename))
+		return err
+	}
+	file.job = job.ID
+	return nil
+}
+
+// collect 检查已提交的任务, 结束后将原文件移入对应的子目录
+func (w *HotFolderWatcher) collect() {
+	for path, file := range w.files {
+		if file.job != "" && file.result == "" {
+			job, err := w.queue.Get(file.job)
+			switch {
+			case errors.Is(err, ErrJobNotFound):
+				file.result = HotFolderFailed
+				file.reason = "任务记录已不存在"
+			case err != nil || !job.State.Finished():
+				continue
+			case job.State == JobDone:
+				file.result = HotFolderDone
+			case job.State == JobCanceled:
+				file.result = HotFolderFailed
+				file.reason = "任务已取消"
+			default:
+				file.result = HotFolderFailed
+				file.reason = job.Error
+			}
+		}
+		if file.result != "" {
+			w.move(path, file)
+		}
+	}
+}
+
+// move 将文件移入结果子目录, 与已有文件重名时加上时间后缀.
+// 移动失败时保留记录, 之后继续重试, 以免文件被再次提交
+func (w *HotFolderWatcher) move(path string, file *hotFile) {
+	dest, err := moveToDir(path, filepath.Join(file.folder.Path, file.result))
+	if os.IsNotExist(err) {
+		// 原文件已被删除
+		delete(w.files, path)
+		return
+	}
+	if err != nil {
+		if !file.moveFailed {
+			log.Printf("移动热文件夹中的 %s 失败: %v", path, err)
+			file.moveFailed = true
+		}
+		return
+	}
+	delete(w.files, path)
+
+	if file.result == HotFolderFailed && file.reason != "" {
+		if err := os.WriteFile(dest+".error.txt", []byte(file.reason+"\n"), 0644); err != nil {
+			log.Printf("写入失败原因失败: %v", err)
+		}
+	}
+}
+
+// moveToDir 将文件移入 dir, 返回移动后的路径
+func moveToDir(path, dir string) (string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	name := filepath.Base(path)
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	dest := filepath.Join(dir, name)
+	suffix := time.Now().Format("20060102-150405")
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(dest); os.IsNotExist(err) {
+			break
+		}
+		if i == 1 {
+			dest = filepath.Join(dir, stem+"-"+suffix+ext)
+		} else {
+			dest = filepath.Join(dir, fmt.Sprintf("%s-%s-%d%s", stem, suffix, i, ext))
+		}
+	}
+	return dest, os.Rename(path, dest)
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// hotFolderEvents 引起扫描的 inotify 事件: 写入结束、移入、新建和修改
+const hotFolderEvents = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE | syscall.IN_MODIFY
+
+// watchDirs 通过 inotify 监视目录, 目录中有文件变化时调用 changed.
+// 关闭返回的 io.Closer 即停止监视
+func watchDirs(dirs []string, changed func(dir string)) (io.Closer, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify 初始化失败: %v", err)
+	}
+	// 非阻塞的文件描述符由 Go 运行时轮询, Close 时正在进行的 Read 会返回
+	file := os.NewFile(uintptr(fd), "inotify")
+
+	watches := make(map[int32]string)
+	for _, dir := range dirs {
+		wd, err := syscall.InotifyAddWatch(fd, dir, hotFolderEvents)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("监视目录 %s 失败: %v", dir, err)
+		}
+		watches[int32(wd)] = dir
+	}
+
+	go func() {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := file.Read(buf)
+			if errors.Is(err, os.ErrClosed) {
+				return
+			}
+			if err != nil {
+				log.Printf("读取 inotify 事件失败: %v", err)
+				return
+			}
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				offset += syscall.SizeofInotifyEvent + int(event.Len)
+				if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+					// 事件队列溢出, 需要扫描全部目录
+					changed("")
+					continue
+				}
+				if dir, ok := watches[event.Wd]; ok {
+					changed(dir)
+				}
+			}
+		}
+	}()
+	return file, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package services
+
+import (
+	"errors"
+	"io"
+)
+
+// watchDirs 当前系统不支持 inotify, 热文件夹只能定期扫描
+func watchDirs(dirs []string, changed func(dir string)) (io.Closer, error) {
+	return nil, errors.New("当前系统不支持目录监视")
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestHotFolder 创建使用 backend 的队列和 t.TempDir() 下的热文件夹, settle 为 1 秒
+func newTestHotFolder(t *testing.T, backend PrintBackend) (*HotFolderWatcher, *JobQueue, string) {
+	t.Helper()
+	q, dir := newTestQueue(t, backend)
+	folder := filepath.Join(t.TempDir(), "hot")
+	w, err := NewHotFolderWatcher(q, q.printers, dir, []HotFolder{{Path: folder, User: "scanner"}},
+		time.Second, time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, q, folder
+}
+
+// exists 判断文件是否存在
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestHotFolderPickup(t *testing.T) {
+	backend := NewFakeBackend()
+	w, q, folder := newTestHotFolder(t, backend)
+	for _, name := range []string{"report.pdf", "download.pdf.part", ".hidden.pdf", "~$draft.docx"} {
+		writeTestFile(t, folder, name, []byte("%PDF-1.4\n"))
+	}
+	writeTestFile(t, folder, "scan.pdf", []byte("%PDF-1.4\n"))
+
+	now := time.Now()
+	f := w.folders[0]
+	w.scan(f, now)
+	// 还在写入的文件: 两次扫描之间大小发生变化
+	writeTestFile(t, folder, "scan.pdf", []byte("%PDF-1.4\n% more pages\n"))
+	w.scan(f, now.Add(500*time.Millisecond))
+	if jobs := q.List(); len(jobs) != 0 {
+		t.Fatalf("未写入完成的文件被提交: %+v", jobs)
+	}
+
+	w.scan(f, now.Add(1200*time.Millisecond))
+	jobs := q.List()
+	if len(jobs) != 1 || jobs[0].Source != filepath.Join(f.Path, "report.pdf") || jobs[0].User != "scanner" {
+		t.Fatalf("jobs = %+v", jobs)
+	}
+	w.scan(f, now.Add(1600*time.Millisecond))
+	if jobs := q.List(); len(jobs) != 2 {
+		t.Fatalf("scan.pdf 未提交: %+v", jobs)
+	}
+	for _, name := range []string{"download.pdf.part", ".hidden.pdf", "~$draft.docx"} {
+		if _, ok := w.files[filepath.Join(f.Path, name)]; ok {
+			t.Errorf("%s 应被忽略", name)
+		}
+	}
+
+	// 任务结束后移入 done, 再次扫描不会重复提交
+	q.Start(1)
+	for _, job := range q.List() {
+		waitFinished(t, q, job.ID)
+	}
+	w.collect()
+	for _, name := range []string{"report.pdf", "scan.pdf"} {
+		if exists(filepath.Join(folder, name)) || !exists(filepath.Join(folder, HotFolderDone, name)) {
+			t.Errorf("%s 未移入 done", name)
+		}
+	}
+	w.scan(f, now.Add(time.Minute))
+	if len(q.List()) != 2 || len(backend.Printed()) != 2 {
+		t.Errorf("jobs = %d, printed = %d", len(q.List()), len(backend.Printed()))
+	}
+}
+
+func TestHotFolderFailed(t *testing.T) {
+	backend := NewFakeBackend()
+	backend.SetError(errors.New("卡纸"))
+	w, q, folder := newTestHotFolder(t, backend)
+	writeTestFile(t, folder, "report.pdf", []byte("%PDF-1.4\n"))
+	writeTestFile(t, folder, "setup.exe", []byte("MZ"))
+	// failed 中已有同名文件, 移入时加上时间后缀
+	writeTestFile(t, filepath.Join(folder, HotFolderFailed), "setup.exe", []byte("old"))
+
+	now := time.Now()
+	f := w.folders[0]
+	w.scan(f, now)
+	w.scan(f, now.Add(2*time.Second))
+
+	// 不能打印的类型不提交, 直接移入 failed 并写明原因
+	entries, _ := os.ReadDir(filepath.Join(folder, HotFolderFailed))
+	var moved string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "setup-") && strings.HasSuffix(e.Name(), ".exe") {
+			moved = e.Name()
+		}
+	}
+	if moved == "" || exists(filepath.Join(folder, "setup.exe")) {
+		t.Fatalf("setup.exe 未移入 failed: %v", entries)
+	}
+	reason, _ := os.ReadFile(filepath.Join(folder, HotFolderFailed, moved+".error.txt"))
+	if !strings.Contains(string(reason), "不支持的文件类型") {
+		t.Errorf("reason = %q", reason)
+	}
+
+	q.Start(1)
+	jobs := q.List()
+	if len(jobs) != 1 {
+		t.Fatalf("jobs = %+v", jobs)
+	}
+	waitFinished(t, q, jobs[0].ID)
+	w.collect()
+	reason, err := os.ReadFile(filepath.Join(folder, HotFolderFailed, "report.pdf.error.txt"))
+	if err != nil || !strings.Contains(string(reason), "卡纸") {
+		t.Errorf("reason = %q, err = %v", reason, err)
+	}
+	if exists(filepath.Join(folder, "report.pdf")) {
+		t.Error("report.pdf 未移走")
+	}
+}
+
+func TestHotFolderWatcher(t *testing.T) {
+	backend := NewFakeBackend()
+	q, dir := newTestQueue(t, backend)
+	folder := filepath.Join(t.TempDir(), "hot")
+	w, err := NewHotFolderWatcher(q, q.printers, dir, []HotFolder{{Path: folder}},
+		10*time.Millisecond, 10*time.Millisecond, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Start(1)
+	w.Start()
+	defer w.Stop()
+
+	writeTestFile(t, folder, "report.pdf", []byte("%PDF-1.4\n"))
+	done := filepath.Join(folder, HotFolderDone, "report.pdf")
+	deadline := time.Now().Add(10 * time.Second)
+	for !exists(done) {
+		if time.Now().After(deadline) {
+			t.Fatalf("文件未移入 done, jobs = %+v", q.List())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(backend.Printed()) != 1 {
+		t.Errorf("printed = %v", backend.Printed())
+	}
+}
+
+func TestNewHotFolderWatcherInvalid(t *testing.T) {
+	q, dir := newTestQueue(t, NewFakeBackend())
+	folder := t.TempDir()
+	tests := [][]HotFolder{
+		{{Path: ""}},
+		{{Path: folder}, {Path: folder + "/."}},
+		{{Path: folder, Options: PrintOptions{Copies: -1}}},
+	}
+	for _, folders := range tests {
+		if _, err := NewHotFolderWatcher(q, q.printers, dir, folders, 0, 0, true); err == nil {
+			t.Errorf("%+v: 应返回错误", folders)
+		}
+	}
+}
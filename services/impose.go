@@ -0,0 +1,444 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"printer/services/pdf"
+)
+
+// 拼版顺序, 与 CUPS 的 number-up-layout 一致
+const (
+	// 从左到右, 从上到下
+	LayoutLRTB = "lrtb"
+	// 从右到左, 从上到下
+	LayoutRLTB = "rltb"
+	// 从上到下, 从左到右
+	LayoutTBLR = "tblr"
+	// 从上到下, 从右到左
+	LayoutTBRL = "tbrl"
+)
+
+// 拼版时每页周围的边框
+const (
+	BorderNone   = "none"
+	BorderSingle = "single"
+	BorderDouble = "double"
+)
+
+// NumberUpValues 支持的每面页数
+var NumberUpValues = []int{1, 2, 4, 6, 9}
+
+// 海报每个方向最多的纸张数
+const maxPosterTiles = 8
+
+const (
+	// 拼版后纸张四周留白, 单位为点
+	imposeMargin = 18.0
+	// 拼版单元格之间的间距
+	imposeGutter = 6.0
+)
+
+// numberUpGrids 每面页数对应的可选排列 (列数, 行数), 按页面比例选择缩放最大的一种
+var numberUpGrids = map[int][][2]int{
+	2: {{2, 1}, {1, 2}},
+	4: {{2, 2}},
+	6: {{3, 2}, {2, 3}},
+	9: {{3, 3}},
+}
+
+// ParsePoster 解析 "2x3" 形式的海报尺寸, 返回横向和纵向的纸张数
+func ParsePoster(s string) (int, int, error) {
+	c, r, ok := strings.Cut(strings.ToLower(s), "x")
+	cols, err1 := strconv.Atoi(strings.TrimSpace(c))
+	rows, err2 := strconv.Atoi(strings.TrimSpace(r))
+	if !ok || err1 != nil || err2 != nil || cols < 1 || rows < 1 || cols > maxPosterTiles || rows > maxPosterTiles || cols*rows < 2 {
+		return 0, 0, fmt.Errorf("海报尺寸无效: %s", s)
+	}
+	return cols, rows, nil
+}
+
+// Imposed 判断是否需要拼版 (多页合一、小册子或海报)
+func (o PrintOptions) Imposed() bool {
+	return o.NumberUp > 1 || o.IsBooklet() || o.Poster != ""
+}
+
+// IsBooklet 判断是否按骑马钉小册子拼版
+func (o PrintOptions) IsBooklet() bool {
+	return o.Booklet != nil && *o.Booklet
+}
+
+// validateImposition 检查拼版选项, 多页合一、小册子和海报只能选一种
+func (o PrintOptions) validateImposition() error {
+	if o.NumberUp != 0 && !containsInt(NumberUpValues, o.NumberUp) {
+		return fmt.Errorf("每面页数无效: %d", o.NumberUp)
+	}
+	switch o.NumberUpLayout {
+	case "", LayoutLRTB, LayoutRLTB, LayoutTBLR, LayoutTBRL:
+	default:
+		return fmt.Errorf("拼版顺序无效: %s", o.NumberUpLayout)
+	}
+	switch o.PageBorder {
+	case "", BorderNone, BorderSingle, BorderDouble:
+	default:
+		return fmt.Errorf("拼版边框无效: %s", o.PageBorder)
+	}
+	if o.Poster != "" {
+		if _, _, err := ParsePoster(o.Poster); err != nil {
+			return err
+		}
+	}
+	modes := 0
+	for _, on := range []bool{o.NumberUp > 1, o.IsBooklet(), o.Poster != ""} {
+		if on {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return fmt.Errorf("多页合一、小册子和海报只能选择一种")
+	}
+	return nil
+}
+
+// afterImposition 返回拼版后交给后端的选项: 页码范围和方向已在拼版时处理,
+// 小册子未指定双面方式时按短边翻转双面打印
+func (o PrintOptions) afterImposition(caps Capabilities) PrintOptions {
+	booklet := o.IsBooklet()
+	o.PageRanges = ""
+	o.Orientation = ""
+	o.NumberUp = 0
+	o.NumberUpLayout = ""
+	o.PageBorder = ""
+	o.Booklet = nil
+	o.Poster = ""
+	if booklet && o.Duplex == "" && caps.Duplex {
+		o.Duplex = DuplexShortEdge
+	}
+	return o
+}
+
+func containsInt(list []int, n int) bool {
+	for _, item := range list {
+		if item == n {
+			return true
+		}
+	}
+	return false
+}
+
+// ImposePDF 按 opts 的拼版选项重排 PDF, 页码范围在拼版前应用.
+// 返回临时文件路径和清理函数
+func ImposePDF(ctx context.Context, src string, opts PrintOptions) (string, func(), error) {
+	r, pages, err := readPages(src, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	out, cleanup, err := tempPDF("printer-impose-*.pdf")
+	if err != nil {
+		return "", nil, err
+	}
+
+	title := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	err = writePDF(out, title, func(w *pdf.Writer) ([]pdfPage, error) {
+		im := &imposer{ctx: ctx, w: w, im: pdf.NewImporter(r, w), opts: opts}
+		switch {
+		case opts.IsBooklet():
+			return im.booklet(pages)
+		case opts.Poster != "":
+			return im.poster(pages)
+		default:
+			return im.numberUp(pages)
+		}
+	})
+	if err != nil {
+		cleanup()
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		return "", nil, fmt.Errorf("拼版失败: %v", err)
+	}
+	return out, cleanup, nil
+}
+
+// readPages 读取 PDF 并按 opts 的页码范围选出页面
+func readPages(src string, opts PrintOptions) (*pdf.Reader, []pdf.Page, error) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取PDF失败: %v", err)
+	}
+	r, err := pdf.NewReader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.CryptError() != nil {
+		return nil, nil, fmt.Errorf("无法处理加密的文档: %v", r.CryptError())
+	}
+	all, err := r.Pages()
+	if err != nil {
+		return nil, nil, err
+	}
+	ranges, err := ResolvePageRanges(opts.Ranges(), len(all))
+	if err != nil {
+		return nil, nil, err
+	}
+	var pages []pdf.Page
+	for _, rg := range ranges {
+		pages = append(pages, all[rg.First-1:rg.Last]...)
+	}
+	if len(pages) == 0 {
+		return nil, nil, fmt.Errorf("文档没有页面")
+	}
+	return r, pages, nil
+}
+
+// tempPDF 创建临时 PDF 文件, 返回路径和删除它的清理函数
+func tempPDF(pattern string) (string, func(), error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	f.Close()
+	return f.Name(), func() { os.Remove(f.Name()) }, nil
+}
+
+// imposer 拼版时的共享状态
+type imposer struct {
+	ctx  context.Context
+	w    *pdf.Writer
+	im   *pdf.Importer
+	opts PrintOptions
+	font pdf.Ref
+}
+
+// sheet 正在排版的一面纸
+type sheet struct {
+	width, height float64
+	xobjects      pdf.Dict
+	content       strings.Builder
+}
+
+func newSheet(width, height float64) *sheet {
+	return &sheet{width: width, height: height, xobjects: pdf.Dict{}}
+}
+
+// place 将页面等比缩放到 (x, y, w, h) 区域内居中绘制, 返回实际占用的区域
+func (s *sheet) place(im *pdf.Importer, page pdf.Page, x, y, w, h float64) (pdf.Rect, error) {
+	form, err := im.PageForm(page)
+	if err != nil {
+		return pdf.Rect{}, err
+	}
+	pw, ph := page.DisplaySize()
+	scale := min(w/pw, h/ph)
+	x += (w - pw*scale) / 2
+	y += (h - ph*scale) / 2
+	s.draw(form, pdf.PlaceMatrix(page.Box(), page.Rotate(), x, y, scale))
+	return pdf.Rect{LLX: x, LLY: y, URX: x + pw*scale, URY: y + ph*scale}, nil
+}
+
+// draw 按矩阵 m 绘制表单
+func (s *sheet) draw(form pdf.Ref, m [6]float64) {
+	name := pdf.Name("P" + strconv.Itoa(len(s.xobjects)))
+	s.xobjects[name] = form
+	fmt.Fprintf(&s.content, "q %s cm /%s Do Q\n", pdf.FormatMatrix(m), name)
+}
+
+// border 在区域周围画边框
+func (s *sheet) border(r pdf.Rect, style string) {
+	rect := func(r pdf.Rect) {
+		fmt.Fprintf(&s.content, "%s %s %s %s re S\n",
+			pdf.FormatNumber(r.LLX), pdf.FormatNumber(r.LLY), pdf.FormatNumber(r.Width()), pdf.FormatNumber(r.Height()))
+	}
+	switch style {
+	case BorderSingle:
+		s.content.WriteString("q 0.5 w\n")
+		rect(r)
+		s.content.WriteString("Q\n")
+	case BorderDouble:
+		s.content.WriteString("q 0.5 w\n")
+		rect(r)
+		rect(pdf.Rect{LLX: r.LLX - 2, LLY: r.LLY - 2, URX: r.URX + 2, URY: r.URY + 2})
+		s.content.WriteString("Q\n")
+	}
+}
+
+func (s *sheet) page(resources pdf.Dict) pdfPage {
+	if resources == nil {
+		resources = pdf.Dict{}
+	}
+	resources["XObject"] = s.xobjects
+	return pdfPage{width: s.width, height: s.height, resources: resources, content: []byte(s.content.String())}
+}
+
+// sheetSizes 返回可选的纸张宽高. 指定了方向时只有一种, 否则纵向和横向都可以
+func (p *imposer) sheetSizes() [][2]float64 {
+	opts := p.opts
+	if opts.Orientation != "" {
+		w, h := opts.PageSize()
+		return [][2]float64{{w, h}}
+	}
+	opts.Orientation = OrientationPortrait
+	w, h := opts.PageSize()
+	return [][2]float64{{w, h}, {h, w}}
+}
+
+// cell 返回 cols 列 rows 行排列时第 col 列第 row 行 (从上往下) 单元格的左下角和宽高
+func cell(sheetW, sheetH float64, cols, rows, col, row int) (float64, float64, float64, float64) {
+	w := (sheetW - 2*imposeMargin - float64(cols-1)*imposeGutter) / float64(cols)
+	h := (sheetH - 2*imposeMargin - float64(rows-1)*imposeGutter) / float64(rows)
+	x := imposeMargin + float64(col)*(w+imposeGutter)
+	y := sheetH - imposeMargin - float64(row+1)*h - float64(row)*imposeGutter
+	return x, y, w, h
+}
+
+// numberUp 每面纸排 NumberUp 页. 纸张方向和行列数按第一页的比例选择缩放最大的一种
+func (p *imposer) numberUp(pages []pdf.Page) ([]pdfPage, error) {
+	n := p.opts.NumberUp
+	if n < 2 {
+		n = 1
+	}
+	grids := numberUpGrids[n]
+	if grids == nil {
+		grids = [][2]int{{1, 1}}
+	}
+	pw, ph := pages[0].DisplaySize()
+	var sheetW, sheetH float64
+	var cols, rows int
+	best := -1.0
+	for _, size := range p.sheetSizes() {
+		for _, g := range grids {
+			_, _, w, h := cell(size[0], size[1], g[0], g[1], 0, 0)
+			if scale := min(w/pw, h/ph); scale > best {
+				best = scale
+				sheetW, sheetH, cols, rows = size[0], size[1], g[0], g[1]
+			}
+		}
+	}
+
+	var out []pdfPage
+	for start := 0; start < len(pages); start += n {
+		if err := p.ctx.Err(); err != nil {
+			return nil, err
+		}
+		s := newSheet(sheetW, sheetH)
+		for i := 0; i < n && start+i < len(pages); i++ {
+			col, row := layoutPosition(p.opts.NumberUpLayout, cols, rows, i)
+			x, y, w, h := cell(sheetW, sheetH, cols, rows, col, row)
+			placed, err := s.place(p.im, pages[start+i], x, y, w, h)
+			if err != nil {
+				return nil, err
+			}
+			s.border(placed, p.opts.PageBorder)
+		}
+		out = append(out, s.page(nil))
+	}
+	return out, nil
+}
+
+// layoutPosition 返回按拼版顺序第 i 页所在的列和行 (从上往下)
+func layoutPosition(layout string, cols, rows, i int) (int, int) {
+	switch layout {
+	case LayoutRLTB:
+		return cols - 1 - i%cols, i / cols
+	case LayoutTBLR:
+		return i / rows, i % rows
+	case LayoutTBRL:
+		return cols - 1 - i/rows, i % rows
+	}
+	return i % cols, i / cols
+}
+
+// booklet 骑马钉小册子: 页数补齐为4的倍数, 每张横向纸的正反面各排两页,
+// 双面打印后对折即为按顺序装订的小册子
+func (p *imposer) booklet(pages []pdf.Page) ([]pdfPage, error) {
+	n := (len(pages) + 3) / 4 * 4
+	// 纸张固定为横向
+	opts := p.opts
+	opts.Orientation = OrientationLandscape
+	sheetW, sheetH := opts.PageSize()
+
+	var out []pdfPage
+	side := func(left, right int) error {
+		s := newSheet(sheetW, sheetH)
+		for col, idx := range []int{left, right} {
+			// 补齐的空白页
+			if idx >= len(pages) {
+				continue
+			}
+			x, y, w, h := cell(sheetW, sheetH, 2, 1, col, 0)
+			placed, err := s.place(p.im, pages[idx], x, y, w, h)
+			if err != nil {
+				return err
+			}
+			s.border(placed, p.opts.PageBorder)
+		}
+		out = append(out, s.page(nil))
+		return nil
+	}
+	for i := 0; i < n/4; i++ {
+		if err := p.ctx.Err(); err != nil {
+			return nil, err
+		}
+		// 正面: 末页和首页; 反面: 第二页和倒数第二页
+		if err := side(n-1-2*i, 2*i); err != nil {
+			return nil, err
+		}
+		if err := side(2*i+1, n-2-2*i); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// poster 将每页放大到 cols x rows 张纸上, 每张纸打印其中一块, 并在页边标注位置
+func (p *imposer) poster(pages []pdf.Page) ([]pdfPage, error) {
+	cols, rows, _ := ParsePoster(p.opts.Poster)
+	if p.font.Num == 0 {
+		p.font = p.w.Add(pdf.Courier())
+	}
+
+	var out []pdfPage
+	for num, page := range pages {
+		pw, ph := page.DisplaySize()
+		// 选择拼出的海报最大的纸张方向
+		var sheetW, sheetH, tileW, tileH, scale float64
+		for _, size := range p.sheetSizes() {
+			tw, th := size[0]-2*imposeMargin, size[1]-2*imposeMargin
+			if s := min(float64(cols)*tw/pw, float64(rows)*th/ph); s > scale {
+				sheetW, sheetH, tileW, tileH, scale = size[0], size[1], tw, th, s
+			}
+		}
+		form, err := p.im.PageForm(page)
+		if err != nil {
+			return nil, err
+		}
+		// 海报在全部纸张拼成的区域内居中
+		offsetX := (float64(cols)*tileW - pw*scale) / 2
+		offsetY := (float64(rows)*tileH - ph*scale) / 2
+
+		for row := 0; row < rows; row++ {
+			for col := 0; col < cols; col++ {
+				if err := p.ctx.Err(); err != nil {
+					return nil, err
+				}
+				s := newSheet(sheetW, sheetH)
+				x := imposeMargin + offsetX - float64(col)*tileW
+				y := imposeMargin + offsetY - float64(rows-1-row)*tileH
+				fmt.Fprintf(&s.content, "q %s %s %s %s re W n\n",
+					pdf.FormatNumber(imposeMargin), pdf.FormatNumber(imposeMargin), pdf.FormatNumber(tileW), pdf.FormatNumber(tileH))
+				s.draw(form, pdf.PlaceMatrix(page.Box(), page.Rotate(), x, y, scale))
+				s.content.WriteString("Q\n")
+				// 裁切线和位置标注
+				s.border(pdf.Rect{LLX: imposeMargin, LLY: imposeMargin, URX: imposeMargin + tileW, URY: imposeMargin + tileH}, BorderSingle)
+				label := fmt.Sprintf("page %d  row %d/%d  col %d/%d", num+1, row+1, rows, col+1, cols)
+				fmt.Fprintf(&s.content, "BT /F1 7 Tf %s %s Td %s Tj ET\n",
+					pdf.FormatNumber(imposeMargin), pdf.FormatNumber(imposeMargin/2-2), pdf.EncodeLatin1(label))
+				out = append(out, s.page(pdf.Dict{"Font": pdf.Dict{"F1": p.font}}))
+			}
+		}
+	}
+	return out, nil
+}
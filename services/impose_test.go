@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"printer/services/pdf"
+)
+
+// writeImposeSource 写入 n 页 A4 纵向文档, 第 i 页的内容为 "% page i"
+func writeImposeSource(t *testing.T, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "source.pdf")
+	err := writePDF(path, "source", func(w *pdf.Writer) ([]pdfPage, error) {
+		var pages []pdfPage
+		for i := 1; i <= n; i++ {
+			pages = append(pages, pdfPage{width: 595, height: 842, content: []byte(fmt.Sprintf("%% page %d\n", i))})
+		}
+		return pages, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var (
+	drawPattern = regexp.MustCompile(`q (\S+) (\S+) (\S+) (\S+) (\S+) (\S+) cm /(P\d+) Do Q`)
+	pagePattern = regexp.MustCompile(`% page (\d+)`)
+)
+
+// imposeSheet 拼版结果中的一面纸, cells[行][列] 为放在该单元格中的原页码, 0 表示空白
+type imposeSheet struct {
+	width, height float64
+	cells         [][]int
+}
+
+// readImposed 读取拼版结果, 按 cols x rows 的单元格还原每面纸上原页面的位置
+func readImposed(t *testing.T, path string, cols, rows int) []imposeSheet {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := pdf.NewReader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := r.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sheets []imposeSheet
+	for _, page := range pages {
+		box := page.MediaBox()
+		s := imposeSheet{width: box.Width(), height: box.Height(), cells: make([][]int, rows)}
+		for row := range s.cells {
+			s.cells[row] = make([]int, cols)
+		}
+		_, _, cw, ch := cell(s.width, s.height, cols, rows, 0, 0)
+
+		stream, _ := r.Resolve(page.Dict["Contents"]).(*pdf.Stream)
+		content, err := r.Decode(stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, _ := r.Resolve(page.Dict["Resources"]).(pdf.Dict)
+		xobjects, _ := r.Resolve(res["XObject"]).(pdf.Dict)
+		for _, m := range drawPattern.FindAllStringSubmatch(string(content), -1) {
+			form, _ := r.Resolve(xobjects[pdf.Name(m[7])]).(*pdf.Stream)
+			formContent, err := r.Decode(form)
+			if err != nil {
+				t.Fatal(err)
+			}
+			num := pagePattern.FindStringSubmatch(string(formContent))
+			if num == nil {
+				t.Fatalf("表单内容 %q", formContent)
+			}
+			// 页面未旋转, 平移量即放置区域的左下角, 落在所属单元格内
+			x, _ := strconv.ParseFloat(m[5], 64)
+			y, _ := strconv.ParseFloat(m[6], 64)
+			col := int((x - imposeMargin + 0.01) / (cw + imposeGutter))
+			row := rows - 1 - int((y-imposeMargin+0.01)/(ch+imposeGutter))
+			s.cells[row][col], _ = strconv.Atoi(num[1])
+		}
+		sheets = append(sheets, s)
+	}
+	return sheets
+}
+
+func TestLayoutPosition(t *testing.T) {
+	tests := []struct {
+		layout     string
+		cols, rows int
+		want       [][2]int
+	}{
+		{"", 2, 2, [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}}},
+		{LayoutLRTB, 3, 2, [][2]int{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {1, 1}, {2, 1}}},
+		{LayoutRLTB, 2, 2, [][2]int{{1, 0}, {0, 0}, {1, 1}, {0, 1}}},
+		{LayoutTBLR, 3, 2, [][2]int{{0, 0}, {0, 1}, {1, 0}, {1, 1}, {2, 0}, {2, 1}}},
+		{LayoutTBRL, 2, 2, [][2]int{{1, 0}, {1, 1}, {0, 0}, {0, 1}}},
+	}
+	for _, tt := range tests {
+		var got [][2]int
+		for i := 0; i < tt.cols*tt.rows; i++ {
+			col, row := layoutPosition(tt.layout, tt.cols, tt.rows, i)
+			got = append(got, [2]int{col, row})
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q %dx%d: %v, want %v", tt.layout, tt.cols, tt.rows, got, tt.want)
+		}
+	}
+}
+
+func TestImposeNumberUp(t *testing.T) {
+	tests := []struct {
+		name       string
+		pages      int
+		opts       PrintOptions
+		cols, rows int
+		landscape  bool
+		want       [][][]int
+	}{
+		{
+			name: "4-up", pages: 6, opts: PrintOptions{NumberUp: 4}, cols: 2, rows: 2,
+			want: [][][]int{{{1, 2}, {3, 4}}, {{5, 6}, {0, 0}}},
+		},
+		{
+			name: "4-up tbrl", pages: 4, opts: PrintOptions{NumberUp: 4, NumberUpLayout: LayoutTBRL}, cols: 2, rows: 2,
+			want: [][][]int{{{3, 1}, {4, 2}}},
+		},
+		{
+			// 纵向页面两页合一时横放纸张
+			name: "2-up", pages: 3, opts: PrintOptions{NumberUp: 2}, cols: 2, rows: 1, landscape: true,
+			want: [][][]int{{{1, 2}}, {{3, 0}}},
+		},
+		{
+			name: "6-up page ranges", pages: 9, opts: PrintOptions{NumberUp: 6, PageRanges: "2-4,8-"},
+			cols: 3, rows: 2, landscape: true,
+			want: [][][]int{{{2, 3, 4}, {8, 9, 0}}},
+		},
+	}
+	for _, tt := range tests {
+		out, cleanup, err := ImposePDF(context.Background(), writeImposeSource(t, tt.pages), tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		sheets := readImposed(t, out, tt.cols, tt.rows)
+		cleanup()
+
+		var got [][][]int
+		for _, s := range sheets {
+			if (s.width > s.height) != tt.landscape {
+				t.Errorf("%s: 纸张 %vx%v", tt.name, s.width, s.height)
+			}
+			got = append(got, s.cells)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestImposeBooklet(t *testing.T) {
+	booklet := true
+	tests := []struct {
+		name   string
+		pages  int
+		ranges string
+		// 每面纸上左右两页
+		want [][2]int
+	}{
+		{"8 pages", 8, "", [][2]int{{8, 1}, {2, 7}, {6, 3}, {4, 5}}},
+		// 补齐到8页, 空白页排在最后
+		{"5 pages", 5, "", [][2]int{{0, 1}, {2, 0}, {0, 3}, {4, 5}}},
+		{"1 page", 1, "", [][2]int{{0, 1}, {0, 0}}},
+		{"page ranges", 8, "2-7", [][2]int{{0, 2}, {3, 0}, {7, 4}, {5, 6}}},
+	}
+	for _, tt := range tests {
+		opts := PrintOptions{Booklet: &booklet, PageRanges: tt.ranges}
+		out, cleanup, err := ImposePDF(context.Background(), writeImposeSource(t, tt.pages), opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		sheets := readImposed(t, out, 2, 1)
+		cleanup()
+
+		var got [][2]int
+		for _, s := range sheets {
+			if s.width <= s.height {
+				t.Errorf("%s: 小册子纸张应为横向, %vx%v", tt.name, s.width, s.height)
+			}
+			got = append(got, [2]int{s.cells[0][0], s.cells[0][1]})
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestImposeCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := ImposePDF(ctx, writeImposeSource(t, 4), PrintOptions{NumberUp: 2}); err != context.Canceled {
+		t.Errorf("err = %v", err)
+	}
+}
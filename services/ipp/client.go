@@ -0,0 +1,124 @@
+package ipp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+)
+
+// ContentType IPP over HTTP 使用的媒体类型
+const ContentType = "application/ipp"
+
+// StatusError 打印机返回的非成功状态
+type StatusError struct {
+	Status  Status
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("ipp: 状态 0x%04x: %s", uint16(e.Status), e.Message)
+	}
+	return fmt.Sprintf("ipp: 状态 0x%04x", uint16(e.Status))
+}
+
+// Client 向单个打印机发送 IPP 请求
+type Client struct {
+	// 打印机地址, 支持 ipp://, ipps://, http://, https://
+	URI string
+	// 为空时使用 http.DefaultClient
+	HTTPClient *http.Client
+
+	requestID atomic.Uint32
+}
+
+// NewClient 创建指向 uri 的客户端
+func NewClient(uri string) (*Client, error) {
+	if _, err := HTTPURL(uri); err != nil {
+		return nil, err
+	}
+	return &Client{URI: uri}, nil
+}
+
+// HTTPURL 将 ipp:// 地址转换为实际请求的 http:// 地址, 默认端口为631
+func HTTPURL(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("无效的IPP地址: %v", err)
+	}
+	switch u.Scheme {
+	case "ipp":
+		u.Scheme = "http"
+	case "ipps":
+		u.Scheme = "https"
+	case "http", "https":
+		return u.String(), nil
+	default:
+		return "", fmt.Errorf("不支持的IPP地址协议: %s", u.Scheme)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "631")
+	}
+	return u.String(), nil
+}
+
+// NewRequest 创建带有 printer-uri 的请求
+func (c *Client) NewRequest(op Operation) *Message {
+	req := NewRequest(op, c.requestID.Add(1))
+	req.Group(TagOperationGroup).Add("printer-uri", TagURI, c.URI)
+	return req
+}
+
+// Do 发送请求, doc 为可选的文档数据. 状态码不是成功时返回 *StatusError
+func (c *Client) Do(ctx context.Context, req *Message, doc io.Reader) (*Message, error) {
+	target, err := HTTPURL(c.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	var header bytes.Buffer
+	if err := req.Encode(&header); err != nil {
+		return nil, err
+	}
+	var body io.Reader = &header
+	if doc != nil {
+		body = io.MultiReader(&header, doc)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, target, body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", ContentType)
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ipp: HTTP状态 %s", resp.Status)
+	}
+
+	msg, err := Decode(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Status() >= 0x0100 {
+		return msg, &StatusError{
+			Status:  msg.Status(),
+			Message: msg.Attr(TagOperationGroup, "status-message").String(),
+		}
+	}
+	return msg, nil
+}
@@ -0,0 +1,596 @@
+// Package ipp 实现 IPP/1.1 与 IPP/2.0 (RFC 8010/8011) 消息的编解码
+package ipp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Tag IPP 分组标签或值标签
+type Tag byte
+
+// 分组标签
+const (
+	TagOperationGroup   Tag = 0x01
+	TagJobGroup         Tag = 0x02
+	TagEnd              Tag = 0x03
+	TagPrinterGroup     Tag = 0x04
+	TagUnsupportedGroup Tag = 0x05
+)
+
+// 值标签
+const (
+	TagUnsupportedValue Tag = 0x10
+	TagUnknown          Tag = 0x12
+	TagNoValue          Tag = 0x13
+	TagInteger          Tag = 0x21
+	TagBoolean          Tag = 0x22
+	TagEnum             Tag = 0x23
+	TagString           Tag = 0x30
+	TagDate             Tag = 0x31
+	TagResolution       Tag = 0x32
+	TagRange            Tag = 0x33
+	TagBeginCollection  Tag = 0x34
+	TagTextLang         Tag = 0x35
+	TagNameLang         Tag = 0x36
+	TagEndCollection    Tag = 0x37
+	TagText             Tag = 0x41
+	TagName             Tag = 0x42
+	TagKeyword          Tag = 0x44
+	TagURI              Tag = 0x45
+	TagURIScheme        Tag = 0x46
+	TagCharset          Tag = 0x47
+	TagLanguage         Tag = 0x48
+	TagMimeType         Tag = 0x49
+	TagMemberName       Tag = 0x4a
+)
+
+// Operation IPP 操作码
+type Operation uint16
+
+// 常用操作
+const (
+	OpPrintJob             Operation = 0x0002
+	OpValidateJob          Operation = 0x0004
+	OpCreateJob            Operation = 0x0005
+	OpSendDocument         Operation = 0x0006
+	OpCancelJob            Operation = 0x0008
+	OpGetJobAttributes     Operation = 0x0009
+	OpGetJobs              Operation = 0x000a
+	OpGetPrinterAttributes Operation = 0x000b
+)
+
+// Status IPP 状态码
+type Status uint16
+
+// 常用状态码
+const (
+	StatusOK                            Status = 0x0000
+	StatusOKIgnoredOrSubstituted        Status = 0x0001
+	StatusBadRequest                    Status = 0x0400
+	StatusForbidden                     Status = 0x0401
+	StatusNotAuthenticated              Status = 0x0402
+	StatusNotAuthorized                 Status = 0x0403
+	StatusNotPossible                   Status = 0x0404
+	StatusNotFound                      Status = 0x0406
+	StatusRequestEntityTooLarge         Status = 0x0409
+	StatusDocumentFormatNotSupported    Status = 0x040a
+	StatusAttributesOrValuesUnsupported Status = 0x040b
+	StatusInternalError                 Status = 0x0500
+	StatusOperationNotSupported         Status = 0x0501
+	StatusVersionNotSupported           Status = 0x0503
+	StatusNotAcceptingJobs              Status = 0x0506
+	StatusBusy                          Status = 0x0507
+)
+
+// 任务状态 (job-state)
+const (
+	JobStatePending           = 3
+	JobStatePendingHeld       = 4
+	JobStateProcessing        = 5
+	JobStateProcessingStopped = 6
+	JobStateCanceled          = 7
+	JobStateAborted           = 8
+	JobStateCompleted         = 9
+)
+
+// 打印机状态 (printer-state)
+const (
+	PrinterStateIdle       = 3
+	PrinterStateProcessing = 4
+	PrinterStateStopped    = 5
+)
+
+// Range rangeOfInteger 类型的值
+type Range struct {
+	Lower int32
+	Upper int32
+}
+
+// Resolution resolution 类型的值
+type Resolution struct {
+	X     int32
+	Y     int32
+	Units int8 // 3: 每英寸点数, 4: 每厘米点数
+}
+
+// Value 单个属性值, Data 的类型由 Tag 决定:
+// integer/enum 为 int32, boolean 为 bool, 字符串类为 string,
+// rangeOfInteger 为 Range, resolution 为 Resolution,
+// collection 为 []Attribute, 其余为 []byte
+type Value struct {
+	Tag  Tag
+	Data interface{}
+}
+
+// Attribute 一个属性及其全部取值
+type Attribute struct {
+	Name   string
+	Values []Value
+}
+
+// String 返回第一个取值的字符串形式
+func (a *Attribute) String() string {
+	if a == nil || len(a.Values) == 0 {
+		return ""
+	}
+	switch v := a.Values[0].Data.(type) {
+	case string:
+		return v
+	case int32:
+		return fmt.Sprint(v)
+	case bool:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// Strings 返回所有字符串取值
+func (a *Attribute) Strings() []string {
+	if a == nil {
+		return nil
+	}
+	values := make([]string, 0, len(a.Values))
+	for _, v := range a.Values {
+		if s, ok := v.Data.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// Int 返回第一个整数取值
+func (a *Attribute) Int() (int, bool) {
+	if a == nil || len(a.Values) == 0 {
+		return 0, false
+	}
+	v, ok := a.Values[0].Data.(int32)
+	return int(v), ok
+}
+
+// Ints 返回所有整数取值
+func (a *Attribute) Ints() []int {
+	if a == nil {
+		return nil
+	}
+	values := make([]int, 0, len(a.Values))
+	for _, v := range a.Values {
+		if i, ok := v.Data.(int32); ok {
+			values = append(values, int(i))
+		}
+	}
+	return values
+}
+
+// Bool 返回第一个布尔取值
+func (a *Attribute) Bool() (bool, bool) {
+	if a == nil || len(a.Values) == 0 {
+		return false, false
+	}
+	v, ok := a.Values[0].Data.(bool)
+	return v, ok
+}
+
+// Group 属性分组
+type Group struct {
+	Tag        Tag
+	Attributes []Attribute
+}
+
+// Get 按名称查找属性, 不存在时返回 nil
+func (g *Group) Get(name string) *Attribute {
+	if g == nil {
+		return nil
+	}
+	for i := range g.Attributes {
+		if g.Attributes[i].Name == name {
+			return &g.Attributes[i]
+		}
+	}
+	return nil
+}
+
+// Add 向分组追加属性
+func (g *Group) Add(name string, tag Tag, values ...interface{}) {
+	attr := Attribute{Name: name}
+	for _, v := range values {
+		attr.Values = append(attr.Values, Value{Tag: tag, Data: v})
+	}
+	if len(values) == 0 {
+		attr.Values = append(attr.Values, Value{Tag: tag})
+	}
+	g.Attributes = append(g.Attributes, attr)
+}
+
+// Message IPP 请求或响应
+type Message struct {
+	Major     byte
+	Minor     byte
+	Code      uint16 // 请求中为操作码, 响应中为状态码
+	RequestID uint32
+	Groups    []*Group
+}
+
+// NewRequest 创建请求, 并写入必需的 attributes-charset 和 attributes-natural-language
+func NewRequest(op Operation, requestID uint32) *Message {
+	m := &Message{Major: 2, Minor: 0, Code: uint16(op), RequestID: requestID}
+	g := m.Group(TagOperationGroup)
+	g.Add("attributes-charset", TagCharset, "utf-8")
+	g.Add("attributes-natural-language", TagLanguage, "en")
+	return m
+}
+
+// NewResponse 创建对 req 的响应
+func NewResponse(req *Message, status Status) *Message {
+	m := &Message{Major: req.Major, Minor: req.Minor, Code: uint16(status), RequestID: req.RequestID}
+	if m.Major == 0 {
+		m.Major, m.Minor = 2, 0
+	}
+	g := m.Group(TagOperationGroup)
+	g.Add("attributes-charset", TagCharset, "utf-8")
+	g.Add("attributes-natural-language", TagLanguage, "en")
+	return m
+}
+
+// Operation 返回请求的操作码
+func (m *Message) Operation() Operation {
+	return Operation(m.Code)
+}
+
+// Status 返回响应的状态码
+func (m *Message) Status() Status {
+	return Status(m.Code)
+}
+
+// Group 返回指定标签的第一个分组, 不存在时新建
+func (m *Message) Group(tag Tag) *Group {
+	if g := m.Find(tag); g != nil {
+		return g
+	}
+	return m.NewGroup(tag)
+}
+
+// NewGroup 总是追加一个新分组, 用于 Get-Jobs 等包含多个任务分组的响应
+func (m *Message) NewGroup(tag Tag) *Group {
+	g := &Group{Tag: tag}
+	m.Groups = append(m.Groups, g)
+	return g
+}
+
+// Find 返回指定标签的第一个分组, 不存在时返回 nil
+func (m *Message) Find(tag Tag) *Group {
+	for _, g := range m.Groups {
+		if g.Tag == tag {
+			return g
+		}
+	}
+	return nil
+}
+
+// FindAll 返回指定标签的全部分组
+func (m *Message) FindAll(tag Tag) []*Group {
+	var groups []*Group
+	for _, g := range m.Groups {
+		if g.Tag == tag {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// Attr 在指定分组中查找属性
+func (m *Message) Attr(tag Tag, name string) *Attribute {
+	return m.Find(tag).Get(name)
+}
+
+// Encode 将消息编码写入 w, 不包含文档数据
+func (m *Message) Encode(w io.Writer) error {
+	buf := make([]byte, 0, 512)
+	buf = append(buf, m.Major, m.Minor)
+	buf = binary.BigEndian.AppendUint16(buf, m.Code)
+	buf = binary.BigEndian.AppendUint32(buf, m.RequestID)
+
+	for _, g := range m.Groups {
+		buf = append(buf, byte(g.Tag))
+		for _, attr := range g.Attributes {
+			var err error
+			if buf, err = appendAttribute(buf, attr); err != nil {
+				return err
+			}
+		}
+	}
+	buf = append(buf, byte(TagEnd))
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func appendAttribute(buf []byte, attr Attribute) ([]byte, error) {
+	for i, v := range attr.Values {
+		name := ""
+		if i == 0 {
+			name = attr.Name
+		}
+		var err error
+		if buf, err = appendValue(buf, name, v); err != nil {
+			return nil, fmt.Errorf("属性 %s: %v", attr.Name, err)
+		}
+	}
+	return buf, nil
+}
+
+func appendValue(buf []byte, name string, v Value) ([]byte, error) {
+	buf = append(buf, byte(v.Tag))
+	buf = appendString(buf, name)
+
+	switch data := v.Data.(type) {
+	case nil:
+		buf = binary.BigEndian.AppendUint16(buf, 0)
+	case int32:
+		buf = binary.BigEndian.AppendUint16(buf, 4)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(data))
+	case int:
+		buf = binary.BigEndian.AppendUint16(buf, 4)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(int32(data)))
+	case bool:
+		buf = binary.BigEndian.AppendUint16(buf, 1)
+		if data {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+	case string:
+		buf = appendString(buf, data)
+	case []byte:
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(data)))
+		buf = append(buf, data...)
+	case Range:
+		buf = binary.BigEndian.AppendUint16(buf, 8)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(data.Lower))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(data.Upper))
+	case Resolution:
+		buf = binary.BigEndian.AppendUint16(buf, 9)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(data.X))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(data.Y))
+		buf = append(buf, byte(data.Units))
+	case []Attribute:
+		// begCollection 的值为空, 成员以 memberAttrName 开头, 最后是 endCollection
+		buf = binary.BigEndian.AppendUint16(buf, 0)
+		for _, member := range data {
+			for i, mv := range member.Values {
+				if i == 0 {
+					buf = append(buf, byte(TagMemberName))
+					buf = appendString(buf, "")
+					buf = appendString(buf, member.Name)
+				}
+				var err error
+				if buf, err = appendValue(buf, "", mv); err != nil {
+					return nil, err
+				}
+			}
+		}
+		buf = append(buf, byte(TagEndCollection))
+		buf = appendString(buf, "")
+		buf = binary.BigEndian.AppendUint16(buf, 0)
+	default:
+		return nil, fmt.Errorf("不支持的值类型 %T", v.Data)
+	}
+	return buf, nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+// ErrMalformed 消息格式错误
+var ErrMalformed = errors.New("ipp: 消息格式错误")
+
+// Decode 从 r 读取一个消息, 读取到 end-of-attributes 为止,
+// r 中剩余的内容即为文档数据
+func Decode(r io.Reader) (*Message, error) {
+	d := &decoder{r: r}
+	var header [8]byte
+	if err := d.read(header[:]); err != nil {
+		return nil, err
+	}
+	m := &Message{
+		Major:     header[0],
+		Minor:     header[1],
+		Code:      binary.BigEndian.Uint16(header[2:4]),
+		RequestID: binary.BigEndian.Uint32(header[4:8]),
+	}
+
+	var group *Group
+	var attr *Attribute
+	for {
+		tag, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		if tag == byte(TagEnd) {
+			return m, nil
+		}
+		if tag < 0x10 {
+			// 分组标签
+			group = m.NewGroup(Tag(tag))
+			attr = nil
+			continue
+		}
+		if group == nil {
+			return nil, ErrMalformed
+		}
+
+		name, value, err := d.value(Tag(tag))
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			// 多值属性的后续取值
+			if attr == nil {
+				return nil, ErrMalformed
+			}
+			attr.Values = append(attr.Values, value)
+			continue
+		}
+		group.Attributes = append(group.Attributes, Attribute{Name: name, Values: []Value{value}})
+		attr = &group.Attributes[len(group.Attributes)-1]
+	}
+}
+
+type decoder struct {
+	r io.Reader
+}
+
+func (d *decoder) read(p []byte) error {
+	if _, err := io.ReadFull(d.r, p); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrMalformed
+		}
+		return err
+	}
+	return nil
+}
+
+func (d *decoder) byte() (byte, error) {
+	var b [1]byte
+	err := d.read(b[:])
+	return b[0], err
+}
+
+func (d *decoder) bytes() ([]byte, error) {
+	var n [2]byte
+	if err := d.read(n[:]); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint16(n[:]))
+	if err := d.read(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// value 读取名称和值, tag 已被读取
+func (d *decoder) value(tag Tag) (string, Value, error) {
+	name, err := d.bytes()
+	if err != nil {
+		return "", Value{}, err
+	}
+	data, err := d.bytes()
+	if err != nil {
+		return "", Value{}, err
+	}
+
+	v := Value{Tag: tag}
+	switch tag {
+	case TagInteger, TagEnum:
+		if len(data) != 4 {
+			return "", v, ErrMalformed
+		}
+		v.Data = int32(binary.BigEndian.Uint32(data))
+	case TagBoolean:
+		if len(data) != 1 {
+			return "", v, ErrMalformed
+		}
+		v.Data = data[0] != 0
+	case TagRange:
+		if len(data) != 8 {
+			return "", v, ErrMalformed
+		}
+		v.Data = Range{
+			Lower: int32(binary.BigEndian.Uint32(data[0:4])),
+			Upper: int32(binary.BigEndian.Uint32(data[4:8])),
+		}
+	case TagResolution:
+		if len(data) != 9 {
+			return "", v, ErrMalformed
+		}
+		v.Data = Resolution{
+			X:     int32(binary.BigEndian.Uint32(data[0:4])),
+			Y:     int32(binary.BigEndian.Uint32(data[4:8])),
+			Units: int8(data[8]),
+		}
+	case TagTextLang, TagNameLang:
+		// 去掉语言部分, 按普通 text/name 处理
+		if len(data) < 4 {
+			return "", v, ErrMalformed
+		}
+		n := int(binary.BigEndian.Uint16(data[0:2]))
+		if len(data) < 4+n {
+			return "", v, ErrMalformed
+		}
+		rest := data[2+n:]
+		m := int(binary.BigEndian.Uint16(rest[0:2]))
+		if len(rest) < 2+m {
+			return "", v, ErrMalformed
+		}
+		v.Data = string(rest[2 : 2+m])
+		if tag == TagTextLang {
+			v.Tag = TagText
+		} else {
+			v.Tag = TagName
+		}
+	case TagText, TagName, TagKeyword, TagURI, TagURIScheme, TagCharset, TagLanguage, TagMimeType, TagMemberName:
+		v.Data = string(data)
+	case TagBeginCollection:
+		members, err := d.collection()
+		if err != nil {
+			return "", v, err
+		}
+		v.Data = members
+	case TagNoValue, TagUnknown, TagUnsupportedValue:
+		v.Data = nil
+	default:
+		v.Data = data
+	}
+	return string(name), v, nil
+}
+
+// collection 读取集合成员直到 endCollection
+func (d *decoder) collection() ([]Attribute, error) {
+	var members []Attribute
+	for {
+		tag, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		_, v, err := d.value(Tag(tag))
+		if err != nil {
+			return nil, err
+		}
+		switch v.Tag {
+		case TagEndCollection:
+			return members, nil
+		case TagMemberName:
+			members = append(members, Attribute{Name: v.Data.(string)})
+		default:
+			if len(members) == 0 {
+				return nil, ErrMalformed
+			}
+			last := &members[len(members)-1]
+			last.Values = append(last.Values, v)
+		}
+	}
+}
@@ -0,0 +1,890 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"printer/services/ipp"
+	"printer/services/mdns"
+)
+
+// IPPServerPath 内置 IPP 打印机的 HTTP 路径
+const IPPServerPath = "/ipp/print"
+
+// 内置 IPP 打印机支持的操作
+var ippServerOperations = []ipp.Operation{
+	ipp.OpPrintJob,
+	ipp.OpValidateJob,
+	ipp.OpCancelJob,
+	ipp.OpGetJobAttributes,
+	ipp.OpGetJobs,
+	ipp.OpGetPrinterAttributes,
+}
+
+// 可在提交任务时指定的任务属性
+var ippJobTemplate = []string{
+	"copies", "page-ranges", "sides", "orientation-requested", "media", "media-col",
+	"print-color-mode", "print-scaling", "multiple-document-handling", "number-up",
+}
+
+// 多页合一支持的每面页数
+var ippNumberUp = []int{1, 2, 4, 6, 9}
+
+// IPPServerSettings 内置 IPP 打印机的设置
+type IPPServerSettings struct {
+	// 打印机名称 (printer-name)
+	Name string
+	// 位置说明 (printer-location)
+	Location string
+	// 任务提交到的打印机或打印池, 为空时使用默认打印后端
+	Printer string
+	// 单个文档的大小上限 (字节), 0 表示不限制
+	MaxDocumentSize int64
+}
+
+// IPPServer 将打印服务本身作为 IPP Everywhere 打印机提供给网络上的电脑和手机.
+// 收到的文档保存到上传目录后加入打印队列, 与网页上传的文件走相同的打印流程
+//
+// 支持 Print-Job、Validate-Job、Get-Jobs、Get-Job-Attributes、Cancel-Job 和 Get-Printer-Attributes.
+// 任务属性中目标打印机不支持的部分被忽略并在响应中列出, 请求 ipp-attribute-fidelity 时拒绝任务
+type IPPServer struct {
+	queue     *JobQueue
+	printers  *PrinterRegistry
+	uploadDir string
+	settings  IPPServerSettings
+	uuid      string
+}
+
+// NewIPPServer 创建 IPP 打印机, 收到的任务加入 queue
+func NewIPPServer(queue *JobQueue, printers *PrinterRegistry, uploadDir string, settings IPPServerSettings) *IPPServer {
+	if settings.Name == "" {
+		settings.Name = "Printer Service"
+	}
+	return &IPPServer{
+		queue:     queue,
+		printers:  printers,
+		uploadDir: uploadDir,
+		settings:  settings,
+		uuid:      ippPrinterUUID(settings.Name),
+	}
+}
+
+// ippPrinterUUID 由主机名和打印机名称生成 printer-uuid, 重启后保持不变
+func ippPrinterUUID(name string) string {
+	host, _ := os.Hostname()
+	sum := sha1.Sum([]byte(host + "/" + name))
+	// 按 RFC 4122 第5版设置版本和变体
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// Instance 返回在 mDNS 上公布的 _ipp._tcp 服务实例, host 为本机的 mDNS 主机名, 如 "office.local."
+func (s *IPPServer) Instance(host string, port int, addrs []net.IP) mdns.Instance {
+	caps, _ := s.capabilities()
+	boolText := func(b bool) string {
+		if b {
+			return "T"
+		}
+		return "F"
+	}
+	return mdns.Instance{
+		Name:    s.settings.Name + "._ipp._tcp.local.",
+		Service: "_ipp._tcp",
+		Host:    host,
+		Port:    port,
+		Addrs:   addrs,
+		Text: map[string]string{
+			"txtvers": "1",
+			"qtotal":  "1",
+			"rp":      strings.TrimPrefix(IPPServerPath, "/"),
+			"ty":      s.settings.Name,
+			"note":    s.settings.Location,
+			"pdl":     strings.Join(ippDocumentFormats(caps), ","),
+			"UUID":    strings.TrimPrefix(s.uuid, "urn:uuid:"),
+			"Color":   boolText(caps.Color),
+			"Duplex":  boolText(caps.Duplex),
+		},
+	}
+}
+
+// capabilities 返回目标打印机的能力, 目标不可用时返回错误
+func (s *IPPServer) capabilities() (Capabilities, error) {
+	service, _, err := s.printers.ResolveTarget(s.settings.Printer, PrintOptions{})
+	if err != nil {
+		return Capabilities{}, err
+	}
+	return service.Capabilities(), nil
+}
+
+// ServeHTTP 处理以 HTTP POST 发送的 IPP 请求, Print-Job 的文档紧跟在请求属性之后
+func (s *IPPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "IPP请求需使用POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != ipp.ContentType {
+		http.Error(w, "Content-Type 需为 "+ipp.ContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body := bufio.NewReader(r.Body)
+	req, err := ipp.Decode(body)
+	if err != nil {
+		http.Error(w, "IPP请求格式错误", http.StatusBadRequest)
+		return
+	}
+
+	resp := s.handle(req, body, ippPrinterURI(r))
+	w.Header().Set("Content-Type", ipp.ContentType)
+	if err := resp.Encode(w); err != nil {
+		log.Printf("写入IPP响应失败: %v", err)
+	}
+}
+
+// ippPrinterURI 按请求的 Host 生成 printer-uri. 总是带上端口,
+// 否则客户端会按 ipp 协议的默认端口 631 访问
+func ippPrinterURI(r *http.Request) string {
+	scheme, port := "ipp", "80"
+	if r.TLS != nil {
+		scheme, port = "ipps", "443"
+	}
+	host := r.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+	return scheme + "://" + host + IPPServerPath
+}
+
+func (s *IPPServer) handle(req *ipp.Message, body *bufio.Reader, uri string) *ipp.Message {
+	if req.Major != 1 && req.Major != 2 {
+		return ippError(req, ipp.StatusVersionNotSupported, "不支持的IPP版本")
+	}
+	op := req.Find(ipp.TagOperationGroup)
+	if op.Get("attributes-charset") == nil || op.Get("attributes-natural-language") == nil {
+		return ippError(req, ipp.StatusBadRequest, "缺少 attributes-charset 或 attributes-natural-language")
+	}
+
+	switch req.Operation() {
+	case ipp.OpPrintJob:
+		return s.printJob(req, body, uri)
+	case ipp.OpValidateJob:
+		return s.validateJob(req)
+	case ipp.OpCancelJob:
+		return s.cancelJob(req)
+	case ipp.OpGetJobAttributes:
+		return s.getJobAttributes(req, uri)
+	case ipp.OpGetJobs:
+		return s.getJobs(req, uri)
+	case ipp.OpGetPrinterAttributes:
+		return s.getPrinterAttributes(req, uri)
+	}
+	return ippError(req, ipp.StatusOperationNotSupported, "不支持的操作")
+}
+
+// ippError 返回带 status-message 的错误响应
+func ippError(req *ipp.Message, status ipp.Status, message string) *ipp.Message {
+	resp := ipp.NewResponse(req, status)
+	resp.Group(ipp.TagOperationGroup).Add("status-message", ipp.TagText, message)
+	return resp
+}
+
+// ippTargetError 将解析目标打印机或检查选项的错误转换为响应
+func ippTargetError(req *ipp.Message, err error) *ipp.Message {
+	switch {
+	case errors.Is(err, ErrPrinterDisabled), errors.Is(err, ErrPoolUnavailable),
+		errors.Is(err, ErrPrinterNotFound), errors.Is(err, ErrNoDefaultPrinter):
+		return ippError(req, ipp.StatusNotAcceptingJobs, err.Error())
+	case errors.Is(err, ErrOptionUnsupported):
+		return ippError(req, ipp.StatusAttributesOrValuesUnsupported, err.Error())
+	}
+	return ippError(req, ipp.StatusNotPossible, err.Error())
+}
+
+// prepareJob 将任务属性转换为打印选项并检查目标打印机能否打印, 失败时返回错误响应.
+// 目标不支持的属性被忽略并返回, 请求要求 ipp-attribute-fidelity 时拒绝
+func (s *IPPServer) prepareJob(req *ipp.Message) (*PrintService, PrintOptions, []ipp.Attribute, *ipp.Message) {
+	caps, err := s.capabilities()
+	if err != nil {
+		return nil, PrintOptions{}, nil, ippTargetError(req, err)
+	}
+	opts, unsupported := ippJobOptions(req.Find(ipp.TagJobGroup), caps)
+	if fidelity, _ := req.Attr(ipp.TagOperationGroup, "ipp-attribute-fidelity").Bool(); fidelity && len(unsupported) > 0 {
+		resp := ippError(req, ipp.StatusAttributesOrValuesUnsupported, "打印机不支持部分任务属性")
+		resp.Group(ipp.TagUnsupportedGroup).Attributes = unsupported
+		return nil, opts, nil, resp
+	}
+
+	service, opts, err := s.printers.ResolveTarget(s.settings.Printer, opts)
+	if err != nil {
+		return nil, opts, nil, ippTargetError(req, err)
+	}
+	return service, opts, unsupported, nil
+}
+
+// ippJobResponse 创建任务请求的成功响应, 有被忽略的属性时状态为 successful-ok-ignored-or-substituted-attributes
+func ippJobResponse(req *ipp.Message, unsupported []ipp.Attribute) *ipp.Message {
+	if len(unsupported) == 0 {
+		return ipp.NewResponse(req, ipp.StatusOK)
+	}
+	resp := ipp.NewResponse(req, ipp.StatusOKIgnoredOrSubstituted)
+	resp.Group(ipp.TagUnsupportedGroup).Attributes = unsupported
+	return resp
+}
+
+// checkFormat 检查文档格式能否打印, 返回保存文档使用的扩展名
+func checkFormat(req *ipp.Message, service *PrintService, format string) (string, *ipp.Message) {
+	ext := DocumentExtension(format)
+	if ext == "" || !service.Capabilities().CanPrint(ext) {
+		resp := ippError(req, ipp.StatusDocumentFormatNotSupported, "不支持的文档格式: "+format)
+		resp.Group(ipp.TagUnsupportedGroup).Add("document-format", ipp.TagMimeType, format)
+		return "", resp
+	}
+	return ext, nil
+}
+
+func (s *IPPServer) validateJob(req *ipp.Message) *ipp.Message {
+	service, _, unsupported, errResp := s.prepareJob(req)
+	if errResp != nil {
+		return errResp
+	}
+	format := req.Attr(ipp.TagOperationGroup, "document-format").String()
+	if format != "" && format != "application/octet-stream" {
+		if _, errResp := checkFormat(req, service, format); errResp != nil {
+			return errResp
+		}
+	}
+	return ippJobResponse(req, unsupported)
+}
+
+func (s *IPPServer) printJob(req *ipp.Message, body *bufio.Reader, uri string) *ipp.Message {
+	service, opts, unsupported, errResp := s.prepareJob(req)
+	if errResp != nil {
+		return errResp
+	}
+
+	op := req.Find(ipp.TagOperationGroup)
+	head, _ := body.Peek(512)
+	if len(head) == 0 {
+		return ippError(req, ipp.StatusBadRequest, "缺少文档数据")
+	}
+	// 未指定格式或客户端要求自动识别时按内容判断
+	format := op.Get("document-format").String()
+	if format == "" || format == "application/octet-stream" {
+		format = SniffDocumentFormat(head)
+	}
+	ext, errResp := checkFormat(req, service, format)
+	if errResp != nil {
+		return errResp
+	}
+
+	name := op.Get("job-name").String()
+	if name == "" {
+		name = op.Get("document-name").String()
+	}
+	filename, err := SaveDocument(s.uploadDir, name, ext, body, s.settings.MaxDocumentSize)
+	if errors.Is(err, ErrDocumentTooLarge) {
+		return ippError(req, ipp.StatusRequestEntityTooLarge,
+			fmt.Sprintf("文档超过 %d MB", s.settings.MaxDocumentSize>>20))
+	}
+	if err != nil {
+		log.Printf("保存IPP文档失败: %v", err)
+		return ippError(req, ipp.StatusInternalError, err.Error())
+	}
+
+	job, err := s.queue.Submit(Job{
+		Filename: filename,
+		Printer:  s.settings.Printer,
+		User:     op.Get("requesting-user-name").String(),
+		Options:  opts,
+	})
+	if err != nil {
+		os.Remove(filepath.Join(s.uploadDir, filename))
+		if errors.Is(err, ErrQuotaExceeded) {
+			return ippError(req, ipp.StatusNotPossible, err.Error())
+		}
+		return ippError(req, ipp.StatusInternalError, err.Error())
+	}
+
+	resp := ippJobResponse(req, unsupported)
+	g := s.jobAttributes(job, uri)
+	filterAttributes(g, []string{"job-id", "job-uri", "job-state", "job-state-reasons"})
+	resp.Groups = append(resp.Groups, g)
+	return resp
+}
+
+// jobs 返回提交到本打印机目标的任务
+func (s *IPPServer) jobs() []Job {
+	var jobs []Job
+	for _, job := range s.queue.List() {
+		if job.Printer == s.settings.Printer {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// findJob 按 job-id 或 job-uri 查找任务, 失败时返回错误响应
+func (s *IPPServer) findJob(req *ipp.Message) (Job, *ipp.Message) {
+	op := req.Find(ipp.TagOperationGroup)
+	id, ok := op.Get("job-id").Int()
+	if !ok {
+		if uri := op.Get("job-uri").String(); uri != "" {
+			n, err := strconv.Atoi(uri[strings.LastIndex(uri, "/")+1:])
+			id, ok = n, err == nil
+		}
+	}
+	if !ok {
+		return Job{}, ippError(req, ipp.StatusBadRequest, "缺少 job-id 或 job-uri")
+	}
+	for _, job := range s.jobs() {
+		if ippJobID(job.ID) == id {
+			return job, nil
+		}
+	}
+	return Job{}, ippError(req, ipp.StatusNotFound, "任务不存在")
+}
+
+func (s *IPPServer) cancelJob(req *ipp.Message) *ipp.Message {
+	job, errResp := s.findJob(req)
+	if errResp != nil {
+		return errResp
+	}
+	// 只允许提交任务的用户取消
+	if user := req.Attr(ipp.TagOperationGroup, "requesting-user-name").String(); job.User != "" && user != job.User {
+		return ippError(req, ipp.StatusNotAuthorized, "只能取消自己的任务")
+	}
+	if _, err := s.queue.Cancel(job.ID); err != nil {
+		return ippError(req, ipp.StatusNotPossible, err.Error())
+	}
+	return ipp.NewResponse(req, ipp.StatusOK)
+}
+
+func (s *IPPServer) getJobAttributes(req *ipp.Message, uri string) *ipp.Message {
+	job, errResp := s.findJob(req)
+	if errResp != nil {
+		return errResp
+	}
+	resp := ipp.NewResponse(req, ipp.StatusOK)
+	g := s.jobAttributes(job, uri)
+	filterAttributes(g, req.Attr(ipp.TagOperationGroup, "requested-attributes").Strings())
+	resp.Groups = append(resp.Groups, g)
+	return resp
+}
+
+func (s *IPPServer) getJobs(req *ipp.Message, uri string) *ipp.Message {
+	op := req.Find(ipp.TagOperationGroup)
+	which := op.Get("which-jobs").String()
+	switch which {
+	case "":
+		which = "not-completed"
+	case "not-completed", "completed", "all":
+	default:
+		resp := ippError(req, ipp.StatusAttributesOrValuesUnsupported, "不支持的 which-jobs: "+which)
+		resp.Group(ipp.TagUnsupportedGroup).Add("which-jobs", ipp.TagKeyword, which)
+		return resp
+	}
+	limit, _ := op.Get("limit").Int()
+	myJobs, _ := op.Get("my-jobs").Bool()
+	user := op.Get("requesting-user-name").String()
+	// 未指定时只返回 job-uri 和 job-id (RFC 8011 4.2.6.1)
+	requested := op.Get("requested-attributes").Strings()
+	if len(requested) == 0 {
+		requested = []string{"job-uri", "job-id"}
+	}
+
+	resp := ipp.NewResponse(req, ipp.StatusOK)
+	count := 0
+	for _, job := range s.jobs() {
+		if which != "all" && (which == "completed") != job.State.Finished() {
+			continue
+		}
+		if myJobs && job.User != user {
+			continue
+		}
+		if limit > 0 && count >= limit {
+			break
+		}
+		g := s.jobAttributes(job, uri)
+		filterAttributes(g, requested)
+		resp.Groups = append(resp.Groups, g)
+		count++
+	}
+	return resp
+}
+
+func (s *IPPServer) getPrinterAttributes(req *ipp.Message, uri string) *ipp.Message {
+	resp := ipp.NewResponse(req, ipp.StatusOK)
+	g := s.printerAttributes(uri)
+	filterAttributes(g, req.Attr(ipp.TagOperationGroup, "requested-attributes").Strings())
+	resp.Groups = append(resp.Groups, g)
+	return resp
+}
+
+// filterAttributes 只保留 requested 中的属性. requested 为空或包含 all 及属性分组名时保留全部
+func filterAttributes(g *ipp.Group, requested []string) {
+	if len(requested) == 0 {
+		return
+	}
+	for _, name := range requested {
+		switch name {
+		case "all", "printer-description", "job-template", "job-description":
+			return
+		}
+	}
+	kept := g.Attributes[:0]
+	for _, attr := range g.Attributes {
+		if containsString(requested, attr.Name) {
+			kept = append(kept, attr)
+		}
+	}
+	g.Attributes = kept
+}
+
+// ippJobID 由任务ID生成 IPP 的整数 job-id
+func ippJobID(id string) int {
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	n, _ := strconv.ParseUint(id, 16, 32)
+	n &= math.MaxInt32
+	if n == 0 {
+		n = 1
+	}
+	return int(n)
+}
+
+// ippJobState 将任务状态映射为 IPP 的 job-state 和 job-state-reasons
+func ippJobState(state JobState) (int, string) {
+	switch state {
+	case JobScheduled, JobHeld:
+		return ipp.JobStatePendingHeld, "job-hold-until-specified"
+	case JobConverting:
+		return ipp.JobStateProcessing, "job-transforming"
+	case JobPrinting:
+		return ipp.JobStateProcessing, "job-printing"
+	case JobDone:
+		return ipp.JobStateCompleted, "job-completed-successfully"
+	case JobFailed:
+		return ipp.JobStateAborted, "aborted-by-system"
+	case JobCanceled:
+		return ipp.JobStateCanceled, "job-canceled-by-user"
+	}
+	return ipp.JobStatePending, "job-queued"
+}
+
+// ippTime 写入 time-at-* 属性, 取 Unix 时间, 与 printer-up-time 一致. 时间未知时为 no-value
+func ippTime(g *ipp.Group, name string, t *time.Time) {
+	if t == nil {
+		g.Add(name, ipp.TagNoValue)
+		return
+	}
+	g.Add(name, ipp.TagInteger, int32(t.Unix()))
+}
+
+// jobAttributes 返回任务的全部属性
+func (s *IPPServer) jobAttributes(job Job, uri string) *ipp.Group {
+	id := ippJobID(job.ID)
+	state, reason := ippJobState(job.State)
+	user := job.User
+	if user == "" {
+		user = "anonymous"
+	}
+
+	g := &ipp.Group{Tag: ipp.TagJobGroup}
+	g.Add("job-id", ipp.TagInteger, int32(id))
+	g.Add("job-uri", ipp.TagURI, uri+"/"+strconv.Itoa(id))
+	g.Add("job-printer-uri", ipp.TagURI, uri)
+	g.Add("job-name", ipp.TagName, job.Filename)
+	g.Add("job-originating-user-name", ipp.TagName, user)
+	g.Add("job-state", ipp.TagEnum, int32(state))
+	g.Add("job-state-reasons", ipp.TagKeyword, reason)
+	if job.Error != "" {
+		g.Add("job-state-message", ipp.TagText, job.Error)
+	}
+	if job.Pages > 0 {
+		impressions := job.Pages * job.Options.CopyCount()
+		g.Add("job-impressions", ipp.TagInteger, int32(impressions))
+		if job.State == JobDone {
+			g.Add("job-impressions-completed", ipp.TagInteger, int32(impressions))
+		}
+	}
+	g.Add("time-at-creation", ipp.TagInteger, int32(job.CreatedAt.Unix()))
+	ippTime(g, "time-at-processing", job.StartedAt)
+	ippTime(g, "time-at-completed", job.FinishedAt)
+	g.Add("job-printer-up-time", ipp.TagInteger, int32(time.Now().Unix()))
+	return g
+}
+
+// printerAttributes 返回打印机的全部属性, 能力和默认值取自目标打印机
+func (s *IPPServer) printerAttributes(uri string) *ipp.Group {
+	service, defaults, err := s.printers.ResolveTarget(s.settings.Printer, PrintOptions{})
+	accepting := err == nil
+
+	queued, processing := 0, false
+	for _, job := range s.jobs() {
+		switch job.State {
+		case JobQueued, JobHeld:
+			queued++
+		case JobConverting, JobPrinting:
+			processing = true
+		}
+	}
+	state, reason := ipp.PrinterStateIdle, "none"
+	switch {
+	case !accepting:
+		state, reason = ipp.PrinterStateStopped, "paused"
+	case !s.queue.TargetAvailable(s.settings.Printer):
+		// 任务仍然接收, 在打印机恢复后打印
+		state, reason = ipp.PrinterStateStopped, "other-error"
+	case processing:
+		state = ipp.PrinterStateProcessing
+	}
+	security := "none"
+	if strings.HasPrefix(uri, "ipps:") {
+		security = "tls"
+	}
+	operations := make([]interface{}, len(ippServerOperations))
+	for i, op := range ippServerOperations {
+		operations[i] = int32(op)
+	}
+
+	g := &ipp.Group{Tag: ipp.TagPrinterGroup}
+	g.Add("printer-uri-supported", ipp.TagURI, uri)
+	g.Add("uri-security-supported", ipp.TagKeyword, security)
+	g.Add("uri-authentication-supported", ipp.TagKeyword, "requesting-user-name")
+	g.Add("printer-name", ipp.TagName, s.settings.Name)
+	g.Add("printer-info", ipp.TagText, s.settings.Name)
+	g.Add("printer-location", ipp.TagText, s.settings.Location)
+	g.Add("printer-make-and-model", ipp.TagText, "Printer Service")
+	g.Add("printer-uuid", ipp.TagURI, s.uuid)
+	g.Add("printer-state", ipp.TagEnum, int32(state))
+	g.Add("printer-state-reasons", ipp.TagKeyword, reason)
+	g.Add("printer-is-accepting-jobs", ipp.TagBoolean, accepting)
+	g.Add("queued-job-count", ipp.TagInteger, int32(queued))
+	g.Add("printer-up-time", ipp.TagInteger, int32(time.Now().Unix()))
+	g.Add("ipp-versions-supported", ipp.TagKeyword, "1.1", "2.0")
+	g.Add("ipp-features-supported", ipp.TagKeyword, "ipp-everywhere")
+	g.Add("operations-supported", ipp.TagEnum, operations...)
+	g.Add("charset-configured", ipp.TagCharset, "utf-8")
+	g.Add("charset-supported", ipp.TagCharset, "utf-8")
+	g.Add("natural-language-configured", ipp.TagLanguage, "en")
+	g.Add("generated-natural-language-supported", ipp.TagLanguage, "en")
+	g.Add("compression-supported", ipp.TagKeyword, "none")
+	g.Add("pdl-override-supported", ipp.TagKeyword, "attempted")
+	g.Add("multiple-document-jobs-supported", ipp.TagBoolean, false)
+	g.Add("which-jobs-supported", ipp.TagKeyword, "completed", "not-completed", "all")
+	g.Add("job-creation-attributes-supported", ipp.TagKeyword, stringValues(ippJobTemplate)...)
+	g.Add("document-format-default", ipp.TagMimeType, "application/octet-stream")
+	if !accepting {
+		g.Add("document-format-supported", ipp.TagMimeType, "application/octet-stream")
+		return g
+	}
+
+	caps := service.Capabilities()
+	formats := append([]string{"application/octet-stream"}, ippDocumentFormats(caps)...)
+	g.Add("document-format-supported", ipp.TagMimeType, stringValues(formats)...)
+
+	g.Add("copies-default", ipp.TagInteger, int32(max(defaults.Copies, 1)))
+	g.Add("copies-supported", ipp.TagRange, ipp.Range{Lower: 1, Upper: int32(max(caps.MaxCopies, 1))})
+	g.Add("page-ranges-supported", ipp.TagBoolean, caps.PageRanges)
+
+	sides := []string{"one-sided"}
+	if caps.Duplex {
+		sides = append(sides, "two-sided-long-edge", "two-sided-short-edge")
+	}
+	g.Add("sides-default", ipp.TagKeyword, ippSides(defaults.Duplex))
+	g.Add("sides-supported", ipp.TagKeyword, stringValues(sides)...)
+
+	orientation := []interface{}{int32(3)}
+	if caps.Orientation {
+		orientation = append(orientation, int32(4))
+	}
+	defaultOrientation := int32(3)
+	if defaults.Orientation == OrientationLandscape {
+		defaultOrientation = 4
+	}
+	g.Add("orientation-requested-default", ipp.TagEnum, defaultOrientation)
+	g.Add("orientation-requested-supported", ipp.TagEnum, orientation...)
+
+	if len(caps.Media) > 0 {
+		media := defaults.Media
+		if !containsString(caps.Media, media) {
+			media = caps.Media[0]
+			if containsString(caps.Media, DefaultMedia) {
+				media = DefaultMedia
+			}
+		}
+		var names, sizes []interface{}
+		for _, key := range caps.Media {
+			names = append(names, MediaSizes[key].IPP)
+			sizes = append(sizes, ippMediaSize(key))
+		}
+		g.Add("media-default", ipp.TagKeyword, MediaSizes[media].IPP)
+		g.Add("media-supported", ipp.TagKeyword, names...)
+		g.Add("media-ready", ipp.TagKeyword, MediaSizes[media].IPP)
+		g.Add("media-col-default", ipp.TagBeginCollection, []ipp.Attribute{
+			{Name: "media-size", Values: []ipp.Value{{Tag: ipp.TagBeginCollection, Data: ippMediaSize(media)}}},
+		})
+		g.Add("media-col-supported", ipp.TagKeyword, "media-size")
+		g.Add("media-size-supported", ipp.TagBeginCollection, sizes...)
+	}
+
+	colorModes := []string{"auto"}
+	if caps.Color {
+		colorModes = append(colorModes, ColorColor, ColorMonochrome)
+	}
+	colorDefault := "auto"
+	if caps.Color && defaults.Color != "" {
+		colorDefault = defaults.Color
+	}
+	g.Add("color-supported", ipp.TagBoolean, caps.Color)
+	g.Add("print-color-mode-default", ipp.TagKeyword, colorDefault)
+	g.Add("print-color-mode-supported", ipp.TagKeyword, stringValues(colorModes)...)
+
+	scaling := defaults.Scaling
+	if scaling == "" {
+		scaling = ScalingAuto
+	}
+	g.Add("print-scaling-default", ipp.TagKeyword, scaling)
+	g.Add("print-scaling-supported", ipp.TagKeyword, ScalingAuto, ScalingFit, ScalingFill, ScalingNone)
+
+	numberUp := []interface{}{int32(1)}
+	if caps.CanPrint(".pdf") {
+		numberUp = numberUp[:0]
+		for _, n := range ippNumberUp {
+			numberUp = append(numberUp, int32(n))
+		}
+	}
+	g.Add("number-up-default", ipp.TagInteger, int32(max(defaults.NumberUp, 1)))
+	g.Add("number-up-supported", ipp.TagInteger, numberUp...)
+
+	if caps.Collate {
+		g.Add("multiple-document-handling-supported", ipp.TagKeyword,
+			"separate-documents-collated-copies", "separate-documents-uncollated-copies")
+	}
+	return g
+}
+
+// ippDocumentFormats 返回可以打印的 MIME 类型
+func ippDocumentFormats(caps Capabilities) []string {
+	var formats []string
+	for ext, format := range documentFormats {
+		if caps.CanPrint(ext) && !containsString(formats, format) {
+			formats = append(formats, format)
+		}
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func stringValues(list []string) []interface{} {
+	values := make([]interface{}, len(list))
+	for i, s := range list {
+		values[i] = s
+	}
+	return values
+}
+
+func ippSides(duplex string) string {
+	switch duplex {
+	case DuplexLongEdge:
+		return "two-sided-long-edge"
+	case DuplexShortEdge:
+		return "two-sided-short-edge"
+	}
+	return "one-sided"
+}
+
+// ippMediaSize 返回纸张的 media-size 集合, 单位为 1/100 毫米
+func ippMediaSize(key string) []ipp.Attribute {
+	size := MediaSizes[key]
+	return []ipp.Attribute{
+		{Name: "x-dimension", Values: []ipp.Value{{Tag: ipp.TagInteger, Data: int32(math.Round(size.Width * 2540 / 72))}}},
+		{Name: "y-dimension", Values: []ipp.Value{{Tag: ipp.TagInteger, Data: int32(math.Round(size.Height * 2540 / 72))}}},
+	}
+}
+
+// ippJobOptions 将任务属性转换为打印选项. 无法识别或 caps 不支持的属性不设置, 放入 unsupported 返回
+func ippJobOptions(job *ipp.Group, caps Capabilities) (PrintOptions, []ipp.Attribute) {
+	var opts PrintOptions
+	var unsupported []ipp.Attribute
+	if job == nil {
+		return opts, nil
+	}
+	for _, attr := range job.Attributes {
+		// 逐个属性单独检查, 不支持的属性不影响其他属性
+		var single PrintOptions
+		if !setIPPOption(&single, attr) || single.Validate() != nil || caps.Check(single) != nil {
+			unsupported = append(unsupported, attr)
+			continue
+		}
+		setIPPOption(&opts, attr)
+	}
+	return opts, unsupported
+}
+
+// setIPPOption 按 IPP 任务属性设置打印选项, 属性或取值无法识别时返回 false
+func setIPPOption(opts *PrintOptions, attr ipp.Attribute) bool {
+	value := attr.String()
+	switch attr.Name {
+	case "copies":
+		n, ok := attr.Int()
+		if !ok || n < 1 {
+			return false
+		}
+		opts.Copies = n
+	case "page-ranges":
+		var parts []string
+		for _, v := range attr.Values {
+			r, ok := v.Data.(ipp.Range)
+			if !ok || r.Lower < 1 || r.Upper < r.Lower {
+				return false
+			}
+			switch r.Upper {
+			case r.Lower:
+				parts = append(parts, strconv.Itoa(int(r.Lower)))
+			case math.MaxInt32:
+				parts = append(parts, fmt.Sprintf("%d-", r.Lower))
+			default:
+				parts = append(parts, fmt.Sprintf("%d-%d", r.Lower, r.Upper))
+			}
+		}
+		opts.PageRanges = strings.Join(parts, ",")
+	case "sides":
+		switch value {
+		case "one-sided":
+			opts.Duplex = DuplexOneSided
+		case "two-sided-long-edge":
+			opts.Duplex = DuplexLongEdge
+		case "two-sided-short-edge":
+			opts.Duplex = DuplexShortEdge
+		default:
+			return false
+		}
+	case "orientation-requested":
+		switch n, _ := attr.Int(); n {
+		case 3:
+			opts.Orientation = OrientationPortrait
+		case 4:
+			opts.Orientation = OrientationLandscape
+		default:
+			return false
+		}
+	case "media":
+		key, ok := ippMediaByName(value)
+		if !ok {
+			return false
+		}
+		opts.Media = key
+	case "media-col":
+		key, ok := ippMediaFromCol(attr)
+		if !ok {
+			return false
+		}
+		opts.Media = key
+	case "print-color-mode":
+		switch value {
+		case "auto":
+		case ColorColor, ColorMonochrome:
+			opts.Color = value
+		default:
+			return false
+		}
+	case "print-scaling":
+		switch value {
+		case ScalingAuto, ScalingFit, ScalingFill, ScalingNone:
+			opts.Scaling = value
+		case "auto-fit":
+			opts.Scaling = ScalingFit
+		default:
+			return false
+		}
+	case "multiple-document-handling":
+		var collate bool
+		switch value {
+		case "separate-documents-collated-copies":
+			collate = true
+		case "separate-documents-uncollated-copies":
+		default:
+			return false
+		}
+		opts.Collate = &collate
+	case "number-up":
+		n, ok := attr.Int()
+		if !ok || !containsInt(ippNumberUp, n) {
+			return false
+		}
+		opts.NumberUp = n
+	default:
+		return false
+	}
+	return true
+}
+
+// ippMediaByName 按 IPP 纸张名称或本服务的纸张名称查找纸张
+func ippMediaByName(name string) (string, bool) {
+	for key, size := range MediaSizes {
+		if size.IPP == name || key == name {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// ippMediaFromCol 从 media-col 中取纸张, 先按 media-size-name, 再按尺寸匹配, 误差不超过1毫米.
+// 纸张类型、来源等其他成员不影响打印, 直接忽略
+func ippMediaFromCol(attr ipp.Attribute) (string, bool) {
+	members, ok := attr.Values[0].Data.([]ipp.Attribute)
+	if !ok {
+		return "", false
+	}
+	col := &ipp.Group{Attributes: members}
+	if name := col.Get("media-size-name").String(); name != "" {
+		return ippMediaByName(name)
+	}
+	size := col.Get("media-size")
+	if size == nil {
+		return "", false
+	}
+	dims, ok := size.Values[0].Data.([]ipp.Attribute)
+	if !ok {
+		return "", false
+	}
+	dimensions := &ipp.Group{Attributes: dims}
+	x, okX := dimensions.Get("x-dimension").Int()
+	y, okY := dimensions.Get("y-dimension").Int()
+	if !okX || !okY {
+		return "", false
+	}
+	for key := range MediaSizes {
+		want := ippMediaSize(key)
+		wx, _ := want[0].Int()
+		wy, _ := want[1].Int()
+		if abs(x-wx) <= 100 && abs(y-wy) <= 100 {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"printer/services/ipp"
+)
+
+// startIPPServer 启动使用 FakeBackend 的队列和内置 IPP 打印机, 返回客户端、队列和上传目录
+func startIPPServer(t *testing.T, backend *FakeBackend, settings IPPServerSettings) (*ipp.Client, *JobQueue, string) {
+	t.Helper()
+	q, dir := newTestQueue(t, backend)
+	mux := http.NewServeMux()
+	mux.Handle(IPPServerPath, NewIPPServer(q, q.printers, dir, settings))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client, err := ipp.NewClient("ipp://" + strings.TrimPrefix(server.URL, "http://") + IPPServerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, q, dir
+}
+
+// ippStatus 返回 Do 的状态码, 请求未得到 IPP 响应时测试失败
+func ippStatus(t *testing.T, resp *ipp.Message, err error) ipp.Status {
+	t.Helper()
+	var statusErr *ipp.StatusError
+	if err != nil && !errors.As(err, &statusErr) {
+		t.Fatal(err)
+	}
+	return resp.Status()
+}
+
+// newPrintJob 创建 Print-Job 请求
+func newPrintJob(client *ipp.Client, user string) *ipp.Message {
+	req := client.NewRequest(ipp.OpPrintJob)
+	op := req.Group(ipp.TagOperationGroup)
+	op.Add("requesting-user-name", ipp.TagName, user)
+	op.Add("job-name", ipp.TagName, "report.pdf")
+	op.Add("document-format", ipp.TagMimeType, "application/pdf")
+	return req
+}
+
+var ippTestDocument = []byte("%PDF-1.4\n% ipp document\n")
+
+func TestIPPServerPrintJob(t *testing.T) {
+	backend := NewFakeBackend()
+	client, q, _ := startIPPServer(t, backend, IPPServerSettings{})
+	q.Start(1)
+
+	req := newPrintJob(client, "zhangsan")
+	job := req.Group(ipp.TagJobGroup)
+	job.Add("copies", ipp.TagInteger, int32(2))
+	job.Add("sides", ipp.TagKeyword, "two-sided-long-edge")
+	resp, err := client.Do(context.Background(), req, bytes.NewReader(ippTestDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, ok := resp.Attr(ipp.TagJobGroup, "job-id").Int()
+	if !ok || resp.Attr(ipp.TagJobGroup, "job-uri").String() == "" {
+		t.Fatalf("响应缺少任务属性: %+v", resp)
+	}
+
+	jobs := q.List()
+	if len(jobs) != 1 || jobs[0].User != "zhangsan" || ippJobID(jobs[0].ID) != id {
+		t.Fatalf("jobs = %+v", jobs)
+	}
+	if done := waitFinished(t, q, jobs[0].ID); done.State != JobDone {
+		t.Fatalf("state = %s, error = %s", done.State, done.Error)
+	}
+	printed := backend.PrintedOptions()
+	if len(printed) != 1 || printed[0].Copies != 2 || printed[0].Duplex != DuplexLongEdge {
+		t.Errorf("printed options = %+v", printed)
+	}
+
+	// 默认只返回未完成的任务
+	getJobs := func(which string) []*ipp.Group {
+		req := client.NewRequest(ipp.OpGetJobs)
+		if which != "" {
+			req.Group(ipp.TagOperationGroup).Add("which-jobs", ipp.TagKeyword, which)
+		}
+		req.Group(ipp.TagOperationGroup).Add("requested-attributes", ipp.TagKeyword, "job-id", "job-state")
+		resp, err := client.Do(context.Background(), req, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.FindAll(ipp.TagJobGroup)
+	}
+	if groups := getJobs(""); len(groups) != 0 {
+		t.Errorf("not-completed: %d 个任务", len(groups))
+	}
+	groups := getJobs("completed")
+	if len(groups) != 1 {
+		t.Fatalf("completed: %d 个任务", len(groups))
+	}
+	if got, _ := groups[0].Get("job-id").Int(); got != id {
+		t.Errorf("job-id = %d, want %d", got, id)
+	}
+	// 完成 (9)
+	if state, _ := groups[0].Get("job-state").Int(); state != 9 || groups[0].Get("job-uri") != nil {
+		t.Errorf("job attributes = %+v", groups[0].Attributes)
+	}
+
+	req = client.NewRequest(ipp.OpGetJobs)
+	req.Group(ipp.TagOperationGroup).Add("which-jobs", ipp.TagKeyword, "aborted")
+	resp, err = client.Do(context.Background(), req, nil)
+	if status := ippStatus(t, resp, err); status != ipp.StatusAttributesOrValuesUnsupported {
+		t.Errorf("which-jobs aborted: status = %#x", status)
+	}
+}
+
+func TestIPPServerValidateJob(t *testing.T) {
+	client, q, _ := startIPPServer(t, NewFakeBackend(), IPPServerSettings{})
+
+	tests := []struct {
+		name   string
+		format string
+		attrs  func(g *ipp.Group)
+		status ipp.Status
+	}{
+		{"pdf", "application/pdf", nil, ipp.StatusOK},
+		{"auto", "application/octet-stream", nil, ipp.StatusOK},
+		{"unsupported format", "image/pwg-raster", nil, ipp.StatusDocumentFormatNotSupported},
+		{"ignored number-up", "application/pdf", func(g *ipp.Group) {
+			g.Add("number-up", ipp.TagInteger, int32(3))
+		}, ipp.StatusOKIgnoredOrSubstituted},
+	}
+	for _, tt := range tests {
+		req := client.NewRequest(ipp.OpValidateJob)
+		req.Group(ipp.TagOperationGroup).Add("document-format", ipp.TagMimeType, tt.format)
+		if tt.attrs != nil {
+			tt.attrs(req.Group(ipp.TagJobGroup))
+		}
+		resp, err := client.Do(context.Background(), req, nil)
+		if status := ippStatus(t, resp, err); status != tt.status {
+			t.Errorf("%s: status = %#x, want %#x", tt.name, status, tt.status)
+		}
+	}
+
+	// 要求属性保真时拒绝
+	req := client.NewRequest(ipp.OpValidateJob)
+	req.Group(ipp.TagOperationGroup).Add("ipp-attribute-fidelity", ipp.TagBoolean, true)
+	req.Group(ipp.TagJobGroup).Add("number-up", ipp.TagInteger, int32(3))
+	resp, err := client.Do(context.Background(), req, nil)
+	if status := ippStatus(t, resp, err); status != ipp.StatusAttributesOrValuesUnsupported ||
+		resp.Attr(ipp.TagUnsupportedGroup, "number-up") == nil {
+		t.Errorf("fidelity: status = %#x", status)
+	}
+	if jobs := q.List(); len(jobs) != 0 {
+		t.Errorf("Validate-Job 不应创建任务: %+v", jobs)
+	}
+}
+
+func TestIPPServerCancelJob(t *testing.T) {
+	client, q, _ := startIPPServer(t, NewFakeBackend(), IPPServerSettings{})
+	// 不启动队列, 任务保持排队状态
+	resp, err := client.Do(context.Background(), newPrintJob(client, "zhangsan"), bytes.NewReader(ippTestDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := resp.Attr(ipp.TagJobGroup, "job-id").Int()
+
+	cancel := func(user string, id int) ipp.Status {
+		req := client.NewRequest(ipp.OpCancelJob)
+		req.Group(ipp.TagOperationGroup).Add("job-id", ipp.TagInteger, int32(id))
+		req.Group(ipp.TagOperationGroup).Add("requesting-user-name", ipp.TagName, user)
+		resp, err := client.Do(context.Background(), req, nil)
+		return ippStatus(t, resp, err)
+	}
+	if status := cancel("lisi", id); status != ipp.StatusNotAuthorized {
+		t.Errorf("其他用户取消: status = %#x", status)
+	}
+	if status := cancel("zhangsan", id+1); status != ipp.StatusNotFound {
+		t.Errorf("不存在的任务: status = %#x", status)
+	}
+	if status := cancel("zhangsan", id); status != ipp.StatusOK {
+		t.Fatalf("取消: status = %#x", status)
+	}
+	if jobs := q.List(); len(jobs) != 1 || jobs[0].State != JobCanceled {
+		t.Errorf("jobs = %+v", jobs)
+	}
+}
+
+func TestIPPServerMalformedRequest(t *testing.T) {
+	client, q, _ := startIPPServer(t, NewFakeBackend(), IPPServerSettings{})
+	target, _ := ipp.HTTPURL(client.URI)
+
+	post := func(contentType string, body []byte) int {
+		resp, err := http.Post(target, contentType, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post(ipp.ContentType, []byte{2, 0, 0, 2, 0}); code != http.StatusBadRequest {
+		t.Errorf("截断的请求: HTTP %d", code)
+	}
+	if code := post("application/pdf", ippTestDocument); code != http.StatusUnsupportedMediaType {
+		t.Errorf("错误的 Content-Type: HTTP %d", code)
+	}
+	resp, err := http.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: HTTP %d", resp.StatusCode)
+	}
+
+	// 缺少必需的操作属性
+	req := &ipp.Message{Major: 2, Code: uint16(ipp.OpGetJobs), RequestID: 1}
+	req.Group(ipp.TagOperationGroup).Add("printer-uri", ipp.TagURI, client.URI)
+	msg, err := client.Do(context.Background(), req, nil)
+	if status := ippStatus(t, msg, err); status != ipp.StatusBadRequest {
+		t.Errorf("缺少 attributes-charset: status = %#x", status)
+	}
+	// 缺少文档数据
+	msg, err = client.Do(context.Background(), newPrintJob(client, "zhangsan"), nil)
+	if status := ippStatus(t, msg, err); status != ipp.StatusBadRequest {
+		t.Errorf("缺少文档: status = %#x", status)
+	}
+	if jobs := q.List(); len(jobs) != 0 {
+		t.Errorf("jobs = %+v", jobs)
+	}
+}
+
+func TestIPPServerDocumentTooLarge(t *testing.T) {
+	client, q, dir := startIPPServer(t, NewFakeBackend(), IPPServerSettings{MaxDocumentSize: 1 << 20})
+	doc := append(append([]byte(nil), ippTestDocument...), make([]byte, 1<<20)...)
+	resp, err := client.Do(context.Background(), newPrintJob(client, "zhangsan"), bytes.NewReader(doc))
+	if status := ippStatus(t, resp, err); status != ipp.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %#x", status)
+	}
+	if jobs := q.List(); len(jobs) != 0 {
+		t.Errorf("jobs = %+v", jobs)
+	}
+	// 超过上限的文档不留在上传目录中
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if !e.IsDir() {
+			t.Errorf("残留文件 %s", e.Name())
+		}
+	}
+
+	// 上限以内的文档正常提交
+	resp, err = client.Do(context.Background(), newPrintJob(client, "zhangsan"), bytes.NewReader(ippTestDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs := q.List(); len(jobs) != 1 {
+		t.Errorf("jobs = %+v", jobs)
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// JobState 打印任务状态
+type JobState string
+
+const (
+	// JobScheduled 等待到达定时打印的时间
+	JobScheduled JobState = "scheduled"
+	// JobHeld 保留中, 等待用户用 PIN 释放
+	JobHeld JobState = "held"
+	// JobQueued 等待打印
+	JobQueued JobState = "queued"
+	// JobConverting 正在准备文档
+	JobConverting JobState = "converting"
+	// JobPrinting 正在打印
+	JobPrinting JobState = "printing"
+	// JobDone 打印完成
+	JobDone JobState = "done"
+	// JobFailed 打印失败
+	JobFailed JobState = "failed"
+	// JobCanceled 已取消
+	JobCanceled JobState = "canceled"
+)
+
+// JobStates 全部任务状态
+var JobStates = []JobState{JobScheduled, JobHeld, JobQueued, JobConverting, JobPrinting, JobDone, JobFailed, JobCanceled}
+
+// Finished 判断任务是否已经结束
+func (s JobState) Finished() bool {
+	return s == JobDone || s == JobFailed || s == JobCanceled
+}
+
+// Job 打印任务
+type Job struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	// 批量打印时按顺序合并的文件, Filename 为其中第一个
+	Files []BatchFile `json:"files,omitempty"`
+	// 提交任务的用户, 用于水印和分隔页
+	User string `json:"user,omitempty"`
+	// 目标打印机或打印池, 为空时使用默认打印后端
+	Printer string `json:"printer,omitempty"`
+	// 实际打印的打印机, 打印池中的任务为分配到的成员
+	Device string   `json:"device,omitempty"`
+	State  JobState `json:"state"`
+	Error  string   `json:"error,omitempty"`
+	// 打印选项
+	Options PrintOptions `json:"options"`
+	// 优先级, 数值越大越先打印
+	Priority int `json:"priority"`
+	// 重试次数
+	Attempts int `json:"attempts,omitempty"`
+	// 每份的页数, 提交时估算, 打印完成后更新为实际交给打印机的页数
+	Pages int `json:"pages,omitempty"`
+	// 定时打印: 不早于该时间打印. 周期任务中为下一次打印的时间
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	// 周期打印的 cron 表达式, 每次到期时生成一个新任务, 本任务保持定时状态直到取消
+	Schedule string `json:"schedule,omitempty"`
+	// 由周期任务生成的任务记录其来源任务ID
+	Origin string `json:"origin,omitempty"`
+	// 热文件夹提交的任务记录被监视目录中的原文件, 任务结束后移入 done 或 failed 子目录
+	Source string `json:"source,omitempty"`
+
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// 保留任务的过期时间, 到期仍未释放时自动取消
+	HeldUntil *time.Time `json:"held_until,omitempty"`
+	// 保留任务被释放的时间
+	ReleasedAt *time.Time `json:"released_at,omitempty"`
+
+	// 保留任务的 PIN 摘要, 只随队列文件保存, 不出现在接口返回中
+	pinHash string
+}
+
+// newJobID 生成随机任务ID
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type jobContextKey struct{}
+
+// WithJob 返回携带任务信息的 context, 打印流程中的水印和分隔页从中读取用户、文件名等
+func WithJob(ctx context.Context, job Job) context.Context {
+	return context.WithValue(ctx, jobContextKey{}, job)
+}
+
+// JobFromContext 返回 WithJob 设置的任务信息
+func JobFromContext(ctx context.Context) (Job, bool) {
+	job, ok := ctx.Value(jobContextKey{}).(Job)
+	return job, ok
+}
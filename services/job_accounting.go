@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// SetAccounting 设置用量记录, 设置后提交任务时检查配额, 任务完成后记录用量.
+// 需在 Start 之前调用
+func (q *JobQueue) SetAccounting(a *Accounting) {
+	q.accounting = a
+}
+
+// checkQuotaLocked 检查任务是否超出用户配额, 任务页数未知时先估算. 调用方需持有 q.mu
+func (q *JobQueue) checkQuotaLocked(job *Job, now time.Time) error {
+	if q.accounting == nil {
+		return nil
+	}
+	if job.Pages == 0 {
+		job.Pages = estimatePages(q.uploadDir, *job)
+	}
+	pending := q.pendingPagesLocked(job.User, job.ID)
+	return q.accounting.checkQuota(job.User, pending, job.Pages*job.Options.CopyCount(), now)
+}
+
+// pendingPagesLocked 返回用户已接受但还未打印完的面数, 不含 except 和周期任务的模板.
+// 调用方需持有 q.mu
+func (q *JobQueue) pendingPagesLocked(user, except string) int {
+	pending := 0
+	for _, job := range q.jobs {
+		if job.ID == except || job.User != user || job.State.Finished() || job.Schedule != "" {
+			continue
+		}
+		pending += job.Pages * job.Options.CopyCount()
+	}
+	return pending
+}
+
+// QuotaStatus 返回用户的配额、已用和待打印的面数, 未启用用量记录时返回 false
+func (q *JobQueue) QuotaStatus(user string) (QuotaStatus, bool) {
+	if q.accounting == nil {
+		return QuotaStatus{}, false
+	}
+	q.mu.Lock()
+	pending := q.pendingPagesLocked(user, "")
+	q.mu.Unlock()
+
+	day, month := q.accounting.Usage(user, time.Now())
+	return QuotaStatus{
+		User:        user,
+		Quota:       q.accounting.QuotaFor(user),
+		DailyUsed:   day,
+		MonthlyUsed: month,
+		Pending:     pending,
+	}, true
+}
+
+// trackPrinted 启用用量记录时返回会记录最终文档页数的 context
+func (q *JobQueue) trackPrinted(ctx context.Context) (context.Context, *printedDoc) {
+	if q.accounting == nil {
+		return ctx, nil
+	}
+	return withPrintedDoc(ctx)
+}
+
+// account 记录完成任务的用量, 并将任务页数更新为实际打印的页数.
+// 后端直接打印非 PDF 文件时无法得知页数, 按提交时的估算计
+func (q *JobQueue) account(job *Job, printed *printedDoc) {
+	if printed == nil {
+		return
+	}
+	q.mu.Lock()
+	opts := printed.opts
+	if printed.pages > 0 {
+		job.Pages = printed.pages
+	} else {
+		opts = job.Options
+	}
+	snapshot := *job
+	q.mu.Unlock()
+
+	q.accounting.Record(q.accounting.newRecord(snapshot, snapshot.Pages, opts, time.Now()))
+}
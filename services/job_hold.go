@@ -0,0 +1,182 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrJobNotHeld 任务不处于保留状态, 无需释放
+	ErrJobNotHeld = errors.New("任务未处于保留状态")
+	// ErrWrongPIN 释放任务的 PIN 不正确
+	ErrWrongPIN = errors.New("PIN 不正确")
+	// ErrTooManyAttempts PIN 错误次数过多, 只能由打印机旁的终端释放或取消
+	ErrTooManyAttempts = errors.New("PIN 错误次数过多")
+)
+
+// 每个任务允许输错 PIN 的次数
+const maxReleaseAttempts = 5
+
+// ValidatePIN 检查 PIN 格式, 要求 4 到 8 位数字
+func ValidatePIN(pin string) error {
+	if len(pin) < 4 || len(pin) > 8 {
+		return fmt.Errorf("PIN 必须是 4 到 8 位数字")
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("PIN 必须是 4 到 8 位数字")
+		}
+	}
+	return nil
+}
+
+// hashPIN 返回 "盐:哈希" 形式的 PIN 摘要
+func hashPIN(pin string) string {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	sum := sha256.Sum256(append(salt, pin...))
+	return hex.EncodeToString(salt) + ":" + hex.EncodeToString(sum[:])
+}
+
+// checkPIN 判断 pin 与 hashPIN 生成的摘要是否一致
+func checkPIN(hashed, pin string) bool {
+	if len(hashed) != 32+1+64 || hashed[32] != ':' {
+		return false
+	}
+	salt, err := hex.DecodeString(hashed[:32])
+	if err != nil {
+		return false
+	}
+	sum := sha256.Sum256(append(salt, pin...))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(hashed[33:])) == 1
+}
+
+// SetHoldTTL 设置保留任务的有效期, 超过有效期仍未释放的任务被自动取消,
+// 0 表示一直保留. 需在 Start 之前调用
+func (q *JobQueue) SetHoldTTL(ttl time.Duration) {
+	q.holdTTL = ttl
+}
+
+// SubmitHeld 提交一个保留任务, 任务在用 PIN 释放之前不会打印
+func (q *JobQueue) SubmitHeld(job Job, pin string) (Job, error) {
+	if err := ValidatePIN(pin); err != nil {
+		return Job{}, err
+	}
+	return q.submit(job, hashPIN(pin))
+}
+
+// Release 用 PIN 释放保留任务, trusted 为 true 时 (打印机旁已认证的终端) 不检查 PIN
+func (q *JobQueue) Release(id, pin string, trusted bool) (Job, error) {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	if !ok {
+		q.mu.Unlock()
+		return Job{}, ErrJobNotFound
+	}
+	if job.State != JobHeld {
+		q.mu.Unlock()
+		return *job, ErrJobNotHeld
+	}
+	if !trusted {
+		if q.releaseFailures[id] >= maxReleaseAttempts {
+			q.mu.Unlock()
+			return *job, ErrTooManyAttempts
+		}
+		if !checkPIN(job.pinHash, pin) {
+			q.releaseFailures[id]++
+			q.mu.Unlock()
+			return *job, ErrWrongPIN
+		}
+	}
+	q.releaseLocked(job)
+	q.save()
+	snapshot := *job
+	q.mu.Unlock()
+
+	q.notify()
+	return snapshot, nil
+}
+
+// ReleaseUser 释放用户全部 PIN 相同的保留任务, 用于在打印机旁一次取走自己的文档.
+// 用户没有保留任务时返回 ErrJobNotFound, PIN 都不匹配时返回 ErrWrongPIN
+func (q *JobQueue) ReleaseUser(user, pin string) ([]Job, error) {
+	q.mu.Lock()
+	var released []Job
+	var held []*Job
+	for _, job := range q.sortedLocked() {
+		if job.State != JobHeld || job.User != user || q.releaseFailures[job.ID] >= maxReleaseAttempts {
+			continue
+		}
+		held = append(held, job)
+		if checkPIN(job.pinHash, pin) {
+			q.releaseLocked(job)
+			released = append(released, *job)
+		}
+	}
+	if len(held) == 0 {
+		q.mu.Unlock()
+		return nil, ErrJobNotFound
+	}
+	if len(released) == 0 {
+		// 一个任务都没有匹配时才计为输错, 不同任务可以使用不同的 PIN
+		for _, job := range held {
+			q.releaseFailures[job.ID]++
+		}
+		q.mu.Unlock()
+		return nil, ErrWrongPIN
+	}
+	q.save()
+	q.mu.Unlock()
+
+	q.notify()
+	return released, nil
+}
+
+// holdLocked 将任务转为保留状态并重新计算过期时间, 调用方需持有 q.mu
+func (q *JobQueue) holdLocked(job *Job, now time.Time) {
+	job.State = JobHeld
+	job.HeldUntil = nil
+	if q.holdTTL > 0 {
+		until := now.Add(q.holdTTL)
+		job.HeldUntil = &until
+	}
+}
+
+// releaseLocked 将保留任务转为排队, 调用方需持有 q.mu
+func (q *JobQueue) releaseLocked(job *Job) {
+	now := time.Now()
+	job.State = JobQueued
+	job.pinHash = ""
+	job.HeldUntil = nil
+	job.ReleasedAt = &now
+	job.UpdatedAt = now
+	delete(q.releaseFailures, job.ID)
+}
+
+// purgeHeld 取消超过有效期仍未释放的保留任务, 重试时任务重新进入保留状态
+func (q *JobQueue) purgeHeld() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	purged := false
+	for _, job := range q.jobs {
+		if job.State == JobHeld && job.HeldUntil != nil && now.After(*job.HeldUntil) {
+			job.State = JobCanceled
+			job.Error = "超过保留期限未释放, 已自动取消"
+			job.HeldUntil = nil
+			job.UpdatedAt = now
+			job.FinishedAt = &now
+			delete(q.releaseFailures, job.ID)
+			purged = true
+		}
+	}
+	if purged {
+		q.save()
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidatePIN(t *testing.T) {
+	tests := []struct {
+		pin string
+		ok  bool
+	}{
+		{"1234", true},
+		{"12345678", true},
+		{"123", false},
+		{"123456789", false},
+		{"12a4", false},
+		{"", false},
+		{"１２３４", false},
+	}
+	for _, tt := range tests {
+		if err := ValidatePIN(tt.pin); (err == nil) != tt.ok {
+			t.Errorf("ValidatePIN(%q) = %v", tt.pin, err)
+		}
+	}
+	hashed := hashPIN("1234")
+	if !checkPIN(hashed, "1234") || checkPIN(hashed, "4321") || checkPIN("", "") {
+		t.Error("checkPIN 结果错误")
+	}
+}
+
+// submitHeld 提交保留任务
+func submitHeld(t *testing.T, q *JobQueue, dir, user, pin string) Job {
+	t.Helper()
+	writeTestFile(t, dir, user+".pdf", []byte("%PDF-1.4\n"))
+	job, err := q.SubmitHeld(Job{Filename: user + ".pdf", User: user}, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State != JobHeld {
+		t.Fatalf("state = %s", job.State)
+	}
+	return job
+}
+
+func TestJobQueueReleaseHeld(t *testing.T) {
+	backend := NewFakeBackend()
+	q, dir := newTestQueue(t, backend)
+	q.Start(1)
+
+	if _, err := q.SubmitHeld(Job{Filename: "a.pdf"}, "12"); err == nil {
+		t.Error("格式错误的 PIN 应被拒绝")
+	}
+	job := submitHeld(t, q, dir, "zhangsan", "1234")
+	// 释放前不打印
+	time.Sleep(50 * time.Millisecond)
+	if printed := backend.Printed(); len(printed) != 0 {
+		t.Fatalf("保留任务被打印: %v", printed)
+	}
+
+	if _, err := q.Release(job.ID, "4321", false); !errors.Is(err, ErrWrongPIN) {
+		t.Errorf("错误的 PIN: err = %v", err)
+	}
+	if _, err := q.Release("unknown", "1234", false); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("不存在的任务: err = %v", err)
+	}
+	released, err := q.Release(job.ID, "1234", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if released.ReleasedAt == nil || released.State == JobHeld {
+		t.Errorf("released = %+v", released)
+	}
+	if done := waitFinished(t, q, job.ID); done.State != JobDone {
+		t.Fatalf("state = %s, error = %s", done.State, done.Error)
+	}
+	if printed := backend.Printed(); len(printed) != 1 {
+		t.Errorf("printed = %v", printed)
+	}
+	if _, err := q.Release(job.ID, "1234", false); !errors.Is(err, ErrJobNotHeld) {
+		t.Errorf("重复释放: err = %v", err)
+	}
+}
+
+func TestJobQueueReleaseLockout(t *testing.T) {
+	q, dir := newTestQueue(t, NewFakeBackend())
+	job := submitHeld(t, q, dir, "zhangsan", "1234")
+
+	for i := 0; i < maxReleaseAttempts; i++ {
+		if _, err := q.Release(job.ID, "0000", false); !errors.Is(err, ErrWrongPIN) {
+			t.Fatalf("第 %d 次: err = %v", i+1, err)
+		}
+	}
+	// 锁定后正确的 PIN 也不能释放, 按用户释放时跳过该任务
+	if _, err := q.Release(job.ID, "1234", false); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("锁定后: err = %v", err)
+	}
+	if _, err := q.ReleaseUser("zhangsan", "1234"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("锁定后按用户释放: err = %v", err)
+	}
+	if got, _ := q.Get(job.ID); got.State != JobHeld {
+		t.Errorf("state = %s", got.State)
+	}
+
+	// 打印机旁的终端不需要 PIN
+	released, err := q.Release(job.ID, "", true)
+	if err != nil || released.State != JobQueued {
+		t.Errorf("trusted release: %+v, %v", released, err)
+	}
+	if _, ok := q.releaseFailures[job.ID]; ok {
+		t.Error("释放后应清除错误次数")
+	}
+}
+
+func TestJobQueueReleaseUser(t *testing.T) {
+	q, dir := newTestQueue(t, NewFakeBackend())
+	first := submitHeld(t, q, dir, "zhangsan", "1234")
+	other := submitHeld(t, q, dir, "zhangsan", "5678")
+	second, err := q.SubmitHeld(Job{Filename: "zhangsan.pdf", User: "zhangsan"}, "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	submitHeld(t, q, dir, "lisi", "1234")
+
+	if _, err := q.ReleaseUser("wangwu", "1234"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("没有保留任务: err = %v", err)
+	}
+	if _, err := q.ReleaseUser("zhangsan", "0000"); !errors.Is(err, ErrWrongPIN) {
+		t.Errorf("PIN 都不匹配: err = %v", err)
+	}
+	if q.releaseFailures[first.ID] != 1 || q.releaseFailures[other.ID] != 1 {
+		t.Errorf("failures = %v", q.releaseFailures)
+	}
+
+	released, err := q.ReleaseUser("zhangsan", "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(released) != 2 || released[0].ID != first.ID || released[1].ID != second.ID {
+		t.Fatalf("released = %+v", released)
+	}
+	// PIN 不同的任务和其他用户的任务仍保留
+	for _, job := range q.List() {
+		if held := job.State == JobHeld; held != (job.ID == other.ID || job.User == "lisi") {
+			t.Errorf("%s (%s): state = %s", job.ID, job.User, job.State)
+		}
+	}
+}
+
+func TestJobQueuePurgeHeld(t *testing.T) {
+	q, dir := newTestQueue(t, NewFakeBackend())
+	q.SetHoldTTL(time.Millisecond)
+	job := submitHeld(t, q, dir, "zhangsan", "1234")
+	if job.HeldUntil == nil {
+		t.Fatal("设置有效期后应记录 HeldUntil")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	q.purgeHeld()
+	got, _ := q.Get(job.ID)
+	if got.State != JobCanceled || got.FinishedAt == nil {
+		t.Errorf("job = %+v", got)
+	}
+	if _, err := q.Release(job.ID, "1234", false); !errors.Is(err, ErrJobNotHeld) {
+		t.Errorf("过期后释放: err = %v", err)
+	}
+}
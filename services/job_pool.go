@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+)
+
+// targetAvailableLocked 判断任务的目标能否接收任务, 打印池中有一台可用的打印机即可.
+// 调用方需持有 q.mu
+func (q *JobQueue) targetAvailableLocked(target string) bool {
+	if q.available == nil {
+		return true
+	}
+	pool, err := q.printers.GetPool(target)
+	if err != nil {
+		return q.available(target)
+	}
+	for _, m := range pool.Members {
+		if q.available(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// TargetAvailable 判断打印机或打印池当前能否接收任务
+func (q *JobQueue) TargetAvailable(target string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.targetAvailableLocked(target)
+}
+
+// print 将任务交给目标打印机. 目标为打印池时按分配方式依次尝试可用的成员,
+// 成员的打印后端出错时换用下一台, 文档本身的错误不再尝试
+func (q *JobQueue) print(ctx context.Context, job Job, progress func(JobState)) error {
+	if !q.printers.IsPool(job.Printer) {
+		service, _, err := q.printers.Resolve(job.Printer)
+		if err != nil {
+			return err
+		}
+		q.setDevice(job.ID, job.Printer)
+		return q.process(ctx, service, job, job.Options, progress)
+	}
+
+	pool, members, err := q.printers.ResolvePool(job.Printer)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, m := range q.orderMembers(pool, members) {
+		// 池的默认选项已在提交时合并, 成员的默认选项只补充未设置的部分
+		opts := job.Options.WithDefaults(m.Defaults)
+		if err := m.Service.CheckOptions(opts); err != nil {
+			lastErr = fmt.Errorf("%s: %w", m.Name, err)
+			continue
+		}
+		q.setDevice(job.ID, m.Name)
+		err := q.process(ctx, m.Service, job, opts, progress)
+		var backendErr *backendError
+		if err == nil || ctx.Err() != nil || !errors.As(err, &backendErr) {
+			return err
+		}
+		log.Printf("打印任务 %s 在打印池 %s 的 %s 上失败, 换用其他打印机: %v", job.ID, pool.Name, m.Name, err)
+		lastErr = fmt.Errorf("%s: %w", m.Name, err)
+	}
+	if lastErr == nil {
+		return ErrPoolUnavailable
+	}
+	return lastErr
+}
+
+// process 用 service 打印任务的文件
+func (q *JobQueue) process(ctx context.Context, service *PrintService, job Job, opts PrintOptions, progress func(JobState)) error {
+	if len(job.Files) > 0 {
+		return service.ProcessBatch(ctx, q.uploadDir, job.Files, opts, progress)
+	}
+	return service.Process(ctx, filepath.Join(q.uploadDir, job.Filename), opts, progress)
+}
+
+// orderMembers 返回本次尝试成员的顺序, 跳过状态检查为不可用的打印机.
+// 轮流分配时从上次之后的成员开始, 按排队分配时排队和正在打印的任务少的优先
+func (q *JobQueue) orderMembers(pool Pool, members []PoolMember) []PoolMember {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var ordered []PoolMember
+	if pool.Strategy == PoolLeastQueued {
+		load := q.deviceLoadLocked()
+		ordered = append(ordered, members...)
+		// 负载相同时保持成员顺序
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return load[ordered[i].Name] < load[ordered[j].Name]
+		})
+	} else {
+		start := q.poolCursor[pool.Name] % len(members)
+		q.poolCursor[pool.Name] = start + 1
+		ordered = append(ordered, members[start:]...)
+		ordered = append(ordered, members[:start]...)
+	}
+
+	available := ordered[:0]
+	for _, m := range ordered {
+		if q.available == nil || q.available(m.Name) {
+			available = append(available, m)
+		}
+	}
+	return available
+}
+
+// deviceLoadLocked 统计每台打印机排队和正在处理的任务数, 调用方需持有 q.mu
+func (q *JobQueue) deviceLoadLocked() map[string]int {
+	load := make(map[string]int)
+	for _, job := range q.jobs {
+		switch job.State {
+		case JobQueued:
+			// 打印池中排队的任务还未分配
+			if !q.printers.IsPool(job.Printer) {
+				load[job.Printer]++
+			}
+		case JobConverting, JobPrinting:
+			load[job.Device]++
+		}
+	}
+	return load
+}
+
+// setDevice 记录任务分配到的打印机
+func (q *JobQueue) setDevice(id, device string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job, ok := q.jobs[id]; ok {
+		job.Device = device
+		q.save()
+	}
+}
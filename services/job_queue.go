@@ -0,0 +1,524 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrJobNotFound 任务不存在
+	ErrJobNotFound = errors.New("任务不存在")
+	// ErrJobFinished 任务已经结束, 无法取消或调整
+	ErrJobFinished = errors.New("任务已结束")
+	// ErrJobNotRetryable 只有失败或已取消的任务可以重试
+	ErrJobNotRetryable = errors.New("只能重试失败或已取消的任务")
+)
+
+// JobQueue 持久化的打印任务队列, 由若干 worker 依次取出任务,
+// 交给目标打印机对应的 PrintService
+type JobQueue struct {
+	printers  *PrinterRegistry
+	path      string
+	uploadDir string
+	retention time.Duration
+	// 判断打印机能否接收任务, 为 nil 时总是可以, 由 q.mu 保护
+	available func(printer string) bool
+	// 保留任务的有效期, 0 表示一直保留
+	holdTTL time.Duration
+	// 用量记录, 为 nil 时不检查配额
+	accounting *Accounting
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	running map[string]*runningJob
+	wake    chan struct{}
+	// 保留任务输错 PIN 的次数
+	releaseFailures map[string]int
+	// 轮流分配的打印池下一次从第几个成员开始
+	poolCursor map[string]int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// runningJob 正在处理的任务, 用于取消
+type runningJob struct {
+	cancel   context.CancelFunc
+	canceled bool
+}
+
+// NewJobQueue 创建任务队列并从 path 恢复历史任务,
+// 上次退出时未完成的任务会重新排队
+func NewJobQueue(printers *PrinterRegistry, path, uploadDir string, retention time.Duration) (*JobQueue, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &JobQueue{
+		printers:  printers,
+		path:      path,
+		uploadDir: uploadDir,
+		retention: retention,
+		jobs:      make(map[string]*Job),
+		running:   make(map[string]*runningJob),
+		ctx:       ctx,
+		cancel:    cancel,
+
+		releaseFailures: make(map[string]int),
+		poolCursor:      make(map[string]int),
+	}
+	if err := q.load(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *JobQueue) load() error {
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var stored []storedJob
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range stored {
+		job := &stored[i].Job
+		job.pinHash = stored[i].PINHash
+		if job.State == JobConverting || job.State == JobPrinting {
+			// 服务中断时正在处理的任务, 重新排队
+			job.State = JobQueued
+			job.StartedAt = nil
+			job.UpdatedAt = now
+		}
+		q.jobs[job.ID] = job
+	}
+	return nil
+}
+
+// save 将全部任务写入文件, 调用方需持有 q.mu
+func (q *JobQueue) save() {
+	q.prune()
+
+	jobs := q.sortedLocked()
+	stored := make([]storedJob, len(jobs))
+	for i, job := range jobs {
+		stored[i] = storedJob{Job: *job, PINHash: job.pinHash}
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		log.Printf("序列化打印任务失败: %v", err)
+		return
+	}
+	if err := writeFileAtomic(q.path, data); err != nil {
+		log.Printf("保存打印任务失败: %v", err)
+	}
+}
+
+// storedJob 队列文件中的任务, 包含不出现在接口返回中的字段
+type storedJob struct {
+	Job
+	PINHash string `json:"pin_hash,omitempty"`
+}
+
+// prune 清理超过保留期限的已结束任务, 调用方需持有 q.mu
+func (q *JobQueue) prune() {
+	if q.retention <= 0 {
+		return
+	}
+	deadline := time.Now().Add(-q.retention)
+	for id, job := range q.jobs {
+		if job.State.Finished() && job.UpdatedAt.Before(deadline) {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// writeFileAtomic 先写临时文件再重命名, 避免进程中断时留下半个文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Start 启动指定数量的 worker
+func (q *JobQueue) Start(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	q.wake = make(chan struct{}, workers)
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	q.wg.Add(1)
+	go q.tickLoop()
+	q.notify()
+}
+
+// Stop 停止所有 worker, 正在处理的任务会在下次启动时重新排队
+func (q *JobQueue) Stop() {
+	q.cancel()
+	q.wg.Wait()
+}
+
+// SetAvailability 设置判断打印机是否可用的函数, 不可用的打印机上的任务保持排队.
+// 可以在 Start 之后调用, worker 读取该函数时都持有 q.mu
+func (q *JobQueue) SetAvailability(available func(printer string) bool) {
+	q.mu.Lock()
+	q.available = available
+	q.mu.Unlock()
+}
+
+// Wake 唤醒 worker 重新检查排队的任务, 在打印机恢复可用时调用
+func (q *JobQueue) Wake() {
+	q.notify()
+}
+
+// notify 唤醒一个空闲的 worker
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Submit 提交一个新任务, job 中由调用方填写文件名、优先级等字段,
+// ID、状态和时间由队列生成. 设置了 NotBefore 或 Schedule 的任务先进入定时状态
+func (q *JobQueue) Submit(job Job) (Job, error) {
+	return q.submit(job, "")
+}
+
+// submit 加入任务, 保留任务需提供 PIN 摘要
+func (q *JobQueue) submit(job Job, pinHash string) (Job, error) {
+	if job.Schedule != "" {
+		if _, err := ParseSchedule(job.Schedule); err != nil {
+			return Job{}, err
+		}
+	}
+
+	now := time.Now()
+	job.ID = newJobID()
+	job.pinHash = pinHash
+	job.HeldUntil = nil
+	job.Error = ""
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	job.StartedAt = nil
+	job.FinishedAt = nil
+	job.ReleasedAt = nil
+
+	if q.accounting != nil {
+		// 估算需要读取文件, 在加锁前完成
+		job.Pages = estimatePages(q.uploadDir, job)
+	}
+
+	q.mu.Lock()
+	if err := q.checkQuotaLocked(&job, now); err != nil {
+		q.mu.Unlock()
+		return Job{}, err
+	}
+	q.arrangeLocked(&job, now)
+	// 队列保存副本, 解锁后 worker 可能立即修改它
+	stored := job
+	q.jobs[job.ID] = &stored
+	q.save()
+	q.mu.Unlock()
+
+	q.notify()
+	return job, nil
+}
+
+// arrangeLocked 根据定时和保留设置决定新任务或重试任务的状态, 调用方需持有 q.mu
+func (q *JobQueue) arrangeLocked(job *Job, now time.Time) {
+	if job.Schedule != "" {
+		if s, err := ParseSchedule(job.Schedule); err == nil {
+			next := s.Next(now)
+			job.NotBefore = &next
+		}
+	}
+	switch {
+	case job.NotBefore != nil && job.NotBefore.After(now):
+		job.State = JobScheduled
+	case job.pinHash != "":
+		q.holdLocked(job, now)
+	default:
+		job.State = JobQueued
+	}
+}
+
+// Cancel 取消任务. 排队中的任务直接标记为已取消,
+// 正在处理的任务通过 context 通知后端中止
+func (q *JobQueue) Cancel(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	if job.State.Finished() {
+		return *job, ErrJobFinished
+	}
+
+	if running, ok := q.running[id]; ok {
+		running.canceled = true
+		running.cancel()
+		return *job, nil
+	}
+
+	now := time.Now()
+	job.State = JobCanceled
+	job.UpdatedAt = now
+	job.FinishedAt = &now
+	q.save()
+	return *job, nil
+}
+
+// Retry 将失败或已取消的任务重新排队, 无需重新上传文件.
+// 未释放的保留任务重新进入保留状态, 未到时间的定时任务重新进入定时状态
+func (q *JobQueue) Retry(id string) (Job, error) {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	if !ok {
+		q.mu.Unlock()
+		return Job{}, ErrJobNotFound
+	}
+	if job.State != JobFailed && job.State != JobCanceled {
+		q.mu.Unlock()
+		return *job, ErrJobNotRetryable
+	}
+
+	now := time.Now()
+	if err := q.checkQuotaLocked(job, now); err != nil {
+		q.mu.Unlock()
+		return *job, err
+	}
+	// 未释放就被取消的保留任务需要重新用 PIN 释放, 周期任务等待下一次打印时间
+	q.arrangeLocked(job, now)
+	job.Error = ""
+	job.Attempts++
+	job.StartedAt = nil
+	job.FinishedAt = nil
+	job.UpdatedAt = now
+	q.save()
+	snapshot := *job
+	q.mu.Unlock()
+
+	q.notify()
+	return snapshot, nil
+}
+
+// SetPriority 调整未结束任务的优先级, 数值越大越先打印
+func (q *JobQueue) SetPriority(id string, priority int) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	if job.State.Finished() {
+		return *job, ErrJobFinished
+	}
+
+	job.Priority = priority
+	job.UpdatedAt = time.Now()
+	q.save()
+	return *job, nil
+}
+
+// Get 返回任务的副本
+func (q *JobQueue) Get(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return *job, nil
+}
+
+// List 按创建时间返回全部任务
+func (q *JobQueue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	sorted := q.sortedLocked()
+	jobs := make([]Job, len(sorted))
+	for i, job := range sorted {
+		jobs[i] = *job
+	}
+	return jobs
+}
+
+func (q *JobQueue) sortedLocked() []*Job {
+	jobs := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// next 取出优先级最高的排队任务并标记为处理中, 优先级相同时先提交的先处理,
+// 跳过目标打印机不可用的任务, 没有任务时返回 nil
+func (q *JobQueue) next() (*Job, context.Context) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var next *Job
+	for _, job := range q.jobs {
+		if job.State != JobQueued {
+			continue
+		}
+		if !q.targetAvailableLocked(job.Printer) {
+			continue
+		}
+		if next == nil || job.Priority > next.Priority ||
+			(job.Priority == next.Priority && job.CreatedAt.Before(next.CreatedAt)) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithCancel(q.ctx)
+	q.running[next.ID] = &runningJob{cancel: cancel}
+
+	now := time.Now()
+	next.State = JobConverting
+	next.Device = ""
+	next.Error = ""
+	next.StartedAt = &now
+	next.FinishedAt = nil
+	next.UpdatedAt = now
+	q.save()
+	return next, WithJob(ctx, *next)
+}
+
+// setState 更新任务状态, 结束状态会记录完成时间
+func (q *JobQueue) setState(job *Job, state JobState, jobErr error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	job.State = state
+	job.UpdatedAt = now
+	if jobErr != nil {
+		job.Error = jobErr.Error()
+	}
+	if state.Finished() {
+		job.FinishedAt = &now
+	}
+	if state == JobQueued {
+		job.StartedAt = nil
+	}
+	q.save()
+}
+
+// tickLoop 定期将到期的定时任务转为排队, 并取消过期未释放的保留任务
+func (q *JobQueue) tickLoop() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(queueTickInterval)
+	defer ticker.Stop()
+	for {
+		q.promoteScheduled()
+		q.purgeHeld()
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *JobQueue) worker() {
+	defer q.wg.Done()
+
+	for {
+		job, ctx := q.next()
+		if job == nil {
+			select {
+			case <-q.ctx.Done():
+				return
+			case <-q.wake:
+				continue
+			}
+		}
+		// 可能还有其他排队任务, 唤醒其他 worker 并行处理
+		q.notify()
+		q.run(ctx, job)
+
+		if q.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// printRecover 调用打印函数, 后端 panic (如 COM 调用出错) 时转换为任务失败, 避免整个服务退出
+func (q *JobQueue) printRecover(ctx context.Context, job Job, progress func(JobState)) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("打印任务 %s 发生 panic: %v\n%s", job.ID, r, debug.Stack())
+			err = fmt.Errorf("打印时发生内部错误: %v", r)
+		}
+	}()
+	return q.print(ctx, job, progress)
+}
+
+// run 执行单个任务. 打印时只读取加锁取得的任务快照, 调整优先级等操作会同时修改任务,
+// 状态和分配的打印机通过加锁的方法写回
+func (q *JobQueue) run(ctx context.Context, job *Job) {
+	progress := func(state JobState) {
+		q.setState(job, state, nil)
+	}
+	q.mu.Lock()
+	snapshot := *job
+	q.mu.Unlock()
+	ctx, printed := q.trackPrinted(ctx)
+	err := q.printRecover(ctx, snapshot, progress)
+
+	q.mu.Lock()
+	running := q.running[job.ID]
+	delete(q.running, job.ID)
+	q.mu.Unlock()
+	running.cancel()
+
+	switch {
+	case running.canceled:
+		q.setState(job, JobCanceled, nil)
+	case err == nil:
+		q.account(job, printed)
+		q.setState(job, JobDone, nil)
+	case q.ctx.Err() != nil:
+		// 服务关闭导致的中断, 下次启动时重新打印
+		q.setState(job, JobQueued, nil)
+	default:
+		log.Printf("打印任务 %s 失败: %v", job.ID, err)
+		q.setState(job, JobFailed, err)
+	}
+}
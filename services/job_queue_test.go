@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestQueue 创建使用 backend 作为默认后端的队列, 返回队列和上传目录
+func newTestQueue(t *testing.T, backend PrintBackend) (*JobQueue, string) {
+	t.Helper()
+	dir := t.TempDir()
+	registry, err := NewPrinterRegistry(filepath.Join(dir, "config", "printers.json"), NewPrintService(backend))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewJobQueue(registry, filepath.Join(dir, "config", "jobs.json"), dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(q.Stop)
+	return q, dir
+}
+
+// writeTestFile 在上传目录中写入文件
+func writeTestFile(t *testing.T, dir, name string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitFinished 等待任务结束
+func waitFinished(t *testing.T, q *JobQueue, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.State.Finished() {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("任务 %s 未结束, 状态 %s", id, job.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJobQueuePrints(t *testing.T) {
+	backend := NewFakeBackend()
+	q, dir := newTestQueue(t, backend)
+	writeTestFile(t, dir, "a.pdf", []byte("%PDF-1.4\n"))
+	q.Start(1)
+
+	job, err := q.Submit(Job{Filename: "a.pdf", Options: PrintOptions{Copies: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job = waitFinished(t, q, job.ID); job.State != JobDone {
+		t.Fatalf("state = %s, error = %s", job.State, job.Error)
+	}
+	if printed := backend.PrintedOptions(); len(printed) != 1 || printed[0].Copies != 2 {
+		t.Fatalf("printed options = %+v", printed)
+	}
+}
+
+func TestJobQueueBackendError(t *testing.T) {
+	backend := NewFakeBackend()
+	backend.SetError(errors.New("卡纸"))
+	q, dir := newTestQueue(t, backend)
+	writeTestFile(t, dir, "a.pdf", []byte("%PDF-1.4\n"))
+	q.Start(1)
+
+	job, err := q.Submit(Job{Filename: "a.pdf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job = waitFinished(t, q, job.ID); job.State != JobFailed || job.Error == "" {
+		t.Fatalf("state = %s, error = %q", job.State, job.Error)
+	}
+}
+
+// panicBackend 打印时 panic, 模拟 COM 调用出错
+type panicBackend struct {
+	*FakeBackend
+}
+
+func (b panicBackend) Print(ctx context.Context, filePath string, opts PrintOptions) error {
+	panic("COM 调用失败")
+}
+
+func TestJobQueueRecoversBackendPanic(t *testing.T) {
+	q, dir := newTestQueue(t, panicBackend{NewFakeBackend()})
+	writeTestFile(t, dir, "a.pdf", []byte("%PDF-1.4\n"))
+	q.Start(1)
+
+	for i := 0; i < 2; i++ {
+		// 第二个任务验证 worker 在 panic 之后仍在工作
+		job, err := q.Submit(Job{Filename: "a.pdf"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job = waitFinished(t, q, job.ID); job.State != JobFailed {
+			t.Fatalf("state = %s", job.State)
+		}
+	}
+}
+
+func TestJobQueueWaitsForAvailablePrinter(t *testing.T) {
+	q, dir := newTestQueue(t, NewFakeBackend())
+	if err := q.printers.Add(Printer{Name: "office", Backend: "fake", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dir, "a.pdf", []byte("%PDF-1.4\n"))
+	q.Start(1)
+
+	var available atomic.Bool
+	q.SetAvailability(func(printer string) bool { return available.Load() })
+	job, err := q.Submit(Job{Filename: "a.pdf", Printer: "office"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if job, _ = q.Get(job.ID); job.State != JobQueued {
+		t.Fatalf("打印机不可用时 state = %s", job.State)
+	}
+
+	available.Store(true)
+	q.Wake()
+	if job = waitFinished(t, q, job.ID); job.State != JobDone {
+		t.Fatalf("state = %s, error = %s", job.State, job.Error)
+	}
+}
+
+// TestJobQueueSetPriorityWhilePrinting 打印过程中调整优先级, 配合 go test -race 检查数据竞争
+func TestJobQueueSetPriorityWhilePrinting(t *testing.T) {
+	backend := NewFakeBackend()
+	backend.SetDelay(50 * time.Millisecond)
+	q, dir := newTestQueue(t, backend)
+	writeTestFile(t, dir, "a.pdf", []byte("%PDF-1.4\n"))
+	q.Start(1)
+
+	job, err := q.Submit(Job{Filename: "a.pdf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		if _, err := q.SetPriority(job.ID, i); err != nil {
+			if !errors.Is(err, ErrJobFinished) {
+				t.Fatal(err)
+			}
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if job = waitFinished(t, q, job.ID); job.State != JobDone || job.Device != "" {
+		t.Fatalf("state = %s, device = %q, error = %s", job.State, job.Device, job.Error)
+	}
+}
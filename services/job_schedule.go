@@ -0,0 +1,55 @@
+package services
+
+import "time"
+
+// 检查定时任务和保留任务的间隔
+const queueTickInterval = 15 * time.Second
+
+// promoteScheduled 将到期的定时任务转为排队 (设置了 PIN 的转为保留).
+// 周期任务生成一个新任务并计算下一次时间, 服务停止期间错过的多次只补打一次.
+// 生成的任务超出用户配额时直接标记为失败
+func (q *JobQueue) promoteScheduled() {
+	q.mu.Lock()
+	now := time.Now()
+	changed := false
+	for _, job := range q.sortedLocked() {
+		if job.State != JobScheduled || job.NotBefore == nil || job.NotBefore.After(now) {
+			continue
+		}
+		changed = true
+		if job.Schedule == "" {
+			job.UpdatedAt = now
+			q.arrangeLocked(job, now)
+			continue
+		}
+
+		run := *job
+		run.ID = newJobID()
+		run.Schedule = ""
+		run.NotBefore = nil
+		run.Origin = job.ID
+		run.Attempts = 0
+		run.CreatedAt = now
+		run.UpdatedAt = now
+		if err := q.checkQuotaLocked(&run, now); err != nil {
+			// 超出配额的这一次不打印, 模板继续等待下一次
+			run.State = JobFailed
+			run.Error = err.Error()
+			run.FinishedAt = &now
+		} else {
+			q.arrangeLocked(&run, now)
+		}
+		q.jobs[run.ID] = &run
+
+		job.UpdatedAt = now
+		q.arrangeLocked(job, now)
+	}
+	if changed {
+		q.save()
+	}
+	q.mu.Unlock()
+
+	if changed {
+		q.notify()
+	}
+}
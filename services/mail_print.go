@@ -0,0 +1,501 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	netsmtp "net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"printer/services/smtp"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// maxMailDepth 解析邮件时 multipart 和转发邮件的最大嵌套层数
+const maxMailDepth = 8
+
+// mailPollInterval 等待任务结束再回复时检查任务状态的间隔
+const mailPollInterval = 2 * time.Second
+
+// MailPrintSettings 邮件打印设置
+type MailPrintSettings struct {
+	// 接收的收件地址, 为空时接收发往任意地址的邮件
+	Recipients []string
+	// 允许的发件人: 地址或 "@域名" -> 任务的用户, 用户为空时使用地址中 @ 之前的部分
+	Senders map[string]string
+	// 允许连接的客户端地址, 每项为 IP 或 CIDR, 通常为公司邮件服务器的地址, 不能为空
+	Networks []string
+	// 目标打印机或打印池, 为空时使用默认打印后端
+	Printer string
+	// 打印选项
+	Options PrintOptions
+	// 发送回复邮件的中继服务器, Addr 为空时不回复
+	Relay MailRelay
+	// 回复前等待任务结束的最长时间, 0 表示加入队列后立即回复
+	ReplyWait time.Duration
+}
+
+// MailRelay 发送回复邮件的 SMTP 中继服务器
+type MailRelay struct {
+	// 地址 host:port
+	Addr string
+	// 用户名和密码, 为空时不认证. 认证只在 TLS 连接或本机上进行
+	Username string
+	Password string
+	// 回复邮件的发件地址, 默认为第一个收件地址
+	From string
+}
+
+// MailPrinter 打印收到的邮件中的附件. 作为 smtp.Server 的 Client、Recipient 和 Handler 使用:
+// 只接受允许的网段中的客户端, 检查发件人是否在允许列表中, 每个能打印的附件提交一个任务, 并可回复打印结果
+//
+// SMTP 不认证发件人, 邮件头 From 和信封发件人都可以伪造. 因此要求两者一致,
+// 并只接受来自公司邮件服务器等可信地址的连接, 由这些服务器负责验证发件人
+type MailPrinter struct {
+	queue     *JobQueue
+	printers  *PrinterRegistry
+	uploadDir string
+	settings  MailPrintSettings
+	// 小写的收件地址和发件人
+	recipients map[string]bool
+	senders    map[string]string
+	networks   hostRules
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewMailPrinter 创建邮件打印
+func NewMailPrinter(queue *JobQueue, printers *PrinterRegistry, uploadDir string, settings MailPrintSettings) (*MailPrinter, error) {
+	if len(settings.Senders) == 0 {
+		return nil, errors.New("邮件打印需要配置允许的发件人")
+	}
+	networks, err := parseHostRules(settings.Networks)
+	if err != nil {
+		return nil, err
+	}
+	if len(networks.names) > 0 {
+		return nil, fmt.Errorf("允许连接的地址只能是 IP 或网段: %s", networks.names[0])
+	}
+	if networks.empty() {
+		return nil, errors.New("邮件打印需要配置允许连接的网段")
+	}
+	if err := settings.Options.Validate(); err != nil {
+		return nil, err
+	}
+	if settings.Relay.Addr != "" && settings.Relay.From == "" {
+		if len(settings.Recipients) == 0 {
+			return nil, errors.New("回复邮件需要配置发件地址")
+		}
+		settings.Relay.From = settings.Recipients[0]
+	}
+
+	m := &MailPrinter{
+		queue:      queue,
+		printers:   printers,
+		uploadDir:  uploadDir,
+		settings:   settings,
+		recipients: make(map[string]bool),
+		senders:    make(map[string]string),
+		networks:   networks,
+	}
+	for _, addr := range settings.Recipients {
+		m.recipients[strings.ToLower(addr)] = true
+	}
+	for addr, user := range settings.Senders {
+		m.senders[strings.ToLower(addr)] = user
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	return m, nil
+}
+
+// Stop 停止等待中的回复
+func (m *MailPrinter) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Client 检查客户端地址是否在允许的网段中
+func (m *MailPrinter) Client(addr net.Addr) error {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	default:
+		if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+			ip = net.ParseIP(host)
+		}
+	}
+	if ip == nil || !m.networks.matchIP(ip) {
+		log.Printf("拒绝来自 %s 的 SMTP 连接: 不在允许的网段中", addr)
+		return &smtp.Error{Code: 554, Message: "5.7.1 Client host rejected"}
+	}
+	return nil
+}
+
+// Recipient 检查收件地址
+func (m *MailPrinter) Recipient(addr string) error {
+	if len(m.recipients) > 0 && !m.recipients[strings.ToLower(addr)] {
+		return &smtp.Error{Code: 550, Message: "5.1.1 Mailbox unavailable"}
+	}
+	return nil
+}
+
+// senderUser 返回允许的发件人对应的用户, 先按完整地址再按域名查找
+func (m *MailPrinter) senderUser(addr string) (string, bool) {
+	addr = strings.ToLower(addr)
+	at := strings.LastIndexByte(addr, '@')
+	if at <= 0 {
+		return "", false
+	}
+	user, ok := m.senders[addr]
+	if !ok {
+		user, ok = m.senders[addr[at:]]
+	}
+	if !ok {
+		return "", false
+	}
+	if user == "" {
+		user = addr[:at]
+	}
+	return user, true
+}
+
+// mailAttachment 邮件中的附件
+type mailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// mailResult 单个附件的处理结果
+type mailResult struct {
+	Filename string
+	// 提交的任务, 未提交时为空
+	Job string
+	// 未提交的原因
+	Error string
+}
+
+// Receive 处理收到的邮件. 邮件头 From 与信封发件人不一致或发件人不在允许列表中时拒绝
+func (m *MailPrinter) Receive(env *smtp.Envelope) error {
+	msg, err := mail.ReadMessage(bytes.NewReader(env.Data))
+	if err != nil {
+		return &smtp.Error{Code: 554, Message: "5.6.0 Malformed message"}
+	}
+	sender := env.From
+	if from, err := mail.ParseAddress(msg.Header.Get("From")); err == nil && !strings.EqualFold(from.Address, sender) {
+		log.Printf("拒绝来自 %s 的打印邮件: 邮件头 From %s 与信封发件人不一致", sender, from.Address)
+		return &smtp.Error{Code: 550, Message: "5.7.1 From header does not match envelope sender"}
+	}
+	user, ok := m.senderUser(sender)
+	if !ok {
+		log.Printf("拒绝来自 %s 的打印邮件: 发件人不在允许列表中", sender)
+		return &smtp.Error{Code: 550, Message: "5.7.1 Sender not allowed"}
+	}
+
+	var attachments []mailAttachment
+	err = walkMail(msg.Header, msg.Body, 0, func(a mailAttachment) {
+		attachments = append(attachments, a)
+	})
+	if err != nil {
+		log.Printf("解析来自 %s 的邮件失败: %v", sender, err)
+		return &smtp.Error{Code: 554, Message: "5.6.0 Malformed message"}
+	}
+
+	results := m.submit(attachments, user)
+	log.Printf("收到 %s 的打印邮件, %d 个附件", sender, len(attachments))
+	if m.settings.Relay.Addr != "" && shouldReply(env, msg.Header) {
+		m.replyLater(sender, msg.Header, results)
+	}
+	return nil
+}
+
+// submit 将能打印的附件保存到上传目录并提交任务
+func (m *MailPrinter) submit(attachments []mailAttachment, user string) []mailResult {
+	results := make([]mailResult, len(attachments))
+	service, opts, targetErr := m.printers.ResolveTarget(m.settings.Printer, m.settings.Options)
+	for i, a := range attachments {
+		results[i].Filename = a.Filename
+		if targetErr != nil {
+			results[i].Error = targetErr.Error()
+			continue
+		}
+
+		ext := strings.ToLower(filepath.Ext(a.Filename))
+		if ext == "" {
+			// 没有扩展名时按声明的类型, 未声明具体类型时按内容判断
+			ext = DocumentExtension(a.ContentType)
+			if ext == "" {
+				ext = DocumentExtension(SniffDocumentFormat(a.Data))
+			}
+		}
+		if ext == "" || !service.Capabilities().CanPrint(ext) {
+			results[i].Error = "不支持的文件类型"
+			continue
+		}
+		filename, err := SaveDocument(m.uploadDir, a.Filename, ext, bytes.NewReader(a.Data), 0)
+		if err != nil {
+			log.Printf("保存邮件附件失败: %v", err)
+			results[i].Error = "保存文件失败"
+			continue
+		}
+		job, err := m.queue.Submit(Job{
+			Filename: filename,
+			Printer:  m.settings.Printer,
+			User:     user,
+			Options:  opts,
+		})
+		if err != nil {
+			os.Remove(filepath.Join(m.uploadDir, filename))
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Job = job.ID
+	}
+	return results
+}
+
+// mailHeader net/mail.Header 和 textproto.MIMEHeader 共有的方法
+type mailHeader interface {
+	Get(key string) string
+}
+
+// walkMail 遍历邮件的各部分, 对每个带文件名的部分调用 add.
+// 嵌入正文的图片 (inline 且带 Content-ID, 如签名中的图标) 不算附件,
+// 作为附件转发的邮件会展开其中的附件
+func walkMail(h mailHeader, body io.Reader, depth int, add func(mailAttachment)) error {
+	if depth > maxMailDepth {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	body = decodeTransferEncoding(h.Get("Content-Transfer-Encoding"), body)
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkMail(part.Header, part, depth+1, add); err != nil {
+				return err
+			}
+		}
+	case mediaType == "message/rfc822":
+		inner, err := mail.ReadMessage(body)
+		if err != nil {
+			return err
+		}
+		return walkMail(inner.Header, inner.Body, depth+1, add)
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	if disposition == "inline" && h.Get("Content-ID") != "" {
+		return nil
+	}
+	name := dispParams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	name = decodeMailWord(name)
+	if name == "" {
+		return nil
+	}
+	// 文本文件按 UTF-8 打印, 其他字符集先转换
+	if charset := strings.ToLower(params["charset"]); strings.HasPrefix(mediaType, "text/") &&
+		charset != "" && charset != "utf-8" && charset != "us-ascii" {
+		if enc, err := htmlindex.Get(charset); err == nil {
+			body = enc.NewDecoder().Reader(body)
+		}
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	add(mailAttachment{Filename: name, ContentType: mediaType, Data: data})
+	return nil
+}
+
+// decodeTransferEncoding 按 Content-Transfer-Encoding 解码
+func decodeTransferEncoding(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// mailWordDecoder 解码 RFC 2047 编码的文件名, 支持 GBK、Big5 等常见字符集
+var mailWordDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		enc, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, err
+		}
+		return enc.NewDecoder().Reader(input), nil
+	},
+}
+
+// decodeMailWord 解码文件名, 并去掉其中的目录
+func decodeMailWord(name string) string {
+	if decoded, err := mailWordDecoder.DecodeHeader(name); err == nil {
+		name = decoded
+	}
+	name = strings.ReplaceAll(name, "\\", "/")
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSpace(name)
+}
+
+// shouldReply 判断是否回复, 不回复退信和自动发送的邮件, 以免邮件循环 (RFC 3834)
+func shouldReply(env *smtp.Envelope, h mail.Header) bool {
+	if env.From == "" {
+		return false
+	}
+	if auto := strings.ToLower(h.Get("Auto-Submitted")); auto != "" && auto != "no" {
+		return false
+	}
+	switch strings.ToLower(h.Get("Precedence")) {
+	case "bulk", "junk", "list":
+		return false
+	}
+	return true
+}
+
+// replyLater 在后台等待任务结束后回复打印结果, 超过 ReplyWait 时回复当时的状态
+func (m *MailPrinter) replyLater(to string, h mail.Header, results []mailResult) {
+	subject := h.Get("Subject")
+	if decoded, err := mailWordDecoder.DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	messageID := h.Get("Message-ID")
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		deadline := time.Now().Add(m.settings.ReplyWait)
+		for !m.finished(results) && time.Now().Before(deadline) {
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-time.After(mailPollInterval):
+			}
+		}
+		body := m.replyBody(results)
+		if err := m.sendReply(to, "打印结果: "+subject, messageID, body); err != nil {
+			log.Printf("发送打印结果邮件到 %s 失败: %v", to, err)
+		}
+	}()
+}
+
+// finished 判断提交的任务是否都已结束
+func (m *MailPrinter) finished(results []mailResult) bool {
+	for _, r := range results {
+		if r.Job == "" {
+			continue
+		}
+		if job, err := m.queue.Get(r.Job); err == nil && !job.State.Finished() {
+			return false
+		}
+	}
+	return true
+}
+
+// replyBody 生成回复正文, 列出每个附件的结果
+func (m *MailPrinter) replyBody(results []mailResult) string {
+	var b strings.Builder
+	if len(results) == 0 {
+		b.WriteString("邮件中没有附件, 请将要打印的文件作为附件发送。\n")
+		return b.String()
+	}
+	b.WriteString("已收到您的邮件, 附件的打印结果如下:\n\n")
+	for _, r := range results {
+		fmt.Fprintf(&b, "- %s: %s\n", r.Filename, m.resultText(r))
+	}
+	return b.String()
+}
+
+func (m *MailPrinter) resultText(r mailResult) string {
+	if r.Job == "" {
+		return "未打印, " + r.Error
+	}
+	job, err := m.queue.Get(r.Job)
+	if err != nil {
+		return fmt.Sprintf("任务 %s 已不存在", r.Job)
+	}
+	switch job.State {
+	case JobDone:
+		return fmt.Sprintf("已打印 (任务 %s)", job.ID)
+	case JobFailed:
+		return fmt.Sprintf("打印失败 (任务 %s): %s", job.ID, job.Error)
+	case JobCanceled:
+		return fmt.Sprintf("已取消 (任务 %s)", job.ID)
+	case JobHeld, JobScheduled:
+		return fmt.Sprintf("等待打印 (任务 %s)", job.ID)
+	default:
+		return fmt.Sprintf("正在排队 (任务 %s)", job.ID)
+	}
+}
+
+// sendReply 通过中继服务器发送纯文本回复
+func (m *MailPrinter) sendReply(to, subject, inReplyTo, body string) error {
+	relay := m.settings.Relay
+	host, _, err := net.SplitHostPort(relay.Addr)
+	if err != nil {
+		return fmt.Errorf("中继服务器地址无效: %v", err)
+	}
+	var auth netsmtp.Auth
+	if relay.Username != "" {
+		auth = netsmtp.PlainAuth("", relay.Username, relay.Password, host)
+	}
+
+	var msg bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", key, value)
+	}
+	header("From", relay.From)
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	if inReplyTo != "" {
+		header("In-Reply-To", inReplyTo)
+		header("References", inReplyTo)
+	}
+	header("Auto-Submitted", "auto-replied")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	msg.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	qp.Write([]byte(body))
+	qp.Close()
+
+	return netsmtp.SendMail(relay.Addr, auth, relay.From, []string{to}, msg.Bytes())
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"net"
+	netsmtp "net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"printer/services/smtp"
+)
+
+// startMailPrinter 启动使用 FakeBackend 的队列和邮件打印的 SMTP 服务器, 返回地址和队列
+func startMailPrinter(t *testing.T, settings MailPrintSettings) (string, *JobQueue, string) {
+	t.Helper()
+	q, dir := newTestQueue(t, NewFakeBackend())
+	printer, err := NewMailPrinter(q, q.printers, dir, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(printer.Stop)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	server := &smtp.Server{
+		Client:    printer.Client,
+		Recipient: printer.Recipient,
+		Handler:   printer.Receive,
+	}
+	go server.Serve(l)
+	return l.Addr().String(), q, dir
+}
+
+// testMail 生成带一个 PDF 附件的邮件
+func testMail(from, filename string) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: print@office.test\r\n")
+	b.WriteString("Subject: print\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: multipart/mixed; boundary=BOUNDARY\r\n\r\n")
+	b.WriteString("--BOUNDARY\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n请打印附件\r\n")
+	b.WriteString("--BOUNDARY\r\nContent-Type: application/pdf\r\n")
+	b.WriteString("Content-Disposition: attachment; filename=\"" + filename + "\"\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	b.WriteString(base64.StdEncoding.EncodeToString([]byte("%PDF-1.4\n% mail attachment\n")) + "\r\n")
+	b.WriteString("--BOUNDARY--\r\n")
+	return []byte(b.String())
+}
+
+func mailCode(err error) int {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code
+	}
+	return 0
+}
+
+func TestMailPrinterReceive(t *testing.T) {
+	addr, q, dir := startMailPrinter(t, MailPrintSettings{
+		Recipients: []string{"print@office.test"},
+		Senders:    map[string]string{"boss@office.test": "zhangsan", "@office.test": ""},
+		Networks:   []string{"127.0.0.0/8"},
+	})
+
+	send := func(envFrom, headerFrom string) error {
+		return netsmtp.SendMail(addr, nil, envFrom, []string{"print@office.test"}, testMail(headerFrom, "report.pdf"))
+	}
+	if err := send("boss@office.test", "Boss <boss@office.test>"); err != nil {
+		t.Fatal(err)
+	}
+	if err := send("lisi@office.test", "lisi@office.test"); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := q.List()
+	if len(jobs) != 2 {
+		t.Fatalf("jobs = %+v", jobs)
+	}
+	users := map[string]bool{}
+	for _, job := range jobs {
+		users[job.User] = true
+		if !strings.HasSuffix(job.Filename, ".pdf") {
+			t.Errorf("filename = %s", job.Filename)
+		}
+		if _, err := os.Stat(filepath.Join(dir, job.Filename)); err != nil {
+			t.Error(err)
+		}
+	}
+	if !users["zhangsan"] || !users["lisi"] {
+		t.Errorf("users = %v", users)
+	}
+}
+
+func TestMailPrinterRejects(t *testing.T) {
+	addr, q, _ := startMailPrinter(t, MailPrintSettings{
+		Recipients: []string{"print@office.test"},
+		Senders:    map[string]string{"boss@office.test": "zhangsan"},
+		Networks:   []string{"127.0.0.1"},
+	})
+
+	tests := []struct {
+		name       string
+		envFrom    string
+		headerFrom string
+		to         string
+		code       int
+	}{
+		{"unknown sender", "stranger@example.test", "stranger@example.test", "print@office.test", 550},
+		// 信封发件人不在列表中, 伪造邮件头 From 冒充允许的发件人
+		{"spoofed header", "stranger@example.test", "boss@office.test", "print@office.test", 550},
+		// 信封发件人冒充允许的发件人, 邮件头 From 不一致
+		{"spoofed envelope", "boss@office.test", "stranger@example.test", "print@office.test", 550},
+		{"bounce", "", "boss@office.test", "print@office.test", 550},
+		{"unknown recipient", "boss@office.test", "boss@office.test", "other@office.test", 550},
+	}
+	for _, tt := range tests {
+		err := netsmtp.SendMail(addr, nil, tt.envFrom, []string{tt.to}, testMail(tt.headerFrom, "a.pdf"))
+		if code := mailCode(err); code != tt.code {
+			t.Errorf("%s: err = %v, want code %d", tt.name, err, tt.code)
+		}
+	}
+	if jobs := q.List(); len(jobs) != 0 {
+		t.Errorf("jobs = %+v", jobs)
+	}
+}
+
+func TestMailPrinterClientNetworks(t *testing.T) {
+	addr, _, _ := startMailPrinter(t, MailPrintSettings{
+		Senders:  map[string]string{"boss@office.test": ""},
+		Networks: []string{"10.0.0.25"},
+	})
+
+	if _, err := netsmtp.Dial(addr); mailCode(err) != 554 {
+		t.Fatalf("err = %v, want 554", err)
+	}
+}
+
+func TestNewMailPrinterRequiresNetworks(t *testing.T) {
+	q, dir := newTestQueue(t, NewFakeBackend())
+	senders := map[string]string{"boss@office.test": ""}
+	for _, networks := range [][]string{nil, {"mail.office.test"}, {"10.0.0.0/33"}} {
+		_, err := NewMailPrinter(q, q.printers, dir, MailPrintSettings{Senders: senders, Networks: networks})
+		if err == nil {
+			t.Errorf("networks %v: 应返回错误", networks)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package mdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultAddr mDNS 组播地址
+const DefaultAddr = "224.0.0.251:5353"
+
+// followUpInterval 追加查询的检查间隔
+const followUpInterval = 100 * time.Millisecond
+
+// Instance 发现的服务实例
+type Instance struct {
+	// 实例全名, 如 "Office Printer._ipp._tcp.local."
+	Name string `json:"name"`
+	// 服务类型, 如 "_ipp._tcp"
+	Service string `json:"service"`
+	// 主机名
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// 主机地址
+	Addrs []net.IP `json:"addrs"`
+	// TXT 记录中的键值对, 键保留原始大小写
+	Text map[string]string `json:"text"`
+}
+
+// InstanceName 返回实例名中服务类型之前的部分, 如 "Office Printer"
+func (i Instance) InstanceName() string {
+	labels := splitLabels(strings.TrimSuffix(i.Name, "."))
+	if len(labels) == 0 {
+		return ""
+	}
+	return labels[0]
+}
+
+// TXT 按不区分大小写的键查找 TXT 记录值 (RFC 6763 6.4)
+func (i Instance) TXT(key string) string {
+	for k, v := range i.Text {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// Browser 通过 mDNS 浏览 DNS-SD 服务
+//
+// 查询从临时端口发出, 按 RFC 6762 6.7 应答方会单播回复到该端口,
+// 因此无需加入组播组. Addr 可以改为普通单播地址以便与进程内的 Responder 通信
+type Browser struct {
+	// 查询发往的地址, 默认 DefaultAddr
+	Addr string
+	// 域名, 默认 "local."
+	Domain string
+}
+
+// Browse 查询 services 中的每种服务类型 (如 "_ipp._tcp"), 在 ctx 结束前收集应答.
+// 缺少 SRV/TXT/地址记录的实例会追加查询一次
+func (b *Browser) Browse(ctx context.Context, services []string) ([]Instance, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return nil, errors.New("mdns: 浏览需要设置超时")
+	}
+	addr := b.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	domain := b.Domain
+	if domain == "" {
+		domain = "local."
+	}
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("mdns: 地址无效: %v", err)
+	}
+	network := "udp4"
+	if raddr.IP.To4() == nil {
+		network = "udp6"
+	}
+	conn, err := net.ListenUDP(network, nil)
+	if err != nil {
+		return nil, fmt.Errorf("mdns: 打开套接字失败: %v", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	c := newCollector()
+	query := func(qs []Question) error {
+		if len(qs) == 0 {
+			return nil
+		}
+		data, err := (&Message{Questions: qs}).Pack()
+		if err != nil {
+			return err
+		}
+		_, err = conn.WriteToUDP(data, raddr)
+		return err
+	}
+
+	var questions []Question
+	for _, service := range services {
+		name := strings.TrimSuffix(service, ".") + "." + domain
+		c.services[strings.ToLower(name)] = strings.TrimSuffix(service, ".")
+		questions = append(questions, Question{Name: name, Type: TypePTR})
+	}
+	if err := query(questions); err != nil {
+		return nil, fmt.Errorf("mdns: 发送查询失败: %v", err)
+	}
+
+	// 每隔一段时间检查缺少记录的实例并追加查询, 每个查询只发送一次
+	deadline, _ := ctx.Deadline()
+	asked := make(map[Question]bool)
+	buf := make([]byte, 9000)
+	for {
+		conn.SetReadDeadline(minTime(deadline, time.Now().Add(followUpInterval)))
+		// ctx 取消时 AfterFunc 会把读超时设为当前时间, 这里再检查一次避免被上面覆盖
+		if ctx.Err() != nil {
+			break
+		}
+		n, _, err := conn.ReadFromUDP(buf)
+		if err == nil {
+			if msg, err := Unpack(buf[:n]); err == nil && msg.Response {
+				c.add(msg.Records())
+			}
+			continue
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			return nil, fmt.Errorf("mdns: 接收应答失败: %v", err)
+		}
+		if ctx.Err() != nil || !time.Now().Before(deadline) {
+			break
+		}
+		var missing []Question
+		for _, q := range c.missing() {
+			if !asked[q] {
+				asked[q] = true
+				missing = append(missing, q)
+			}
+		}
+		if err := query(missing); err != nil {
+			return nil, fmt.Errorf("mdns: 发送查询失败: %v", err)
+		}
+	}
+	return c.result(), nil
+}
+
+// collector 汇总多个应答中的记录
+type collector struct {
+	// 小写服务全名 -> 服务类型
+	services  map[string]string
+	instances map[string]*Instance
+	hosts     map[string][]net.IP
+	// 实例是否已收到 SRV/TXT
+	srv map[string]bool
+	txt map[string]bool
+}
+
+func newCollector() *collector {
+	return &collector{
+		services:  make(map[string]string),
+		instances: make(map[string]*Instance),
+		hosts:     make(map[string][]net.IP),
+		srv:       make(map[string]bool),
+		txt:       make(map[string]bool),
+	}
+}
+
+func (c *collector) add(records []Record) {
+	// 先处理 PTR, 同一应答中的 SRV/TXT 才能找到对应实例
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Type == TypePTR && records[j].Type != TypePTR
+	})
+	for _, rr := range records {
+		key := strings.ToLower(rr.Name)
+		switch rr.Type {
+		case TypePTR:
+			service, ok := c.services[key]
+			if !ok || rr.TTL == 0 {
+				continue
+			}
+			id := strings.ToLower(rr.Target)
+			if _, ok := c.instances[id]; !ok {
+				c.instances[id] = &Instance{Name: rr.Target, Service: service, Text: map[string]string{}}
+			}
+		case TypeSRV:
+			if inst, ok := c.instances[key]; ok {
+				inst.Host = rr.Target
+				inst.Port = int(rr.Port)
+				c.srv[key] = true
+			}
+		case TypeTXT:
+			if inst, ok := c.instances[key]; ok {
+				for _, s := range rr.Text {
+					k, v, _ := strings.Cut(s, "=")
+					if k != "" {
+						inst.Text[k] = v
+					}
+				}
+				c.txt[key] = true
+			}
+		case TypeA, TypeAAAA:
+			if !containsIP(c.hosts[key], rr.IP) {
+				c.hosts[key] = append(c.hosts[key], rr.IP)
+			}
+		}
+	}
+}
+
+// missing 返回仍缺少记录的查询
+func (c *collector) missing() []Question {
+	var qs []Question
+	for key, inst := range c.instances {
+		if !c.srv[key] {
+			qs = append(qs, Question{Name: inst.Name, Type: TypeSRV})
+		}
+		if !c.txt[key] {
+			qs = append(qs, Question{Name: inst.Name, Type: TypeTXT})
+		}
+		if inst.Host != "" && len(c.hosts[strings.ToLower(inst.Host)]) == 0 {
+			qs = append(qs, Question{Name: inst.Host, Type: TypeA})
+		}
+	}
+	sort.Slice(qs, func(i, j int) bool { return qs[i].Name < qs[j].Name })
+	return qs
+}
+
+// result 返回已解析出主机和端口的实例, 按名称排序
+func (c *collector) result() []Instance {
+	var list []Instance
+	for key, inst := range c.instances {
+		if !c.srv[key] {
+			continue
+		}
+		inst.Addrs = c.hosts[strings.ToLower(inst.Host)]
+		list = append(list, *inst)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].Service < list[j].Service
+	})
+	return list
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, item := range ips {
+		if item.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,155 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testInstances 模拟网络上的两台打印机
+var testInstances = []Instance{
+	{
+		Name:    "Office Printer._ipp._tcp.local.",
+		Service: "_ipp._tcp",
+		Host:    "office.local.",
+		Port:    631,
+		Addrs:   []net.IP{net.IPv4(192, 0, 2, 10).To4()},
+		Text:    map[string]string{"rp": "ipp/print", "ty": "HP LaserJet", "pdl": "application/pdf", "Color": "T"},
+	},
+	{
+		Name:    "Lobby._pdl-datastream._tcp.local.",
+		Service: "_pdl-datastream._tcp",
+		Host:    "lobby.local.",
+		Port:    9100,
+		Addrs:   []net.IP{net.IPv4(192, 0, 2, 11).To4()},
+		Text:    map[string]string{"note": "1F"},
+	},
+}
+
+// startResponder 在本机随机端口上运行 r, 返回地址
+func startResponder(t *testing.T, r *Responder) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go r.Serve(conn)
+	return conn.LocalAddr().String()
+}
+
+func browse(t *testing.T, addr string) []Instance {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	instances, err := (&Browser{Addr: addr}).Browse(ctx, []string{"_ipp._tcp", "_ipps._tcp", "_pdl-datastream._tcp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return instances
+}
+
+func TestBrowse(t *testing.T) {
+	addr := startResponder(t, &Responder{Instances: testInstances})
+	instances := browse(t, addr)
+	if len(instances) != 2 {
+		t.Fatalf("instances = %+v", instances)
+	}
+	// 按名称排序
+	for i, want := range []Instance{testInstances[1], testInstances[0]} {
+		got := instances[i]
+		if got.Name != want.Name || got.Service != want.Service || got.Host != want.Host || got.Port != want.Port {
+			t.Errorf("instance %d = %+v", i, got)
+		}
+		if len(got.Addrs) != 1 || !got.Addrs[0].Equal(want.Addrs[0]) {
+			t.Errorf("%s: addrs = %v", got.Name, got.Addrs)
+		}
+		if !reflect.DeepEqual(got.Text, want.Text) {
+			t.Errorf("%s: text = %v", got.Name, got.Text)
+		}
+	}
+	if name := instances[1].InstanceName(); name != "Office Printer" {
+		t.Errorf("instance name = %q", name)
+	}
+	if color := instances[1].TXT("color"); color != "T" {
+		t.Errorf("TXT(color) = %q", color)
+	}
+}
+
+// TestBrowseFollowUp 应答方只回复 PTR 时, 浏览方追加查询 SRV、TXT 和地址
+func TestBrowseFollowUp(t *testing.T) {
+	r := &Responder{Instances: testInstances[:1]}
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 9000)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query, err := Unpack(buf[:n])
+			if err != nil {
+				continue
+			}
+			resp := r.answer(query)
+			if resp == nil {
+				continue
+			}
+			resp.Additional = nil
+			data, _ := resp.Pack()
+			conn.WriteTo(data, addr)
+		}
+	}()
+
+	instances := browse(t, conn.LocalAddr().String())
+	if len(instances) != 1 {
+		t.Fatalf("instances = %+v", instances)
+	}
+	inst := instances[0]
+	if inst.Port != 631 || len(inst.Addrs) != 1 || inst.TXT("rp") != "ipp/print" {
+		t.Errorf("instance = %+v", inst)
+	}
+}
+
+func TestBrowseRequiresDeadline(t *testing.T) {
+	if _, err := (&Browser{}).Browse(context.Background(), []string{"_ipp._tcp"}); err == nil {
+		t.Fatal("没有超时时应返回错误")
+	}
+}
+
+func TestPackUnpack(t *testing.T) {
+	msg := &Message{
+		ID:        7,
+		Response:  true,
+		Questions: []Question{{Name: "_ipp._tcp.local.", Type: TypePTR}},
+		Answers: []Record{
+			{Name: "_ipp._tcp.local.", Type: TypePTR, TTL: 4500, Target: "A\\.B._ipp._tcp.local."},
+		},
+		Additional: []Record{
+			{Name: "A\\.B._ipp._tcp.local.", Type: TypeSRV, TTL: 120, Target: "host.local.", Port: 631},
+			{Name: "A\\.B._ipp._tcp.local.", Type: TypeTXT, TTL: 4500, Text: []string{"rp=ipp/print", "Color=T"}},
+			{Name: "host.local.", Type: TypeA, TTL: 120, IP: net.IPv4(192, 0, 2, 1).To4()},
+			{Name: "host.local.", Type: TypeAAAA, TTL: 120, IP: net.ParseIP("2001:db8::1")},
+		},
+	}
+	data, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Unpack(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Errorf("Unpack(Pack(msg)) = %+v\nwant %+v", got, msg)
+	}
+	if _, err := Unpack(data[:len(data)-3]); err == nil {
+		t.Error("截断的报文应返回错误")
+	}
+}
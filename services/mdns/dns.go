@@ -0,0 +1,310 @@
+// Package mdns 实现发现打印机所需的最小 mDNS/DNS-SD (RFC 6762/6763) 功能
+package mdns
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+)
+
+// 资源记录类型
+const (
+	TypeA    uint16 = 1
+	TypePTR  uint16 = 12
+	TypeTXT  uint16 = 16
+	TypeAAAA uint16 = 28
+	TypeSRV  uint16 = 33
+	TypeANY  uint16 = 255
+)
+
+const (
+	classIN = 1
+	// 查询中表示希望单播应答, 记录中表示 cache-flush
+	classTopBit = 0x8000
+)
+
+var errMalformed = errors.New("mdns: 报文格式错误")
+
+// Question 查询
+type Question struct {
+	Name string
+	Type uint16
+}
+
+// Record 资源记录, 按 Type 使用对应字段
+type Record struct {
+	Name string
+	Type uint16
+	TTL  uint32
+
+	// PTR 的目标或 SRV 的主机名
+	Target string
+	// SRV
+	Port uint16
+	// TXT
+	Text []string
+	// A/AAAA
+	IP net.IP
+}
+
+// Message DNS 报文
+type Message struct {
+	ID         uint16
+	Response   bool
+	Questions  []Question
+	Answers    []Record
+	Additional []Record
+}
+
+// Records 返回应答和附加记录
+func (m *Message) Records() []Record {
+	return append(append([]Record(nil), m.Answers...), m.Additional...)
+}
+
+// Pack 编码报文, 不使用名称压缩
+func (m *Message) Pack() ([]byte, error) {
+	buf := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(buf[0:], m.ID)
+	if m.Response {
+		binary.BigEndian.PutUint16(buf[2:], 0x8400) // QR + AA
+	}
+	binary.BigEndian.PutUint16(buf[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(buf[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(buf[10:], uint16(len(m.Additional)))
+
+	var err error
+	for _, q := range m.Questions {
+		if buf, err = appendName(buf, q.Name); err != nil {
+			return nil, err
+		}
+		buf = binary.BigEndian.AppendUint16(buf, q.Type)
+		buf = binary.BigEndian.AppendUint16(buf, classIN|classTopBit)
+	}
+	for _, rr := range append(append([]Record(nil), m.Answers...), m.Additional...) {
+		if buf, err = appendRecord(buf, rr); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func appendName(buf []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name != "" {
+		for _, label := range splitLabels(name) {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, errMalformed
+			}
+			buf = append(buf, byte(len(label)))
+			buf = append(buf, label...)
+		}
+	}
+	return append(buf, 0), nil
+}
+
+// splitLabels 按点分割名称, 支持实例名中以 "\." 转义的点
+func splitLabels(name string) []string {
+	var labels []string
+	var label strings.Builder
+	for i := 0; i < len(name); i++ {
+		switch {
+		case name[i] == '\\' && i+1 < len(name):
+			i++
+			label.WriteByte(name[i])
+		case name[i] == '.':
+			labels = append(labels, label.String())
+			label.Reset()
+		default:
+			label.WriteByte(name[i])
+		}
+	}
+	return append(labels, label.String())
+}
+
+func appendRecord(buf []byte, rr Record) ([]byte, error) {
+	var err error
+	if buf, err = appendName(buf, rr.Name); err != nil {
+		return nil, err
+	}
+	buf = binary.BigEndian.AppendUint16(buf, rr.Type)
+	buf = binary.BigEndian.AppendUint16(buf, classIN)
+	buf = binary.BigEndian.AppendUint32(buf, rr.TTL)
+
+	var rdata []byte
+	switch rr.Type {
+	case TypePTR:
+		if rdata, err = appendName(nil, rr.Target); err != nil {
+			return nil, err
+		}
+	case TypeSRV:
+		rdata = make([]byte, 6)
+		binary.BigEndian.PutUint16(rdata[4:], rr.Port)
+		if rdata, err = appendName(rdata, rr.Target); err != nil {
+			return nil, err
+		}
+	case TypeTXT:
+		for _, s := range rr.Text {
+			if len(s) > 255 {
+				return nil, errMalformed
+			}
+			rdata = append(rdata, byte(len(s)))
+			rdata = append(rdata, s...)
+		}
+		if len(rdata) == 0 {
+			rdata = []byte{0}
+		}
+	case TypeA:
+		rdata = rr.IP.To4()
+	case TypeAAAA:
+		rdata = rr.IP.To16()
+	}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(rdata)))
+	return append(buf, rdata...), nil
+}
+
+// Unpack 解析报文, 不认识的记录类型会被跳过
+func Unpack(data []byte) (*Message, error) {
+	if len(data) < 12 {
+		return nil, errMalformed
+	}
+	m := &Message{
+		ID:       binary.BigEndian.Uint16(data[0:]),
+		Response: data[2]&0x80 != 0,
+	}
+	qd := int(binary.BigEndian.Uint16(data[4:]))
+	an := int(binary.BigEndian.Uint16(data[6:]))
+	ns := int(binary.BigEndian.Uint16(data[8:]))
+	ar := int(binary.BigEndian.Uint16(data[10:]))
+
+	off := 12
+	for i := 0; i < qd; i++ {
+		name, n, err := readName(data, off)
+		if err != nil {
+			return nil, err
+		}
+		off = n
+		if off+4 > len(data) {
+			return nil, errMalformed
+		}
+		m.Questions = append(m.Questions, Question{Name: name, Type: binary.BigEndian.Uint16(data[off:])})
+		off += 4
+	}
+
+	for i := 0; i < an+ns+ar; i++ {
+		rr, n, err := readRecord(data, off)
+		if err != nil {
+			return nil, err
+		}
+		off = n
+		if rr == nil {
+			continue
+		}
+		switch {
+		case i < an:
+			m.Answers = append(m.Answers, *rr)
+		case i >= an+ns:
+			m.Additional = append(m.Additional, *rr)
+		}
+	}
+	return m, nil
+}
+
+func readRecord(data []byte, off int) (*Record, int, error) {
+	name, off, err := readName(data, off)
+	if err != nil {
+		return nil, 0, err
+	}
+	if off+10 > len(data) {
+		return nil, 0, errMalformed
+	}
+	rr := &Record{
+		Name: name,
+		Type: binary.BigEndian.Uint16(data[off:]),
+		TTL:  binary.BigEndian.Uint32(data[off+4:]),
+	}
+	length := int(binary.BigEndian.Uint16(data[off+8:]))
+	off += 10
+	end := off + length
+	if end > len(data) {
+		return nil, 0, errMalformed
+	}
+	rdata := data[off:end]
+
+	switch rr.Type {
+	case TypePTR:
+		if rr.Target, _, err = readName(data, off); err != nil {
+			return nil, 0, err
+		}
+	case TypeSRV:
+		if length < 7 {
+			return nil, 0, errMalformed
+		}
+		rr.Port = binary.BigEndian.Uint16(rdata[4:])
+		if rr.Target, _, err = readName(data, off+6); err != nil {
+			return nil, 0, err
+		}
+	case TypeTXT:
+		for i := 0; i < len(rdata); {
+			n := int(rdata[i])
+			if i+1+n > len(rdata) {
+				return nil, 0, errMalformed
+			}
+			if n > 0 {
+				rr.Text = append(rr.Text, string(rdata[i+1:i+1+n]))
+			}
+			i += 1 + n
+		}
+	case TypeA:
+		if length != 4 {
+			return nil, 0, errMalformed
+		}
+		rr.IP = net.IP(append([]byte(nil), rdata...))
+	case TypeAAAA:
+		if length != 16 {
+			return nil, 0, errMalformed
+		}
+		rr.IP = net.IP(append([]byte(nil), rdata...))
+	default:
+		return nil, end, nil
+	}
+	return rr, end, nil
+}
+
+// readName 读取可能被压缩的名称, 返回名称和名称之后的偏移.
+// 标签中的点会被转义为 "\.", 以便与分隔符区分
+func readName(data []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(data) {
+			return "", 0, errMalformed
+		}
+		n := int(data[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, ".") + ".", end, nil
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(data) {
+				return "", 0, errMalformed
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			if jumps++; jumps > 32 {
+				return "", 0, errMalformed
+			}
+			off = int(binary.BigEndian.Uint16(data[off:]) & 0x3fff)
+		default:
+			if off+1+n > len(data) {
+				return "", 0, errMalformed
+			}
+			label := string(data[off+1 : off+1+n])
+			labels = append(labels, strings.ReplaceAll(label, ".", "\\."))
+			off += 1 + n
+		}
+	}
+}
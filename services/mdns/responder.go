@@ -0,0 +1,132 @@
+package mdns
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+)
+
+// mdnsPort mDNS 的标准端口, 从其他端口发出的是传统单播查询
+const mdnsPort = 5353
+
+// 应答记录的 TTL, 单位秒
+const (
+	hostTTL    = 120
+	serviceTTL = 4500
+)
+
+// Responder 应答 DNS-SD 查询的最小实现, 默认单播回复到查询来源
+//
+// 用于在进程内模拟网络上的打印机, 也可在 conn 上应答传统单播查询.
+// 设置 Group 后可在加入组播组的 conn 上公布本机服务
+type Responder struct {
+	// 要公布的实例, Name 为实例全名, Service 为服务类型
+	Instances []Instance
+	// 域名, 默认 "local."
+	Domain string
+	// 组播地址, 不为空时来自 mDNS 端口的查询按 RFC 6762 6 组播应答
+	Group net.Addr
+}
+
+// Serve 在 conn 上应答查询, 直到 conn 被关闭
+func (r *Responder) Serve(conn net.PacketConn) error {
+	buf := make([]byte, 9000)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		msg, err := Unpack(buf[:n])
+		if err != nil || msg.Response {
+			continue
+		}
+		resp := r.answer(msg)
+		if resp == nil {
+			continue
+		}
+		data, err := resp.Pack()
+		if err != nil {
+			continue
+		}
+		if udp, ok := addr.(*net.UDPAddr); ok && r.Group != nil && udp.Port == mdnsPort {
+			conn.WriteTo(data, r.Group)
+			continue
+		}
+		conn.WriteTo(data, addr)
+	}
+}
+
+func (r *Responder) domain() string {
+	if r.Domain == "" {
+		return "local."
+	}
+	return r.Domain
+}
+
+// answer 生成应答, 没有匹配的记录时返回 nil
+func (r *Responder) answer(query *Message) *Message {
+	resp := &Message{ID: query.ID, Response: true, Questions: query.Questions}
+	for _, q := range query.Questions {
+		for _, inst := range r.Instances {
+			serviceName := inst.Service + "." + r.domain()
+			switch {
+			case strings.EqualFold(q.Name, serviceName) && matchType(q.Type, TypePTR):
+				resp.Answers = append(resp.Answers, Record{Name: serviceName, Type: TypePTR, TTL: serviceTTL, Target: inst.Name})
+				resp.Additional = append(resp.Additional, r.serviceRecords(inst)...)
+				resp.Additional = append(resp.Additional, r.hostRecords(inst, TypeANY)...)
+			case strings.EqualFold(q.Name, inst.Name):
+				for _, rr := range r.serviceRecords(inst) {
+					if matchType(q.Type, rr.Type) {
+						resp.Answers = append(resp.Answers, rr)
+					}
+				}
+			case strings.EqualFold(q.Name, inst.Host):
+				resp.Answers = append(resp.Answers, r.hostRecords(inst, q.Type)...)
+			}
+		}
+	}
+	if len(resp.Answers) == 0 {
+		return nil
+	}
+	return resp
+}
+
+// serviceRecords 返回实例的 SRV 和 TXT 记录
+func (r *Responder) serviceRecords(inst Instance) []Record {
+	keys := make([]string, 0, len(inst.Text))
+	for k := range inst.Text {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	text := make([]string, 0, len(keys))
+	for _, k := range keys {
+		text = append(text, k+"="+inst.Text[k])
+	}
+	return []Record{
+		{Name: inst.Name, Type: TypeSRV, TTL: hostTTL, Target: inst.Host, Port: uint16(inst.Port)},
+		{Name: inst.Name, Type: TypeTXT, TTL: serviceTTL, Text: text},
+	}
+}
+
+// hostRecords 返回主机的 A/AAAA 记录
+func (r *Responder) hostRecords(inst Instance, qtype uint16) []Record {
+	var records []Record
+	for _, ip := range inst.Addrs {
+		rtype := TypeAAAA
+		if ip.To4() != nil {
+			rtype = TypeA
+		}
+		if matchType(qtype, rtype) {
+			records = append(records, Record{Name: inst.Host, Type: rtype, TTL: hostTTL, IP: ip})
+		}
+	}
+	return records
+}
+
+func matchType(qtype, rtype uint16) bool {
+	return qtype == TypeANY || qtype == rtype
+}
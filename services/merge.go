@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"printer/services/pdf"
+)
+
+// BatchFile 批量打印中的一个文件
+type BatchFile struct {
+	Filename string `json:"filename"`
+	// 页码范围, 为空表示全部页面
+	PageRanges string `json:"page_ranges,omitempty"`
+}
+
+// CheckBatchFile 检查批量打印中的文件能否合并: 文件名不能包含路径,
+// 页码范围必须合法, 非 PDF 文件需要有转换器
+func CheckBatchFile(f BatchFile) error {
+	if f.Filename == "" || filepath.Base(f.Filename) != f.Filename {
+		return fmt.Errorf("文件名无效: %s", f.Filename)
+	}
+	if _, err := ParsePageRanges(f.PageRanges); err != nil {
+		return fmt.Errorf("%s: %v", f.Filename, err)
+	}
+	ext := strings.ToLower(filepath.Ext(f.Filename))
+	if ext != ".pdf" && converterFor(ext) == nil {
+		return fmt.Errorf("不支持的文件类型: %s", f.Filename)
+	}
+	return nil
+}
+
+// MergeFiles 将 dir 中的 files 按顺序合并为一个 PDF, 每个文件先应用自己的页码范围,
+// 非 PDF 文件按 opts 的纸张和方向转换. 返回临时文件路径和清理函数
+func MergeFiles(ctx context.Context, dir string, files []BatchFile, opts PrintOptions) (string, func(), error) {
+	if len(files) == 0 {
+		return "", nil, fmt.Errorf("没有要合并的文件")
+	}
+	convertOpts := PrintOptions{Media: opts.Media, Orientation: opts.Orientation, Scaling: opts.Scaling}
+
+	type part struct {
+		r     *pdf.Reader
+		pages []pdf.Page
+	}
+	var parts []part
+	var cleanups []func()
+	cleanupAll := func() {
+		for _, fn := range cleanups {
+			fn()
+		}
+	}
+	for _, f := range files {
+		if err := CheckBatchFile(f); err != nil {
+			cleanupAll()
+			return "", nil, err
+		}
+		path := filepath.Join(dir, f.Filename)
+		if !strings.EqualFold(filepath.Ext(path), ".pdf") {
+			converted, cleanup, err := ConvertToPDF(ctx, path, convertOpts)
+			if err != nil {
+				cleanupAll()
+				return "", nil, fmt.Errorf("%s: %v", f.Filename, err)
+			}
+			cleanups = append(cleanups, cleanup)
+			path = converted
+		}
+		r, pages, err := readPages(path, PrintOptions{PageRanges: f.PageRanges})
+		if err != nil {
+			cleanupAll()
+			return "", nil, fmt.Errorf("%s: %v", f.Filename, err)
+		}
+		parts = append(parts, part{r: r, pages: pages})
+	}
+	// 转换结果已读入内存
+	cleanupAll()
+
+	out, cleanup, err := tempPDF("printer-merge-*.pdf")
+	if err != nil {
+		return "", nil, err
+	}
+	title := strings.TrimSuffix(files[0].Filename, filepath.Ext(files[0].Filename))
+	err = writePDF(out, title, func(w *pdf.Writer) ([]pdfPage, error) {
+		var pages []pdfPage
+		for _, p := range parts {
+			// 每个文件的对象编号各自独立, 分别复制
+			im := pdf.NewImporter(p.r, w)
+			for _, page := range p.pages {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				copied, err := copyPage(im, page)
+				if err != nil {
+					return nil, err
+				}
+				pages = append(pages, copied)
+			}
+		}
+		return pages, nil
+	})
+	if err != nil {
+		cleanup()
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		return "", nil, fmt.Errorf("合并文件失败: %v", err)
+	}
+	return out, cleanup, nil
+}
+
+// copyPage 将页面原样复制为新页面, 尺寸为原页面旋转后的显示尺寸.
+// 原页面以表单 /P0 绘制, 调用方可在内容后追加绘制
+func copyPage(im *pdf.Importer, page pdf.Page) (pdfPage, error) {
+	form, err := im.PageForm(page)
+	if err != nil {
+		return pdfPage{}, err
+	}
+	pw, ph := page.DisplaySize()
+	content := fmt.Sprintf("q %s cm /P0 Do Q\n", pdf.FormatMatrix(pdf.PlaceMatrix(page.Box(), page.Rotate(), 0, 0, 1)))
+	return pdfPage{
+		width:     pw,
+		height:    ph,
+		resources: pdf.Dict{"XObject": pdf.Dict{"P0": form}},
+		content:   []byte(content),
+	}, nil
+}
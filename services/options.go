@@ -0,0 +1,335 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 双面打印方式
+const (
+	DuplexOneSided  = "one-sided"
+	DuplexLongEdge  = "long-edge"
+	DuplexShortEdge = "short-edge"
+)
+
+// 打印方向
+const (
+	OrientationPortrait  = "portrait"
+	OrientationLandscape = "landscape"
+)
+
+// 颜色模式
+const (
+	ColorColor      = "color"
+	ColorMonochrome = "monochrome"
+)
+
+// 图片缩放方式, 与 IPP print-scaling 一致
+const (
+	// 图片记录了分辨率且原尺寸能放下时按原尺寸, 否则同 fit
+	ScalingAuto = "auto"
+	// 等比缩放到可打印区域内
+	ScalingFit = "fit"
+	// 等比缩放到铺满可打印区域, 超出部分裁掉
+	ScalingFill = "fill"
+	// 按原尺寸打印, 超出部分裁掉
+	ScalingNone = "none"
+)
+
+// DefaultMedia 未指定纸张时使用的纸张
+const DefaultMedia = "a4"
+
+// MediaSize 纸张尺寸, 单位为点 (1/72 英寸)
+type MediaSize struct {
+	Width  float64
+	Height float64
+	// IPP/PWG 中的纸张名称
+	IPP string
+}
+
+// MediaSizes 支持的纸张尺寸
+var MediaSizes = map[string]MediaSize{
+	"a3":     {Width: 841.89, Height: 1190.55, IPP: "iso_a3_297x420mm"},
+	"a4":     {Width: 595.28, Height: 841.89, IPP: "iso_a4_210x297mm"},
+	"a5":     {Width: 419.53, Height: 595.28, IPP: "iso_a5_148x210mm"},
+	"b5":     {Width: 515.91, Height: 728.5, IPP: "jis_b5_182x257mm"},
+	"letter": {Width: 612, Height: 792, IPP: "na_letter_8.5x11in"},
+	"legal":  {Width: 612, Height: 1008, IPP: "na_legal_8.5x14in"},
+}
+
+// PageRange 页码范围, 从1开始, 包含首尾
+type PageRange struct {
+	First int `json:"first"`
+	Last  int `json:"last"`
+}
+
+// PrintOptions 打印选项, 零值表示使用打印机默认设置
+type PrintOptions struct {
+	// 份数
+	Copies int `json:"copies,omitempty"`
+	// 页码范围, 如 "1-3,7"
+	PageRanges string `json:"page_ranges,omitempty"`
+	// 双面打印: one-sided, long-edge, short-edge
+	Duplex string `json:"duplex,omitempty"`
+	// 方向: portrait, landscape
+	Orientation string `json:"orientation,omitempty"`
+	// 纸张: a4, a3, letter 等, 参见 MediaSizes
+	Media string `json:"media,omitempty"`
+	// 颜色: color, monochrome
+	Color string `json:"color,omitempty"`
+	// 多份时是否逐份打印
+	Collate *bool `json:"collate,omitempty"`
+	// 图片缩放: auto, fit, fill, none
+	Scaling string `json:"scaling,omitempty"`
+	// 每面打印的页数: 1, 2, 4, 6, 9
+	NumberUp int `json:"number_up,omitempty"`
+	// 多页合一时的排列顺序: lrtb, rltb, tblr, tbrl
+	NumberUpLayout string `json:"number_up_layout,omitempty"`
+	// 多页合一和小册子的页面边框: none, single, double
+	PageBorder string `json:"page_border,omitempty"`
+	// 是否按骑马钉小册子拼版
+	Booklet *bool `json:"booklet,omitempty"`
+	// 海报: 每页放大打印到 "列x行" 张纸上, 如 "2x2"
+	Poster string `json:"poster,omitempty"`
+	// 每页叠加的水印
+	Watermark *Stamp `json:"watermark,omitempty"`
+	// 分隔页: none, start, end, both
+	Banner string `json:"banner,omitempty"`
+}
+
+// Validate 检查选项取值是否合法
+func (o PrintOptions) Validate() error {
+	if o.Copies < 0 || o.Copies > 999 {
+		return fmt.Errorf("份数无效: %d", o.Copies)
+	}
+	if _, err := ParsePageRanges(o.PageRanges); err != nil {
+		return err
+	}
+	switch o.Duplex {
+	case "", DuplexOneSided, DuplexLongEdge, DuplexShortEdge:
+	default:
+		return fmt.Errorf("双面打印方式无效: %s", o.Duplex)
+	}
+	switch o.Orientation {
+	case "", OrientationPortrait, OrientationLandscape:
+	default:
+		return fmt.Errorf("打印方向无效: %s", o.Orientation)
+	}
+	if _, ok := MediaSizes[o.Media]; o.Media != "" && !ok {
+		return fmt.Errorf("纸张无效: %s", o.Media)
+	}
+	switch o.Color {
+	case "", ColorColor, ColorMonochrome:
+	default:
+		return fmt.Errorf("颜色模式无效: %s", o.Color)
+	}
+	switch o.Scaling {
+	case "", ScalingAuto, ScalingFit, ScalingFill, ScalingNone:
+	default:
+		return fmt.Errorf("缩放方式无效: %s", o.Scaling)
+	}
+	if err := o.validateImposition(); err != nil {
+		return err
+	}
+	return o.validateStamp()
+}
+
+// WithDefaults 返回以 defaults 为基础, 再用 o 中已设置的选项覆盖后的结果
+func (o PrintOptions) WithDefaults(defaults PrintOptions) PrintOptions {
+	merged := defaults
+	if o.Copies != 0 {
+		merged.Copies = o.Copies
+	}
+	if o.PageRanges != "" {
+		merged.PageRanges = o.PageRanges
+	}
+	if o.Duplex != "" {
+		merged.Duplex = o.Duplex
+	}
+	if o.Orientation != "" {
+		merged.Orientation = o.Orientation
+	}
+	if o.Media != "" {
+		merged.Media = o.Media
+	}
+	if o.Color != "" {
+		merged.Color = o.Color
+	}
+	if o.Collate != nil {
+		merged.Collate = o.Collate
+	}
+	if o.Scaling != "" {
+		merged.Scaling = o.Scaling
+	}
+	if o.NumberUp != 0 {
+		merged.NumberUp = o.NumberUp
+	}
+	if o.NumberUpLayout != "" {
+		merged.NumberUpLayout = o.NumberUpLayout
+	}
+	if o.PageBorder != "" {
+		merged.PageBorder = o.PageBorder
+	}
+	if o.Booklet != nil {
+		merged.Booklet = o.Booklet
+	}
+	if o.Poster != "" {
+		merged.Poster = o.Poster
+	}
+	if o.Watermark != nil {
+		merged.Watermark = o.Watermark
+	}
+	if o.Banner != "" {
+		merged.Banner = o.Banner
+	}
+	return merged
+}
+
+// CopyCount 返回份数, 未设置时为1
+func (o PrintOptions) CopyCount() int {
+	if o.Copies < 1 {
+		return 1
+	}
+	return o.Copies
+}
+
+// Collated 返回是否逐份打印, 未设置时为是
+func (o PrintOptions) Collated() bool {
+	return o.Collate == nil || *o.Collate
+}
+
+// PageSize 返回纸张的宽高 (点), 横向时宽高互换
+func (o PrintOptions) PageSize() (float64, float64) {
+	media, ok := MediaSizes[o.Media]
+	if !ok {
+		media = MediaSizes[DefaultMedia]
+	}
+	if o.Orientation == OrientationLandscape {
+		return media.Height, media.Width
+	}
+	return media.Width, media.Height
+}
+
+// Ranges 返回解析后的页码范围, 未设置时返回 nil 表示全部页面
+func (o PrintOptions) Ranges() []PageRange {
+	ranges, _ := ParsePageRanges(o.PageRanges)
+	return ranges
+}
+
+// ParsePageRanges 解析 "1-3,7,9-" 形式的页码范围, "9-" 表示第9页到最后一页,
+// 此时 Last 为0
+func ParsePageRanges(s string) ([]PageRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	var ranges []PageRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		first, last, isRange := strings.Cut(part, "-")
+
+		var r PageRange
+		var err error
+		if r.First, err = strconv.Atoi(strings.TrimSpace(first)); err != nil || r.First < 1 {
+			return nil, fmt.Errorf("页码范围无效: %s", part)
+		}
+		switch {
+		case !isRange:
+			r.Last = r.First
+		case strings.TrimSpace(last) == "":
+			r.Last = 0
+		default:
+			if r.Last, err = strconv.Atoi(strings.TrimSpace(last)); err != nil || r.Last < r.First {
+				return nil, fmt.Errorf("页码范围无效: %s", part)
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// ResolvePageRanges 根据总页数补全开放的范围, 并检查页码是否越界
+func ResolvePageRanges(ranges []PageRange, pages int) ([]PageRange, error) {
+	if len(ranges) == 0 {
+		return []PageRange{{First: 1, Last: pages}}, nil
+	}
+	resolved := make([]PageRange, len(ranges))
+	for i, r := range ranges {
+		if r.Last == 0 {
+			r.Last = pages
+		}
+		if r.First > pages || r.Last > pages {
+			return nil, fmt.Errorf("页码超出范围: 文档共 %d 页", pages)
+		}
+		resolved[i] = r
+	}
+	return resolved, nil
+}
+
+// ErrOptionUnsupported 后端不支持请求的打印选项
+var ErrOptionUnsupported = errors.New("打印后端不支持该选项")
+
+// Check 检查后端是否支持选项, 不支持时返回包装了 ErrOptionUnsupported 的错误.
+// 取默认值的选项 (单面、纵向、一份) 总是被接受
+func (c Capabilities) Check(o PrintOptions) error {
+	unsupported := func(name string) error {
+		return fmt.Errorf("%w: %s", ErrOptionUnsupported, name)
+	}
+
+	if o.CopyCount() > 1 && o.CopyCount() > c.MaxCopies {
+		if c.MaxCopies <= 1 {
+			return unsupported("多份打印")
+		}
+		return fmt.Errorf("%w: 最多打印 %d 份", ErrOptionUnsupported, c.MaxCopies)
+	}
+	// 拼版和水印生成新的 PDF, 页码范围在生成时处理, 不需要后端支持
+	imposed := o.Imposed()
+	if imposed && !c.CanPrint(".pdf") {
+		return unsupported("拼版")
+	}
+	if o.Stamped() && !c.CanPrint(".pdf") {
+		return unsupported("水印和分隔页")
+	}
+	if o.PageRanges != "" && !c.PageRanges && !imposed && !o.Stamped() {
+		return unsupported("页码范围")
+	}
+	if o.Duplex != "" && o.Duplex != DuplexOneSided && !c.Duplex {
+		return unsupported("双面打印")
+	}
+	if o.Orientation != "" && o.Orientation != OrientationPortrait && !c.Orientation && !imposed {
+		return unsupported("横向打印")
+	}
+	if o.Media != "" && !containsString(c.Media, o.Media) {
+		return unsupported("纸张 " + o.Media)
+	}
+	if o.Color != "" && !c.Color {
+		return unsupported("颜色模式")
+	}
+	if o.Collate != nil && !c.Collate {
+		return unsupported("逐份打印设置")
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// allMedia 返回全部已知纸张名称
+func allMedia() []string {
+	media := make([]string, 0, len(MediaSizes))
+	for name := range MediaSizes {
+		media = append(media, name)
+	}
+	sort.Strings(media)
+	return media
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePageRanges(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []PageRange
+		ok   bool
+	}{
+		{"", nil, true},
+		{"  ", nil, true},
+		{"1-3,5", []PageRange{{1, 3}, {5, 5}}, true},
+		{" 2 - 4 , 7 ", []PageRange{{2, 4}, {7, 7}}, true},
+		// 开放范围的 Last 为0, 按总页数补全
+		{"4-", []PageRange{{4, 0}}, true},
+		{"1,4-", []PageRange{{1, 1}, {4, 0}}, true},
+		{"3-3", []PageRange{{3, 3}}, true},
+		// 重叠和乱序的范围原样保留, 重复的页面打印多次
+		{"1-3,2-4", []PageRange{{1, 3}, {2, 4}}, true},
+		{"5,1", []PageRange{{5, 5}, {1, 1}}, true},
+		{"3-1", nil, false},
+		{"0", nil, false},
+		{"0-2", nil, false},
+		{"-3", nil, false},
+		{"-", nil, false},
+		{"1,,2", nil, false},
+		{"1,", nil, false},
+		{"a", nil, false},
+		{"1-b", nil, false},
+		{"1-2-3", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := ParsePageRanges(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParsePageRanges(%q): err = %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePageRanges(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestResolvePageRanges(t *testing.T) {
+	tests := []struct {
+		ranges string
+		pages  int
+		want   []PageRange
+		ok     bool
+	}{
+		{"", 5, []PageRange{{1, 5}}, true},
+		{"1-3,5", 5, []PageRange{{1, 3}, {5, 5}}, true},
+		{"4-", 10, []PageRange{{4, 10}}, true},
+		{"4-", 4, []PageRange{{4, 4}}, true},
+		{"1-3,2-4", 4, []PageRange{{1, 3}, {2, 4}}, true},
+		{"4-", 3, nil, false},
+		{"6", 5, nil, false},
+		{"1-6", 5, nil, false},
+		{"1", 0, nil, false},
+	}
+	for _, tt := range tests {
+		ranges, err := ParsePageRanges(tt.ranges)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ResolvePageRanges(ranges, tt.pages)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q / %d 页: err = %v", tt.ranges, tt.pages, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q / %d 页 = %v, want %v", tt.ranges, tt.pages, got, tt.want)
+		}
+	}
+
+	// 不修改传入的范围
+	ranges := []PageRange{{2, 0}}
+	ResolvePageRanges(ranges, 9)
+	if ranges[0].Last != 0 {
+		t.Errorf("ranges = %v", ranges)
+	}
+}
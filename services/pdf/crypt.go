@@ -0,0 +1,296 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrPassword 文档设置了打开密码, 无法用空密码解密
+var ErrPassword = errors.New("pdf: 文档需要密码才能打开")
+
+// passwordPad 标准安全处理程序用于补齐密码的32字节
+var passwordPad = []byte{
+	0x28, 0xbf, 0x4e, 0x5e, 0x4e, 0x75, 0x8a, 0x41, 0x64, 0x00, 0x4e, 0x56, 0xff, 0xfa, 0x01, 0x08,
+	0x2e, 0x2e, 0x00, 0xb6, 0xd0, 0x68, 0x3e, 0x80, 0x2f, 0x0c, 0xa9, 0xfe, 0x64, 0x53, 0x69, 0x7a,
+}
+
+// 加密算法
+const (
+	cryptNone   = "Identity"
+	cryptRC4    = "V2"
+	cryptAES    = "AESV2"
+	cryptAES256 = "AESV3"
+)
+
+// securityHandler 标准安全处理程序, 只支持空的用户密码,
+// 即只限制了编辑和打印权限、任何人都能打开的文档
+type securityHandler struct {
+	key             []byte
+	stmMethod       string
+	strMethod       string
+	encryptMetadata bool
+}
+
+// newSecurityHandler 根据 Encrypt 字典和文件标识计算文件密钥
+func newSecurityHandler(enc Dict, id []byte) (*securityHandler, error) {
+	if filter, _ := enc["Filter"].(Name); filter != "Standard" {
+		return nil, fmt.Errorf("pdf: 不支持的加密方式 %s", filter)
+	}
+	v := intOr(enc["V"], 0)
+	rev := intOr(enc["R"], 0)
+	o, _ := enc["O"].(String)
+	u, _ := enc["U"].(String)
+	h := &securityHandler{encryptMetadata: true}
+	if b, ok := enc["EncryptMetadata"].(bool); ok {
+		h.encryptMetadata = b
+	}
+
+	keyLen := 5
+	switch v {
+	case 1:
+		h.stmMethod, h.strMethod = cryptRC4, cryptRC4
+	case 2:
+		h.stmMethod, h.strMethod = cryptRC4, cryptRC4
+		keyLen = intOr(enc["Length"], 40) / 8
+	case 4, 5:
+		filters, _ := enc["CF"].(Dict)
+		method := func(key Name) string {
+			name, _ := enc[key].(Name)
+			if name == "" || name == cryptNone {
+				return cryptNone
+			}
+			cf, _ := filters[name].(Dict)
+			cfm, _ := cf["CFM"].(Name)
+			if cfm == "None" {
+				return cryptNone
+			}
+			return string(cfm)
+		}
+		h.stmMethod, h.strMethod = method("StmF"), method("StrF")
+		keyLen = 16
+		if v == 5 {
+			keyLen = 32
+		}
+	default:
+		return nil, fmt.Errorf("pdf: 不支持的加密版本 V%d", v)
+	}
+	for _, m := range []string{h.stmMethod, h.strMethod} {
+		if m != cryptNone && m != cryptRC4 && m != cryptAES && m != cryptAES256 {
+			return nil, fmt.Errorf("pdf: 不支持的加密算法 %s", m)
+		}
+	}
+	if keyLen < 5 || keyLen > 32 {
+		return nil, fmt.Errorf("pdf: 密钥长度无效")
+	}
+
+	if rev >= 5 {
+		key, err := fileKeyR6(rev, u, enc)
+		if err != nil {
+			return nil, err
+		}
+		h.key = key
+		return h, nil
+	}
+
+	if len(o) < 32 || len(u) < 32 && rev == 2 || len(u) < 16 {
+		return nil, fmt.Errorf("pdf: 加密字典无效")
+	}
+	// 算法2: 由空密码计算文件密钥
+	m := md5.New()
+	m.Write(passwordPad)
+	m.Write(o[:32])
+	binary.Write(m, binary.LittleEndian, uint32(int32(intOr(enc["P"], 0))))
+	m.Write(id)
+	if rev >= 4 && !h.encryptMetadata {
+		m.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	}
+	key := m.Sum(nil)
+	if rev >= 3 {
+		for i := 0; i < 50; i++ {
+			sum := md5.Sum(key[:keyLen])
+			key = sum[:]
+		}
+	}
+	key = key[:keyLen]
+
+	// 算法4/5: 验证空密码是否就是用户密码
+	if rev == 2 {
+		if !bytes.Equal(rc4Crypt(key, passwordPad), u[:32]) {
+			return nil, ErrPassword
+		}
+	} else {
+		sum := md5.Sum(append(append([]byte(nil), passwordPad...), id...))
+		x := rc4Crypt(key, sum[:])
+		for i := 1; i <= 19; i++ {
+			k := make([]byte, len(key))
+			for j := range key {
+				k[j] = key[j] ^ byte(i)
+			}
+			x = rc4Crypt(k, x)
+		}
+		if !bytes.Equal(x[:16], u[:16]) {
+			return nil, ErrPassword
+		}
+	}
+	h.key = key
+	return h, nil
+}
+
+// fileKeyR6 按 PDF 2.0 (R5/R6, AES-256) 的算法用空密码解出文件密钥
+func fileKeyR6(rev int, u String, enc Dict) ([]byte, error) {
+	ue, _ := enc["UE"].(String)
+	if len(u) < 48 || len(ue) < 32 {
+		return nil, fmt.Errorf("pdf: 加密字典无效")
+	}
+	hash := func(salt []byte) []byte {
+		if rev == 5 {
+			sum := sha256.Sum256(salt)
+			return sum[:]
+		}
+		return hashR6(nil, salt, nil)
+	}
+	if !bytes.Equal(hash(u[32:40]), u[:32]) {
+		return nil, ErrPassword
+	}
+	block, err := aes.NewCipher(hash(u[40:48]))
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(key, ue[:32])
+	return key, nil
+}
+
+// hashR6 PDF 2.0 算法 2.B
+func hashR6(password, salt, udata []byte) []byte {
+	sum := sha256.Sum256(append(append(append([]byte(nil), password...), salt...), udata...))
+	k := sum[:]
+	var e []byte
+	for i := 0; i < 64 || int(e[len(e)-1]) > i-32; i++ {
+		var k1 []byte
+		for j := 0; j < 64; j++ {
+			k1 = append(k1, password...)
+			k1 = append(k1, k...)
+			k1 = append(k1, udata...)
+		}
+		block, _ := aes.NewCipher(k[:16])
+		e = make([]byte, len(k1))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+		mod := 0
+		for _, b := range e[:16] {
+			mod += int(b)
+		}
+		switch mod % 3 {
+		case 0:
+			s := sha256.Sum256(e)
+			k = s[:]
+		case 1:
+			s := sha512.Sum384(e)
+			k = s[:]
+		case 2:
+			s := sha512.Sum512(e)
+			k = s[:]
+		}
+	}
+	return k[:32]
+}
+
+func rc4Crypt(key, data []byte) []byte {
+	c, _ := rc4.NewCipher(key)
+	out := make([]byte, len(data))
+	c.XORKeyStream(out, data)
+	return out
+}
+
+// decrypt 解密对象 num gen 中的一段数据
+func (h *securityHandler) decrypt(data []byte, num, gen int, method string) []byte {
+	if method == cryptNone {
+		return data
+	}
+	key := h.key
+	if method != cryptAES256 {
+		// 算法1: 每个对象使用由文件密钥和对象编号派生的密钥
+		m := md5.New()
+		m.Write(h.key)
+		m.Write([]byte{byte(num), byte(num >> 8), byte(num >> 16), byte(gen), byte(gen >> 8)})
+		if method == cryptAES {
+			m.Write([]byte("sAlT"))
+		}
+		key = m.Sum(nil)
+		if n := len(h.key) + 5; n < 16 {
+			key = key[:n]
+		}
+	}
+	if method == cryptRC4 {
+		return rc4Crypt(key, data)
+	}
+
+	// AES-CBC, 前16字节为初始向量, 末尾为 PKCS#5 填充
+	if len(data) < 2*aes.BlockSize {
+		return nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return data
+	}
+	body := data[aes.BlockSize:]
+	body = body[:len(body)-len(body)%aes.BlockSize]
+	out := make([]byte, len(body))
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(out, body)
+	if n := int(out[len(out)-1]); n >= 1 && n <= aes.BlockSize && n <= len(out) {
+		out = out[:len(out)-n]
+	}
+	return out
+}
+
+// decryptObject 解密对象中的字符串和流数据
+func (h *securityHandler) decryptObject(obj Object, num, gen int) Object {
+	switch v := obj.(type) {
+	case String:
+		return String(h.decrypt(v, num, gen, h.strMethod))
+	case Array:
+		for i, item := range v {
+			v[i] = h.decryptObject(item, num, gen)
+		}
+	case Dict:
+		for k, item := range v {
+			v[k] = h.decryptObject(item, num, gen)
+		}
+	case *Stream:
+		h.decryptObject(v.Dict, num, gen)
+		typ, _ := v.Dict["Type"].(Name)
+		switch {
+		case typ == "XRef":
+			// 交叉引用流不加密
+		case typ == "Metadata" && !h.encryptMetadata:
+		case hasCryptFilter(v.Dict):
+			// 流自带 Crypt 过滤器时只支持 Identity
+		default:
+			v.Data = h.decrypt(v.Data, num, gen, h.stmMethod)
+		}
+	}
+	return obj
+}
+
+// hasCryptFilter 判断流的过滤器中是否有 Crypt
+func hasCryptFilter(d Dict) bool {
+	switch f := d["Filter"].(type) {
+	case Name:
+		return f == "Crypt"
+	case Array:
+		for _, item := range f {
+			if item == Name("Crypt") {
+				return true
+			}
+		}
+	}
+	return false
+}
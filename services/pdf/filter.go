@@ -0,0 +1,201 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// 解码后的流最大长度, 防止压缩炸弹
+const maxStreamSize = 256 << 20
+
+// decodeFilter 按一个过滤器解码数据, parms 为对应的 DecodeParms
+func decodeFilter(data []byte, filter Name, parms Dict) ([]byte, error) {
+	switch filter {
+	case "FlateDecode", "Fl":
+		out, err := inflate(data)
+		if err != nil {
+			return nil, err
+		}
+		return applyPredictor(out, parms)
+	case "ASCIIHexDecode", "AHx":
+		if i := bytes.IndexByte(data, '>'); i >= 0 {
+			data = data[:i]
+		}
+		data = bytes.Map(func(r rune) rune {
+			if r < 0x80 && isSpace(byte(r)) {
+				return -1
+			}
+			return r
+		}, data)
+		if len(data)%2 == 1 {
+			data = append(data, '0')
+		}
+		out := make([]byte, len(data)/2)
+		if _, err := hex.Decode(out, data); err != nil {
+			return nil, fmt.Errorf("pdf: ASCIIHex 数据无效: %v", err)
+		}
+		return out, nil
+	case "ASCII85Decode", "A85":
+		data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+		if i := bytes.Index(data, []byte("~>")); i >= 0 {
+			data = data[:i]
+		}
+		out, err := io.ReadAll(ascii85.NewDecoder(bytes.NewReader(data)))
+		if err != nil {
+			return nil, fmt.Errorf("pdf: ASCII85 数据无效: %v", err)
+		}
+		return out, nil
+	case "Crypt":
+		// 解密在读取对象时已经完成
+		return data, nil
+	}
+	return nil, fmt.Errorf("pdf: 不支持的压缩方式 %s", filter)
+}
+
+// inflate 解压 zlib 数据. 缺少 zlib 头时按原始 deflate 数据处理,
+// 数据被截断时返回已解压的部分
+func inflate(data []byte) ([]byte, error) {
+	var r io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		r = zr
+	} else {
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+	out, err := io.ReadAll(io.LimitReader(r, maxStreamSize+1))
+	if len(out) > maxStreamSize {
+		return nil, fmt.Errorf("pdf: 解压后的数据过大")
+	}
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("pdf: 解压失败: %v", err)
+	}
+	return out, nil
+}
+
+// applyPredictor 还原 FlateDecode 的 PNG 或 TIFF 预测
+func applyPredictor(data []byte, parms Dict) ([]byte, error) {
+	predictor := intOr(parms["Predictor"], 1)
+	if predictor == 1 {
+		return data, nil
+	}
+	colors := intOr(parms["Colors"], 1)
+	bpc := intOr(parms["BitsPerComponent"], 8)
+	columns := intOr(parms["Columns"], 1)
+	if colors < 1 || bpc < 1 || columns < 1 {
+		return nil, fmt.Errorf("pdf: 预测参数无效")
+	}
+	bpp := (colors*bpc + 7) / 8
+	rowLen := (colors*bpc*columns + 7) / 8
+
+	if predictor == 2 {
+		if bpc != 8 {
+			return nil, fmt.Errorf("pdf: 不支持的 TIFF 预测位深 %d", bpc)
+		}
+		out := append([]byte(nil), data...)
+		for row := 0; row+rowLen <= len(out); row += rowLen {
+			for i := bpp; i < rowLen; i++ {
+				out[row+i] += out[row+i-bpp]
+			}
+		}
+		return out, nil
+	}
+	if predictor < 10 {
+		return nil, fmt.Errorf("pdf: 不支持的预测方式 %d", predictor)
+	}
+
+	// PNG 预测: 每行前有一个字节表示该行的预测算法
+	out := make([]byte, 0, len(data)/(rowLen+1)*rowLen)
+	prev := make([]byte, rowLen)
+	for i := 0; i+1+rowLen <= len(data); i += rowLen + 1 {
+		kind := data[i]
+		row := append([]byte(nil), data[i+1:i+1+rowLen]...)
+		for j := range row {
+			var left, up, upLeft byte
+			if j >= bpp {
+				left = row[j-bpp]
+				upLeft = prev[j-bpp]
+			}
+			up = prev[j]
+			switch kind {
+			case 1:
+				row[j] += left
+			case 2:
+				row[j] += up
+			case 3:
+				row[j] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[j] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// intOr 返回整数对象的值, 不是整数时返回 def
+func intOr(obj Object, def int) int {
+	switch v := obj.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return def
+}
+
+// Number 返回数字对象的值
+func Number(obj Object) (float64, bool) {
+	switch v := obj.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// RectFromArray 将 [llx lly urx ury] 数组转换为 Rect, 左下角和右上角顺序颠倒时自动调整
+func RectFromArray(obj Object) (Rect, bool) {
+	arr, ok := obj.(Array)
+	if !ok || len(arr) != 4 {
+		return Rect{}, false
+	}
+	var v [4]float64
+	for i, item := range arr {
+		if v[i], ok = Number(item); !ok {
+			return Rect{}, false
+		}
+	}
+	r := Rect{LLX: v[0], LLY: v[1], URX: v[2], URY: v[3]}
+	if r.LLX > r.URX {
+		r.LLX, r.URX = r.URX, r.LLX
+	}
+	if r.LLY > r.URY {
+		r.LLY, r.URY = r.URY, r.LLY
+	}
+	return r, true
+}
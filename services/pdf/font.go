@@ -0,0 +1,112 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// CourierWidth Courier 字体每个字符的宽度, 单位为字号的千分之一
+const CourierWidth = 600
+
+// CJKWidth 中文字体每个字符的宽度, 单位为字号的千分之一
+const CJKWidth = 1000
+
+// Courier 返回标准14字体 Courier 的字体字典, 使用 WinAnsiEncoding,
+// 可以显示 ASCII 和 Latin-1 字符
+func Courier() Dict {
+	return Dict{
+		"Type":     Name("Font"),
+		"Subtype":  Name("Type1"),
+		"BaseFont": Name("Courier"),
+		"Encoding": Name("WinAnsiEncoding"),
+	}
+}
+
+// AddCJKFont 写出 Adobe 预定义的中文字体 STSong-Light, 不嵌入字形,
+// 由阅读器或打印机提供字体. 文本按 UCS-2 大端编码, 参见 EncodeUCS2
+func AddCJKFont(w *Writer) Ref {
+	descriptor := w.Add(Dict{
+		"Type":        Name("FontDescriptor"),
+		"FontName":    Name("STSong-Light"),
+		"Flags":       6,
+		"FontBBox":    Array{-25, -254, 1000, 880},
+		"ItalicAngle": 0,
+		"Ascent":      880,
+		"Descent":     -120,
+		"CapHeight":   626,
+		"StemV":       93,
+	})
+	cidFont := w.Add(Dict{
+		"Type":     Name("Font"),
+		"Subtype":  Name("CIDFontType0"),
+		"BaseFont": Name("STSong-Light"),
+		"CIDSystemInfo": Dict{
+			"Registry":   String("Adobe"),
+			"Ordering":   String("GB1"),
+			"Supplement": 4,
+		},
+		"FontDescriptor": descriptor,
+		"DW":             CJKWidth,
+	})
+	return w.Add(Dict{
+		"Type":            Name("Font"),
+		"Subtype":         Name("Type0"),
+		"BaseFont":        Name("STSong-Light-UniGB-UCS2-H"),
+		"Encoding":        Name("UniGB-UCS2-H"),
+		"DescendantFonts": Array{cidFont},
+	})
+}
+
+// EncodeUCS2 将文本编码为 UCS-2 大端十六进制字符串 (含尖括号),
+// 基本平面以外的字符替换为 "?"
+func EncodeUCS2(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('<')
+	for _, r := range s {
+		if r > 0xffff || r == utf8.RuneError {
+			r = '?'
+		}
+		fmt.Fprintf(&sb, "%04X", r)
+	}
+	sb.WriteByte('>')
+	return sb.String()
+}
+
+// IsLatin1 判断字符能否用 Courier 的 WinAnsiEncoding 显示
+func IsLatin1(r rune) bool {
+	return (r >= 0x20 && r <= 0x7e) || (r >= 0xa0 && r <= 0xff)
+}
+
+// EncodeLatin1 将只含 Latin-1 字符的文本编码为字面字符串 (含括号)
+func EncodeLatin1(s string) string {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if !IsLatin1(r) {
+			r = '?'
+		}
+		b = append(b, byte(r))
+	}
+	return "(" + EscapeString(b) + ")"
+}
+
+// EncodeTextString 将文本编码为文档信息等处使用的文本字符串,
+// 纯 ASCII 原样返回, 否则使用带 BOM 的 UTF-16 大端编码
+func EncodeTextString(s string) []byte {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return []byte(s)
+	}
+	b := []byte{0xfe, 0xff}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return b
+}
@@ -0,0 +1,245 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// MaxImagePixels 图片的最大像素数. 解码前按文件头中的尺寸检查,
+// 避免几 KB 的图片声明极大的尺寸, 解码时耗尽内存
+const MaxImagePixels = 50_000_000
+
+// ImageInfo 图片尺寸和元数据
+type ImageInfo struct {
+	// 像素尺寸, 未考虑 Orientation
+	Width  int
+	Height int
+	// 分辨率, 文件中没有记录时为0
+	DPIX float64
+	DPIY float64
+	// EXIF 方向 1-8, 没有记录时为1
+	Orientation int
+}
+
+// Rotated 判断 EXIF 方向是否需要旋转90度显示
+func (i ImageInfo) Rotated() bool {
+	return i.Orientation >= 5 && i.Orientation <= 8
+}
+
+// DisplaySize 返回按 EXIF 方向摆正后的像素尺寸
+func (i ImageInfo) DisplaySize() (int, int) {
+	if i.Rotated() {
+		return i.Height, i.Width
+	}
+	return i.Width, i.Height
+}
+
+// ImageMatrix 返回把图片摆正后绘制到 (x, y, w, h) 区域的变换矩阵 (cm 操作数),
+// w 和 h 是摆正后的宽高
+func (i ImageInfo) ImageMatrix(x, y, w, h float64) [6]float64 {
+	switch i.Orientation {
+	case 2: // 水平翻转
+		return [6]float64{-w, 0, 0, h, x + w, y}
+	case 3: // 旋转180度
+		return [6]float64{-w, 0, 0, -h, x + w, y + h}
+	case 4: // 垂直翻转
+		return [6]float64{w, 0, 0, -h, x, y + h}
+	case 5: // 沿左上-右下对角线翻转
+		return [6]float64{0, -h, -w, 0, x + w, y + h}
+	case 6: // 顺时针旋转90度
+		return [6]float64{0, -h, w, 0, x, y + h}
+	case 7: // 沿右上-左下对角线翻转
+		return [6]float64{0, h, w, 0, x, y}
+	case 8: // 逆时针旋转90度
+		return [6]float64{0, h, -w, 0, x + w, y}
+	}
+	return [6]float64{w, 0, 0, h, x, y}
+}
+
+// ReadImageInfo 读取 JPEG、PNG、GIF 图片的尺寸、分辨率和方向, 超过 MaxImagePixels 的图片返回错误
+func ReadImageInfo(data []byte) (ImageInfo, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("无法识别的图片: %v", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return ImageInfo{}, fmt.Errorf("图片尺寸无效: %dx%d", cfg.Width, cfg.Height)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxImagePixels {
+		return ImageInfo{}, fmt.Errorf("图片太大: %dx%d, 最多 %d 像素", cfg.Width, cfg.Height, MaxImagePixels)
+	}
+	info := ImageInfo{Width: cfg.Width, Height: cfg.Height, Orientation: 1}
+	switch format {
+	case "jpeg":
+		readJPEGMeta(data, &info)
+	case "png":
+		readPNGMeta(data, &info)
+	}
+	if info.Orientation < 1 || info.Orientation > 8 {
+		info.Orientation = 1
+	}
+	return info, nil
+}
+
+// readJPEGMeta 从 JFIF (APP0) 读取分辨率, 从 EXIF (APP1) 读取方向
+func readJPEGMeta(data []byte, info *ImageInfo) {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return
+		}
+		marker := data[i+1]
+		// 帧数据开始后不再有元数据段
+		if marker == 0xda || marker == 0xd9 {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return
+		}
+		seg := data[i+4 : i+2+length]
+		switch {
+		case marker == 0xe0 && bytes.HasPrefix(seg, []byte("JFIF\x00")) && len(seg) >= 12:
+			units := seg[7]
+			x := float64(binary.BigEndian.Uint16(seg[8:]))
+			y := float64(binary.BigEndian.Uint16(seg[10:]))
+			switch units {
+			case 1: // 每英寸
+				info.DPIX, info.DPIY = x, y
+			case 2: // 每厘米
+				info.DPIX, info.DPIY = x*2.54, y*2.54
+			}
+		case marker == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")):
+			info.Orientation = exifOrientation(seg[6:])
+		}
+		i += 2 + length
+	}
+}
+
+// exifOrientation 在 TIFF 结构的 IFD0 中查找 Orientation (0x0112) 标签
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
+
+// readPNGMeta 从 pHYs 块读取分辨率
+func readPNGMeta(data []byte, info *ImageInfo) {
+	for i := 8; i+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		kind := string(data[i+4 : i+8])
+		if length < 0 || i+12+length > len(data) {
+			return
+		}
+		chunk := data[i+8 : i+8+length]
+		switch kind {
+		case "pHYs":
+			// 单位1表示每米像素数
+			if length == 9 && chunk[8] == 1 {
+				info.DPIX = float64(binary.BigEndian.Uint32(chunk)) * 0.0254
+				info.DPIY = float64(binary.BigEndian.Uint32(chunk[4:])) * 0.0254
+			}
+			return
+		case "IDAT", "IEND":
+			return
+		}
+		i += 12 + length
+	}
+}
+
+// AddImage 写出图片 XObject. 普通 JPEG 原样嵌入 (DCTDecode),
+// 其他图片解码后以 FlateDecode 嵌入, 带透明通道时附加 SMask. 尺寸在解码前由 ReadImageInfo 检查
+func AddImage(w *Writer, data []byte) (Ref, ImageInfo, error) {
+	info, err := ReadImageInfo(data)
+	if err != nil {
+		return Ref{}, info, err
+	}
+	cfg, format, _ := image.DecodeConfig(bytes.NewReader(data))
+
+	dict := Dict{
+		"Type":             Name("XObject"),
+		"Subtype":          Name("Image"),
+		"Width":            info.Width,
+		"Height":           info.Height,
+		"BitsPerComponent": 8,
+	}
+
+	// CMYK JPEG 的反相约定不统一, 交给解码器处理
+	if format == "jpeg" && cfg.ColorModel != color.CMYKModel {
+		dict["Filter"] = Name("DCTDecode")
+		dict["ColorSpace"] = Name("DeviceRGB")
+		if cfg.ColorModel == color.GrayModel {
+			dict["ColorSpace"] = Name("DeviceGray")
+		}
+		return w.Add(&Stream{Dict: dict, Data: data}), info, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Ref{}, info, fmt.Errorf("解码图片失败: %v", err)
+	}
+	bounds := img.Bounds()
+	gray := img.ColorModel() == color.GrayModel
+	pixels := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	alpha := make([]byte, 0, bounds.Dx()*bounds.Dy())
+	opaque := true
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if gray {
+				pixels = append(pixels, c.R)
+			} else {
+				pixels = append(pixels, c.R, c.G, c.B)
+			}
+			alpha = append(alpha, c.A)
+			if c.A != 0xff {
+				opaque = false
+			}
+		}
+	}
+
+	dict["ColorSpace"] = Name("DeviceRGB")
+	if gray {
+		dict["ColorSpace"] = Name("DeviceGray")
+	}
+	if !opaque {
+		dict["SMask"] = w.Add(NewStream(Dict{
+			"Type":             Name("XObject"),
+			"Subtype":          Name("Image"),
+			"Width":            info.Width,
+			"Height":           info.Height,
+			"ColorSpace":       Name("DeviceGray"),
+			"BitsPerComponent": 8,
+		}, alpha, true))
+	}
+	return w.Add(NewStream(dict, pixels, true)), info, nil
+}
@@ -0,0 +1,65 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// pngHeader 返回只有文件头和 IHDR 块的 PNG, 声明的尺寸为 width x height
+func pngHeader(width, height uint32) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	chunk := make([]byte, 0, 17)
+	chunk = append(chunk, "IHDR"...)
+	chunk = binary.BigEndian.AppendUint32(chunk, width)
+	chunk = binary.BigEndian.AppendUint32(chunk, height)
+	// 8 位 RGB, 默认压缩、过滤, 不隔行
+	chunk = append(chunk, 8, 2, 0, 0, 0)
+	binary.Write(&buf, binary.BigEndian, uint32(len(chunk)-4))
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestImageTooLarge(t *testing.T) {
+	data := pngHeader(60000, 60000)
+	if _, err := ReadImageInfo(data); err == nil || !strings.Contains(err.Error(), "图片太大") {
+		t.Fatalf("ReadImageInfo: err = %v", err)
+	}
+	w := NewWriter(&bytes.Buffer{})
+	if _, _, err := AddImage(w, data); err == nil {
+		t.Fatal("AddImage 应拒绝超过像素上限的图片")
+	}
+}
+
+func TestAddImagePNG(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.NRGBA{R: 255, A: 128})
+	var data bytes.Buffer
+	if err := png.Encode(&data, img); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	ref, info, err := AddImage(w, data.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Num == 0 || info.Width != 3 || info.Height != 2 || info.Orientation != 1 {
+		t.Fatalf("ref = %v, info = %+v", ref, info)
+	}
+	// 带透明通道的图片附加 SMask
+	if err := w.Close(Dict{}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("/SMask")) {
+		t.Error("缺少 SMask")
+	}
+}
@@ -0,0 +1,154 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Importer 将 Reader 中的对象复制到 Writer, 同一对象只复制一次
+type Importer struct {
+	r     *Reader
+	w     *Writer
+	refs  map[int]Ref
+	forms map[int]Ref
+}
+
+// NewImporter 创建从 r 复制到 w 的 Importer
+func NewImporter(r *Reader, w *Writer) *Importer {
+	return &Importer{r: r, w: w, refs: make(map[int]Ref), forms: make(map[int]Ref)}
+}
+
+// Copy 复制对象, 引用的间接对象一并写出并重新编号
+func (im *Importer) Copy(obj Object) Object {
+	switch v := obj.(type) {
+	case Ref:
+		if ref, ok := im.refs[v.Num]; ok {
+			return ref
+		}
+		// 先登记再复制, 对象之间循环引用时不会重复写出
+		ref := im.w.Alloc()
+		im.refs[v.Num] = ref
+		im.w.Write(ref, im.Copy(im.r.Resolve(v)))
+		return ref
+	case Array:
+		arr := make(Array, len(v))
+		for i, item := range v {
+			arr[i] = im.Copy(item)
+		}
+		return arr
+	case Dict:
+		dict := make(Dict, len(v))
+		for k, item := range v {
+			dict[k] = im.Copy(item)
+		}
+		return dict
+	case *Stream:
+		dict := im.Copy(v.Dict).(Dict)
+		// 长度由 Writer 重新计算
+		delete(dict, "Length")
+		return &Stream{Dict: dict, Data: v.Data}
+	}
+	return obj
+}
+
+// Box 返回页面的可见区域, 即 CropBox 与 MediaBox 的交集
+func (p Page) Box() Rect {
+	media := p.MediaBox()
+	crop, ok := RectFromArray(p.Dict["CropBox"])
+	if !ok {
+		return media
+	}
+	box := Rect{
+		LLX: max(crop.LLX, media.LLX),
+		LLY: max(crop.LLY, media.LLY),
+		URX: min(crop.URX, media.URX),
+		URY: min(crop.URY, media.URY),
+	}
+	if box.Width() <= 0 || box.Height() <= 0 {
+		return media
+	}
+	return box
+}
+
+// DisplaySize 返回页面按 Rotate 旋转后显示的宽高
+func (p Page) DisplaySize() (float64, float64) {
+	box := p.Box()
+	if p.Rotate() == 90 || p.Rotate() == 270 {
+		return box.Height(), box.Width()
+	}
+	return box.Width(), box.Height()
+}
+
+// PageForm 将页面内容写为 Form XObject, 同一页面只写一次.
+// 表单的坐标系与原页面相同, 绘制时用 PlaceMatrix 计算变换矩阵
+func (im *Importer) PageForm(page Page) (Ref, error) {
+	if ref, ok := im.forms[page.Ref.Num]; ok {
+		return ref, nil
+	}
+
+	var contents []Object
+	switch v := im.r.Resolve(page.Dict["Contents"]).(type) {
+	case *Stream:
+		contents = []Object{v}
+	case Array:
+		contents = v
+	}
+	var data bytes.Buffer
+	for _, c := range contents {
+		s, ok := im.r.Resolve(c).(*Stream)
+		if !ok {
+			continue
+		}
+		decoded, err := im.r.Decode(s)
+		if err != nil {
+			return Ref{}, fmt.Errorf("pdf: 读取页面内容失败: %v", err)
+		}
+		// 多个内容流之间需要分隔
+		data.Write(decoded)
+		data.WriteByte('\n')
+	}
+
+	dict := Dict{
+		"Type":    Name("XObject"),
+		"Subtype": Name("Form"),
+		"BBox":    page.Box().Array(),
+	}
+	if res, ok := im.r.Resolve(page.Dict["Resources"]).(Dict); ok {
+		dict["Resources"] = im.Copy(res)
+	} else {
+		dict["Resources"] = Dict{}
+	}
+	if group, ok := page.Dict["Group"]; ok {
+		dict["Group"] = im.Copy(group)
+	}
+	ref := im.w.Add(NewStream(dict, data.Bytes(), true))
+	im.forms[page.Ref.Num] = ref
+	return ref, nil
+}
+
+// PlaceMatrix 返回把页面 (可见区域 box, 旋转 rotate) 按 scale 缩放后,
+// 左下角放在 (x, y) 处的变换矩阵 (cm 操作数)
+func PlaceMatrix(box Rect, rotate int, x, y, scale float64) [6]float64 {
+	s := scale
+	switch rotate {
+	case 90:
+		return [6]float64{0, -s, s, 0, x - s*box.LLY, y + s*box.URX}
+	case 180:
+		return [6]float64{-s, 0, 0, -s, x + s*box.URX, y + s*box.URY}
+	case 270:
+		return [6]float64{0, s, -s, 0, x + s*box.URY, y - s*box.LLX}
+	}
+	return [6]float64{s, 0, 0, s, x - s*box.LLX, y - s*box.LLY}
+}
+
+// FormatMatrix 将矩阵格式化为内容流中的 cm 操作数
+func FormatMatrix(m [6]float64) string {
+	var b []byte
+	for i, v := range m {
+		if i > 0 {
+			b = append(b, ' ')
+		}
+		b = append(b, FormatNumber(v)...)
+	}
+	return string(b)
+}
@@ -0,0 +1,69 @@
+package pdf
+
+import (
+	"errors"
+	"strings"
+)
+
+// PageBox 页面尺寸
+type PageBox struct {
+	MediaBox Rect `json:"media_box"`
+	Rotate   int  `json:"rotate,omitempty"`
+}
+
+// Info PDF 文件的检查结果
+type Info struct {
+	Version string `json:"version"`
+	Pages   int    `json:"pages"`
+	// 每页的尺寸, 按页面顺序
+	PageBoxes []PageBox `json:"page_boxes"`
+	Encrypted bool      `json:"encrypted"`
+	// 设置了打开密码, 无法读取内容
+	NeedsPassword bool   `json:"needs_password,omitempty"`
+	Title         string `json:"title,omitempty"`
+	Author        string `json:"author,omitempty"`
+	// 文件结构有错误, Problems 为具体问题. 损坏的文件可能仍能打印
+	Damaged  bool     `json:"damaged"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Inspect 读取 PDF 的页数、页面尺寸、加密状态和标题作者, 只有不是 PDF 时才返回错误.
+// 损坏到找不到文档目录的文件返回页数为0的结果
+func Inspect(data []byte) (*Info, error) {
+	r, err := NewReader(data)
+	if errors.Is(err, ErrNotPDF) {
+		return nil, err
+	}
+	if err != nil {
+		return &Info{Damaged: true, Problems: []string{err.Error()}}, nil
+	}
+	info := &Info{
+		Version:       r.Version(),
+		Encrypted:     r.Encrypted(),
+		NeedsPassword: errors.Is(r.CryptError(), ErrPassword),
+	}
+
+	pages, err := r.Pages()
+	if err != nil {
+		r.problem("%v", err)
+	}
+	info.Pages = len(pages)
+	info.PageBoxes = make([]PageBox, len(pages))
+	for i, page := range pages {
+		info.PageBoxes[i] = PageBox{MediaBox: page.MediaBox(), Rotate: page.Rotate()}
+	}
+
+	// 无法解密时字符串是密文
+	if r.CryptError() == nil {
+		if doc := r.Info(); doc != nil {
+			title, _ := r.Resolve(doc["Title"]).(String)
+			author, _ := r.Resolve(doc["Author"]).(String)
+			info.Title = strings.TrimSpace(DecodeTextString(title))
+			info.Author = strings.TrimSpace(DecodeTextString(author))
+		}
+	}
+
+	info.Damaged = r.Damaged()
+	info.Problems = r.Problems()
+	return info, nil
+}
@@ -0,0 +1,324 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 数组和字典的最大嵌套层数, 防止恶意文件耗尽栈空间
+const maxDepth = 64
+
+var errEOF = errors.New("pdf: 文件意外结束")
+
+// parser 从 data 的 pos 处解析 PDF 对象
+type parser struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func isSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("pdf: 偏移 %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// skipSpace 跳过空白和注释
+func (p *parser) skipSpace() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if isSpace(c) {
+			p.pos++
+			continue
+		}
+		if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// keyword 读取一个由普通字符组成的记号, 如 obj、R、true
+func (p *parser) keyword() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.data) && !isSpace(p.data[p.pos]) && !isDelim(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+// peekKeyword 读取下一个记号但不移动位置
+func (p *parser) peekKeyword() string {
+	pos := p.pos
+	kw := p.keyword()
+	p.pos = pos
+	return kw
+}
+
+// integer 读取一个非负整数, 失败时不移动位置
+func (p *parser) integer() (int, bool) {
+	pos := p.pos
+	kw := p.keyword()
+	n, err := strconv.Atoi(kw)
+	if err != nil || n < 0 {
+		p.pos = pos
+		return 0, false
+	}
+	return n, true
+}
+
+// object 解析一个直接对象, "n g R" 解析为 Ref
+func (p *parser) object() (Object, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, errEOF
+	}
+	c := p.data[p.pos]
+	switch {
+	case c == '/':
+		return p.name(), nil
+	case c == '(':
+		return p.literalString()
+	case c == '<':
+		if p.pos+1 < len(p.data) && p.data[p.pos+1] == '<' {
+			return p.dict()
+		}
+		return p.hexString()
+	case c == '[':
+		return p.array()
+	case c == '+' || c == '-' || c == '.' || isDigit(c):
+		return p.number(), nil
+	}
+
+	switch kw := p.keyword(); kw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	case "":
+		p.pos++
+		return nil, p.errorf("意外的字符 %q", c)
+	default:
+		return nil, p.errorf("意外的关键字 %q", kw)
+	}
+}
+
+// number 解析数字, 后面跟着 "g R" 时解析为引用. 格式错误的数字按0处理
+func (p *parser) number() Object {
+	kw := p.keyword()
+	if strings.ContainsAny(kw, ".eE") {
+		f, _ := strconv.ParseFloat(kw, 64)
+		return f
+	}
+	n, err := strconv.ParseInt(kw, 10, 64)
+	if err != nil {
+		f, _ := strconv.ParseFloat(kw, 64)
+		return f
+	}
+	if n >= 0 && strings.IndexByte("+-", kw[0]) < 0 {
+		pos := p.pos
+		if gen, ok := p.integer(); ok && p.keyword() == "R" {
+			return Ref{Num: int(n), Gen: gen}
+		}
+		p.pos = pos
+	}
+	return int(n)
+}
+
+// name 解析名称, 处理 #xx 转义
+func (p *parser) name() Name {
+	p.pos++ // "/"
+	var b []byte
+	for p.pos < len(p.data) && !isSpace(p.data[p.pos]) && !isDelim(p.data[p.pos]) {
+		c := p.data[p.pos]
+		if c == '#' && p.pos+2 < len(p.data) {
+			if v, err := strconv.ParseUint(string(p.data[p.pos+1:p.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				p.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		p.pos++
+	}
+	return Name(b)
+}
+
+// literalString 解析 (...) 字符串, 处理转义和嵌套括号
+func (p *parser) literalString() (Object, error) {
+	p.pos++ // "("
+	var b []byte
+	depth := 1
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return String(b), nil
+			}
+		case '\r':
+			// 字符串中的换行统一为 \n
+			if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+				p.pos++
+			}
+			c = '\n'
+		case '\\':
+			if p.pos >= len(p.data) {
+				return nil, errEOF
+			}
+			e := p.data[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// 反斜杠加换行表示续行
+				if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return nil, errEOF
+}
+
+// hexString 解析 <...> 字符串, 奇数个数字时末尾补0
+func (p *parser) hexString() (Object, error) {
+	p.pos++ // "<"
+	var b []byte
+	var hi byte
+	half := false
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		var v byte
+		switch {
+		case c == '>':
+			if half {
+				b = append(b, hi<<4)
+			}
+			return String(b), nil
+		case isSpace(c):
+			continue
+		case c >= '0' && c <= '9':
+			v = c - '0'
+		case c >= 'a' && c <= 'f':
+			v = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			v = c - 'A' + 10
+		default:
+			return nil, p.errorf("十六进制字符串中有无效字符 %q", c)
+		}
+		if half {
+			b = append(b, hi<<4|v)
+		} else {
+			hi = v
+		}
+		half = !half
+	}
+	return nil, errEOF
+}
+
+func (p *parser) array() (Object, error) {
+	if p.depth++; p.depth > maxDepth {
+		return nil, p.errorf("嵌套层数过多")
+	}
+	defer func() { p.depth-- }()
+
+	p.pos++ // "["
+	arr := Array{}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return nil, errEOF
+		}
+		if p.data[p.pos] == ']' {
+			p.pos++
+			return arr, nil
+		}
+		obj, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, obj)
+	}
+}
+
+func (p *parser) dict() (Object, error) {
+	if p.depth++; p.depth > maxDepth {
+		return nil, p.errorf("嵌套层数过多")
+	}
+	defer func() { p.depth-- }()
+
+	p.pos += 2 // "<<"
+	dict := Dict{}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return nil, errEOF
+		}
+		if p.data[p.pos] == '>' {
+			if p.pos+1 < len(p.data) && p.data[p.pos+1] == '>' {
+				p.pos += 2
+				return dict, nil
+			}
+			return nil, p.errorf("字典结束符无效")
+		}
+		if p.data[p.pos] != '/' {
+			return nil, p.errorf("字典的键不是名称")
+		}
+		key := p.name()
+		value, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		// 值为 null 等同于没有该键
+		if value != nil {
+			dict[key] = value
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Package pdf 实现打印服务需要的 PDF 读写功能, 只依赖标准库
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Object PDF 对象: nil, bool, int, float64, Name, String, Array, Dict, Ref 或 *Stream
+type Object interface{}
+
+// Name 名称对象, 不含开头的 "/"
+type Name string
+
+// String 字符串对象, 保存原始字节
+type String []byte
+
+// Array 数组对象
+type Array []Object
+
+// Dict 字典对象
+type Dict map[Name]Object
+
+// Ref 间接引用
+type Ref struct {
+	Num int
+	Gen int
+}
+
+// Stream 流对象, Data 为按 Filter 编码后的数据
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+// NewStream 创建流对象, compress 为 true 时使用 FlateDecode 压缩
+func NewStream(dict Dict, data []byte, compress bool) *Stream {
+	if dict == nil {
+		dict = Dict{}
+	}
+	if compress {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		data = buf.Bytes()
+		dict["Filter"] = Name("FlateDecode")
+	}
+	return &Stream{Dict: dict, Data: data}
+}
+
+// Rect 矩形 [llx lly urx ury]
+type Rect struct {
+	LLX float64 `json:"llx"`
+	LLY float64 `json:"lly"`
+	URX float64 `json:"urx"`
+	URY float64 `json:"ury"`
+}
+
+// Width 返回宽度
+func (r Rect) Width() float64 { return r.URX - r.LLX }
+
+// Height 返回高度
+func (r Rect) Height() float64 { return r.URY - r.LLY }
+
+// Array 转换为数组对象
+func (r Rect) Array() Array {
+	return Array{r.LLX, r.LLY, r.URX, r.URY}
+}
+
+// appendObject 序列化直接对象, 流对象需通过 Writer 写为间接对象
+func appendObject(buf []byte, obj Object) []byte {
+	switch v := obj.(type) {
+	case nil:
+		return append(buf, "null"...)
+	case bool:
+		return strconv.AppendBool(buf, v)
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(buf, v, 10)
+	case float64:
+		return append(buf, FormatNumber(v)...)
+	case Name:
+		return appendName(buf, v)
+	case String:
+		return appendString(buf, v)
+	case Array:
+		buf = append(buf, '[')
+		for i, item := range v {
+			if i > 0 {
+				buf = append(buf, ' ')
+			}
+			buf = appendObject(buf, item)
+		}
+		return append(buf, ']')
+	case Dict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		buf = append(buf, "<<"...)
+		for _, k := range keys {
+			buf = appendName(buf, Name(k))
+			buf = append(buf, ' ')
+			buf = appendObject(buf, v[Name(k)])
+		}
+		return append(buf, ">>"...)
+	case Ref:
+		return fmt.Appendf(buf, "%d %d R", v.Num, v.Gen)
+	}
+	panic(fmt.Sprintf("pdf: 无法序列化 %T", obj))
+}
+
+// FormatNumber 格式化实数, 最多保留4位小数
+func FormatNumber(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 4, 64)
+	s = strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+func appendName(buf []byte, name Name) []byte {
+	buf = append(buf, '/')
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < '!' || c > '~' || bytes.IndexByte([]byte("#()<>[]{}/%"), c) >= 0 {
+			buf = fmt.Appendf(buf, "#%02X", c)
+		} else {
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+func appendString(buf []byte, s String) []byte {
+	buf = append(buf, '(')
+	buf = append(buf, EscapeString(s)...)
+	return append(buf, ')')
+}
+
+// EscapeString 转义字面字符串中的特殊字符, 结果不含两侧括号
+func EscapeString(s []byte) string {
+	var buf []byte
+	for _, c := range s {
+		switch c {
+		case '(', ')', '\\':
+			buf = append(buf, '\\', c)
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return string(buf)
+}
@@ -0,0 +1,135 @@
+package pdf
+
+import (
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// DefaultMediaBox 页面没有 MediaBox 时使用的尺寸 (Letter)
+var DefaultMediaBox = Rect{URX: 612, URY: 792}
+
+// 页面可以从上级 Pages 节点继承的属性
+var inheritable = []Name{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// Page 页面对象, Dict 中已合并从上级节点继承的属性
+type Page struct {
+	Ref  Ref
+	Dict Dict
+}
+
+// MediaBox 返回页面的 MediaBox, 没有或无效时返回 DefaultMediaBox
+func (p Page) MediaBox() Rect {
+	if r, ok := RectFromArray(p.Dict["MediaBox"]); ok && r.Width() > 0 && r.Height() > 0 {
+		return r
+	}
+	return DefaultMediaBox
+}
+
+// Rotate 返回页面的旋转角度, 取值为 0、90、180 或 270
+func (p Page) Rotate() int {
+	rotate := intOr(p.Dict["Rotate"], 0) % 360
+	if rotate < 0 {
+		rotate += 360
+	}
+	return rotate / 90 * 90
+}
+
+// Pages 按顺序返回全部页面. 页面树有错误时跳过出错的节点, 并记录为损坏
+func (r *Reader) Pages() ([]Page, error) {
+	root, ok := r.Catalog()["Pages"].(Ref)
+	if !ok {
+		return nil, fmt.Errorf("pdf: 文档没有页面树")
+	}
+	var pages []Page
+	visited := make(map[int]bool)
+	var walk func(ref Ref, inherited Dict, depth int)
+	walk = func(ref Ref, inherited Dict, depth int) {
+		if visited[ref.Num] {
+			r.problem("页面树循环引用对象 %d", ref.Num)
+			return
+		}
+		visited[ref.Num] = true
+		node, ok := r.Resolve(ref).(Dict)
+		if !ok {
+			r.problem("页面树节点 %d 无效", ref.Num)
+			return
+		}
+
+		attrs := make(Dict, len(inherited))
+		for k, v := range inherited {
+			attrs[k] = v
+		}
+		for _, k := range inheritable {
+			if v, ok := node[k]; ok {
+				attrs[k] = r.Resolve(v)
+			}
+		}
+
+		kids, isNode := r.Resolve(node["Kids"]).(Array)
+		if node["Type"] == Name("Page") || !isNode {
+			page := make(Dict, len(node)+len(attrs))
+			for k, v := range node {
+				page[k] = v
+			}
+			for k, v := range attrs {
+				page[k] = v
+			}
+			pages = append(pages, Page{Ref: ref, Dict: page})
+			return
+		}
+		if depth >= maxResolve {
+			r.problem("页面树层数过多")
+			return
+		}
+		for _, kid := range kids {
+			if kidRef, ok := kid.(Ref); ok {
+				walk(kidRef, attrs, depth+1)
+			} else {
+				r.problem("页面树节点 %d 的子节点不是引用", ref.Num)
+			}
+		}
+	}
+	walk(root, nil, 0)
+
+	rootNode, _ := r.Resolve(root).(Dict)
+	if count, ok := rootNode["Count"].(int); ok && count != len(pages) {
+		r.problem("页面树记录 %d 页, 实际 %d 页", count, len(pages))
+	}
+	return pages, nil
+}
+
+// Info 返回文档信息字典, 没有时返回 nil
+func (r *Reader) Info() Dict {
+	d, _ := r.resolveDict(r.trailer["Info"])
+	return d
+}
+
+// pdfDocEncoding PDFDocEncoding 中与 Latin-1 不同的 0x80-0x9f 区域
+var pdfDocEncoding = [32]rune{
+	'•', '†', '‡', '…', '—', '–', 'ƒ', '⁄', '‹', '›', '−', '‰', '„', '“', '”', '‘',
+	'’', '‚', '™', 'ﬁ', 'ﬂ', 'Ł', 'Œ', 'Š', 'Ÿ', 'Ž', 'ı', 'ł', 'œ', 'š', 'ž', '�',
+}
+
+// DecodeTextString 解码文档信息等处的文本字符串, 支持 UTF-16 (带 BOM)、UTF-8 (带 BOM) 和 PDFDocEncoding
+func DecodeTextString(s []byte) string {
+	switch {
+	case len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff:
+		units := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(units))
+	case len(s) >= 3 && s[0] == 0xef && s[1] == 0xbb && s[2] == 0xbf && utf8.Valid(s[3:]):
+		return string(s[3:])
+	}
+	runes := make([]rune, 0, len(s))
+	for _, c := range s {
+		if c >= 0x80 && c < 0xa0 {
+			runes = append(runes, pdfDocEncoding[c-0x80])
+		} else {
+			runes = append(runes, rune(c))
+		}
+	}
+	return string(runes)
+}
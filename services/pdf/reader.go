@@ -0,0 +1,661 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// ErrNotPDF 文件不是 PDF
+var ErrNotPDF = errors.New("pdf: 不是PDF文件")
+
+// 引用链和页面树的最大深度
+const maxResolve = 32
+
+// xrefEntry 交叉引用表中的一项
+type xrefEntry struct {
+	free bool
+	// 不在对象流中时为文件偏移, 否则为对象流的编号
+	offset int
+	gen    int
+	// 在对象流中的序号, 不在对象流中时为 -1
+	index int
+}
+
+// objectStream 已解析的对象流
+type objectStream struct {
+	data    []byte
+	offsets map[int]int
+}
+
+// Reader 读取整个 PDF 文件. 交叉引用表损坏时扫描全文重建, 并记录为损坏.
+// 加密文档只能用空的用户密码解密
+type Reader struct {
+	data    []byte
+	version string
+	xref    map[int]xrefEntry
+	trailer Dict
+
+	// 交叉引用表已读完, 此后才能解析流长度等引用
+	xrefLoaded bool
+	// 重建过交叉引用表
+	rebuilt  bool
+	problems []string
+
+	encrypted  bool
+	encryptNum int
+	crypt      *securityHandler
+	cryptErr   error
+
+	cache   map[int]Object
+	objStms map[int]*objectStream
+	// 重建后尚未建立索引的对象流
+	pendingStms []int
+}
+
+// NewReader 解析 PDF 文件, 只有完全无法识别时才返回错误
+func NewReader(data []byte) (*Reader, error) {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	start := bytes.Index(head, []byte("%PDF-"))
+	if start < 0 {
+		return nil, ErrNotPDF
+	}
+	// 文件头之前有其他数据时, 偏移量通常相对于文件头
+	data = data[start:]
+
+	r := &Reader{data: data, version: "1.0"}
+	if m := regexp.MustCompile(`^%PDF-(\d\.\d)`).FindSubmatch(data); m != nil {
+		r.version = string(m[1])
+	}
+	r.reset()
+	if err := r.readXref(); err != nil {
+		r.problem("交叉引用表损坏: %v", err)
+		r.rebuild()
+	}
+	r.xrefLoaded = true
+	r.initEncryption()
+	if _, ok := r.resolveDict(r.trailer["Root"]); !ok && !r.rebuilt {
+		r.problem("找不到文档目录")
+		r.rebuild()
+		r.initEncryption()
+	}
+	if _, ok := r.resolveDict(r.trailer["Root"]); !ok {
+		return nil, fmt.Errorf("pdf: 文件已损坏, 找不到文档目录")
+	}
+	return r, nil
+}
+
+func (r *Reader) reset() {
+	r.xref = make(map[int]xrefEntry)
+	r.xrefLoaded = false
+	r.trailer = Dict{}
+	r.cache = make(map[int]Object)
+	r.objStms = make(map[int]*objectStream)
+	r.pendingStms = nil
+}
+
+func (r *Reader) problem(format string, args ...interface{}) {
+	r.problems = append(r.problems, fmt.Sprintf(format, args...))
+}
+
+// Version 返回文件头中的版本号, 文档目录中的 Version 更高时以其为准
+func (r *Reader) Version() string {
+	if catalog := r.Catalog(); catalog != nil {
+		if v, ok := catalog["Version"].(Name); ok && string(v) > r.version {
+			return string(v)
+		}
+	}
+	return r.version
+}
+
+// Trailer 返回文件尾字典
+func (r *Reader) Trailer() Dict {
+	return r.trailer
+}
+
+// Catalog 返回文档目录字典
+func (r *Reader) Catalog() Dict {
+	d, _ := r.resolveDict(r.trailer["Root"])
+	return d
+}
+
+// Damaged 判断文件是否有结构错误, Problems 返回具体问题
+func (r *Reader) Damaged() bool {
+	return len(r.problems) > 0
+}
+
+// Problems 返回读取过程中发现的结构问题
+func (r *Reader) Problems() []string {
+	return r.problems
+}
+
+// Encrypted 判断文档是否加密
+func (r *Reader) Encrypted() bool {
+	return r.encrypted
+}
+
+// CryptError 返回无法解密的原因, 可以解密或未加密时返回 nil
+func (r *Reader) CryptError() error {
+	return r.cryptErr
+}
+
+// Resolve 跟随引用返回实际对象, 引用不存在的对象时返回 nil
+func (r *Reader) Resolve(obj Object) Object {
+	for i := 0; i < maxResolve; i++ {
+		ref, ok := obj.(Ref)
+		if !ok {
+			return obj
+		}
+		obj = r.object(ref)
+	}
+	return nil
+}
+
+func (r *Reader) resolveDict(obj Object) (Dict, bool) {
+	switch v := r.Resolve(obj).(type) {
+	case Dict:
+		return v, true
+	case *Stream:
+		return v.Dict, true
+	}
+	return nil, false
+}
+
+// object 读取间接对象, 读取失败且未重建过时重建交叉引用表后再试一次
+func (r *Reader) object(ref Ref) Object {
+	if obj, ok := r.cache[ref.Num]; ok {
+		return obj
+	}
+	// 先占位, 防止对象流或流长度循环引用
+	r.cache[ref.Num] = nil
+
+	e, ok := r.xref[ref.Num]
+	if !ok && len(r.pendingStms) > 0 {
+		r.indexObjectStreams()
+		e, ok = r.xref[ref.Num]
+	}
+	if !ok || e.free {
+		return nil
+	}
+
+	var obj Object
+	var err error
+	if e.index >= 0 {
+		obj, err = r.streamObject(e.offset, e.index, ref.Num)
+	} else {
+		var num, gen int
+		num, gen, obj, err = r.readIndirect(e.offset)
+		if err == nil && num != ref.Num {
+			err = fmt.Errorf("偏移 %d 处是对象 %d", e.offset, num)
+		}
+		if err == nil && r.crypt != nil && num != r.encryptNum {
+			obj = r.crypt.decryptObject(obj, num, gen)
+		}
+	}
+	if err != nil {
+		if !r.rebuilt {
+			r.problem("读取对象 %d 失败: %v", ref.Num, err)
+			r.rebuild()
+			r.initEncryption()
+			return r.object(ref)
+		}
+		return nil
+	}
+	r.cache[ref.Num] = obj
+	return obj
+}
+
+// readIndirect 读取 offset 处的 "n g obj ... endobj"
+func (r *Reader) readIndirect(offset int) (int, int, Object, error) {
+	if offset < 0 || offset >= len(r.data) {
+		return 0, 0, nil, fmt.Errorf("偏移 %d 超出文件范围", offset)
+	}
+	p := &parser{data: r.data, pos: offset}
+	num, ok1 := p.integer()
+	gen, ok2 := p.integer()
+	if !ok1 || !ok2 || p.keyword() != "obj" {
+		return 0, 0, nil, fmt.Errorf("偏移 %d 处不是对象", offset)
+	}
+	obj, err := p.object()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if dict, ok := obj.(Dict); ok && p.peekKeyword() == "stream" {
+		p.keyword()
+		data, err := r.streamData(p, dict)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		obj = &Stream{Dict: dict, Data: data}
+	}
+	return num, gen, obj, nil
+}
+
+// streamData 读取 stream 关键字之后的原始数据. Length 错误时以 endstream 为准
+func (r *Reader) streamData(p *parser, dict Dict) ([]byte, error) {
+	// stream 后是 \r\n 或 \n
+	if p.pos < len(p.data) && p.data[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+		p.pos++
+	}
+	start := p.pos
+
+	length := -1
+	switch v := dict["Length"].(type) {
+	case int:
+		length = v
+	case Ref:
+		// 读取交叉引用表时还不能解析引用
+		if r.xrefLoaded {
+			length = intOr(r.Resolve(v), -1)
+		}
+	}
+	if length >= 0 && start+length <= len(p.data) {
+		q := &parser{data: p.data, pos: start + length}
+		if q.keyword() == "endstream" {
+			return p.data[start : start+length], nil
+		}
+	}
+
+	end := bytes.Index(p.data[start:], []byte("endstream"))
+	if end < 0 {
+		return nil, fmt.Errorf("流没有结束标记")
+	}
+	if length >= 0 {
+		r.problem("偏移 %d 处的流长度错误", start)
+	}
+	data := p.data[start : start+end]
+	// 去掉 endstream 前的换行
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	data = bytes.TrimSuffix(data, []byte("\r"))
+	return data, nil
+}
+
+// Decode 返回流解码后的数据, 依次应用 Filter 中的过滤器
+func (r *Reader) Decode(s *Stream) ([]byte, error) {
+	var filters []Name
+	var parms []Dict
+	switch f := r.Resolve(s.Dict["Filter"]).(type) {
+	case Name:
+		filters = []Name{f}
+		d, _ := r.resolveDict(s.Dict["DecodeParms"])
+		parms = []Dict{d}
+	case Array:
+		p, _ := r.Resolve(s.Dict["DecodeParms"]).(Array)
+		for i, item := range f {
+			name, _ := r.Resolve(item).(Name)
+			filters = append(filters, name)
+			var d Dict
+			if i < len(p) {
+				d, _ = r.resolveDict(p[i])
+			}
+			parms = append(parms, d)
+		}
+	}
+
+	data := s.Data
+	for i, f := range filters {
+		var err error
+		if data, err = decodeFilter(data, f, parms[i]); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// streamObject 从对象流 stmNum 中读取第 index 个对象
+func (r *Reader) streamObject(stmNum, index, num int) (Object, error) {
+	stm, ok := r.objStms[stmNum]
+	if !ok {
+		var err error
+		if stm, err = r.loadObjectStream(stmNum); err != nil {
+			return nil, err
+		}
+	}
+	offset, ok := stm.offsets[num]
+	if !ok {
+		return nil, fmt.Errorf("对象流 %d 中没有对象 %d", stmNum, num)
+	}
+	p := &parser{data: stm.data, pos: offset}
+	return p.object()
+}
+
+func (r *Reader) loadObjectStream(stmNum int) (*objectStream, error) {
+	s, ok := r.Resolve(Ref{Num: stmNum}).(*Stream)
+	if !ok {
+		return nil, fmt.Errorf("对象流 %d 不存在", stmNum)
+	}
+	data, err := r.Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("对象流 %d: %v", stmNum, err)
+	}
+	n := intOr(s.Dict["N"], 0)
+	first := intOr(s.Dict["First"], 0)
+	stm := &objectStream{data: data, offsets: make(map[int]int, n)}
+	p := &parser{data: data}
+	for i := 0; i < n; i++ {
+		num, ok1 := p.integer()
+		off, ok2 := p.integer()
+		if !ok1 || !ok2 {
+			break
+		}
+		stm.offsets[num] = first + off
+	}
+	r.objStms[stmNum] = stm
+	return stm, nil
+}
+
+// readXref 从 startxref 开始沿 Prev 读取全部交叉引用表, 新的表项优先
+func (r *Reader) readXref() error {
+	i := bytes.LastIndex(r.data, []byte("startxref"))
+	if i < 0 {
+		return fmt.Errorf("缺少 startxref")
+	}
+	p := &parser{data: r.data, pos: i + len("startxref")}
+	offset, ok := p.integer()
+	if !ok {
+		return fmt.Errorf("startxref 无效")
+	}
+
+	seen := make(map[int]bool)
+	for {
+		if seen[offset] {
+			return fmt.Errorf("交叉引用表循环引用")
+		}
+		seen[offset] = true
+
+		entries, trailer, err := r.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+		// 混合文件: XRefStm 中的表项优先于同一节的交叉引用表
+		if stmOffset, ok := trailer["XRefStm"].(int); ok && !seen[stmOffset] {
+			seen[stmOffset] = true
+			if stmEntries, _, err := r.readXrefSection(stmOffset); err == nil {
+				r.addEntries(stmEntries)
+			}
+		}
+		r.addEntries(entries)
+		for k, v := range trailer {
+			if _, ok := r.trailer[k]; !ok {
+				r.trailer[k] = v
+			}
+		}
+
+		prev, ok := trailer["Prev"].(int)
+		if !ok {
+			break
+		}
+		offset = prev
+	}
+	delete(r.trailer, "Prev")
+	delete(r.trailer, "XRefStm")
+	if r.trailer["Root"] == nil {
+		return fmt.Errorf("文件尾缺少 Root")
+	}
+	return nil
+}
+
+func (r *Reader) addEntries(entries map[int]xrefEntry) {
+	for num, e := range entries {
+		if _, ok := r.xref[num]; !ok {
+			r.xref[num] = e
+		}
+	}
+}
+
+// readXrefSection 读取 offset 处的交叉引用表或交叉引用流
+func (r *Reader) readXrefSection(offset int) (map[int]xrefEntry, Dict, error) {
+	if offset < 0 || offset >= len(r.data) {
+		return nil, nil, fmt.Errorf("交叉引用表偏移 %d 超出文件范围", offset)
+	}
+	p := &parser{data: r.data, pos: offset}
+	if p.peekKeyword() == "xref" {
+		p.keyword()
+		return r.readXrefTable(p)
+	}
+
+	_, _, obj, err := r.readIndirect(offset)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, ok := obj.(*Stream)
+	if !ok || s.Dict["Type"] != Name("XRef") {
+		return nil, nil, fmt.Errorf("偏移 %d 处不是交叉引用表", offset)
+	}
+	return r.readXrefStream(s)
+}
+
+func (r *Reader) readXrefTable(p *parser) (map[int]xrefEntry, Dict, error) {
+	entries := make(map[int]xrefEntry)
+	for {
+		if p.peekKeyword() == "trailer" {
+			p.keyword()
+			obj, err := p.object()
+			if err != nil {
+				return nil, nil, err
+			}
+			trailer, ok := obj.(Dict)
+			if !ok {
+				return nil, nil, fmt.Errorf("文件尾不是字典")
+			}
+			return entries, trailer, nil
+		}
+		start, ok1 := p.integer()
+		count, ok2 := p.integer()
+		if !ok1 || !ok2 {
+			return nil, nil, fmt.Errorf("交叉引用表格式错误")
+		}
+		for i := 0; i < count; i++ {
+			offset, ok1 := p.integer()
+			gen, ok2 := p.integer()
+			kind := p.keyword()
+			if !ok1 || !ok2 || (kind != "n" && kind != "f") {
+				return nil, nil, fmt.Errorf("交叉引用表项格式错误")
+			}
+			if _, ok := entries[start+i]; !ok {
+				entries[start+i] = xrefEntry{free: kind == "f", offset: offset, gen: gen, index: -1}
+			}
+		}
+	}
+}
+
+func (r *Reader) readXrefStream(s *Stream) (map[int]xrefEntry, Dict, error) {
+	data, err := r.Decode(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	w, _ := s.Dict["W"].(Array)
+	if len(w) != 3 {
+		return nil, nil, fmt.Errorf("交叉引用流 W 无效")
+	}
+	var widths [3]int
+	rowLen := 0
+	for i := range widths {
+		widths[i] = intOr(w[i], -1)
+		if widths[i] < 0 || widths[i] > 8 {
+			return nil, nil, fmt.Errorf("交叉引用流 W 无效")
+		}
+		rowLen += widths[i]
+	}
+	if rowLen == 0 {
+		return nil, nil, fmt.Errorf("交叉引用流 W 无效")
+	}
+	index, _ := s.Dict["Index"].(Array)
+	if index == nil {
+		index = Array{0, intOr(s.Dict["Size"], 0)}
+	}
+
+	field := func(row []byte, i int) int {
+		start := 0
+		for j := 0; j < i; j++ {
+			start += widths[j]
+		}
+		v := 0
+		for _, b := range row[start : start+widths[i]] {
+			v = v<<8 | int(b)
+		}
+		return v
+	}
+
+	entries := make(map[int]xrefEntry)
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, count := intOr(index[i], 0), intOr(index[i+1], 0)
+		for j := 0; j < count && pos+rowLen <= len(data); j++ {
+			row := data[pos : pos+rowLen]
+			pos += rowLen
+			kind := 1
+			if widths[0] > 0 {
+				kind = field(row, 0)
+			}
+			var e xrefEntry
+			switch kind {
+			case 0:
+				e = xrefEntry{free: true, index: -1}
+			case 1:
+				e = xrefEntry{offset: field(row, 1), gen: field(row, 2), index: -1}
+			case 2:
+				e = xrefEntry{offset: field(row, 1), index: field(row, 2)}
+			default:
+				// 未知类型按空对象处理
+				e = xrefEntry{free: true, index: -1}
+			}
+			if _, ok := entries[start+j]; !ok {
+				entries[start+j] = e
+			}
+		}
+	}
+	return entries, s.Dict, nil
+}
+
+var objHeader = regexp.MustCompile(`(\d+)[\x00\t\n\f\r ]+(\d+)[\x00\t\n\f\r ]+obj\b`)
+
+// rebuild 扫描全文中的 "n g obj" 重建交叉引用表, 同一编号以最后出现的为准
+func (r *Reader) rebuild() {
+	r.rebuilt = true
+	r.reset()
+
+	for _, m := range objHeader.FindAllSubmatchIndex(r.data, -1) {
+		// 必须位于行首或分隔符之后
+		if m[0] > 0 && !isSpace(r.data[m[0]-1]) && !isDelim(r.data[m[0]-1]) {
+			continue
+		}
+		num, _ := strconv.Atoi(string(r.data[m[2]:m[3]]))
+		gen, _ := strconv.Atoi(string(r.data[m[4]:m[5]]))
+		r.xref[num] = xrefEntry{offset: m[0], gen: gen, index: -1}
+	}
+	r.xrefLoaded = true
+
+	// 合并所有 trailer 字典和交叉引用流字典, 靠后的优先
+	var trailers []Dict
+	for pos := 0; ; {
+		i := bytes.Index(r.data[pos:], []byte("trailer"))
+		if i < 0 {
+			break
+		}
+		p := &parser{data: r.data, pos: pos + i + len("trailer")}
+		if obj, err := p.object(); err == nil {
+			if d, ok := obj.(Dict); ok {
+				trailers = append(trailers, d)
+			}
+		}
+		pos += i + len("trailer")
+	}
+	var catalog Ref
+	catalogOffset := -1
+	for num, e := range r.xref {
+		_, _, obj, err := r.readIndirect(e.offset)
+		if err != nil {
+			continue
+		}
+		var dict Dict
+		switch v := obj.(type) {
+		case Dict:
+			dict = v
+		case *Stream:
+			dict = v.Dict
+		}
+		switch dict["Type"] {
+		case Name("XRef"):
+			trailers = append(trailers, dict)
+		case Name("ObjStm"):
+			r.pendingStms = append(r.pendingStms, num)
+		case Name("Catalog"):
+			// 有多个文档目录时取最后出现的
+			if e.offset > catalogOffset {
+				catalog, catalogOffset = Ref{Num: num, Gen: e.gen}, e.offset
+			}
+		}
+	}
+	for i := len(trailers) - 1; i >= 0; i-- {
+		for _, k := range []Name{"Root", "Info", "Encrypt", "ID"} {
+			if v, ok := trailers[i][k]; ok {
+				if _, exists := r.trailer[k]; !exists {
+					r.trailer[k] = v
+				}
+			}
+		}
+	}
+	if _, ok := r.resolveDict(r.trailer["Root"]); !ok && catalogOffset >= 0 {
+		r.trailer["Root"] = catalog
+	}
+}
+
+// indexObjectStreams 为重建后找到的对象流中的对象建立索引, 文件中直接出现的对象优先
+func (r *Reader) indexObjectStreams() {
+	pending := r.pendingStms
+	r.pendingStms = nil
+	for _, num := range pending {
+		stm, err := r.loadObjectStream(num)
+		if err != nil {
+			continue
+		}
+		for objNum := range stm.offsets {
+			if _, ok := r.xref[objNum]; !ok {
+				r.xref[objNum] = xrefEntry{offset: num, index: 0}
+			}
+		}
+	}
+}
+
+// initEncryption 根据文件尾的 Encrypt 设置解密
+func (r *Reader) initEncryption() {
+	r.encrypted, r.crypt, r.cryptErr, r.encryptNum = false, nil, nil, -1
+	if r.trailer["Encrypt"] == nil {
+		return
+	}
+	r.encrypted = true
+	if ref, ok := r.trailer["Encrypt"].(Ref); ok {
+		r.encryptNum = ref.Num
+	}
+	enc, ok := r.resolveDict(r.trailer["Encrypt"])
+	if !ok {
+		r.cryptErr = fmt.Errorf("pdf: 加密字典无效")
+		return
+	}
+	var id []byte
+	if ids, ok := r.trailer["ID"].(Array); ok && len(ids) > 0 {
+		id, _ = ids[0].(String)
+	}
+	h, err := newSecurityHandler(enc, id)
+	if err != nil {
+		r.cryptErr = err
+		return
+	}
+	r.crypt = h
+	// 加密字典之外已缓存的对象是未解密的, 需要重新读取
+	for num := range r.cache {
+		if num != r.encryptNum {
+			delete(r.cache, num)
+		}
+	}
+	r.objStms = make(map[int]*objectStream)
+}
@@ -0,0 +1,423 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testContent 测试文档第一页的内容流
+const testContent = "0 0 m 100 100 l S"
+
+// testObjects 两页文档的对象, 编号从 1 开始: 第二页旋转 90 度并有自己的 MediaBox,
+// 第一页从页面树继承 A4 尺寸并引用字体 8
+func testObjects(content string) []string {
+	return []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /MediaBox [0 0 595 842] >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R /Resources << /Font << /F1 8 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Rotate 90 /MediaBox [0 0 300 400] >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /Title (Report) /Author (zhangsan) >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+}
+
+// writeObjects 写出文件头和对象, 返回内容和每个对象的偏移 (下标 0 对应对象 1), 跳过空对象
+func writeObjects(objs []string) ([]byte, []int) {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objs))
+	for i, obj := range objs {
+		if obj == "" {
+			continue
+		}
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	return buf.Bytes(), offsets
+}
+
+// buildPDF 生成使用交叉引用表的文件, trailer 为文件尾字典中 Size 之外的内容
+func buildPDF(objs []string, trailer string) []byte {
+	data, offsets := writeObjects(objs)
+	buf := bytes.NewBuffer(data)
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d %s >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, trailer, xref)
+	return buf.Bytes()
+}
+
+func inspect(t *testing.T, data []byte) *Info {
+	t.Helper()
+	info, err := Inspect(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+// checkTestPages 检查 testObjects 的两页
+func checkTestPages(t *testing.T, info *Info) {
+	t.Helper()
+	want := []PageBox{
+		{MediaBox: Rect{URX: 595, URY: 842}},
+		{MediaBox: Rect{URX: 300, URY: 400}, Rotate: 90},
+	}
+	if info.Pages != 2 || len(info.PageBoxes) != 2 || info.PageBoxes[0] != want[0] || info.PageBoxes[1] != want[1] {
+		t.Fatalf("pages = %d, boxes = %+v", info.Pages, info.PageBoxes)
+	}
+}
+
+func TestInspectXrefTable(t *testing.T) {
+	info := inspect(t, buildPDF(testObjects(testContent), "/Root 1 0 R /Info 6 0 R"))
+	checkTestPages(t, info)
+	if info.Version != "1.7" || info.Title != "Report" || info.Author != "zhangsan" {
+		t.Errorf("info = %+v", info)
+	}
+	if info.Damaged || info.Encrypted {
+		t.Errorf("damaged = %v, encrypted = %v, problems = %v", info.Damaged, info.Encrypted, info.Problems)
+	}
+}
+
+// buildXrefStreamPDF 生成把两个页面对象放在对象流中、使用交叉引用流的文件
+func buildXrefStreamPDF(t *testing.T) []byte {
+	t.Helper()
+	objs := testObjects(testContent)
+	// 页面 3、4 只出现在对象流 9 中
+	page3, page4 := objs[2], objs[3]
+	header := fmt.Sprintf("3 0 4 %d ", len(page3)+1)
+	stm := header + page3 + "\n" + page4
+	objs[2], objs[3] = "", ""
+	objs = append(objs, fmt.Sprintf("<< /Type /ObjStm /N 2 /First %d /Length %d >>\nstream\n%s\nendstream",
+		len(header), len(stm), stm))
+
+	data, offsets := writeObjects(objs)
+	buf := bytes.NewBuffer(data)
+	xrefNum := len(objs) + 1
+	xrefOffset := buf.Len()
+	// W [1 4 2]: 类型, 偏移或对象流编号, 代数或在对象流中的序号
+	var rows []byte
+	row := func(kind byte, field2 uint32, field3 uint16) {
+		rows = append(rows, kind)
+		rows = binary.BigEndian.AppendUint32(rows, field2)
+		rows = binary.BigEndian.AppendUint16(rows, field3)
+	}
+	row(0, 0, 0xffff)
+	for i, off := range offsets {
+		switch i + 1 {
+		case 3:
+			row(2, 9, 0)
+		case 4:
+			row(2, 9, 1)
+		default:
+			row(1, uint32(off), 0)
+		}
+	}
+	row(1, uint32(xrefOffset), 0)
+	fmt.Fprintf(buf, "%d 0 obj\n<< /Type /XRef /Size %d /W [1 4 2] /Root 1 0 R /Info 6 0 R /Length %d >>\nstream\n",
+		xrefNum, xrefNum+1, len(rows))
+	buf.Write(rows)
+	fmt.Fprintf(buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+	return buf.Bytes()
+}
+
+func TestInspectXrefStream(t *testing.T) {
+	info := inspect(t, buildXrefStreamPDF(t))
+	checkTestPages(t, info)
+	if info.Damaged || info.Title != "Report" {
+		t.Errorf("title = %q, problems = %v", info.Title, info.Problems)
+	}
+}
+
+func TestInspectBrokenXref(t *testing.T) {
+	valid := buildPDF(testObjects(testContent), "/Root 1 0 R /Info 6 0 R")
+	// 在第一个对象之前插入数据, 交叉引用表中的偏移全部错位
+	shifted := bytes.Replace(valid, []byte("1 0 obj"), []byte("% padding\n1 0 obj"), 1)
+	i := bytes.Index(valid, []byte("xref\n"))
+	noXref := append(valid[:i:i], "trailer\n<< /Root 1 0 R /Info 6 0 R >>\n%%EOF\n"...)
+	badStartxref := bytes.Replace(valid, []byte("startxref\n"), []byte("startxref\n999999"), 1)
+	// 交叉引用流的字段宽度与数据不符时扫描全文, 从对象流中找回页面
+	brokenStream := bytes.Replace(buildXrefStreamPDF(t), []byte("/W [1 4 2]"), []byte("/W [1 4 3]"), 1)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"shifted offsets", shifted},
+		{"missing xref", noXref},
+		{"bad startxref", badStartxref},
+		{"broken xref stream", brokenStream},
+	}
+	for _, tt := range tests {
+		info := inspect(t, tt.data)
+		if !info.Damaged || len(info.Problems) == 0 {
+			t.Errorf("%s: 应记录为损坏", tt.name)
+		}
+		if info.Pages != 2 || info.Title != "Report" {
+			t.Errorf("%s: pages = %d, title = %q, problems = %v", tt.name, info.Pages, info.Title, info.Problems)
+		}
+	}
+}
+
+func TestInspectInvalid(t *testing.T) {
+	if _, err := Inspect([]byte("<html>not a pdf</html>")); !errors.Is(err, ErrNotPDF) {
+		t.Errorf("非 PDF: err = %v", err)
+	}
+
+	// 找不到文档目录时返回页数为0的结果
+	info := inspect(t, []byte("%PDF-1.4\n1 0 obj\n<< /Type /Pages /Kids [] /Count 0 >>\nendobj\n%%EOF\n"))
+	if !info.Damaged || info.Pages != 0 {
+		t.Errorf("info = %+v", info)
+	}
+
+	// 页面树循环引用和页数不符
+	objs := testObjects(testContent)
+	objs[1] = "<< /Type /Pages /Kids [3 0 R 2 0 R] /Count 5 /MediaBox [0 0 595 842] >>"
+	info = inspect(t, buildPDF(objs, "/Root 1 0 R"))
+	if info.Pages != 1 || !info.Damaged || len(info.Problems) != 2 {
+		t.Errorf("pages = %d, problems = %v", info.Pages, info.Problems)
+	}
+}
+
+// testEncryption 按标准安全处理程序 (空用户密码) 加密测试文档
+type testEncryption struct {
+	key []byte
+	// AESV2 或 AESV3 时为 true, 否则为 RC4
+	aes    bool
+	aes256 bool
+}
+
+var testID = []byte("0123456789abcdef")
+
+// newLegacyEncryption 生成 R3 (RC4 128 位) 或 R4 (AESV2) 的加密, o 为任意的 32 字节
+func newLegacyEncryption(rev int, dict string, useAES bool) (*testEncryption, string) {
+	o := bytes.Repeat([]byte{0x5a}, 32)
+	const p = -3904
+	m := md5.New()
+	m.Write(passwordPad)
+	m.Write(o)
+	binary.Write(m, binary.LittleEndian, int32(p))
+	m.Write(testID)
+	key := m.Sum(nil)
+	for i := 0; i < 50; i++ {
+		sum := md5.Sum(key)
+		key = sum[:]
+	}
+
+	sum := md5.Sum(append(append([]byte(nil), passwordPad...), testID...))
+	u := rc4Crypt(key, sum[:])
+	for i := 1; i <= 19; i++ {
+		k := make([]byte, len(key))
+		for j := range key {
+			k[j] = key[j] ^ byte(i)
+		}
+		u = rc4Crypt(k, u)
+	}
+	u = append(u, make([]byte, 16)...)
+
+	enc := fmt.Sprintf("<< /Filter /Standard /R %d /P %d /O <%x> /U <%x> %s >>", rev, p, o, u, dict)
+	return &testEncryption{key: key, aes: useAES}, enc
+}
+
+// newAES256Encryption 生成 R6 (AESV3) 的加密, 文件密钥为固定值
+func newAES256Encryption() (*testEncryption, string) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	validationSalt, keySalt := []byte("vsalt123"), []byte("ksalt123")
+	u := append(append(hashR6(nil, validationSalt, nil), validationSalt...), keySalt...)
+	block, _ := aes.NewCipher(hashR6(nil, keySalt, nil))
+	ue := make([]byte, 32)
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(ue, key)
+
+	enc := fmt.Sprintf("<< /Filter /Standard /V 5 /R 6 /Length 256 /P -3904 /O <%x> /U <%x> /OE <%x> /UE <%x> "+
+		"/CF << /StdCF << /CFM /AESV3 /Length 32 >> >> /StmF /StdCF /StrF /StdCF >>",
+		bytes.Repeat([]byte{1}, 48), u, bytes.Repeat([]byte{2}, 32), ue)
+	return &testEncryption{key: key, aes: true, aes256: true}, enc
+}
+
+// encrypt 加密对象 num 中的数据
+func (e *testEncryption) encrypt(num int, data []byte) []byte {
+	key := e.key
+	if !e.aes256 {
+		m := md5.New()
+		m.Write(e.key)
+		m.Write([]byte{byte(num), byte(num >> 8), byte(num >> 16), 0, 0})
+		if e.aes {
+			m.Write([]byte("sAlT"))
+		}
+		key = m.Sum(nil)[:min(len(e.key)+5, 16)]
+	}
+	if !e.aes {
+		return rc4Crypt(key, data)
+	}
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	plain := append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	iv := []byte("fedcba9876543210")
+	block, _ := aes.NewCipher(key)
+	out := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, plain)
+	return append(iv, out...)
+}
+
+// buildEncryptedPDF 加密内容流 (对象 5) 和文档信息中的字符串 (对象 6), 加密字典为对象 9
+func buildEncryptedPDF(e *testEncryption, encDict string) []byte {
+	objs := testObjects(testContent)
+	content := e.encrypt(5, []byte(testContent))
+	objs[4] = fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content)
+	objs[5] = fmt.Sprintf("<< /Title <%x> /Author <%x> >>",
+		e.encrypt(6, []byte("Report")), e.encrypt(6, []byte("zhangsan")))
+	objs = append(objs, encDict)
+	id := hex.EncodeToString(testID)
+	return buildPDF(objs, fmt.Sprintf("/Root 1 0 R /Info 6 0 R /Encrypt 9 0 R /ID [<%s> <%s>]", id, id))
+}
+
+func TestReaderEncrypted(t *testing.T) {
+	rc4, rc4Dict := newLegacyEncryption(3, "/V 2 /Length 128", false)
+	aesV2, aesDict := newLegacyEncryption(4,
+		"/V 4 /Length 128 /CF << /StdCF << /CFM /AESV2 /Length 16 >> >> /StmF /StdCF /StrF /StdCF", true)
+	aesV3, aes256Dict := newAES256Encryption()
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"rc4", buildEncryptedPDF(rc4, rc4Dict)},
+		{"aes-128", buildEncryptedPDF(aesV2, aesDict)},
+		{"aes-256", buildEncryptedPDF(aesV3, aes256Dict)},
+	}
+	for _, tt := range tests {
+		info := inspect(t, tt.data)
+		if !info.Encrypted || info.NeedsPassword || info.Title != "Report" || info.Author != "zhangsan" {
+			t.Errorf("%s: info = %+v", tt.name, info)
+			continue
+		}
+		checkTestPages(t, info)
+
+		r, err := NewReader(tt.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, ok := r.Resolve(Ref{Num: 5}).(*Stream)
+		if !ok {
+			t.Fatalf("%s: 内容流不存在", tt.name)
+		}
+		if data, err := r.Decode(s); err != nil || string(data) != testContent {
+			t.Errorf("%s: content = %q, err = %v", tt.name, data, err)
+		}
+	}
+}
+
+func TestReaderNeedsPassword(t *testing.T) {
+	e, dict := newLegacyEncryption(3, "/V 2 /Length 128", false)
+	// 用户密码不为空时 U 校验失败
+	data := buildEncryptedPDF(e, strings.Replace(dict, "/U <", "/U <ff", 1))
+	info := inspect(t, data)
+	if !info.Encrypted || !info.NeedsPassword || info.Title != "" {
+		t.Errorf("info = %+v", info)
+	}
+	if info.Pages != 2 {
+		t.Errorf("pages = %d", info.Pages)
+	}
+}
+
+func TestImporterRoundTrip(t *testing.T) {
+	r, err := NewReader(buildPDF(testObjects(testContent), "/Root 1 0 R"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := r.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 每页写为表单, 两页放在同一张 A3 纸上
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	im := NewImporter(r, w)
+	var content strings.Builder
+	xobjects := Dict{}
+	for i, page := range pages {
+		form, err := im.PageForm(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 同一页面只写一次
+		if again, _ := im.PageForm(page); again != form {
+			t.Errorf("页面 %d 重复写出", i+1)
+		}
+		name := Name(fmt.Sprintf("P%d", i))
+		xobjects[name] = form
+		m := PlaceMatrix(page.Box(), page.Rotate(), float64(i)*595, 0, 1)
+		fmt.Fprintf(&content, "q %s cm /%s Do Q\n", FormatMatrix(m), name)
+	}
+	pagesRef := w.Alloc()
+	page := w.Add(Dict{
+		"Type":      Name("Page"),
+		"Parent":    pagesRef,
+		"MediaBox":  Rect{URX: 1190, URY: 842}.Array(),
+		"Resources": Dict{"XObject": xobjects},
+		"Contents":  w.Add(NewStream(Dict{}, []byte(content.String()), true)),
+	})
+	w.Write(pagesRef, Dict{"Type": Name("Pages"), "Kids": Array{page}, "Count": 1})
+	if err := w.Close(Dict{"Root": w.Add(Dict{"Type": Name("Catalog"), "Pages": pagesRef})}); err != nil {
+		t.Fatal(err)
+	}
+
+	info := inspect(t, out.Bytes())
+	if info.Pages != 1 || info.Damaged || info.PageBoxes[0].MediaBox != (Rect{URX: 1190, URY: 842}) {
+		t.Fatalf("info = %+v", info)
+	}
+	r2, err := NewReader(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages2, _ := r2.Pages()
+	res, _ := r2.Resolve(pages2[0].Dict["Resources"]).(Dict)
+	xo, _ := r2.Resolve(res["XObject"]).(Dict)
+	form, ok := r2.Resolve(xo["P0"]).(*Stream)
+	if !ok {
+		t.Fatal("找不到第一页的表单")
+	}
+	if data, err := r2.Decode(form); err != nil || strings.TrimSpace(string(data)) != testContent {
+		t.Errorf("form content = %q, err = %v", data, err)
+	}
+	if bbox, _ := RectFromArray(form.Dict["BBox"]); bbox != (Rect{URX: 595, URY: 842}) {
+		t.Errorf("bbox = %+v", bbox)
+	}
+	// 页面引用的字体随表单的资源一起复制
+	formRes, _ := r2.Resolve(form.Dict["Resources"]).(Dict)
+	fonts, _ := r2.Resolve(formRes["Font"]).(Dict)
+	font, _ := r2.Resolve(fonts["F1"]).(Dict)
+	if font["BaseFont"] != Name("Helvetica") {
+		t.Errorf("font = %v", font)
+	}
+}
+
+func TestPlaceMatrix(t *testing.T) {
+	box := Rect{URX: 300, URY: 400}
+	tests := []struct {
+		rotate int
+		want   [6]float64
+	}{
+		{0, [6]float64{0.5, 0, 0, 0.5, 10, 20}},
+		{90, [6]float64{0, -0.5, 0.5, 0, 10, 170}},
+		{180, [6]float64{-0.5, 0, 0, -0.5, 160, 220}},
+		{270, [6]float64{0, 0.5, -0.5, 0, 210, 20}},
+	}
+	for _, tt := range tests {
+		if got := PlaceMatrix(box, tt.rotate, 10, 20, 0.5); got != tt.want {
+			t.Errorf("rotate %d: %v, want %v", tt.rotate, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package pdf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Writer 顺序写出 PDF 文件, 对象编号由 Alloc 分配, 写出顺序不限
+type Writer struct {
+	w       *bufio.Writer
+	n       int64
+	offsets map[int]int64
+	next    int
+	err     error
+}
+
+// NewWriter 创建 Writer 并写出文件头
+func NewWriter(w io.Writer) *Writer {
+	pw := &Writer{w: bufio.NewWriter(w), offsets: make(map[int]int64), next: 1}
+	// 第二行的高位字节提示传输程序这是二进制文件
+	pw.write([]byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"))
+	return pw
+}
+
+func (w *Writer) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+}
+
+// Alloc 分配一个对象编号, 对象可以稍后再写出
+func (w *Writer) Alloc() Ref {
+	ref := Ref{Num: w.next}
+	w.next++
+	return ref
+}
+
+// Add 分配编号并立即写出对象
+func (w *Writer) Add(obj Object) Ref {
+	ref := w.Alloc()
+	w.Write(ref, obj)
+	return ref
+}
+
+// Write 写出间接对象, obj 可以是 *Stream
+func (w *Writer) Write(ref Ref, obj Object) {
+	if w.err != nil {
+		return
+	}
+	if _, dup := w.offsets[ref.Num]; dup {
+		w.err = fmt.Errorf("pdf: 对象 %d 重复写出", ref.Num)
+		return
+	}
+	w.offsets[ref.Num] = w.n
+
+	buf := fmt.Appendf(nil, "%d %d obj\n", ref.Num, ref.Gen)
+	if s, ok := obj.(*Stream); ok {
+		dict := make(Dict, len(s.Dict)+1)
+		for k, v := range s.Dict {
+			dict[k] = v
+		}
+		dict["Length"] = len(s.Data)
+		buf = appendObject(buf, dict)
+		buf = append(buf, "\nstream\n"...)
+		w.write(buf)
+		w.write(s.Data)
+		w.write([]byte("\nendstream\nendobj\n"))
+		return
+	}
+	buf = appendObject(buf, obj)
+	buf = append(buf, "\nendobj\n"...)
+	w.write(buf)
+}
+
+// Close 写出交叉引用表和文件尾, trailer 中需包含 Root, 可选 Info
+func (w *Writer) Close(trailer Dict) error {
+	if w.err != nil {
+		return w.err
+	}
+	xref := w.n
+	size := w.next
+	buf := fmt.Appendf(nil, "xref\n0 %d\n0000000000 65535 f \n", size)
+	for i := 1; i < size; i++ {
+		offset, ok := w.offsets[i]
+		if !ok {
+			// 分配了但未写出的对象记为空闲
+			buf = append(buf, "0000000000 00000 f \n"...)
+			continue
+		}
+		buf = fmt.Appendf(buf, "%010d 00000 n \n", offset)
+	}
+
+	dict := Dict{"Size": size}
+	for k, v := range trailer {
+		dict[k] = v
+	}
+	buf = append(buf, "trailer\n"...)
+	buf = appendObject(buf, dict)
+	buf = fmt.Appendf(buf, "\nstartxref\n%d\n%%%%EOF\n", xref)
+	w.write(buf)
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// 打印池分配任务的方式
+const (
+	// 依次轮流分配给各成员
+	PoolRoundRobin = "round-robin"
+	// 分配给排队任务最少的成员
+	PoolLeastQueued = "least-queued"
+)
+
+// ErrPoolUnavailable 打印池中没有可用的打印机
+var ErrPoolUnavailable = errors.New("打印池中没有可用的打印机")
+
+// Pool 打印池, 由若干已登记的打印机组成, 提交打印时可以像打印机一样指定.
+// 任务按 Strategy 分配给可用的成员, 成员打印出错时换用其他成员
+type Pool struct {
+	// 名称, 不能与打印机重名
+	Name string `json:"name"`
+	// 成员打印机名称, 按顺序排列
+	Members []string `json:"members"`
+	// 分配方式: round-robin, least-queued
+	Strategy string `json:"strategy,omitempty"`
+	// 默认打印选项, 优先于成员打印机的默认选项
+	DefaultOptions PrintOptions `json:"default_options"`
+	// 是否启用
+	Enabled bool `json:"enabled"`
+}
+
+// PoolMember 打印池中已启用的成员
+type PoolMember struct {
+	Name     string
+	Service  *PrintService
+	Defaults PrintOptions
+}
+
+// LoadPools 从 path 加载打印池列表, 之后对打印池的修改都保存到 path
+func (r *PrinterRegistry) LoadPools(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.poolsPath = path
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &r.pools)
+}
+
+// savePools 写入打印池列表, 调用方需持有写锁
+func (r *PrinterRegistry) savePools() error {
+	if r.poolsPath == "" {
+		return errors.New("打印池列表未加载")
+	}
+	data, err := json.Marshal(r.pools)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.poolsPath, data)
+}
+
+func (r *PrinterRegistry) poolIndexLocked(name string) int {
+	for i, p := range r.pools {
+		if p.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsPool 判断 name 是否为打印池
+func (r *PrinterRegistry) IsPool(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return name != "" && r.poolIndexLocked(name) >= 0
+}
+
+// ListPools 返回全部打印池
+func (r *PrinterRegistry) ListPools() []Pool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Pool(nil), r.pools...)
+}
+
+// GetPool 按名称返回打印池
+func (r *PrinterRegistry) GetPool(name string) (Pool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.poolIndexLocked(name)
+	if i < 0 {
+		return Pool{}, ErrPrinterNotFound
+	}
+	return r.pools[i], nil
+}
+
+// validatePoolLocked 检查打印池配置, 成员必须是已登记的打印机. 调用方需持有锁
+func (r *PrinterRegistry) validatePoolLocked(p Pool) error {
+	if p.Name == "" {
+		return errors.New("打印池名称不能为空")
+	}
+	if strings.ContainsAny(p.Name, "/\\") {
+		return errors.New("打印池名称不能包含路径分隔符")
+	}
+	switch p.Strategy {
+	case "", PoolRoundRobin, PoolLeastQueued:
+	default:
+		return fmt.Errorf("打印池分配方式无效: %s", p.Strategy)
+	}
+	if len(p.Members) == 0 {
+		return errors.New("打印池至少需要一台打印机")
+	}
+	for i, m := range p.Members {
+		if r.indexLocked(m) < 0 {
+			return fmt.Errorf("%w: %s", ErrPrinterNotFound, m)
+		}
+		if slices.Contains(p.Members[:i], m) {
+			return fmt.Errorf("打印池成员重复: %s", m)
+		}
+	}
+	if err := p.DefaultOptions.Validate(); err != nil {
+		return fmt.Errorf("默认选项无效: %v", err)
+	}
+	return nil
+}
+
+// AddPool 添加打印池
+func (r *PrinterRegistry) AddPool(p Pool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.validatePoolLocked(p); err != nil {
+		return err
+	}
+	if r.indexLocked(p.Name) >= 0 || r.poolIndexLocked(p.Name) >= 0 {
+		return ErrPrinterExists
+	}
+	r.pools = append(r.pools, p)
+	if err := r.savePools(); err != nil {
+		r.pools = r.pools[:len(r.pools)-1]
+		return err
+	}
+	return nil
+}
+
+// UpdatePool 修改打印池, 允许同时修改名称
+func (r *PrinterRegistry) UpdatePool(name string, p Pool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.validatePoolLocked(p); err != nil {
+		return err
+	}
+	i := r.poolIndexLocked(name)
+	if i < 0 {
+		return ErrPrinterNotFound
+	}
+	if p.Name != name && (r.indexLocked(p.Name) >= 0 || r.poolIndexLocked(p.Name) >= 0) {
+		return ErrPrinterExists
+	}
+
+	old := r.pools[i]
+	r.pools[i] = p
+	if err := r.savePools(); err != nil {
+		r.pools[i] = old
+		return err
+	}
+	return nil
+}
+
+// DeletePool 删除打印池
+func (r *PrinterRegistry) DeletePool(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.poolIndexLocked(name)
+	if i < 0 {
+		return ErrPrinterNotFound
+	}
+
+	old := r.pools
+	r.pools = append(append([]Pool(nil), r.pools[:i]...), r.pools[i+1:]...)
+	if err := r.savePools(); err != nil {
+		r.pools = old
+		return err
+	}
+	return nil
+}
+
+// renameMemberLocked 打印机改名或删除后同步修改打印池成员, to 为空表示删除.
+// 调用方需持有写锁
+func (r *PrinterRegistry) renameMemberLocked(from, to string) error {
+	changed := false
+	for i, p := range r.pools {
+		idx := slices.Index(p.Members, from)
+		if idx < 0 {
+			continue
+		}
+		members := slices.Clone(p.Members)
+		if to == "" {
+			members = slices.Delete(members, idx, idx+1)
+		} else {
+			members[idx] = to
+		}
+		r.pools[i].Members = members
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return r.savePools()
+}
+
+// ResolvePool 返回打印池和其中已启用成员的打印服务
+func (r *PrinterRegistry) ResolvePool(name string) (Pool, []PoolMember, error) {
+	pool, err := r.GetPool(name)
+	if err != nil {
+		return Pool{}, nil, err
+	}
+	if !pool.Enabled {
+		return pool, nil, ErrPrinterDisabled
+	}
+
+	var members []PoolMember
+	for _, m := range pool.Members {
+		service, defaults, err := r.Resolve(m)
+		if err != nil {
+			continue
+		}
+		members = append(members, PoolMember{Name: m, Service: service, Defaults: defaults})
+	}
+	if len(members) == 0 {
+		return pool, nil, ErrPoolUnavailable
+	}
+	return pool, members, nil
+}
+
+// ResolveTarget 返回打印到打印机或打印池使用的打印服务, 以及合并默认选项并检查后的选项.
+// 打印池中至少一台打印机支持这些选项即可, 返回其中第一台的打印服务
+func (r *PrinterRegistry) ResolveTarget(name string, opts PrintOptions) (*PrintService, PrintOptions, error) {
+	if !r.IsPool(name) {
+		service, defaults, err := r.Resolve(name)
+		if err != nil {
+			return nil, opts, err
+		}
+		options := opts.WithDefaults(defaults)
+		if err := service.CheckOptions(options); err != nil {
+			return nil, options, err
+		}
+		return service, options, nil
+	}
+
+	pool, members, err := r.ResolvePool(name)
+	if err != nil {
+		return nil, opts, err
+	}
+	options := opts.WithDefaults(pool.DefaultOptions)
+	if err := options.Validate(); err != nil {
+		return nil, options, err
+	}
+	var firstErr error
+	for _, m := range members {
+		err := m.Service.CheckOptions(options.WithDefaults(m.Defaults))
+		if err == nil {
+			return m.Service, options, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, options, fmt.Errorf("打印池中没有支持这些选项的打印机: %w", firstErr)
+}
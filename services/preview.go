@@ -0,0 +1,299 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"printer/services/pdf"
+)
+
+var (
+	// ErrPageOutOfRange 预览的页码超出文档页数
+	ErrPageOutOfRange = errors.New("页码超出范围")
+	// ErrPreviewUnsupported 文件类型无法预览
+	ErrPreviewUnsupported = errors.New("不支持预览的文件类型")
+)
+
+// Previewer 生成文件页面的 PNG 预览. 非 PDF 文件先用已注册的转换器转换,
+// 转换结果和预览图缓存在 cacheDir/<文件内容哈希>/ 下, 总大小超过上限时删除最久未用的文件
+type Previewer struct {
+	rasterizer Rasterizer
+	cacheDir   string
+	maxBytes   int64
+	timeout    time.Duration
+	// 同时进行的渲染数
+	slots chan struct{}
+
+	mu       sync.Mutex
+	hashes   map[string]fileHash
+	inflight map[string]*previewCall
+}
+
+// fileHash 文件内容哈希, 大小和修改时间不变时复用
+type fileHash struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// previewCall 进行中的转换或渲染, 相同的请求等待同一个结果
+type previewCall struct {
+	done chan struct{}
+	err  error
+}
+
+// NewPreviewer 创建预览服务. maxBytes 为缓存大小上限, 0 表示不限制;
+// timeout 为单次渲染的超时
+func NewPreviewer(r Rasterizer, cacheDir string, maxBytes int64, timeout time.Duration) *Previewer {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &Previewer{
+		rasterizer: r,
+		cacheDir:   cacheDir,
+		maxBytes:   maxBytes,
+		timeout:    timeout,
+		slots:      make(chan struct{}, 2),
+		hashes:     make(map[string]fileHash),
+		inflight:   make(map[string]*previewCall),
+	}
+}
+
+// Supports 判断该扩展名的文件能否预览
+func (p *Previewer) Supports(ext string) bool {
+	ext = strings.ToLower(ext)
+	return ext == ".pdf" || converterFor(ext) != nil
+}
+
+// Preview 返回 filePath 第 page 页、宽 width 像素的 PNG 预览图路径
+func (p *Previewer) Preview(ctx context.Context, filePath string, page, width int) (string, error) {
+	if !p.Supports(filepath.Ext(filePath)) {
+		return "", ErrPreviewUnsupported
+	}
+	sum, err := p.hash(filePath)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(p.cacheDir, sum)
+	out := filepath.Join(dir, fmt.Sprintf("page-%d-%d.png", page, width))
+	if touch(out) {
+		return out, nil
+	}
+
+	err = p.do(ctx, out, func() error {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		doc, err := p.document(ctx, filePath, dir)
+		if err != nil {
+			return err
+		}
+		return p.render(ctx, doc, out, page, width)
+	})
+	if err != nil {
+		return "", err
+	}
+	p.prune(dir)
+	return out, nil
+}
+
+// document 返回可渲染的 PDF 路径, 非 PDF 文件转换后缓存为 dir/document.pdf
+func (p *Previewer) document(ctx context.Context, filePath, dir string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if ext == ".pdf" {
+		return filePath, nil
+	}
+	doc := filepath.Join(dir, "document.pdf")
+	if touch(doc) {
+		return doc, nil
+	}
+	err := p.do(ctx, doc, func() error {
+		c := converterFor(ext)
+		if c == nil {
+			return ErrPreviewUnsupported
+		}
+		// 转换超时由转换器自己控制
+		tmp := doc + ".tmp"
+		if err := c.Convert(ctx, filePath, tmp, PrintOptions{}); err != nil {
+			os.Remove(tmp)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("转换为PDF失败: %v", err)
+		}
+		return os.Rename(tmp, doc)
+	})
+	return doc, err
+}
+
+// render 按页面宽度计算分辨率并渲染
+func (p *Previewer) render(ctx context.Context, doc, out string, page, width int) error {
+	data, err := os.ReadFile(doc)
+	if err != nil {
+		return err
+	}
+	info, err := pdf.Inspect(data)
+	if err != nil {
+		return err
+	}
+	if info.NeedsPassword {
+		return fmt.Errorf("文档设置了打开密码, 无法预览")
+	}
+	if page > info.Pages {
+		return fmt.Errorf("%w: 文档共 %d 页", ErrPageOutOfRange, info.Pages)
+	}
+	box := info.PageBoxes[page-1]
+	pageWidth := box.MediaBox.Width()
+	if box.Rotate == 90 || box.Rotate == 270 {
+		pageWidth = box.MediaBox.Height()
+	}
+	dpi := float64(width) * 72 / pageWidth
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-p.slots }()
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	tmp := strings.TrimSuffix(out, ".png") + ".tmp.png"
+	if err := p.rasterizer.Rasterize(ctx, doc, tmp, page, dpi); err != nil {
+		os.Remove(tmp)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("渲染预览超时 (%s)", p.timeout)
+		}
+		return err
+	}
+	return os.Rename(tmp, out)
+}
+
+// do 执行 fn, 同一 key 同时只执行一次, 其他调用等待其结果
+func (p *Previewer) do(ctx context.Context, key string, fn func() error) error {
+	p.mu.Lock()
+	if call, ok := p.inflight[key]; ok {
+		p.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	call := &previewCall{done: make(chan struct{})}
+	p.inflight[key] = call
+	p.mu.Unlock()
+
+	call.err = fn()
+
+	p.mu.Lock()
+	delete(p.inflight, key)
+	p.mu.Unlock()
+	close(call.done)
+	return call.err
+}
+
+// hash 返回文件内容的 SHA-256 前16字节
+func (p *Previewer) hash(filePath string) (string, error) {
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	h, ok := p.hashes[filePath]
+	p.mu.Unlock()
+	if ok && h.size == stat.Size() && h.modTime.Equal(stat.ModTime()) {
+		return h.sum, nil
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sha := sha256.New()
+	if _, err := io.Copy(sha, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(sha.Sum(nil)[:16])
+
+	p.mu.Lock()
+	p.hashes[filePath] = fileHash{size: stat.Size(), modTime: stat.ModTime(), sum: sum}
+	p.mu.Unlock()
+	return sum, nil
+}
+
+// prune 缓存超过上限时按最近使用时间删除文件的整个缓存目录, keep 为正在使用的目录
+func (p *Previewer) prune(keep string) {
+	if p.maxBytes <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(p.cacheDir)
+	if err != nil {
+		return
+	}
+	type cacheDir struct {
+		path    string
+		size    int64
+		lastUse time.Time
+	}
+	var dirs []cacheDir
+	var total int64
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		d := cacheDir{path: filepath.Join(p.cacheDir, e.Name())}
+		files, _ := os.ReadDir(d.path)
+		for _, f := range files {
+			if info, err := f.Info(); err == nil {
+				d.size += info.Size()
+				if info.ModTime().After(d.lastUse) {
+					d.lastUse = info.ModTime()
+				}
+			}
+		}
+		total += d.size
+		dirs = append(dirs, d)
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].lastUse.Before(dirs[j].lastUse) })
+	for _, d := range dirs {
+		if total <= p.maxBytes {
+			break
+		}
+		if d.path == keep {
+			continue
+		}
+		p.mu.Lock()
+		busy := false
+		for key := range p.inflight {
+			if strings.HasPrefix(key, d.path+string(filepath.Separator)) {
+				busy = true
+			}
+		}
+		p.mu.Unlock()
+		if busy {
+			continue
+		}
+		if os.RemoveAll(d.path) == nil {
+			total -= d.size
+		}
+	}
+}
+
+// touch 文件存在时更新其修改时间, 用于记录缓存的最近使用时间
+func touch(path string) bool {
+	now := time.Now()
+	return os.Chtimes(path, now, now) == nil
+}
@@ -1,19 +1,25 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
-
-	"github.com/go-ole/go-ole"
-	"github.com/go-ole/go-ole/oleutil"
 )
 
-// PrintService 打印服务结构体
-type PrintService struct{}
+// PrintService 打印服务结构体, 具体的打印方式由 Backend 决定
+type PrintService struct {
+	Backend PrintBackend
+}
+
+// NewPrintService 使用指定的后端创建打印服务
+func NewPrintService(backend PrintBackend) *PrintService {
+	return &PrintService{Backend: backend}
+}
 
-// PrintFile 通过软件打开文件
-func (s *PrintService) OpenFile(filePath string) error {
+// OpenFile 通过软件打开文件
+func (s *PrintService) OpenFile(ctx context.Context, filePath string) error {
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
 		return fmt.Errorf("获取文件绝对路径失败: %v", err)
@@ -21,153 +27,133 @@ func (s *PrintService) OpenFile(filePath string) error {
 
 	// 获取文件扩展名
 	ext := strings.ToLower(filepath.Ext(absPath))
-
-	// 初始化COM
-	err = ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED)
-	if err != nil {
-		return fmt.Errorf("COM初始化失败: %v", err)
-	}
-	defer ole.CoUninitialize()
-
-	// 根据文件类型选择打开方式
-	switch ext {
-	case ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx":
-		err = s.openOffice(absPath)
-	case ".pdf":
-		err = s.openPDF(absPath)
-	default:
+	if !s.Backend.Capabilities().CanOpen(ext) {
 		return fmt.Errorf("不支持的文件类型: %s", ext)
 	}
 
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return s.Backend.Open(ctx, absPath)
 }
 
-// openWord 打开Word文档
-func (s *PrintService) openOffice(filePath string) error {
-	// 根据文件扩展名选择应用程序
-	ext := strings.ToLower(filepath.Ext(filePath))
-	var appProgID string
-	switch ext {
-	case ".doc", ".docx":
-		appProgID = "kwps.Application" // Word
-	case ".xls", ".xlsx":
-		appProgID = "ket.Application" // Excel
-	case ".ppt", ".pptx":
-		appProgID = "kwpp.Application" // PPT
-	default:
-		return fmt.Errorf("不支持的文件类型: %s", ext)
-	}
+// PrintFile 处理文件打印
+func (s *PrintService) PrintFile(ctx context.Context, filePath string, opts PrintOptions) error {
+	return s.Process(ctx, filePath, opts, func(JobState) {})
+}
 
-	// 创建应用实例
-	unknown, err := oleutil.CreateObject(appProgID)
-	if err != nil {
-		return fmt.Errorf("创建应用实例失败: %v", err)
+// Capabilities 返回后端能力, PrintFormats 中包含可先转换为 PDF 再打印的格式
+func (s *PrintService) Capabilities() Capabilities {
+	caps := s.Backend.Capabilities()
+	if !caps.CanPrint(".pdf") {
+		return caps
 	}
-	defer unknown.Release()
-
-	app, err := unknown.QueryInterface(ole.IID_IDispatch)
-	if err != nil {
-		return fmt.Errorf("获取应用接口失败: %v", err)
+	formats := append([]string(nil), caps.PrintFormats...)
+	for _, ext := range ConvertFormats() {
+		if !containsExt(formats, ext) {
+			formats = append(formats, ext)
+		}
 	}
-	defer app.Release()
+	caps.PrintFormats = formats
+	return caps
+}
 
-	// 打开文件
-	switch ext {
-	case ".doc", ".docx":
-		docs := oleutil.MustGetProperty(app, "Documents").ToIDispatch()
-		doc := oleutil.MustCallMethod(docs, "Open", filePath).ToIDispatch()
-		defer doc.Release()
-	case ".xls", ".xlsx":
-		workbooks := oleutil.MustGetProperty(app, "WorkBooks").ToIDispatch()
-		wb := oleutil.MustCallMethod(workbooks, "Open", filePath).ToIDispatch()
-		defer wb.Release()
-	case ".ppt", ".pptx":
-		presentations := oleutil.MustGetProperty(app, "Presentations").ToIDispatch()
-		ppt := oleutil.MustCallMethod(presentations, "Open", filePath).ToIDispatch()
-		defer ppt.Release()
+// CheckOptions 检查选项是否合法以及后端是否支持
+func (s *PrintService) CheckOptions(opts PrintOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
 	}
-
-	// 设置应用可见
-	oleutil.MustPutProperty(app, "Visible", true)
-
-	return nil
+	return s.Backend.Capabilities().Check(opts)
 }
 
-// openPDF 打开PDF文档
-func (s *PrintService) openPDF(filePath string) error {
-	// 创建PDF应用实例
-	unknown, err := oleutil.CreateObject("AcroExch.App")
-	if err != nil {
-		return fmt.Errorf("创建PDF应用实例失败: %v", err)
-	}
-	defer unknown.Release()
+// Process 执行完整的打印流程, 每进入一个阶段都会调用 progress
+func (s *PrintService) Process(ctx context.Context, filePath string, opts PrintOptions, progress func(JobState)) error {
+	progress(JobConverting)
 
-	pdf, err := unknown.QueryInterface(ole.IID_IDispatch)
+	absPath, err := filepath.Abs(filePath)
 	if err != nil {
-		return fmt.Errorf("获取PDF接口失败: %v", err)
+		return fmt.Errorf("获取文件绝对路径失败: %v", err)
 	}
-	defer pdf.Release()
+	// 水印图片和被打印的文件位于同一目录
+	return s.process(ctx, absPath, filepath.Dir(absPath), opts, progress)
+}
 
-	// 创建PDF文档实例
-	unknownDoc, err := oleutil.CreateObject("AcroExch.AVDoc")
-	if err != nil {
-		return fmt.Errorf("创建PDF文档实例失败: %v", err)
+// ProcessBatch 将 dir 中的 files 按顺序合并为一个文档后打印
+func (s *PrintService) ProcessBatch(ctx context.Context, dir string, files []BatchFile, opts PrintOptions, progress func(JobState)) error {
+	progress(JobConverting)
+
+	if err := s.CheckOptions(opts); err != nil {
+		return err
 	}
-	defer unknownDoc.Release()
-	pdfDoc, err := unknownDoc.QueryInterface(ole.IID_IDispatch)
-	if err != nil {
-		return fmt.Errorf("获取PDF文档接口失败: %v", err)
+	if !s.Backend.Capabilities().CanPrint(".pdf") {
+		return fmt.Errorf("%w: 合并打印", ErrOptionUnsupported)
 	}
-	defer pdfDoc.Release()
-
-	// 打开PDF文档
-	_, err = oleutil.CallMethod(pdfDoc, "Open", filePath, "")
+	dir, err := filepath.Abs(dir)
 	if err != nil {
-		return fmt.Errorf("打开PDF文档失败: %v", err)
+		return fmt.Errorf("获取文件绝对路径失败: %v", err)
 	}
-
-	// 打开PDF应用
-	_, err = oleutil.CallMethod(pdf, "Show")
+	merged, cleanup, err := MergeFiles(ctx, dir, files, opts)
 	if err != nil {
-		return fmt.Errorf("打开PDF应用失败: %v", err)
+		return err
 	}
-
-	return nil
+	defer cleanup()
+	return s.process(ctx, merged, dir, opts, progress)
 }
 
-// PrintFile 处理文件打印
-func (s *PrintService) PrintFile(filePath string) error {
-	absPath, err := filepath.Abs(filePath)
-	if err != nil {
-		return fmt.Errorf("获取文件绝对路径失败: %v", err)
+// process 打印 absPath, 水印图片从 dir 中查找
+func (s *PrintService) process(ctx context.Context, absPath, dir string, opts PrintOptions, progress func(JobState)) error {
+	if err := s.CheckOptions(opts); err != nil {
+		return err
 	}
-
-	// 获取文件扩展名
-	ext := strings.ToLower(filepath.Ext(absPath))
-
-	// 初始化COM
-	err = ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED)
-	if err != nil {
-		return fmt.Errorf("COM初始化失败: %v", err)
+	if _, err := os.Stat(absPath); err != nil {
+		return fmt.Errorf("文件不存在: %s", filepath.Base(absPath))
 	}
-	defer ole.CoUninitialize()
 
-	// 根据文件类型选择打印方式
-	switch ext {
-	case ".doc", ".docx":
-		err = s.printWord(absPath)
-	case ".pdf":
-		err = s.printPDF(absPath)
-	default:
-		return fmt.Errorf("不支持的文件类型: %s", ext)
+	// 获取文件扩展名, 后端不能直接打印时先转换为 PDF
+	ext := strings.ToLower(filepath.Ext(absPath))
+	caps := s.Backend.Capabilities()
+	// 拼版和加水印需要先得到 PDF
+	if !caps.CanPrint(ext) || ((opts.Imposed() || opts.Stamped()) && ext != ".pdf") {
+		if !caps.CanPrint(".pdf") || converterFor(ext) == nil {
+			return fmt.Errorf("不支持的文件类型: %s", ext)
+		}
+		convertOpts := opts
+		if opts.Imposed() {
+			convertOpts = opts.afterImposition(caps)
+		}
+		pdfPath, cleanup, err := ConvertToPDF(ctx, absPath, convertOpts)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		absPath = pdfPath
+	}
+
+	if opts.Imposed() {
+		imposed, cleanup, err := ImposePDF(ctx, absPath, opts)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		absPath = imposed
+		opts = opts.afterImposition(caps)
+	}
+
+	if opts.Stamped() {
+		stamped, cleanup, err := StampPDF(ctx, absPath, dir, opts)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		absPath = stamped
+		opts = opts.afterStamping()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	if err != nil {
-		return err
+	reportPrinted(ctx, absPath, opts)
+	progress(JobPrinting)
+	if err := s.Backend.Print(ctx, absPath, opts); err != nil {
+		return &backendError{err: err}
 	}
 
 	// 打印完成后删除文件
@@ -179,86 +165,12 @@ func (s *PrintService) PrintFile(filePath string) error {
 	return nil
 }
 
-// printWord 打印Word文档
-func (s *PrintService) printWord(filePath string) error {
-	// 创建Word应用实例
-	unknown, err := oleutil.CreateObject("kwps.Application")
-	if err != nil {
-		return fmt.Errorf("创建Word应用实例失败: %v", err)
-	}
-	defer unknown.Release()
-
-	word, err := unknown.QueryInterface(ole.IID_IDispatch)
-	if err != nil {
-		return fmt.Errorf("获取Word接口失败: %v", err)
-	}
-	defer word.Release()
-
-	// 打开文档
-	docs := oleutil.MustGetProperty(word, "Documents").ToIDispatch()
-	doc := oleutil.MustCallMethod(docs, "Open", filePath).ToIDispatch()
-	defer doc.Release()
-
-	// 打印文档
-	_, err = oleutil.CallMethod(doc, "PrintOut")
-	if err != nil {
-		return fmt.Errorf("打印文档失败: %v", err)
-	}
-
-	// 关闭文档
-	_, err = oleutil.CallMethod(doc, "Close")
-	if err != nil {
-		return fmt.Errorf("关闭文档失败: %v", err)
-	}
-
-	// 退出Word应用
-	_, err = oleutil.CallMethod(word, "Quit")
-	if err != nil {
-		return fmt.Errorf("退出Word应用失败: %v", err)
-	}
-
-	return nil
+// backendError 打印后端提交文档时出错, 与文档转换、拼版等准备阶段的错误区分,
+// 打印池遇到此类错误时换用其他打印机
+type backendError struct {
+	err error
 }
 
-// printPDF 打印PDF文档
-func (s *PrintService) printPDF(filePath string) error {
-	// 创建PDF应用实例
-	unknown, err := oleutil.CreateObject("AcroExch.AVDoc")
-	if err != nil {
-		return fmt.Errorf("创建PDF应用实例失败: %v", err)
-	}
-	defer unknown.Release()
-
-	pdf, err := unknown.QueryInterface(ole.IID_IDispatch)
-	if err != nil {
-		return fmt.Errorf("获取PDF接口失败: %v", err)
-	}
-	defer pdf.Release()
-
-	// 打开PDF文档
-	_, err = oleutil.CallMethod(pdf, "Open", filePath, "")
-	if err != nil {
-		return fmt.Errorf("打开PDF文档失败: %v", err)
-	}
-
-	// 获取PDDoc对象
-	pdDoc := oleutil.MustCallMethod(pdf, "GetPDDoc").ToIDispatch()
-	defer pdDoc.Release()
-
-	// 获取页数
-	pages := oleutil.MustCallMethod(pdDoc, "GetNumPages").Val
-
-	// 打印文档
-	_, err = oleutil.CallMethod(pdf, "PrintPages", 0, pages-1, 2, 1, 1)
-	if err != nil {
-		return fmt.Errorf("打印PDF文档失败: %v", err)
-	}
+func (e *backendError) Error() string { return e.err.Error() }
 
-	// 关闭文档
-	_, err = oleutil.CallMethod(pdf, "Close", true)
-	if err != nil {
-		return fmt.Errorf("关闭PDF文档失败: %v", err)
-	}
-
-	return nil
-}
+func (e *backendError) Unwrap() error { return e.err }
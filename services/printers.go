@@ -0,0 +1,277 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrPrinterNotFound 打印机不存在
+	ErrPrinterNotFound = errors.New("打印机不存在")
+	// ErrPrinterExists 打印机名称已被使用
+	ErrPrinterExists = errors.New("打印机名称已存在")
+	// ErrPrinterDisabled 打印机已停用
+	ErrPrinterDisabled = errors.New("打印机已停用")
+	// ErrNoDefaultPrinter 未指定打印机且没有可用的默认打印后端
+	ErrNoDefaultPrinter = errors.New("未指定打印机且默认打印后端不可用")
+)
+
+// Printer 已登记的打印机
+type Printer struct {
+	// 名称, 提交打印时用于指定打印机
+	Name string `json:"name"`
+	// 打印后端, 如 ipp, socket, lpd
+	Backend string `json:"backend"`
+	// 后端地址
+	URI string `json:"uri,omitempty"`
+	// 后端的其他设置
+	Settings map[string]string `json:"settings,omitempty"`
+	// 默认打印选项, 提交任务时未指定的选项取此处的值
+	DefaultOptions PrintOptions `json:"default_options"`
+	// 位置说明, 如 "3楼东侧"
+	Location string `json:"location,omitempty"`
+	// 状态检查设置
+	Monitor MonitorConfig `json:"monitor"`
+	// 是否启用
+	Enabled bool `json:"enabled"`
+}
+
+// backendConfig 返回创建后端使用的配置
+func (p Printer) backendConfig() BackendConfig {
+	return BackendConfig{URI: p.URI, Settings: p.Settings}
+}
+
+// PrinterRegistry 持久化的打印机列表, 并缓存每台打印机的后端实例
+type PrinterRegistry struct {
+	path string
+	// 未指定打印机时使用的打印服务, 可以为 nil
+	fallback *PrintService
+
+	mu       sync.RWMutex
+	printers []Printer
+	services map[string]*PrintService
+	// 打印池, 由 LoadPools 加载
+	pools     []Pool
+	poolsPath string
+}
+
+// NewPrinterRegistry 从 path 加载打印机列表, fallback 为未指定打印机时使用的打印服务
+func NewPrinterRegistry(path string, fallback *PrintService) (*PrinterRegistry, error) {
+	r := &PrinterRegistry{
+		path:     path,
+		fallback: fallback,
+		services: make(map[string]*PrintService),
+	}
+
+	// 确保配置目录存在
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &r.printers); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// save 写入打印机列表, 调用方需持有写锁
+func (r *PrinterRegistry) save() error {
+	data, err := json.Marshal(r.printers)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.path, data)
+}
+
+func (r *PrinterRegistry) indexLocked(name string) int {
+	for i, p := range r.printers {
+		if p.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// List 返回全部打印机
+func (r *PrinterRegistry) List() []Printer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Printer(nil), r.printers...)
+}
+
+// Get 按名称返回打印机
+func (r *PrinterRegistry) Get(name string) (Printer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.indexLocked(name)
+	if i < 0 {
+		return Printer{}, ErrPrinterNotFound
+	}
+	return r.printers[i], nil
+}
+
+// newPrinterBackend 创建登记的打印机的后端. 打印机可以通过管理接口登记, file 后端只能输出到 SetFileRoot 设置的根目录
+func newPrinterBackend(p Printer) (PrintBackend, error) {
+	if p.Backend == "file" {
+		if err := checkFileRoot(p.URI); err != nil {
+			return nil, err
+		}
+	}
+	return NewBackend(p.Backend, p.backendConfig())
+}
+
+// reservedPrinterNames 与 /api/printers 下的固定路径冲突的名称, 这些打印机无法通过 /api/printers/:name 访问
+var reservedPrinterNames = map[string]bool{"status": true, "discovered": true}
+
+// validatePrinter 检查打印机配置, 并试着创建后端以校验地址和设置
+func validatePrinter(p Printer) (PrintBackend, error) {
+	if p.Name == "" {
+		return nil, errors.New("打印机名称不能为空")
+	}
+	if strings.ContainsAny(p.Name, "/\\") {
+		return nil, errors.New("打印机名称不能包含路径分隔符")
+	}
+	if reservedPrinterNames[p.Name] {
+		return nil, fmt.Errorf("打印机名称 %s 为保留名称", p.Name)
+	}
+	backend, err := newPrinterBackend(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Monitor.validate(); err != nil {
+		return nil, err
+	}
+	if err := p.DefaultOptions.Validate(); err != nil {
+		return nil, fmt.Errorf("默认选项无效: %v", err)
+	}
+	if err := backend.Capabilities().Check(p.DefaultOptions); err != nil {
+		return nil, fmt.Errorf("默认选项无效: %v", err)
+	}
+	return backend, nil
+}
+
+// Add 登记新的打印机
+func (r *PrinterRegistry) Add(p Printer) error {
+	backend, err := validatePrinter(p)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.indexLocked(p.Name) >= 0 || r.poolIndexLocked(p.Name) >= 0 {
+		return ErrPrinterExists
+	}
+	r.printers = append(r.printers, p)
+	if err := r.save(); err != nil {
+		r.printers = r.printers[:len(r.printers)-1]
+		return err
+	}
+	r.services[p.Name] = NewPrintService(backend)
+	return nil
+}
+
+// Update 修改打印机配置, 允许同时修改名称
+func (r *PrinterRegistry) Update(name string, p Printer) error {
+	backend, err := validatePrinter(p)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexLocked(name)
+	if i < 0 {
+		return ErrPrinterNotFound
+	}
+	if p.Name != name && (r.indexLocked(p.Name) >= 0 || r.poolIndexLocked(p.Name) >= 0) {
+		return ErrPrinterExists
+	}
+
+	old := r.printers[i]
+	r.printers[i] = p
+	if err := r.save(); err != nil {
+		r.printers[i] = old
+		return err
+	}
+	delete(r.services, name)
+	r.services[p.Name] = NewPrintService(backend)
+	if p.Name != name {
+		if err := r.renameMemberLocked(name, p.Name); err != nil {
+			return fmt.Errorf("更新打印池失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// Delete 删除打印机
+func (r *PrinterRegistry) Delete(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexLocked(name)
+	if i < 0 {
+		return ErrPrinterNotFound
+	}
+
+	printers := append(append([]Printer(nil), r.printers[:i]...), r.printers[i+1:]...)
+	old := r.printers
+	r.printers = printers
+	if err := r.save(); err != nil {
+		r.printers = old
+		return err
+	}
+	delete(r.services, name)
+	if err := r.renameMemberLocked(name, ""); err != nil {
+		return fmt.Errorf("更新打印池失败: %v", err)
+	}
+	return nil
+}
+
+// Resolve 返回打印到指定打印机使用的打印服务和该打印机的默认选项,
+// name 为空时使用默认打印后端
+func (r *PrinterRegistry) Resolve(name string) (*PrintService, PrintOptions, error) {
+	if name == "" {
+		if r.fallback == nil {
+			return nil, PrintOptions{}, ErrNoDefaultPrinter
+		}
+		return r.fallback, PrintOptions{}, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexLocked(name)
+	if i < 0 {
+		return nil, PrintOptions{}, ErrPrinterNotFound
+	}
+	p := r.printers[i]
+	if !p.Enabled {
+		return nil, PrintOptions{}, ErrPrinterDisabled
+	}
+
+	service, ok := r.services[name]
+	if !ok {
+		backend, err := newPrinterBackend(p)
+		if err != nil {
+			return nil, PrintOptions{}, err
+		}
+		service = NewPrintService(backend)
+		r.services[name] = service
+	}
+	return service, p.DefaultOptions, nil
+}
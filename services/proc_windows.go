@@ -0,0 +1,15 @@
+//go:build windows
+
+package services
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup Windows 上不需要额外设置
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup Windows 上只结束进程本身
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rasterizer 将 PDF 的一页渲染为 PNG
+type Rasterizer interface {
+	// Rasterize 将 src 的第 page 页 (从1开始) 按 dpi 渲染为 PNG 写入 dst
+	Rasterize(ctx context.Context, src, dst string, page int, dpi float64) error
+}
+
+// RasterizerFactory 根据可执行文件路径创建渲染器, path 为空时使用默认名称
+type RasterizerFactory func(path string) (Rasterizer, error)
+
+var (
+	rasterizersMu sync.RWMutex
+	rasterizers   = make(map[string]RasterizerFactory)
+	// 未指定渲染器时依次尝试的顺序
+	rasterizerOrder []string
+)
+
+// RegisterRasterizer 注册渲染器, 通常在 init 中调用
+func RegisterRasterizer(name string, factory RasterizerFactory) {
+	rasterizersMu.Lock()
+	defer rasterizersMu.Unlock()
+
+	if factory == nil {
+		panic("services: RegisterRasterizer factory is nil")
+	}
+	if _, dup := rasterizers[name]; dup {
+		panic("services: RegisterRasterizer called twice for rasterizer " + name)
+	}
+	rasterizers[name] = factory
+	rasterizerOrder = append(rasterizerOrder, name)
+}
+
+// NewRasterizer 根据名称创建渲染器, name 为空时返回第一个可用的渲染器
+func NewRasterizer(name, path string) (Rasterizer, error) {
+	rasterizersMu.RLock()
+	defer rasterizersMu.RUnlock()
+
+	if name != "" {
+		factory, ok := rasterizers[name]
+		if !ok {
+			return nil, fmt.Errorf("未知的渲染器: %s", name)
+		}
+		return factory(path)
+	}
+	var errs []string
+	for _, n := range rasterizerOrder {
+		r, err := rasterizers[n](path)
+		if err == nil {
+			return r, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return nil, fmt.Errorf("没有可用的渲染器: %s", strings.Join(errs, "; "))
+}
+
+func init() {
+	RegisterRasterizer("pdftoppm", func(path string) (Rasterizer, error) {
+		if path == "" {
+			path = "pdftoppm"
+		}
+		resolved, err := exec.LookPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("未找到 pdftoppm: %v", err)
+		}
+		return pdftoppmRasterizer{path: resolved}, nil
+	})
+	RegisterRasterizer("ghostscript", func(path string) (Rasterizer, error) {
+		if path == "" {
+			path = "gs"
+			if runtime.GOOS == "windows" {
+				path = "gswin64c"
+			}
+		}
+		resolved, err := exec.LookPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("未找到 Ghostscript: %v", err)
+		}
+		return ghostscriptRasterizer{path: resolved}, nil
+	})
+}
+
+// pdftoppmRasterizer 使用 poppler 的 pdftoppm 渲染
+type pdftoppmRasterizer struct {
+	path string
+}
+
+func (r pdftoppmRasterizer) Rasterize(ctx context.Context, src, dst string, page int, dpi float64) error {
+	// pdftoppm 的输出文件名为前缀加 .png
+	prefix := strings.TrimSuffix(dst, ".png")
+	n := strconv.Itoa(page)
+	err := runTool(ctx, "pdftoppm", r.path,
+		"-png", "-singlefile",
+		"-f", n, "-l", n,
+		"-r", strconv.FormatFloat(dpi, 'f', 2, 64),
+		src, prefix)
+	if err != nil {
+		return err
+	}
+	if prefix+".png" != dst {
+		return os.Rename(prefix+".png", dst)
+	}
+	return nil
+}
+
+// ghostscriptRasterizer 使用 Ghostscript 的 png16m 设备渲染
+type ghostscriptRasterizer struct {
+	path string
+}
+
+func (r ghostscriptRasterizer) Rasterize(ctx context.Context, src, dst string, page int, dpi float64) error {
+	n := strconv.Itoa(page)
+	return runTool(ctx, "Ghostscript", r.path,
+		"-q", "-dSAFER", "-dBATCH", "-dNOPAUSE",
+		"-sDEVICE=png16m", "-dTextAlphaBits=4", "-dGraphicsAlphaBits=4",
+		"-r"+strconv.FormatFloat(dpi, 'f', 2, 64),
+		"-dFirstPage="+n, "-dLastPage="+n,
+		// 输出文件名中的 % 是页码占位符
+		"-sOutputFile="+strings.ReplaceAll(dst, "%", "%%"),
+		src)
+}
+
+// runTool 运行外部程序, ctx 取消时结束整个进程组
+func runTool(ctx context.Context, name, path string, args ...string) error {
+	cmd := exec.CommandContext(ctx, path, args...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = 5 * time.Second
+	var output strings.Builder
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%s 运行失败: %v: %s", name, err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"fmt"
+	"os"
+
+	"printer/services/pdf"
+)
+
+// pdfPage 待写出的一页
+type pdfPage struct {
+	width, height float64
+	resources     pdf.Dict
+	content       []byte
+}
+
+// writePDF 将 build 生成的页面写为 dst 处的 PDF 文件, build 可先写出字体、图片等共享对象
+func writePDF(dst string, title string, build func(w *pdf.Writer) ([]pdfPage, error)) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("创建PDF失败: %v", err)
+	}
+	defer f.Close()
+
+	w := pdf.NewWriter(f)
+	pages, err := build(w)
+	if err != nil {
+		return err
+	}
+
+	parent := w.Alloc()
+	kids := make(pdf.Array, 0, len(pages))
+	for _, p := range pages {
+		kids = append(kids, w.Add(pdf.Dict{
+			"Type":      pdf.Name("Page"),
+			"Parent":    parent,
+			"MediaBox":  pdf.Rect{URX: p.width, URY: p.height}.Array(),
+			"Resources": p.resources,
+			"Contents":  w.Add(pdf.NewStream(nil, p.content, true)),
+		}))
+	}
+	w.Write(parent, pdf.Dict{
+		"Type":  pdf.Name("Pages"),
+		"Kids":  kids,
+		"Count": len(kids),
+	})
+	catalog := w.Add(pdf.Dict{"Type": pdf.Name("Catalog"), "Pages": parent})
+	info := w.Add(pdf.Dict{
+		"Title":    pdf.String(pdf.EncodeTextString(title)),
+		"Producer": pdf.String("printer"),
+	})
+	if err := w.Close(pdf.Dict{"Root": catalog, "Info": info}); err != nil {
+		return fmt.Errorf("写入PDF失败: %v", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"printer/services/pdf"
+)
+
+// ImageFormats 图片转换器处理的扩展名
+var ImageFormats = []string{".jpg", ".jpeg", ".png", ".gif"}
+
+const (
+	// 图片页面四周留白, 单位为点
+	imageMargin = 18.0
+	// 图片没有记录分辨率时按屏幕分辨率估算原尺寸
+	defaultImageDPI = 96.0
+)
+
+func init() {
+	RegisterConverter(ImageConverter{})
+}
+
+// ImageConverter 将单张图片排版为一页 PDF
+type ImageConverter struct{}
+
+// Formats 返回能转换的扩展名
+func (ImageConverter) Formats() []string {
+	return ImageFormats
+}
+
+// Convert 按 opts 的纸张和缩放方式排版图片. 未指定方向时按图片宽高自动选择横向或纵向,
+// 图片按 EXIF 方向摆正
+func (ImageConverter) Convert(ctx context.Context, src, dst string, opts PrintOptions) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("读取图片失败: %v", err)
+	}
+	info, err := pdf.ReadImageInfo(data)
+	if err != nil {
+		return err
+	}
+	imgW, imgH := info.DisplaySize()
+	if opts.Orientation == "" && imgW > imgH {
+		opts.Orientation = OrientationLandscape
+	}
+	pageW, pageH := opts.PageSize()
+
+	title := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	return writePDF(dst, title, func(w *pdf.Writer) ([]pdfPage, error) {
+		ref, _, err := pdf.AddImage(w, data)
+		if err != nil {
+			return nil, err
+		}
+		box := pdf.Rect{LLX: imageMargin, LLY: imageMargin, URX: pageW - imageMargin, URY: pageH - imageMargin}
+		return []pdfPage{{
+			width:  pageW,
+			height: pageH,
+			resources: pdf.Dict{
+				"XObject": pdf.Dict{"Im0": ref},
+			},
+			content: imageContent(info, box, opts.Scaling),
+		}}, nil
+	})
+}
+
+// imageContent 生成把图片按缩放方式放入 box 居中显示的内容流, 超出 box 的部分裁掉
+func imageContent(info pdf.ImageInfo, box pdf.Rect, scaling string) []byte {
+	imgW, imgH := info.DisplaySize()
+	fitScale := math.Min(box.Width()/float64(imgW), box.Height()/float64(imgH))
+
+	// 原尺寸: 每像素 72/DPI 点
+	dpiX, dpiY := info.DPIX, info.DPIY
+	known := dpiX > 0 && dpiY > 0
+	if !known {
+		dpiX, dpiY = defaultImageDPI, defaultImageDPI
+	}
+	if info.Rotated() {
+		dpiX, dpiY = dpiY, dpiX
+	}
+	naturalW, naturalH := float64(imgW)*72/dpiX, float64(imgH)*72/dpiY
+
+	var w, h float64
+	switch scaling {
+	case ScalingFit:
+		w, h = float64(imgW)*fitScale, float64(imgH)*fitScale
+	case ScalingFill:
+		scale := math.Max(box.Width()/float64(imgW), box.Height()/float64(imgH))
+		w, h = float64(imgW)*scale, float64(imgH)*scale
+	case ScalingNone:
+		w, h = naturalW, naturalH
+	default:
+		if known && naturalW <= box.Width() && naturalH <= box.Height() {
+			w, h = naturalW, naturalH
+		} else {
+			w, h = float64(imgW)*fitScale, float64(imgH)*fitScale
+		}
+	}
+	x := box.LLX + (box.Width()-w)/2
+	y := box.LLY + (box.Height()-h)/2
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "q %s %s %s %s re W n\n",
+		pdf.FormatNumber(box.LLX), pdf.FormatNumber(box.LLY), pdf.FormatNumber(box.Width()), pdf.FormatNumber(box.Height()))
+	sb.WriteString("q")
+	for _, v := range info.ImageMatrix(x, y, w, h) {
+		sb.WriteString(" " + pdf.FormatNumber(v))
+	}
+	sb.WriteString(" cm /Im0 Do Q\nQ\n")
+	return []byte(sb.String())
+}
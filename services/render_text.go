@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"printer/services/pdf"
+)
+
+// TextFormats 文本转换器处理的扩展名
+var TextFormats = []string{".txt", ".log"}
+
+const (
+	// 文本页面四周留白, 单位为点
+	textMargin = 36.0
+	// 正文字号和行距
+	textFontSize = 10.0
+	textLeading  = 12.0
+	// 页眉基线到正文第一行基线的距离
+	textHeaderHeight = 24.0
+	// 制表位间隔的列数
+	textTabWidth = 8
+)
+
+// 一列的宽度, 中文等宽字符占两列
+const textColumnWidth = textFontSize * pdf.CourierWidth / 1000
+
+func init() {
+	RegisterConverter(TextConverter{})
+}
+
+// TextConverter 将纯文本按等宽字体排版为 PDF, 长行自动折行, 每页带文件名和页码页眉.
+// ASCII 和 Latin-1 字符使用 Courier, 其他字符使用不嵌入的中文字体 STSong-Light
+type TextConverter struct{}
+
+// Formats 返回能转换的扩展名
+func (TextConverter) Formats() []string {
+	return TextFormats
+}
+
+// Convert 按 opts 的纸张和方向排版文本, 换页符 (\f) 强制换页
+func (TextConverter) Convert(ctx context.Context, src, dst string, opts PrintOptions) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("读取文本失败: %v", err)
+	}
+	pageW, pageH := opts.PageSize()
+	columns := int((pageW - 2*textMargin) / textColumnWidth)
+	bodyTop := pageH - textMargin - textFontSize - textHeaderHeight
+	rows := int((bodyTop-textMargin)/textLeading) + 1
+	if columns < 1 || rows < 1 {
+		return fmt.Errorf("纸张太小, 无法排版文本")
+	}
+
+	pages := layoutText(decodeText(data), columns, rows)
+	name := filepath.Base(src)
+
+	return writePDF(dst, name, func(w *pdf.Writer) ([]pdfPage, error) {
+		resources := pdf.Dict{
+			"Font": pdf.Dict{
+				"F1": w.Add(pdf.Courier()),
+				"F2": pdf.AddCJKFont(w),
+			},
+		}
+		out := make([]pdfPage, 0, len(pages))
+		for i, lines := range pages {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			var sb strings.Builder
+			// 页眉: 左侧文件名, 右侧页码, 下方一条细线
+			headerY := pageH - textMargin - textFontSize
+			pageNo := fmt.Sprintf("第 %d 页 / 共 %d 页", i+1, len(pages))
+			pageNoCols := textColumns(pageNo)
+			title := truncateColumns(name, columns-pageNoCols-2)
+			sb.WriteString("BT\n")
+			writeTextLine(&sb, textMargin, headerY, textFontSize, title)
+			writeTextLine(&sb, pageW-textMargin-float64(pageNoCols)*textColumnWidth, headerY, textFontSize, pageNo)
+			for row, line := range lines {
+				writeTextLine(&sb, textMargin, bodyTop-float64(row)*textLeading, textFontSize, line)
+			}
+			sb.WriteString("ET\n")
+			ruleY := headerY - textHeaderHeight/2
+			fmt.Fprintf(&sb, "0.5 w %s %s m %s %s l S\n",
+				pdf.FormatNumber(textMargin), pdf.FormatNumber(ruleY),
+				pdf.FormatNumber(pageW-textMargin), pdf.FormatNumber(ruleY))
+
+			out = append(out, pdfPage{
+				width:     pageW,
+				height:    pageH,
+				resources: resources,
+				content:   []byte(sb.String()),
+			})
+		}
+		return out, nil
+	})
+}
+
+// decodeText 按 BOM 识别 UTF-8 和 UTF-16 编码, 无 BOM 时按 UTF-8 处理, 无效字节替换为 "?"
+func decodeText(data []byte) string {
+	switch {
+	case len(data) >= 3 && data[0] == 0xef && data[1] == 0xbb && data[2] == 0xbf:
+		data = data[3:]
+	case len(data) >= 2 && (data[0] == 0xff && data[1] == 0xfe || data[0] == 0xfe && data[1] == 0xff):
+		var order binary.ByteOrder = binary.LittleEndian
+		if data[0] == 0xfe {
+			order = binary.BigEndian
+		}
+		units := make([]uint16, 0, len(data)/2)
+		for i := 2; i+1 < len(data); i += 2 {
+			units = append(units, order.Uint16(data[i:]))
+		}
+		return string(utf16.Decode(units))
+	}
+	return strings.ToValidUTF8(string(data), "?")
+}
+
+// layoutText 将文本折行分页, 每页最多 rows 行, 每行最多 columns 列. 至少返回一页
+func layoutText(text string, columns, rows int) [][]string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	var pages [][]string
+	var page []string
+	flush := func() {
+		pages = append(pages, page)
+		page = nil
+	}
+	addLine := func(line string) {
+		if len(page) == rows {
+			flush()
+		}
+		page = append(page, line)
+	}
+
+	for i, block := range strings.Split(text, "\f") {
+		if i > 0 {
+			flush()
+		}
+		// 换页符前后的换行不产生空行
+		block = strings.TrimPrefix(block, "\n")
+		block = strings.TrimSuffix(block, "\n")
+		if block == "" {
+			continue
+		}
+		for _, line := range strings.Split(block, "\n") {
+			for _, wrapped := range wrapLine(line, columns) {
+				addLine(wrapped)
+			}
+		}
+	}
+	if page != nil || len(pages) == 0 {
+		flush()
+	}
+	return pages
+}
+
+// wrapLine 展开制表符, 去掉控制字符, 并按列数折行
+func wrapLine(line string, columns int) []string {
+	var lines []string
+	var sb strings.Builder
+	col := 0
+	for _, r := range line {
+		if r == '\t' {
+			n := textTabWidth - col%textTabWidth
+			if col+n > columns {
+				n = columns - col
+			}
+			sb.WriteString(strings.Repeat(" ", n))
+			col += n
+		} else if r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0) {
+			continue
+		} else {
+			w := runeColumns(r)
+			if col+w > columns {
+				lines = append(lines, sb.String())
+				sb.Reset()
+				col = 0
+			}
+			sb.WriteRune(r)
+			col += w
+		}
+		if col >= columns {
+			lines = append(lines, sb.String())
+			sb.Reset()
+			col = 0
+		}
+	}
+	if sb.Len() > 0 || len(lines) == 0 {
+		lines = append(lines, sb.String())
+	}
+	return lines
+}
+
+// runeColumns 返回字符占用的列数, Courier 能显示的字符占一列, 其他字符占两列
+func runeColumns(r rune) int {
+	if pdf.IsLatin1(r) {
+		return 1
+	}
+	return 2
+}
+
+// textColumns 返回文本占用的列数
+func textColumns(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeColumns(r)
+	}
+	return n
+}
+
+// truncateColumns 将文本截断到 columns 列以内, 截断时以 "..." 结尾
+func truncateColumns(s string, columns int) string {
+	if textColumns(s) <= columns {
+		return s
+	}
+	var sb strings.Builder
+	n := 0
+	for _, r := range s {
+		if n+runeColumns(r) > columns-3 {
+			break
+		}
+		sb.WriteRune(r)
+		n += runeColumns(r)
+	}
+	return sb.String() + "..."
+}
+
+// writeTextLine 在 (x, y) 处按字号 size 写出一行文本. Latin-1 字符和其他字符分段切换字体,
+// 中文字体字宽为一个字号, 加上字符间距后恰好占两列. 需要资源中 F1 为 Courier, F2 为中文字体
+func writeTextLine(sb *strings.Builder, x, y, size float64, line string) {
+	columnWidth := size * pdf.CourierWidth / 1000
+	for len(line) > 0 {
+		r, _ := utf8.DecodeRuneInString(line)
+		latin := pdf.IsLatin1(r)
+		end := strings.IndexFunc(line, func(r rune) bool { return pdf.IsLatin1(r) != latin })
+		if end < 0 {
+			end = len(line)
+		}
+		run := line[:end]
+		line = line[end:]
+
+		if latin {
+			fmt.Fprintf(sb, "/F1 %s Tf 0 Tc ", pdf.FormatNumber(size))
+			fmt.Fprintf(sb, "1 0 0 1 %s %s Tm %s Tj\n", pdf.FormatNumber(x), pdf.FormatNumber(y), pdf.EncodeLatin1(run))
+		} else {
+			spacing := 2*columnWidth - size*pdf.CJKWidth/1000
+			fmt.Fprintf(sb, "/F2 %s Tf %s Tc ", pdf.FormatNumber(size), pdf.FormatNumber(spacing))
+			fmt.Fprintf(sb, "1 0 0 1 %s %s Tm %s Tj\n", pdf.FormatNumber(x), pdf.FormatNumber(y), pdf.EncodeUCS2(run))
+		}
+		x += float64(textColumns(run)) * columnWidth
+	}
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule 解析后的 cron 表达式, 按本地时间计算
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// 日期和星期是否为 "*", 两者都有限制时满足其一即可, 与 cron 一致
+	domAny, dowAny bool
+}
+
+// scheduleDescriptors 常用的简写
+var scheduleDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSchedule 解析 "分 时 日 月 星期" 五段式 cron 表达式, 每段支持 *、列表、范围和步长,
+// 如 "30 2 * * 1-5" 表示工作日凌晨 2:30, 也支持 @daily、@weekly 等简写
+func ParseSchedule(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if d, ok := scheduleDescriptors[strings.ToLower(expr)]; ok {
+		expr = d
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("定时表达式无效: %s, 需要 分 时 日 月 星期 五段", expr)
+	}
+
+	var s Schedule
+	var err error
+	if s.minute, _, err = parseScheduleField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if s.hour, _, err = parseScheduleField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if s.dom, s.domAny, err = parseScheduleField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if s.month, _, err = parseScheduleField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	// 星期中 0 和 7 都表示星期日
+	if s.dow, s.dowAny, err = parseScheduleField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	if s.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("定时表达式没有可执行的时间: %s", expr)
+	}
+	return &s, nil
+}
+
+// parseScheduleField 解析 cron 表达式的一段, 返回取值的位集合以及是否为 "*"
+func parseScheduleField(field string, min, max int) (uint64, bool, error) {
+	invalid := fmt.Errorf("定时表达式字段无效: %s", field)
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return 0, false, invalid
+			}
+			step = n
+		}
+
+		var first, last int
+		switch {
+		case rangePart == "*":
+			first, last = min, max
+		case strings.Contains(rangePart, "-"):
+			a, b, _ := strings.Cut(rangePart, "-")
+			var err1, err2 error
+			first, err1 = strconv.Atoi(a)
+			last, err2 = strconv.Atoi(b)
+			if err1 != nil || err2 != nil {
+				return 0, false, invalid
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, false, invalid
+			}
+			first, last = n, n
+			// "5/15" 表示从5开始每15
+			if hasStep {
+				last = max
+			}
+		}
+		if first < min || last > max || first > last {
+			return 0, false, invalid
+		}
+		for v := first; v <= last; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, field == "*", nil
+}
+
+// Next 返回 t 之后最近一次满足表达式的时间 (精确到分钟), 五年内没有时返回零值
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
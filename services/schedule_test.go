@@ -0,0 +1,85 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// 2026-03-10 是星期二
+	ref := time.Date(2026, 3, 10, 10, 7, 30, 0, time.UTC)
+	at := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", at(3, 10, 10, 8)},
+		{"*/15 * * * *", at(3, 10, 10, 15)},
+		{"5/20 * * * *", at(3, 10, 10, 25)},
+		{"0 9,17 * * *", at(3, 10, 17, 0)},
+		{"0,30 8-9 * * *", at(3, 11, 8, 0)},
+		{"30 2 * * 1-5", at(3, 11, 2, 30)},
+		{"0 0 1 * *", at(4, 1, 0, 0)},
+		{"@daily", at(3, 11, 0, 0)},
+		{"@WEEKLY", at(3, 15, 0, 0)},
+		// 0 和 7 都是星期日
+		{"0 12 * * 7", at(3, 15, 12, 0)},
+		{"0 12 * * 0", at(3, 15, 12, 0)},
+		// 只限制日期或只限制星期
+		{"0 12 20 * *", at(3, 20, 12, 0)},
+		{"0 12 * * 5", at(3, 13, 12, 0)},
+		// 日期和星期都有限制时满足其一即可: 12 日 (星期四) 先于星期五
+		{"0 12 12 * 5", at(3, 12, 12, 0)},
+		{"0 12 20 * 5", at(3, 13, 12, 0)},
+		// 日期为步长时也算有限制
+		{"0 12 */10 * 1", at(3, 11, 12, 0)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(ref); !got.Equal(tt.want) {
+			t.Errorf("%s: Next = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	// 结果严格晚于参考时间
+	s, _ := ParseSchedule("*/15 * * * *")
+	if got := s.Next(at(3, 10, 10, 15)); !got.Equal(at(3, 10, 10, 30)) {
+		t.Errorf("Next(10:15) = %s", got)
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/-1 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+		"1,,2 * * * *",
+		"@often",
+		// 4 月没有 31 日
+		"0 0 31 4 *",
+	} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q) 应返回错误", expr)
+		}
+	}
+}
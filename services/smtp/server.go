@@ -0,0 +1,326 @@
+package smtp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLine 命令行的最大长度, RFC 5321 4.5.3.1.4 规定为 512 字节, 留出扩展参数的余量
+const maxLine = 2048
+
+// Envelope 收到的一封邮件
+type Envelope struct {
+	// 客户端地址
+	RemoteAddr net.Addr
+	// HELO/EHLO 中的客户端名称
+	Helo string
+	// MAIL FROM 中的发件地址, 退信为空
+	From string
+	// RCPT TO 中被接受的收件地址
+	To []string
+	// 邮件原文, 已去掉点填充, 行尾转换为 LF
+	Data []byte
+}
+
+// Error 带应答码的错误, Recipient 和 Handler 返回它时按其中的应答码回复客户端
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, e.Message)
+}
+
+// Server 只接收邮件的最小 SMTP 服务器 (RFC 5321), 不转发也不支持认证和 STARTTLS
+type Server struct {
+	// 主机名, 出现在问候语和 EHLO 应答中, 默认 localhost
+	Hostname string
+	// 邮件大小上限 (字节), 0 表示不限制
+	MaxSize int64
+	// 每封邮件的收件人上限, 默认 100
+	MaxRecipients int
+	// 检查客户端地址, 返回错误时在问候语中拒绝并断开, 为 nil 时接受任意客户端
+	Client func(addr net.Addr) error
+	// 读写超时, 客户端超过这一时间没有发送数据时断开, 默认 5 分钟
+	Timeout time.Duration
+	// 检查收件地址, 返回错误时拒绝该收件人, 为 nil 时接受任意地址
+	Recipient func(addr string) error
+	// 处理收到的邮件, 返回错误时拒绝该邮件
+	Handler func(env *Envelope) error
+}
+
+// Serve 接受 l 上的连接并处理, 直到 l 被关闭
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) hostname() string {
+	if s.Hostname == "" {
+		return "localhost"
+	}
+	return s.Hostname
+}
+
+func (s *Server) timeout() time.Duration {
+	if s.Timeout <= 0 {
+		return 5 * time.Minute
+	}
+	return s.Timeout
+}
+
+func (s *Server) maxRecipients() int {
+	if s.MaxRecipients <= 0 {
+		return 100
+	}
+	return s.MaxRecipients
+}
+
+// session 一个连接上的会话状态
+type session struct {
+	s    *Server
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	env  *Envelope
+	helo string
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	sess := &session{
+		s:    s,
+		conn: conn,
+		r:    bufio.NewReaderSize(idleReader{conn, s.timeout()}, maxLine),
+		w:    bufio.NewWriter(conn),
+	}
+	if s.Client != nil {
+		if err := s.Client(conn.RemoteAddr()); err != nil {
+			sess.replyError(554, err)
+			return
+		}
+	}
+	sess.reply(220, s.hostname()+" ESMTP ready")
+	for {
+		line, err := sess.readLine()
+		if errors.Is(err, bufio.ErrBufferFull) {
+			sess.reply(500, "5.5.2 Line too long")
+			return
+		}
+		if err != nil {
+			return
+		}
+		if !sess.handle(line) {
+			return
+		}
+	}
+}
+
+// idleReader 每次读取前延长读超时, 大邮件只要持续有数据就不会超时
+type idleReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (r idleReader) Read(p []byte) (int, error) {
+	r.conn.SetReadDeadline(time.Now().Add(r.timeout))
+	return r.conn.Read(p)
+}
+
+// readLine 读取一行命令, 去掉行尾的 CRLF
+func (sess *session) readLine() (string, error) {
+	line, err := sess.r.ReadSlice('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// reply 发送应答, 多行文本使用 "code-" 续行
+func (sess *session) reply(code int, lines ...string) {
+	for i, line := range lines {
+		sep := " "
+		if i < len(lines)-1 {
+			sep = "-"
+		}
+		fmt.Fprintf(sess.w, "%d%s%s\r\n", code, sep, line)
+	}
+	sess.conn.SetWriteDeadline(time.Now().Add(sess.s.timeout()))
+	sess.w.Flush()
+}
+
+// replyError 按错误中的应答码回复, 普通错误使用 code
+func (sess *session) replyError(code int, err error) {
+	var smtpErr *Error
+	if errors.As(err, &smtpErr) {
+		sess.reply(smtpErr.Code, smtpErr.Message)
+		return
+	}
+	sess.reply(code, err.Error())
+}
+
+// handle 处理一条命令, 返回 false 时关闭连接
+func (sess *session) handle(line string) bool {
+	verb, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch strings.ToUpper(verb) {
+	case "HELO":
+		sess.helo = arg
+		sess.env = nil
+		sess.reply(250, sess.s.hostname())
+	case "EHLO":
+		sess.helo = arg
+		sess.env = nil
+		lines := []string{sess.s.hostname(), "8BITMIME", "ENHANCEDSTATUSCODES"}
+		if sess.s.MaxSize > 0 {
+			lines = append(lines, "SIZE "+strconv.FormatInt(sess.s.MaxSize, 10))
+		} else {
+			lines = append(lines, "SIZE")
+		}
+		sess.reply(250, lines...)
+	case "MAIL":
+		sess.mail(arg)
+	case "RCPT":
+		sess.rcpt(arg)
+	case "DATA":
+		return sess.data()
+	case "RSET":
+		sess.env = nil
+		sess.reply(250, "2.0.0 OK")
+	case "NOOP":
+		sess.reply(250, "2.0.0 OK")
+	case "VRFY":
+		sess.reply(252, "2.5.0 Cannot verify user")
+	case "QUIT":
+		sess.reply(221, "2.0.0 Bye")
+		return false
+	case "STARTTLS", "AUTH":
+		sess.reply(502, "5.5.1 Command not implemented")
+	default:
+		sess.reply(500, "5.5.2 Unknown command")
+	}
+	return true
+}
+
+// parsePath 解析 "FROM:<addr> 参数" 形式的参数, 返回地址和扩展参数
+func parsePath(arg, prefix string) (string, []string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", nil, false
+	}
+	rest := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(rest, "<") {
+		return "", nil, false
+	}
+	end := strings.IndexByte(rest, '>')
+	if end < 0 {
+		return "", nil, false
+	}
+	return rest[1:end], strings.Fields(rest[end+1:]), true
+}
+
+func (sess *session) mail(arg string) {
+	if sess.helo == "" {
+		sess.reply(503, "5.5.1 Send HELO/EHLO first")
+		return
+	}
+	if sess.env != nil {
+		sess.reply(503, "5.5.1 Sender already specified")
+		return
+	}
+	from, params, ok := parsePath(arg, "FROM:")
+	if !ok {
+		sess.reply(501, "5.5.4 Syntax: MAIL FROM:<address>")
+		return
+	}
+	for _, p := range params {
+		key, value, _ := strings.Cut(p, "=")
+		if !strings.EqualFold(key, "SIZE") || sess.s.MaxSize <= 0 {
+			continue
+		}
+		if size, err := strconv.ParseInt(value, 10, 64); err == nil && size > sess.s.MaxSize {
+			sess.reply(552, "5.3.4 Message size exceeds fixed limit")
+			return
+		}
+	}
+	sess.env = &Envelope{RemoteAddr: sess.conn.RemoteAddr(), Helo: sess.helo, From: from}
+	sess.reply(250, "2.1.0 OK")
+}
+
+func (sess *session) rcpt(arg string) {
+	if sess.env == nil {
+		sess.reply(503, "5.5.1 Need MAIL command")
+		return
+	}
+	to, _, ok := parsePath(arg, "TO:")
+	if !ok || to == "" {
+		sess.reply(501, "5.5.4 Syntax: RCPT TO:<address>")
+		return
+	}
+	if len(sess.env.To) >= sess.s.maxRecipients() {
+		sess.reply(452, "4.5.3 Too many recipients")
+		return
+	}
+	if sess.s.Recipient != nil {
+		if err := sess.s.Recipient(to); err != nil {
+			sess.replyError(550, err)
+			return
+		}
+	}
+	sess.env.To = append(sess.env.To, to)
+	sess.reply(250, "2.1.5 OK")
+}
+
+// data 接收邮件内容, 超过大小上限时读完并丢弃
+func (sess *session) data() bool {
+	if sess.env == nil || len(sess.env.To) == 0 {
+		sess.reply(503, "5.5.1 Need RCPT command")
+		return true
+	}
+	sess.reply(354, "End data with <CR><LF>.<CR><LF>")
+
+	dr := textproto.NewReader(sess.r).DotReader()
+	var body io.Reader = dr
+	if sess.s.MaxSize > 0 {
+		body = io.LimitReader(dr, sess.s.MaxSize+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return false
+	}
+	env := sess.env
+	sess.env = nil
+	if sess.s.MaxSize > 0 && int64(len(data)) > sess.s.MaxSize {
+		if _, err := io.Copy(io.Discard, dr); err != nil {
+			return false
+		}
+		sess.reply(552, "5.3.4 Message size exceeds fixed limit")
+		return true
+	}
+
+	env.Data = data
+	if sess.s.Handler != nil {
+		if err := sess.s.Handler(env); err != nil {
+			sess.replyError(554, err)
+			return true
+		}
+	}
+	sess.reply(250, "2.0.0 OK: queued")
+	return true
+}
@@ -0,0 +1,154 @@
+package smtp
+
+import (
+	"errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// startServer 在本机随机端口上启动 s, 返回地址
+func startServer(t *testing.T, s *Server) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go s.Serve(l)
+	return l.Addr().String()
+}
+
+// smtpCode 返回 net/smtp 客户端错误中的应答码
+func smtpCode(err error) int {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code
+	}
+	return 0
+}
+
+func TestServerReceive(t *testing.T) {
+	var mu sync.Mutex
+	var received []*Envelope
+	addr := startServer(t, &Server{
+		Hostname: "print.test",
+		Recipient: func(addr string) error {
+			if addr != "print@office.test" {
+				return &Error{Code: 550, Message: "5.1.1 Mailbox unavailable"}
+			}
+			return nil
+		},
+		Handler: func(env *Envelope) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, env)
+			return nil
+		},
+	})
+
+	body := "Subject: test\r\n\r\nhello\r\n.leading dot\r\n"
+	err := smtp.SendMail(addr, nil, "boss@office.test", []string{"print@office.test"}, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 {
+		t.Fatalf("received %d messages", len(received))
+	}
+	env := received[0]
+	if env.From != "boss@office.test" || len(env.To) != 1 || env.To[0] != "print@office.test" {
+		t.Errorf("envelope = %+v", env)
+	}
+	// 去掉点填充, 行尾统一为 LF
+	if want := strings.ReplaceAll(body, "\r\n", "\n"); string(env.Data) != want {
+		t.Errorf("data = %q, want %q", env.Data, want)
+	}
+	if !strings.HasPrefix(env.RemoteAddr.String(), "127.0.0.1:") {
+		t.Errorf("remote addr = %s", env.RemoteAddr)
+	}
+}
+
+func TestServerRejections(t *testing.T) {
+	addr := startServer(t, &Server{
+		MaxSize: 64,
+		Recipient: func(addr string) error {
+			if addr != "print@office.test" {
+				return &Error{Code: 550, Message: "5.1.1 Mailbox unavailable"}
+			}
+			return nil
+		},
+		Handler: func(env *Envelope) error {
+			if strings.Contains(string(env.Data), "virus") {
+				return &Error{Code: 554, Message: "5.7.1 Rejected"}
+			}
+			return nil
+		},
+	})
+
+	tests := []struct {
+		name string
+		to   string
+		body string
+		code int
+	}{
+		{"unknown recipient", "other@office.test", "hello\r\n", 550},
+		{"too large", "print@office.test", strings.Repeat("x", 100) + "\r\n", 552},
+		{"handler", "print@office.test", "virus\r\n", 554},
+	}
+	for _, tt := range tests {
+		err := smtp.SendMail(addr, nil, "boss@office.test", []string{tt.to}, []byte(tt.body))
+		if code := smtpCode(err); code != tt.code {
+			t.Errorf("%s: err = %v, want code %d", tt.name, err, tt.code)
+		}
+	}
+}
+
+func TestServerClientRejected(t *testing.T) {
+	addr := startServer(t, &Server{
+		Client: func(addr net.Addr) error {
+			return &Error{Code: 554, Message: "5.7.1 Client host rejected"}
+		},
+	})
+
+	_, err := smtp.Dial(addr)
+	if code := smtpCode(err); code != 554 {
+		t.Fatalf("err = %v, want 554", err)
+	}
+}
+
+func TestServerCommandSequence(t *testing.T) {
+	addr := startServer(t, &Server{})
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// 不支持认证和 STARTTLS
+	if ok, _ := c.Extension("AUTH"); ok {
+		t.Error("EHLO 不应公布 AUTH")
+	}
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		t.Error("EHLO 不应公布 STARTTLS")
+	}
+	if err := c.Rcpt("print@office.test"); smtpCode(err) != 503 {
+		t.Errorf("RCPT before MAIL: err = %v", err)
+	}
+	if err := c.Mail("boss@office.test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Mail("boss@office.test"); smtpCode(err) != 503 {
+		t.Errorf("second MAIL: err = %v", err)
+	}
+	if err := c.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Quit(); err != nil {
+		t.Fatal(err)
+	}
+}
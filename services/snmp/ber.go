@@ -0,0 +1,241 @@
+// Package snmp 实现查询打印机状态所需的最小 SNMP v1/v2c 客户端
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BER 标签
+const (
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagNull        = 0x05
+	tagOID         = 0x06
+	tagSequence    = 0x30
+	tagIPAddress   = 0x40
+	tagCounter32   = 0x41
+	tagGauge32     = 0x42
+	tagTimeTicks   = 0x43
+	tagCounter64   = 0x46
+
+	tagNoSuchObject   = 0x80
+	tagNoSuchInstance = 0x81
+	tagEndOfMibView   = 0x82
+
+	pduGetRequest     = 0xa0
+	pduGetNextRequest = 0xa1
+	pduResponse       = 0xa2
+)
+
+var errMalformed = errors.New("snmp: 报文格式错误")
+
+// OID 对象标识符
+type OID []uint32
+
+// ParseOID 解析 "1.3.6.1.2.1" 形式的 OID
+func ParseOID(s string) (OID, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "."), ".")
+	oid := make(OID, len(parts))
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("snmp: OID 无效: %s", s)
+		}
+		oid[i] = uint32(n)
+	}
+	if len(oid) < 2 {
+		return nil, fmt.Errorf("snmp: OID 无效: %s", s)
+	}
+	return oid, nil
+}
+
+// MustParseOID 解析常量 OID, 格式错误时 panic
+func MustParseOID(s string) OID {
+	oid, err := ParseOID(s)
+	if err != nil {
+		panic(err)
+	}
+	return oid
+}
+
+func (o OID) String() string {
+	parts := make([]string, len(o))
+	for i, n := range o {
+		parts[i] = strconv.FormatUint(uint64(n), 10)
+	}
+	return strings.Join(parts, ".")
+}
+
+// HasPrefix 判断 o 是否位于 prefix 子树下
+func (o OID) HasPrefix(prefix OID) bool {
+	if len(o) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if o[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare 按字典序比较两个 OID
+func (o OID) Compare(other OID) int {
+	for i := 0; i < len(o) && i < len(other); i++ {
+		switch {
+		case o[i] < other[i]:
+			return -1
+		case o[i] > other[i]:
+			return 1
+		}
+	}
+	return len(o) - len(other)
+}
+
+// Last 返回最后一个子标识符, 通常是表格的行索引
+func (o OID) Last() uint32 {
+	if len(o) == 0 {
+		return 0
+	}
+	return o[len(o)-1]
+}
+
+// VarBind 变量绑定, Value 为 int64、[]byte、OID 或 nil
+type VarBind struct {
+	OID   OID
+	Value interface{}
+	// noSuchObject、noSuchInstance、endOfMibView 等异常
+	Exception bool
+}
+
+// Int 返回整数值
+func (v VarBind) Int() (int64, bool) {
+	n, ok := v.Value.(int64)
+	return n, ok
+}
+
+// Bytes 返回字节串值
+func (v VarBind) Bytes() []byte {
+	b, _ := v.Value.([]byte)
+	return b
+}
+
+// String 返回字节串值的字符串形式, 去掉结尾的 NUL
+func (v VarBind) String() string {
+	return strings.TrimRight(string(v.Bytes()), "\x00")
+}
+
+func appendLength(buf []byte, n int) []byte {
+	switch {
+	case n < 0x80:
+		return append(buf, byte(n))
+	case n < 0x100:
+		return append(buf, 0x81, byte(n))
+	default:
+		return append(buf, 0x82, byte(n>>8), byte(n))
+	}
+}
+
+func appendTLV(buf []byte, tag byte, value []byte) []byte {
+	buf = append(buf, tag)
+	buf = appendLength(buf, len(value))
+	return append(buf, value...)
+}
+
+func appendInt(buf []byte, tag byte, n int64) []byte {
+	var value []byte
+	for {
+		value = append([]byte{byte(n)}, value...)
+		// 剩余部分全为符号位时结束
+		if (n < 0x80 && n >= -0x80) || len(value) == 8 {
+			break
+		}
+		n >>= 8
+	}
+	return appendTLV(buf, tag, value)
+}
+
+func appendOID(buf []byte, oid OID) []byte {
+	value := []byte{byte(oid[0]*40 + oid[1])}
+	for _, n := range oid[2:] {
+		var enc []byte
+		enc = append(enc, byte(n&0x7f))
+		for n >>= 7; n > 0; n >>= 7 {
+			enc = append([]byte{byte(n&0x7f) | 0x80}, enc...)
+		}
+		value = append(value, enc...)
+	}
+	return appendTLV(buf, tagOID, value)
+}
+
+// readTLV 读取一个 TLV, 返回标签、值和剩余数据
+func readTLV(data []byte) (byte, []byte, []byte, error) {
+	if len(data) < 2 {
+		return 0, nil, nil, errMalformed
+	}
+	tag := data[0]
+	length := int(data[1])
+	off := 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 3 || len(data) < 2+n {
+			return 0, nil, nil, errMalformed
+		}
+		length = 0
+		for _, b := range data[2 : 2+n] {
+			length = length<<8 | int(b)
+		}
+		off += n
+	}
+	if len(data) < off+length {
+		return 0, nil, nil, errMalformed
+	}
+	return tag, data[off : off+length], data[off+length:], nil
+}
+
+func parseInt(value []byte) (int64, error) {
+	if len(value) == 0 || len(value) > 9 {
+		return 0, errMalformed
+	}
+	var n int64
+	if value[0]&0x80 != 0 {
+		n = -1
+	}
+	for _, b := range value {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+// parseUint 解析无符号类型 (Counter32、Gauge32 等), 最高位为1时不按负数处理
+func parseUint(value []byte) (int64, error) {
+	if len(value) == 0 || len(value) > 9 {
+		return 0, errMalformed
+	}
+	var n uint64
+	for _, b := range value {
+		n = n<<8 | uint64(b)
+	}
+	return int64(n), nil
+}
+
+func parseOID(value []byte) (OID, error) {
+	if len(value) == 0 {
+		return nil, errMalformed
+	}
+	oid := OID{uint32(value[0]) / 40, uint32(value[0]) % 40}
+	var n uint32
+	for i, b := range value[1:] {
+		n = n<<7 | uint32(b&0x7f)
+		if b&0x80 == 0 {
+			oid = append(oid, n)
+			n = 0
+		} else if i == len(value)-2 {
+			return nil, errMalformed
+		}
+	}
+	return oid, nil
+}
@@ -0,0 +1,241 @@
+package snmp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// SNMP 版本
+const (
+	Version1  = 0
+	Version2c = 1
+)
+
+// maxWalk Walk 最多读取的行数, 防止设备返回错误的顺序导致死循环
+const maxWalk = 1000
+
+// ErrorStatus 设备返回的错误状态, 如 noSuchName(2)
+type ErrorStatus struct {
+	Status int64
+	Index  int64
+}
+
+func (e *ErrorStatus) Error() string {
+	return fmt.Sprintf("snmp: 设备返回错误 %d (第 %d 个变量)", e.Status, e.Index)
+}
+
+// Client SNMP 客户端, 每个请求使用一个新的 UDP 套接字
+type Client struct {
+	// 设备地址, 如 192.168.1.10:161
+	Addr      string
+	Community string
+	// Version1 或 Version2c
+	Version int
+	// 单次请求等待应答的时间
+	Timeout time.Duration
+	// 超时后重发的次数
+	Retries int
+}
+
+// NewClient 创建 v2c 客户端, addr 未带端口时使用 161
+func NewClient(addr, community string) *Client {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "161")
+	}
+	return &Client{
+		Addr:      addr,
+		Community: community,
+		Version:   Version2c,
+		Timeout:   2 * time.Second,
+		Retries:   1,
+	}
+}
+
+// Get 读取指定的变量
+func (c *Client) Get(ctx context.Context, oids ...OID) ([]VarBind, error) {
+	return c.request(ctx, pduGetRequest, oids)
+}
+
+// GetNext 读取每个 OID 之后的下一个变量
+func (c *Client) GetNext(ctx context.Context, oids ...OID) ([]VarBind, error) {
+	return c.request(ctx, pduGetNextRequest, oids)
+}
+
+// Walk 依次读取 root 子树下的全部变量
+func (c *Client) Walk(ctx context.Context, root OID) ([]VarBind, error) {
+	var result []VarBind
+	oid := root
+	for i := 0; i < maxWalk; i++ {
+		vbs, err := c.GetNext(ctx, oid)
+		if err != nil {
+			// v1 在子树结束时返回 noSuchName
+			var status *ErrorStatus
+			if errors.As(err, &status) && status.Status == 2 && c.Version == Version1 {
+				return result, nil
+			}
+			return nil, err
+		}
+		if len(vbs) == 0 {
+			return nil, errMalformed
+		}
+		vb := vbs[0]
+		if vb.Exception || !vb.OID.HasPrefix(root) || vb.OID.Compare(oid) <= 0 {
+			return result, nil
+		}
+		result = append(result, vb)
+		oid = vb.OID
+	}
+	return result, nil
+}
+
+func (c *Client) request(ctx context.Context, pduType byte, oids []OID) ([]VarBind, error) {
+	requestID := rand.Int31()
+	packet := c.encode(pduType, requestID, oids)
+
+	conn, err := net.Dial("udp", c.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("snmp: 连接 %s 失败: %v", c.Addr, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	buf := make([]byte, 65535)
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if _, err := conn.Write(packet); err != nil {
+			return nil, c.fail(ctx, fmt.Errorf("snmp: 发送请求失败: %v", err))
+		}
+		deadline := time.Now().Add(c.Timeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		conn.SetReadDeadline(deadline)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+					break
+				}
+				return nil, c.fail(ctx, fmt.Errorf("snmp: 接收应答失败: %v", err))
+			}
+			id, vbs, err := decodeResponse(buf[:n])
+			if err != nil {
+				return nil, err
+			}
+			// 忽略之前重发的请求迟到的应答
+			if id == requestID {
+				return vbs, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("snmp: %s 无应答", c.Addr)
+}
+
+func (c *Client) fail(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (c *Client) encode(pduType byte, requestID int32, oids []OID) []byte {
+	var vbs []byte
+	for _, oid := range oids {
+		vb := appendOID(nil, oid)
+		vb = appendTLV(vb, tagNull, nil)
+		vbs = appendTLV(vbs, tagSequence, vb)
+	}
+
+	pdu := appendInt(nil, tagInteger, int64(requestID))
+	pdu = appendInt(pdu, tagInteger, 0)
+	pdu = appendInt(pdu, tagInteger, 0)
+	pdu = appendTLV(pdu, tagSequence, vbs)
+
+	msg := appendInt(nil, tagInteger, int64(c.Version))
+	msg = appendTLV(msg, tagOctetString, []byte(c.Community))
+	msg = appendTLV(msg, pduType, pdu)
+	return appendTLV(nil, tagSequence, msg)
+}
+
+// decodeResponse 解析 GetResponse, 返回请求ID和变量绑定
+func decodeResponse(data []byte) (int32, []VarBind, error) {
+	tag, msg, _, err := readTLV(data)
+	if err != nil || tag != tagSequence {
+		return 0, nil, errMalformed
+	}
+	// version, community
+	for i := 0; i < 2; i++ {
+		if _, _, msg, err = readTLV(msg); err != nil {
+			return 0, nil, err
+		}
+	}
+	tag, pdu, _, err := readTLV(msg)
+	if err != nil || tag != pduResponse {
+		return 0, nil, errMalformed
+	}
+
+	var fields [3]int64
+	for i := range fields {
+		var value []byte
+		if tag, value, pdu, err = readTLV(pdu); err != nil || tag != tagInteger {
+			return 0, nil, errMalformed
+		}
+		if fields[i], err = parseInt(value); err != nil {
+			return 0, nil, err
+		}
+	}
+	requestID := int32(fields[0])
+	if fields[1] != 0 {
+		return requestID, nil, &ErrorStatus{Status: fields[1], Index: fields[2]}
+	}
+
+	tag, list, _, err := readTLV(pdu)
+	if err != nil || tag != tagSequence {
+		return 0, nil, errMalformed
+	}
+	var vbs []VarBind
+	for len(list) > 0 {
+		var item []byte
+		if tag, item, list, err = readTLV(list); err != nil || tag != tagSequence {
+			return 0, nil, errMalformed
+		}
+		vb, err := decodeVarBind(item)
+		if err != nil {
+			return 0, nil, err
+		}
+		vbs = append(vbs, vb)
+	}
+	return requestID, vbs, nil
+}
+
+func decodeVarBind(item []byte) (VarBind, error) {
+	tag, value, rest, err := readTLV(item)
+	if err != nil || tag != tagOID {
+		return VarBind{}, errMalformed
+	}
+	var vb VarBind
+	if vb.OID, err = parseOID(value); err != nil {
+		return VarBind{}, err
+	}
+	if tag, value, _, err = readTLV(rest); err != nil {
+		return VarBind{}, err
+	}
+	switch tag {
+	case tagInteger:
+		vb.Value, err = parseInt(value)
+	case tagCounter32, tagGauge32, tagTimeTicks, tagCounter64:
+		vb.Value, err = parseUint(value)
+	case tagOctetString, tagIPAddress:
+		vb.Value = append([]byte(nil), value...)
+	case tagOID:
+		vb.Value, err = parseOID(value)
+	case tagNoSuchObject, tagNoSuchInstance, tagEndOfMibView:
+		vb.Exception = true
+	}
+	return vb, err
+}
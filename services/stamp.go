@@ -0,0 +1,427 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"printer/services/pdf"
+)
+
+// 水印位置, center 为沿页面对角线的大号水印, 其他位置为页边的小号标注
+const (
+	StampCenter      = "center"
+	StampTopLeft     = "top-left"
+	StampTop         = "top"
+	StampTopRight    = "top-right"
+	StampBottomLeft  = "bottom-left"
+	StampBottom      = "bottom"
+	StampBottomRight = "bottom-right"
+)
+
+// 分隔页位置, 用于在共享打印机上区分不同任务
+const (
+	BannerNone  = "none"
+	BannerStart = "start"
+	BannerEnd   = "end"
+	BannerBoth  = "both"
+)
+
+const (
+	// 页边标注与纸张边缘的距离
+	stampMargin = 18.0
+	// 页边标注的默认字号
+	stampFontSize = 10.0
+	// 中央水印的最大字号
+	stampMaxFontSize = 96.0
+	// 水印中时间占位符的格式
+	stampTimeLayout = "2006-01-02 15:04"
+)
+
+// Stamp 叠加在每页上的水印, 可以是文本、图片或两者 (文本在图片之上)
+type Stamp struct {
+	// 文本, 可使用占位符 {user} {job} {file} {printer} {time}, \n 换行
+	Text string `json:"text,omitempty"`
+	// 图片 (jpg/png/gif) 的文件名, 位于被打印文件所在的上传目录中
+	Image string `json:"image,omitempty"`
+	// 不透明度 0-1, 未设置时中央水印为 0.3, 页边标注为 1
+	Opacity float64 `json:"opacity,omitempty"`
+	// 位置: center, top-left, top, top-right, bottom-left, bottom, bottom-right
+	Position string `json:"position,omitempty"`
+	// 字号, 0 表示中央水印按页面大小自动计算, 页边标注为 10
+	FontSize float64 `json:"font_size,omitempty"`
+}
+
+// Enabled 判断是否设置了水印, 文本和图片都为空表示不加水印
+func (s *Stamp) Enabled() bool {
+	return s != nil && (s.Text != "" || s.Image != "")
+}
+
+func (s *Stamp) validate() error {
+	if !s.Enabled() {
+		return nil
+	}
+	switch s.Position {
+	case "", StampCenter, StampTopLeft, StampTop, StampTopRight, StampBottomLeft, StampBottom, StampBottomRight:
+	default:
+		return fmt.Errorf("水印位置无效: %s", s.Position)
+	}
+	if s.Opacity < 0 || s.Opacity > 1 {
+		return fmt.Errorf("水印不透明度无效: %v", s.Opacity)
+	}
+	if s.FontSize < 0 || s.FontSize > 200 {
+		return fmt.Errorf("水印字号无效: %v", s.FontSize)
+	}
+	if s.Image != "" {
+		if filepath.Base(s.Image) != s.Image || s.Image == "." || s.Image == ".." {
+			return fmt.Errorf("水印图片必须是上传目录中的文件名: %s", s.Image)
+		}
+		if !containsExt(ImageFormats, strings.ToLower(filepath.Ext(s.Image))) {
+			return fmt.Errorf("不支持的水印图片格式: %s", s.Image)
+		}
+	}
+	return nil
+}
+
+func (s *Stamp) position() string {
+	if s.Position == "" {
+		return StampCenter
+	}
+	return s.Position
+}
+
+func (s *Stamp) opacity() float64 {
+	if s.Opacity > 0 {
+		return s.Opacity
+	}
+	if s.position() == StampCenter {
+		return 0.3
+	}
+	return 1
+}
+
+// Stamped 判断是否需要加水印或分隔页
+func (o PrintOptions) Stamped() bool {
+	return o.Watermark.Enabled() || (o.Banner != "" && o.Banner != BannerNone)
+}
+
+func (o PrintOptions) validateStamp() error {
+	switch o.Banner {
+	case "", BannerNone, BannerStart, BannerEnd, BannerBoth:
+	default:
+		return fmt.Errorf("分隔页位置无效: %s", o.Banner)
+	}
+	return o.Watermark.validate()
+}
+
+// afterStamping 返回加水印后交给后端的选项, 页码范围已在加水印时处理
+func (o PrintOptions) afterStamping() PrintOptions {
+	o.PageRanges = ""
+	o.Watermark = nil
+	o.Banner = ""
+	return o
+}
+
+// stampFields 水印和分隔页中使用的任务信息
+type stampFields struct {
+	job  Job
+	file string
+	time time.Time
+}
+
+// expand 替换水印文本中的占位符
+func (f stampFields) expand(text string) string {
+	return strings.NewReplacer(
+		"{user}", f.job.User,
+		"{job}", f.job.ID,
+		"{file}", f.file,
+		"{printer}", f.job.Printer,
+		"{time}", f.time.Format(stampTimeLayout),
+	).Replace(text)
+}
+
+// StampPDF 按 opts 给 PDF 每页加水印, 并在任务前后插入分隔页. 页码范围在此时应用,
+// 任务信息取自 WithJob 设置的 context, 水印图片相对于 dir 查找.
+// 返回临时文件路径和清理函数
+func StampPDF(ctx context.Context, src, dir string, opts PrintOptions) (string, func(), error) {
+	r, pages, err := readPages(src, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	var image []byte
+	if opts.Watermark.Enabled() && opts.Watermark.Image != "" {
+		if image, err = os.ReadFile(filepath.Join(dir, opts.Watermark.Image)); err != nil {
+			return "", nil, fmt.Errorf("读取水印图片失败: %v", err)
+		}
+	}
+	out, cleanup, err := tempPDF("printer-stamp-*.pdf")
+	if err != nil {
+		return "", nil, err
+	}
+
+	job, _ := JobFromContext(ctx)
+	fields := stampFields{job: job, file: job.Filename, time: time.Now()}
+	if len(job.Files) > 0 {
+		names := make([]string, len(job.Files))
+		for i, f := range job.Files {
+			names[i] = f.Filename
+		}
+		fields.file = strings.Join(names, ", ")
+	}
+	if fields.file == "" {
+		fields.file = filepath.Base(src)
+	}
+	banner := opts.Banner
+	// 双面打印时分隔页单独占一张纸
+	duplex := opts.Duplex == DuplexLongEdge || opts.Duplex == DuplexShortEdge
+
+	title := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	err = writePDF(out, title, func(w *pdf.Writer) ([]pdfPage, error) {
+		im := pdf.NewImporter(r, w)
+		fonts := pdf.Dict{"F1": w.Add(pdf.Courier()), "F2": pdf.AddCJKFont(w)}
+		var overlay *stampOverlay
+		if opts.Watermark.Enabled() {
+			o, err := newStampOverlay(w, opts.Watermark, fields, image)
+			if err != nil {
+				return nil, err
+			}
+			overlay = o
+		}
+
+		var out []pdfPage
+		if banner == BannerStart || banner == BannerBoth {
+			out = append(out, bannerPage(opts, fields, len(pages), fonts))
+			if duplex {
+				out = append(out, blankPage(opts))
+			}
+		}
+		for _, page := range pages {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			// 水印按页面旋转后的显示方向摆放
+			copied, err := copyPage(im, page)
+			if err != nil {
+				return nil, err
+			}
+			if overlay != nil {
+				var sb strings.Builder
+				overlay.draw(&sb, copied.width, copied.height)
+				overlay.addResources(copied.resources, fonts)
+				copied.content = append(copied.content, sb.String()...)
+			}
+			out = append(out, copied)
+		}
+		if banner == BannerEnd || banner == BannerBoth {
+			if duplex && len(out)%2 == 1 {
+				out = append(out, blankPage(opts))
+			}
+			out = append(out, bannerPage(opts, fields, len(pages), fonts))
+		}
+		return out, nil
+	})
+	if err != nil {
+		cleanup()
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		return "", nil, fmt.Errorf("添加水印失败: %v", err)
+	}
+	return out, cleanup, nil
+}
+
+// stampOverlay 已写出图片和透明度设置的水印
+type stampOverlay struct {
+	stamp *Stamp
+	lines []string
+	state pdf.Ref
+	image pdf.Ref
+	info  pdf.ImageInfo
+}
+
+func newStampOverlay(w *pdf.Writer, s *Stamp, fields stampFields, image []byte) (*stampOverlay, error) {
+	o := &stampOverlay{stamp: s}
+	if s.Text != "" {
+		o.lines = strings.Split(fields.expand(s.Text), "\n")
+	}
+	o.state = w.Add(pdf.Dict{
+		"Type": pdf.Name("ExtGState"),
+		"ca":   s.opacity(),
+		"CA":   s.opacity(),
+	})
+	if image != nil {
+		ref, info, err := pdf.AddImage(w, image)
+		if err != nil {
+			return nil, fmt.Errorf("水印图片无效: %v", err)
+		}
+		o.image, o.info = ref, info
+	}
+	return o, nil
+}
+
+func (o *stampOverlay) addResources(resources pdf.Dict, fonts pdf.Dict) {
+	resources["ExtGState"] = pdf.Dict{"GS0": o.state}
+	if len(o.lines) > 0 {
+		resources["Font"] = fonts
+	}
+	if o.image.Num != 0 {
+		resources["XObject"].(pdf.Dict)["Im0"] = o.image
+	}
+}
+
+// draw 在 pw x ph 的页面上绘制水印
+func (o *stampOverlay) draw(sb *strings.Builder, pw, ph float64) {
+	pos := o.stamp.position()
+	columns := 0
+	for _, line := range o.lines {
+		columns = max(columns, textColumns(line))
+	}
+	sb.WriteString("q /GS0 gs\n")
+
+	if pos == StampCenter {
+		// 沿左下到右上的对角线, 文字块中心位于页面中心
+		diagonal := math.Hypot(pw, ph)
+		if o.image.Num != 0 {
+			o.drawImage(sb, pw*0.2, ph*0.2, pw*0.6, ph*0.6)
+		}
+		if len(o.lines) > 0 {
+			size := o.stamp.FontSize
+			if size == 0 {
+				size = min(stampMaxFontSize, diagonal*0.8/(float64(max(columns, 1))*pdf.CourierWidth/1000))
+				size = min(size, math.Min(pw, ph)*0.5/(float64(len(o.lines))*1.2))
+			}
+			angle := math.Atan2(ph, pw)
+			cos, sin := math.Cos(angle), math.Sin(angle)
+			fmt.Fprintf(sb, "q %s cm 0.5 g BT\n", pdf.FormatMatrix([6]float64{cos, sin, -sin, cos, pw / 2, ph / 2}))
+			o.writeLines(sb, size, func(width float64, i int) (float64, float64) {
+				top := float64(len(o.lines)) * size * 1.2 / 2
+				return -width / 2, top - float64(i+1)*size*1.2 + size*0.25
+			})
+			sb.WriteString("ET Q\n")
+		}
+		sb.WriteString("Q\n")
+		return
+	}
+
+	size := o.stamp.FontSize
+	if size == 0 {
+		size = stampFontSize
+	}
+	textH := float64(len(o.lines)) * size * 1.2
+	blockW := float64(columns) * size * pdf.CourierWidth / 1000
+	// 图片放在文字旁边的同一角落, 文字叠加在图片上
+	if o.image.Num != 0 {
+		imgW, imgH := o.info.DisplaySize()
+		scale := min(pw*0.25/float64(imgW), ph*0.15/float64(imgH))
+		w, h := float64(imgW)*scale, float64(imgH)*scale
+		o.drawImage(sb, alignX(pos, pw, w), alignY(pos, ph, h), w, h)
+	}
+	if len(o.lines) > 0 {
+		top := alignY(pos, ph, textH) + textH
+		sb.WriteString("BT\n")
+		o.writeLines(sb, size, func(width float64, i int) (float64, float64) {
+			// 多行文字按位置对齐到左、中或右
+			x := alignX(pos, pw, blockW) + (blockW-width)*alignFactor(pos)
+			return x, top - float64(i+1)*size*1.2 + size*0.25
+		})
+		sb.WriteString("ET\n")
+	}
+	sb.WriteString("Q\n")
+}
+
+// writeLines 逐行写出文本, at 根据行宽和行号返回基线起点
+func (o *stampOverlay) writeLines(sb *strings.Builder, size float64, at func(width float64, i int) (float64, float64)) {
+	for i, line := range o.lines {
+		width := float64(textColumns(line)) * size * pdf.CourierWidth / 1000
+		x, y := at(width, i)
+		writeTextLine(sb, x, y, size, line)
+	}
+}
+
+// drawImage 将图片等比缩放到 (x, y, w, h) 区域内居中绘制
+func (o *stampOverlay) drawImage(sb *strings.Builder, x, y, w, h float64) {
+	imgW, imgH := o.info.DisplaySize()
+	scale := min(w/float64(imgW), h/float64(imgH))
+	dw, dh := float64(imgW)*scale, float64(imgH)*scale
+	m := o.info.ImageMatrix(x+(w-dw)/2, y+(h-dh)/2, dw, dh)
+	fmt.Fprintf(sb, "q %s cm /Im0 Do Q\n", pdf.FormatMatrix(m))
+}
+
+// alignFactor 返回位置的水平对齐比例: 左 0, 中 0.5, 右 1
+func alignFactor(pos string) float64 {
+	switch pos {
+	case StampTop, StampBottom:
+		return 0.5
+	case StampTopRight, StampBottomRight:
+		return 1
+	}
+	return 0
+}
+
+// alignX 返回宽 w 的内容按位置摆放时的左边界
+func alignX(pos string, pw, w float64) float64 {
+	return stampMargin + (pw-2*stampMargin-w)*alignFactor(pos)
+}
+
+// alignY 返回高 h 的内容按位置摆放时的下边界
+func alignY(pos string, ph, h float64) float64 {
+	switch pos {
+	case StampTopLeft, StampTop, StampTopRight:
+		return ph - stampMargin - h
+	}
+	return stampMargin
+}
+
+// bannerPage 生成分隔页, 列出任务ID、用户、文件名等
+func bannerPage(opts PrintOptions, f stampFields, pages int, fonts pdf.Dict) pdfPage {
+	// 分隔页使用纵向纸张
+	opts.Orientation = OrientationPortrait
+	pw, ph := opts.PageSize()
+	const size = 14.0
+	rows := [][2]string{
+		{"任务", f.job.ID},
+		{"用户", f.job.User},
+		{"文件", f.file},
+		{"打印机", f.job.Printer},
+		{"页数", fmt.Sprint(pages)},
+		{"打印时间", f.time.Format(stampTimeLayout)},
+	}
+	if !f.job.CreatedAt.IsZero() {
+		rows = append(rows, [2]string{"提交时间", f.job.CreatedAt.Format(stampTimeLayout)})
+	}
+
+	var sb strings.Builder
+	x := 72.0
+	y := ph - 144
+	sb.WriteString("BT\n")
+	writeTextLine(&sb, x, y, 28, "打印任务")
+	y -= 48
+	columnWidth := size * pdf.CourierWidth / 1000
+	valueColumns := int((pw-2*x)/columnWidth) - 10
+	for _, row := range rows {
+		if row[1] == "" {
+			continue
+		}
+		writeTextLine(&sb, x, y, size, row[0])
+		writeTextLine(&sb, x+10*columnWidth, y, size, truncateColumns(row[1], valueColumns))
+		y -= size * 1.8
+	}
+	sb.WriteString("ET\n")
+	// 上下两条粗线便于在纸堆中辨认
+	for _, ly := range []float64{ph - 100, y - 12} {
+		fmt.Fprintf(&sb, "4 w %s %s m %s %s l S\n",
+			pdf.FormatNumber(x), pdf.FormatNumber(ly), pdf.FormatNumber(pw-x), pdf.FormatNumber(ly))
+	}
+	return pdfPage{width: pw, height: ph, resources: pdf.Dict{"Font": fonts}, content: []byte(sb.String())}
+}
+
+// blankPage 返回一张空白页, 双面打印时让分隔页单独占一张纸
+func blankPage(opts PrintOptions) pdfPage {
+	opts.Orientation = OrientationPortrait
+	pw, ph := opts.PageSize()
+	return pdfPage{width: pw, height: ph, resources: pdf.Dict{}}
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"printer/services/snmp"
+)
+
+// Host Resources MIB (RFC 2790) 和 Printer MIB (RFC 3805) 中用到的对象
+var (
+	oidHrDeviceStatus              = snmp.MustParseOID("1.3.6.1.2.1.25.3.2.1.5")
+	oidHrPrinterStatus             = snmp.MustParseOID("1.3.6.1.2.1.25.3.5.1.1")
+	oidHrPrinterDetectedErrorState = snmp.MustParseOID("1.3.6.1.2.1.25.3.5.1.2")
+
+	oidPrtMarkerSuppliesType        = snmp.MustParseOID("1.3.6.1.2.1.43.11.1.1.5")
+	oidPrtMarkerSuppliesDescription = snmp.MustParseOID("1.3.6.1.2.1.43.11.1.1.6")
+	oidPrtMarkerSuppliesMaxCapacity = snmp.MustParseOID("1.3.6.1.2.1.43.11.1.1.8")
+	oidPrtMarkerSuppliesLevel       = snmp.MustParseOID("1.3.6.1.2.1.43.11.1.1.9")
+
+	oidPrtInputCurrentLevel = snmp.MustParseOID("1.3.6.1.2.1.43.8.2.1.10")
+	oidPrtInputMaxCapacity  = snmp.MustParseOID("1.3.6.1.2.1.43.8.2.1.9")
+	oidPrtInputName         = snmp.MustParseOID("1.3.6.1.2.1.43.8.2.1.13")
+)
+
+// hrPrinterDetectedErrorState 的各个位 (从最高位开始编号) 对应的 printer-state-reasons
+var snmpErrorReasons = []string{
+	"media-low",               // lowPaper
+	"media-empty",             // noPaper
+	"toner-low",               // lowToner
+	"toner-empty",             // noToner
+	"door-open",               // doorOpen
+	"media-jam",               // jammed
+	"offline",                 // offline
+	"other-warning",           // serviceRequested
+	"input-tray-missing",      // inputTrayMissing
+	"output-tray-missing",     // outputTrayMissing
+	"marker-supply-missing",   // markerSupplyMissing
+	"output-area-almost-full", // outputNearFull
+	"output-area-full",        // outputFull
+	"media-empty",             // inputTrayEmpty
+	"other-warning",           // overduePreventMaint
+}
+
+// prtMarkerSuppliesType 取值对应的 marker-types 关键字
+var snmpSupplyTypes = map[int64]string{
+	3:  "toner",
+	4:  "waste-toner",
+	5:  "ink",
+	6:  "ink-cartridge",
+	7:  "ink-ribbon",
+	8:  "waste-ink",
+	9:  "opc",
+	10: "developer",
+	15: "fuser",
+	20: "transfer-unit",
+	21: "toner-cartridge",
+}
+
+// snmpPrinterStatus 通过 SNMP 读取打印机状态、耗材和纸盒余量
+func snmpPrinterStatus(ctx context.Context, client *snmp.Client) (PrinterStatus, error) {
+	// 设备索引不一定是1, 用 GetNext 读取打印机表的第一行
+	vbs, err := client.GetNext(ctx, oidHrPrinterStatus, oidHrPrinterDetectedErrorState)
+	if err != nil {
+		return PrinterStatus{}, fmt.Errorf("SNMP查询打印机状态失败: %v", err)
+	}
+	if len(vbs) != 2 || !vbs[0].OID.HasPrefix(oidHrPrinterStatus) {
+		return PrinterStatus{}, fmt.Errorf("设备不支持 Printer MIB")
+	}
+
+	status := PrinterStatus{State: "unknown"}
+	printerState, _ := vbs[0].Int()
+	switch printerState {
+	case 3: // idle
+		status.State = "idle"
+	case 4, 5: // printing, warmup
+		status.State = "processing"
+	}
+
+	device := vbs[0].OID.Last()
+	if dev, err := client.Get(ctx, append(append(snmp.OID(nil), oidHrDeviceStatus...), device)); err == nil && len(dev) == 1 {
+		// down(5) 表示设备无法工作
+		if n, _ := dev[0].Int(); n == 5 {
+			status.State = "stopped"
+		}
+	}
+
+	if vbs[1].OID.HasPrefix(oidHrPrinterDetectedErrorState) {
+		seen := make(map[string]bool)
+		for i, b := range vbs[1].Bytes() {
+			for bit := 0; bit < 8; bit++ {
+				n := i*8 + bit
+				if b&(0x80>>bit) == 0 || n >= len(snmpErrorReasons) || seen[snmpErrorReasons[n]] {
+					continue
+				}
+				seen[snmpErrorReasons[n]] = true
+				status.Reasons = append(status.Reasons, snmpErrorReasons[n])
+			}
+		}
+	}
+
+	if status.Supplies, err = snmpSupplies(ctx, client); err != nil {
+		return PrinterStatus{}, err
+	}
+	if status.Trays, err = snmpTrays(ctx, client); err != nil {
+		return PrinterStatus{}, err
+	}
+	return status, nil
+}
+
+// snmpColumns 读取表格中的若干列, 按行索引 (OID 中列号之后的部分) 汇总,
+// 返回的行索引按设备返回的顺序排列
+func snmpColumns(ctx context.Context, client *snmp.Client, columns ...snmp.OID) ([]string, map[string][]snmp.VarBind, error) {
+	rows := make(map[string][]snmp.VarBind)
+	var order []string
+	for i, column := range columns {
+		vbs, err := client.Walk(ctx, column)
+		if err != nil {
+			return nil, nil, fmt.Errorf("SNMP读取 %s 失败: %v", column, err)
+		}
+		for _, vb := range vbs {
+			index := vb.OID[len(column):].String()
+			if _, ok := rows[index]; !ok {
+				rows[index] = make([]snmp.VarBind, len(columns))
+				order = append(order, index)
+			}
+			rows[index][i] = vb
+		}
+	}
+	return order, rows, nil
+}
+
+// snmpPercent 将当前值和最大值换算为百分比, 无法换算时返回 SupplyLevelUnknown.
+// Printer MIB 中负数表示未知 (-2) 或 "还有剩余" (-3) 等, 一律视为未知
+func snmpPercent(level, max int64) int {
+	switch {
+	case level == 0:
+		return 0
+	case level > 0 && max > 0:
+		percent := int(level * 100 / max)
+		if percent > 100 {
+			percent = 100
+		}
+		return percent
+	}
+	return SupplyLevelUnknown
+}
+
+func snmpSupplies(ctx context.Context, client *snmp.Client) ([]Supply, error) {
+	order, rows, err := snmpColumns(ctx, client, oidPrtMarkerSuppliesDescription, oidPrtMarkerSuppliesType,
+		oidPrtMarkerSuppliesLevel, oidPrtMarkerSuppliesMaxCapacity)
+	if err != nil {
+		return nil, err
+	}
+	var supplies []Supply
+	for _, index := range order {
+		row := rows[index]
+		supplyType, _ := row[1].Int()
+		level, _ := row[2].Int()
+		max, _ := row[3].Int()
+		typeName, ok := snmpSupplyTypes[supplyType]
+		if !ok {
+			typeName = "other"
+		}
+		supplies = append(supplies, Supply{
+			Name:  row[0].String(),
+			Type:  typeName,
+			Level: snmpPercent(level, max),
+		})
+	}
+	return supplies, nil
+}
+
+func snmpTrays(ctx context.Context, client *snmp.Client) ([]InputTray, error) {
+	order, rows, err := snmpColumns(ctx, client, oidPrtInputName, oidPrtInputCurrentLevel, oidPrtInputMaxCapacity)
+	if err != nil {
+		return nil, err
+	}
+	var trays []InputTray
+	for _, index := range order {
+		row := rows[index]
+		level, _ := row[1].Int()
+		max, _ := row[2].Int()
+		trays = append(trays, InputTray{
+			Name:  row[0].String(),
+			Level: snmpPercent(level, max),
+		})
+	}
+	return trays, nil
+}